@@ -0,0 +1,40 @@
+package main
+
+import (
+	"log"
+
+	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+// setOriginalsDirectory makes wads of directory reference for budget estimation
+func setOriginalsDirectory(path string) {
+	originals := vfs.NewDirectoryDriver(path)
+	file_wad.SetOriginalLoader(func(name string) (*file_wad.Wad, error) {
+		return openWad(originals, name)
+	})
+}
+
+// printBudget logs heaps usage of wad
+func printBudget(rootfs vfs.Directory, name string) error {
+	wad, err := openWad(rootfs, name)
+	if err != nil {
+		return err
+	}
+
+	b := wad.Budget()
+	log.Printf("Budget of '%s': %d bytes (original %d bytes, compared with %s), limit %d bytes",
+		b.Wad, b.Size, b.OriginalSize, b.Original, b.Limit)
+	for _, h := range b.Heaps {
+		if h.Original != nil {
+			log.Printf("  %-24s %-24s used %9d declared %9d (original used %9d declared %9d)",
+				h.Namespace, h.Name, h.Used, h.Declared, h.Original.Used, h.Original.Declared)
+		} else {
+			log.Printf("  %-24s %-24s used %9d declared %9d", h.Namespace, h.Name, h.Used, h.Declared)
+		}
+	}
+	for _, warn := range b.Warnings {
+		log.Printf("  warning: %s", warn)
+	}
+	return nil
+}
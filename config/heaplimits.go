@@ -0,0 +1,41 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// PS2 main memory size, nothing bigger can be loaded by game
+const PS2_MAIN_MEMORY = 32 * 1024 * 1024
+
+type HeapLimits struct {
+	Total uint32            // limit of wad data size, 0 means no limit
+	Heaps map[string]uint32 // limits of heaps by name of entity count tag
+}
+
+// GetHeapLimits reads heap_limits.cfg. Without file only
+// limit of platform memory is used
+func GetHeapLimits() (*HeapLimits, error) {
+	limits := &HeapLimits{Heaps: make(map[string]uint32)}
+	if GetPlayStationVersion() == PS2 {
+		limits.Total = PS2_MAIN_MEMORY
+	}
+
+	data, err := ioutil.ReadFile("heap_limits.cfg")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return limits, nil
+		}
+		return limits, fmt.Errorf("Cannot read heap_limits.cfg: %v", err)
+	}
+
+	if err := json.Unmarshal(data, limits); err != nil {
+		return limits, fmt.Errorf("Unmarshaling error: %v", err)
+	}
+	if limits.Heaps == nil {
+		limits.Heaps = make(map[string]uint32)
+	}
+	return limits, nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+
+	"github.com/mogaika/god_of_war_browser/gamediff"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+// diffSources compares game with other source (kind:path) and
+// writes report to out.json and out.html
+func diffSources(rootfs vfs.Directory, rootName string, spec string, out string) error {
+	other, closer, err := gamediff.OpenSource(spec)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	report, err := gamediff.Compare(nil, rootfs, other, rootName, spec)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(out+".json", data, 0666); err != nil {
+		return err
+	}
+
+	html, err := report.HTML()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(out+".html", html, 0666); err != nil {
+		return err
+	}
+
+	log.Printf("Diff with '%s': %d different files, %d equal files. Report saved to %s.json and %s.html",
+		spec, len(report.Files), report.Same, out, out)
+	return nil
+}
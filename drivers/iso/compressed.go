@@ -0,0 +1,221 @@
+package iso
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+const (
+	CSO_MAGIC       = "CISO" // blocks compressed with deflate
+	ZSO_MAGIC       = "ZISO" // blocks compressed with lz4
+	CSO_HEADER_SIZE = 0x18
+
+	// index entry flag of block stored without compression
+	CSO_PLAIN_BLOCK = 0x80000000
+)
+
+// CompressedFile provides read only random access to CSO or ZSO image
+// through block index, so it can be used by IsoDriver as raw image
+type CompressedFile struct {
+	f          vfs.File
+	lz4        bool
+	totalBytes int64
+	blockSize  uint32
+	align      uint8
+	index      []uint32
+
+	lock       sync.Mutex
+	cacheBlock int64
+	cache      []byte
+}
+
+// IsCompressedImage checks magic of CSO and ZSO images
+func IsCompressedImage(f vfs.File) bool {
+	var magic [4]byte
+	if _, err := f.ReadAt(magic[:], 0); err != nil {
+		return false
+	}
+	return string(magic[:]) == CSO_MAGIC || string(magic[:]) == ZSO_MAGIC
+}
+
+func NewCompressedFile(f vfs.File) (*CompressedFile, error) {
+	var header [CSO_HEADER_SIZE]byte
+	if _, err := f.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("[vfs] [iso] Cannot read compressed image header: %v", err)
+	}
+
+	cf := &CompressedFile{
+		f:          f,
+		lz4:        string(header[:4]) == ZSO_MAGIC,
+		totalBytes: int64(binary.LittleEndian.Uint64(header[8:])),
+		blockSize:  binary.LittleEndian.Uint32(header[16:]),
+		align:      header[21],
+		cacheBlock: -1,
+	}
+	if magic := string(header[:4]); magic != CSO_MAGIC && magic != ZSO_MAGIC {
+		return nil, fmt.Errorf("[vfs] [iso] Unknown compressed image magic %q", magic)
+	}
+	if version := header[20]; version > 1 {
+		return nil, fmt.Errorf("[vfs] [iso] Compressed image version %d is not supported", version)
+	}
+	if cf.blockSize == 0 {
+		return nil, fmt.Errorf("[vfs] [iso] Invalid compressed image block size")
+	}
+
+	blocks := (cf.totalBytes + int64(cf.blockSize) - 1) / int64(cf.blockSize)
+	indexBuf := make([]byte, (blocks+1)*4)
+	if _, err := f.ReadAt(indexBuf, CSO_HEADER_SIZE); err != nil {
+		return nil, fmt.Errorf("[vfs] [iso] Cannot read compressed image index: %v", err)
+	}
+	cf.index = make([]uint32, blocks+1)
+	for i := range cf.index {
+		cf.index[i] = binary.LittleEndian.Uint32(indexBuf[i*4:])
+	}
+	return cf, nil
+}
+
+func (cf *CompressedFile) Init(parent vfs.Directory) {}
+func (cf *CompressedFile) Name() string              { return cf.f.Name() }
+func (cf *CompressedFile) IsDirectory() bool         { return false }
+func (cf *CompressedFile) Size() int64               { return cf.totalBytes }
+func (cf *CompressedFile) Open(readonly bool) error  { return cf.f.Open(true) }
+func (cf *CompressedFile) Close() error              { return cf.f.Close() }
+func (cf *CompressedFile) Reader() (*io.SectionReader, error) {
+	return io.NewSectionReader(cf, 0, cf.totalBytes), nil
+}
+func (cf *CompressedFile) Copy(src io.Reader) error {
+	return fmt.Errorf("[vfs] [iso] Compressed image is read only")
+}
+func (cf *CompressedFile) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, fmt.Errorf("[vfs] [iso] Compressed image is read only")
+}
+
+func (cf *CompressedFile) readBlock(block int64) ([]byte, error) {
+	if block == cf.cacheBlock {
+		return cf.cache, nil
+	}
+
+	start := int64(cf.index[block]&^CSO_PLAIN_BLOCK) << cf.align
+	end := int64(cf.index[block+1]&^CSO_PLAIN_BLOCK) << cf.align
+	plain := cf.index[block]&CSO_PLAIN_BLOCK != 0
+
+	size := end - start
+	if plain {
+		size = int64(cf.blockSize)
+	}
+	raw := make([]byte, size)
+	if n, err := cf.f.ReadAt(raw, start); err != nil && !(err == io.EOF && n != 0) {
+		return nil, fmt.Errorf("[vfs] [iso] Cannot read block %d: %v", block, err)
+	}
+
+	var data []byte
+	if plain {
+		data = raw
+	} else if cf.lz4 {
+		var err error
+		if data, err = lz4DecompressBlock(raw, int(cf.blockSize)); err != nil {
+			return nil, fmt.Errorf("[vfs] [iso] Cannot decompress block %d: %v", block, err)
+		}
+	} else {
+		data = make([]byte, cf.blockSize)
+		n, err := io.ReadFull(flate.NewReader(bytes.NewReader(raw)), data)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, fmt.Errorf("[vfs] [iso] Cannot decompress block %d: %v", block, err)
+		}
+		data = data[:n]
+	}
+
+	cf.cacheBlock, cf.cache = block, data
+	return data, nil
+}
+
+func (cf *CompressedFile) ReadAt(b []byte, off int64) (n int, err error) {
+	cf.lock.Lock()
+	defer cf.lock.Unlock()
+
+	for n < len(b) {
+		pos := off + int64(n)
+		if pos >= cf.totalBytes {
+			return n, io.EOF
+		}
+		block := pos / int64(cf.blockSize)
+		data, err := cf.readBlock(block)
+		if err != nil {
+			return n, err
+		}
+		inBlock := pos - block*int64(cf.blockSize)
+		if inBlock >= int64(len(data)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(b[n:], data[inBlock:])
+	}
+	return n, nil
+}
+
+// lz4DecompressBlock decodes raw lz4 block (without frame)
+func lz4DecompressBlock(src []byte, sizeHint int) ([]byte, error) {
+	dst := make([]byte, 0, sizeHint)
+	readLength := func(i int, length int) (int, int, error) {
+		if length != 15 {
+			return i, length, nil
+		}
+		for {
+			if i >= len(src) {
+				return i, 0, fmt.Errorf("unexpected end of block")
+			}
+			b := src[i]
+			i++
+			length += int(b)
+			if b != 255 {
+				return i, length, nil
+			}
+		}
+	}
+
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+
+		var litLen int
+		var err error
+		if i, litLen, err = readLength(i, int(token>>4)); err != nil {
+			return nil, err
+		}
+		if i+litLen > len(src) {
+			return nil, fmt.Errorf("literals out of block")
+		}
+		dst = append(dst, src[i:i+litLen]...)
+		i += litLen
+		if i >= len(src) {
+			// last sequence contains only literals
+			break
+		}
+
+		if i+2 > len(src) {
+			return nil, fmt.Errorf("unexpected end of block")
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		var matchLen int
+		if i, matchLen, err = readLength(i, int(token&0xf)); err != nil {
+			return nil, err
+		}
+		matchLen += 4
+
+		if offset == 0 || offset > len(dst) {
+			return nil, fmt.Errorf("invalid match offset %d", offset)
+		}
+		// byte by byte, because match can overlap itself
+		for from := len(dst) - offset; matchLen > 0; matchLen-- {
+			dst = append(dst, dst[from])
+			from++
+		}
+	}
+	return dst, nil
+}
@@ -0,0 +1,102 @@
+package iso
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+type memoryFile struct {
+	vfs.File
+	data []byte
+}
+
+func (m *memoryFile) ReadAt(b []byte, off int64) (int, error) {
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(b, m.data[off:])
+	if n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// makeCso packs blocks with deflate, odd blocks are stored plain
+func makeCso(data []byte, blockSize int) []byte {
+	blocks := (len(data) + blockSize - 1) / blockSize
+	var body bytes.Buffer
+	index := make([]uint32, blocks+1)
+	dataStart := CSO_HEADER_SIZE + len(index)*4
+	for i := 0; i < blocks; i++ {
+		block := data[i*blockSize:]
+		if len(block) > blockSize {
+			block = block[:blockSize]
+		}
+		index[i] = uint32(dataStart + body.Len())
+		if i%2 == 1 {
+			index[i] |= CSO_PLAIN_BLOCK
+			body.Write(block)
+		} else {
+			w, _ := flate.NewWriter(&body, flate.BestCompression)
+			w.Write(block)
+			w.Close()
+		}
+	}
+	index[blocks] = uint32(dataStart + body.Len())
+
+	result := make([]byte, dataStart)
+	copy(result, CSO_MAGIC)
+	binary.LittleEndian.PutUint32(result[4:], CSO_HEADER_SIZE)
+	binary.LittleEndian.PutUint64(result[8:], uint64(len(data)))
+	binary.LittleEndian.PutUint32(result[16:], uint32(blockSize))
+	result[20] = 1
+	for i, v := range index {
+		binary.LittleEndian.PutUint32(result[CSO_HEADER_SIZE+i*4:], v)
+	}
+	return append(result, body.Bytes()...)
+}
+
+func TestCompressedFile(t *testing.T) {
+	data := make([]byte, 2048*5+100)
+	for i := range data {
+		data[i] = byte(i * 7 / 3)
+	}
+
+	f := &memoryFile{data: makeCso(data, 2048)}
+	if !IsCompressedImage(f) {
+		t.Fatalf("CSO magic is not detected")
+	}
+	cf, err := NewCompressedFile(f)
+	if err != nil {
+		t.Fatalf("NewCompressedFile() failed: %v", err)
+	}
+	if cf.Size() != int64(len(data)) {
+		t.Errorf("Size()=%d; expected %d", cf.Size(), len(data))
+	}
+
+	for _, c := range []struct{ off, size int }{{0, 10}, {2040, 20}, {3000, 4096}, {len(data) - 50, 50}} {
+		buf := make([]byte, c.size)
+		if _, err := cf.ReadAt(buf, int64(c.off)); err != nil {
+			t.Errorf("ReadAt(%d, %d) failed: %v", c.off, c.size, err)
+		} else if !bytes.Equal(buf, data[c.off:c.off+c.size]) {
+			t.Errorf("ReadAt(%d, %d) returned wrong data", c.off, c.size)
+		}
+	}
+}
+
+func TestLz4DecompressBlock(t *testing.T) {
+	// "abcd" literals, match of 8 bytes at offset 4, "xyz" last literals
+	block := []byte{0x44, 'a', 'b', 'c', 'd', 4, 0, 0x30, 'x', 'y', 'z'}
+	data, err := lz4DecompressBlock(block, 16)
+	if err != nil {
+		t.Fatalf("lz4DecompressBlock() failed: %v", err)
+	}
+	if string(data) != "abcdabcdabcdxyz" {
+		t.Errorf("lz4DecompressBlock()=%q", data)
+	}
+}
@@ -15,9 +15,107 @@ import (
 	"github.com/mogaika/god_of_war_browser/vfs"
 )
 
+// isoEntry is file or directory found on one of disk layers
+type isoEntry struct {
+	name   string
+	dir    bool
+	offset int64 // absolute offset of data in image
+	size   int64
+	list   func() ([]isoEntry, error)
+}
+
+// isoLayer is filesystem of one disk layer (volume).
+// UDF is used when present, ISO9660 otherwise
+type isoLayer struct {
+	r       io.ReaderAt
+	start   int64 // offset of layer in image
+	udf     *udf.Udf
+	iso9660 *iso9660Record
+}
+
+// recoverUdf converts panic of udf library on malformed structures to error
+func recoverUdf(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("[vfs] [iso] UDF error: %v", r)
+	}
+}
+
+func openLayer(r io.ReaderAt, start int64) (*isoLayer, error) {
+	l := &isoLayer{r: r, start: start, udf: udf.NewUdfFromReader(r)}
+	_, udfErr := l.udfEntries(nil)
+	if udfErr == nil {
+		return l, nil
+	}
+	l.udf = nil
+
+	root, err := readIso9660Root(r)
+	if err != nil {
+		return nil, fmt.Errorf("[vfs] [iso] Neither UDF (%v) nor ISO9660 (%v) filesystem found", udfErr, err)
+	}
+	log.Printf("[vfs] [iso] UDF not found at 0x%x (%v), using ISO9660 filesystem", start, udfErr)
+	l.iso9660 = &root
+	return l, nil
+}
+
+func (l *isoLayer) root() ([]isoEntry, error) {
+	if l.udf != nil {
+		return l.udfEntries(nil)
+	}
+	return l.iso9660Entries(*l.iso9660)
+}
+
+// udfEntries lists directory dir or root directory if dir is nil
+func (l *isoLayer) udfEntries(dir *udf.File) (result []isoEntry, err error) {
+	defer recoverUdf(&err)
+
+	var files []udf.File
+	if dir == nil {
+		files = l.udf.ReadDir(nil)
+	} else {
+		files = dir.ReadDir()
+	}
+
+	result = make([]isoEntry, len(files))
+	for i := range files {
+		f := &files[i]
+		result[i] = isoEntry{
+			name:   f.Name(),
+			dir:    f.IsDir(),
+			offset: l.start + f.GetFileOffset(),
+			size:   f.Size(),
+		}
+		if result[i].dir {
+			result[i].list = func() ([]isoEntry, error) { return l.udfEntries(f) }
+		}
+	}
+	return result, nil
+}
+
+func (l *isoLayer) iso9660Entries(dir iso9660Record) ([]isoEntry, error) {
+	records, err := readIso9660Dir(l.r, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]isoEntry, len(records))
+	for i, rec := range records {
+		rec := rec
+		result[i] = isoEntry{
+			name:   rec.Name,
+			dir:    rec.Dir,
+			offset: l.start + int64(rec.Extent)*utils.SECTOR_SIZE,
+			size:   int64(rec.Size),
+		}
+		if rec.Dir {
+			result[i].list = func() ([]isoEntry, error) { return l.iso9660Entries(rec) }
+		}
+	}
+	return result, nil
+}
+
 type IsoDriver struct {
 	f                vfs.File
-	layers           [2]*udf.Udf
+	layers           [2]*isoLayer
 	secondLayerStart int64
 }
 
@@ -25,36 +123,114 @@ func (iso *IsoDriver) Init(parent vfs.Directory) {}
 func (iso *IsoDriver) Name() string              { return iso.f.Name() }
 func (iso *IsoDriver) IsDirectory() bool         { return true }
 
-func (iso *IsoDriver) List() ([]string, error) {
-	result := make([]string, 0, 48)
+// root returns merged root directories of all layers
+func (iso *IsoDriver) root() ([]isoEntry, error) {
+	result := make([]isoEntry, 0, 48)
 	for _, layer := range iso.layers {
 		if layer != nil {
-			files := layer.ReadDir(nil)
-			for i := range files {
-				result = append(result, files[i].Name())
+			entries, err := layer.root()
+			if err != nil {
+				return nil, err
 			}
+			result = append(result, entries...)
 		}
 	}
 	return result, nil
 }
 
-func (iso *IsoDriver) GetElement(name string) (vfs.Element, error) {
-	for _, layer := range iso.layers {
-		if layer != nil {
-			dir := layer.ReadDir(nil)
-			for i := range dir {
-				if strings.ToLower(dir[i].Name()) == strings.ToLower(name) {
-					return &IsoDriverFile{
-						iso: iso,
-						f:   &dir[i]}, nil
+// find walks over directories of path separated by '/'.
+// Names are case insensitive
+func (iso *IsoDriver) find(path string) (isoEntry, error) {
+	entries, err := iso.root()
+	if err != nil {
+		return isoEntry{}, err
+	}
+
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		found := false
+		for _, e := range entries {
+			if strings.ToLower(e.name) != strings.ToLower(part) {
+				continue
+			}
+			if i == len(parts)-1 {
+				return e, nil
+			}
+			if e.dir {
+				if entries, err = e.list(); err != nil {
+					return isoEntry{}, err
 				}
+				found = true
+				break
 			}
 		}
+		if !found {
+			break
+		}
+	}
+	return isoEntry{}, os.ErrNotExist
+}
+
+func (iso *IsoDriver) element(path string, e isoEntry) vfs.Element {
+	if e.dir {
+		return &IsoDriverDirectory{iso: iso, path: path, e: e}
+	}
+	return &IsoDriverFile{iso: iso, e: e}
+}
+
+func (iso *IsoDriver) List() ([]string, error) {
+	entries, err := iso.root()
+	if err != nil {
+		return nil, err
+	}
+	return entryNames(entries), nil
+}
+
+// ListRecursive returns paths of all files on disk, including files of subdirectories
+func (iso *IsoDriver) ListRecursive() ([]string, error) {
+	entries, err := iso.root()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0, len(entries))
+	return listRecursive(result, "", entries)
+}
+
+func listRecursive(result []string, prefix string, entries []isoEntry) ([]string, error) {
+	for _, e := range entries {
+		if !e.dir {
+			result = append(result, prefix+e.name)
+			continue
+		}
+		children, err := e.list()
+		if err != nil {
+			return nil, err
+		}
+		if result, err = listRecursive(result, prefix+e.name+"/", children); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func entryNames(entries []isoEntry) []string {
+	result := make([]string, len(entries))
+	for i := range entries {
+		result[i] = entries[i].name
+	}
+	return result
+}
+
+// GetElement accepts names of subdirectories files too ("DIR/FILE")
+func (iso *IsoDriver) GetElement(name string) (vfs.Element, error) {
+	e, err := iso.find(name)
+	if err != nil {
+		return nil, err
 	}
-	return nil, os.ErrNotExist
+	return iso.element(name, e), nil
 }
-func (iso *IsoDriver) Add(e vfs.Element) error  { panic("Não Implementado") }
-func (iso *IsoDriver) Remove(name string) error { panic("Não Implementado") }
+func (iso *IsoDriver) Add(e vfs.Element) error  { panic("Not implemented") }
+func (iso *IsoDriver) Remove(name string) error { panic("Not implemented") }
 func (iso *IsoDriver) Sync() error {
 	if s, ok := iso.f.(vfs.Syncer); ok {
 		return s.Sync()
@@ -62,41 +238,85 @@ func (iso *IsoDriver) Sync() error {
 	return nil
 }
 
+// Image returns file of whole disk image
+func (iso *IsoDriver) Image() vfs.File {
+	return iso.f
+}
+
 func (iso *IsoDriver) OpenStreams() error {
-	iso.layers[0] = udf.NewUdfFromReader(iso.f)
+	layer, err := openLayer(iso.f, 0)
+	if err != nil {
+		return err
+	}
+	iso.layers[0] = layer
 
 	var volSizeBuf [4]byte
 	// primary volume description sector + offset of volume space size
 	if _, err := iso.f.ReadAt(volSizeBuf[:], 0x10*2048+80); err != nil {
-		log.Printf("[vfs] [iso] Erro ao detectar a segunda camada: Erro ao ler o tamanho do volume do BUF: %v", err)
+		log.Printf("[vfs] [iso] Error detecting second layer: cannot read volume size: %v", err)
 	} else {
 		// minus 16 boot sectors, because they do not replicated over layers (volumes)
 		volumeSize := int64(binary.LittleEndian.Uint32(volSizeBuf[:])-16) * utils.SECTOR_SIZE
 
 		if volumeSize+256*utils.SECTOR_SIZE < iso.f.Size() {
-			iso.layers[1] = udf.NewUdfFromReader(io.NewSectionReader(iso.f, volumeSize, iso.f.Size()-volumeSize))
-			log.Printf("[vfs] [iso] Segunda camada do disco detectada. Início: 0x%x (0x%x)", volumeSize+16*utils.SECTOR_SIZE, volumeSize)
-			iso.secondLayerStart = volumeSize
+			layer, err := openLayer(io.NewSectionReader(iso.f, volumeSize, iso.f.Size()-volumeSize), volumeSize)
+			if err != nil {
+				log.Printf("[vfs] [iso] Error opening second layer: %v", err)
+			} else {
+				iso.layers[1] = layer
+				log.Printf("[vfs] [iso] Second layer of disk detected. Start: 0x%x (0x%x)", volumeSize+16*utils.SECTOR_SIZE, volumeSize)
+				iso.secondLayerStart = volumeSize
+			}
 		}
 	}
 	return nil
 }
 
 func NewIsoDriver(f vfs.File) (*IsoDriver, error) {
+	if IsCompressedImage(f) {
+		cf, err := NewCompressedFile(f)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[vfs] [iso] Compressed image detected, opened in read only mode")
+		f = cf
+	}
 	iso := &IsoDriver{f: f}
 	return iso, iso.OpenStreams()
 }
 
+type IsoDriverDirectory struct {
+	iso  *IsoDriver
+	path string
+	e    isoEntry
+}
+
+func (d *IsoDriverDirectory) Init(parent vfs.Directory) {}
+func (d *IsoDriverDirectory) Name() string              { return d.e.name }
+func (d *IsoDriverDirectory) IsDirectory() bool         { return true }
+func (d *IsoDriverDirectory) List() ([]string, error) {
+	entries, err := d.e.list()
+	if err != nil {
+		return nil, err
+	}
+	return entryNames(entries), nil
+}
+func (d *IsoDriverDirectory) GetElement(name string) (vfs.Element, error) {
+	return d.iso.GetElement(d.path + "/" + name)
+}
+func (d *IsoDriverDirectory) Add(e vfs.Element) error  { panic("Not implemented") }
+func (d *IsoDriverDirectory) Remove(name string) error { panic("Not implemented") }
+
 type IsoDriverFile struct {
 	iso      *IsoDriver
-	f        *udf.File
+	e        isoEntry
 	readonly bool
 }
 
 func (f *IsoDriverFile) Init(parent vfs.Directory) {}
-func (f *IsoDriverFile) Name() string              { return f.f.Name() }
-func (f *IsoDriverFile) IsDirectory() bool         { return f.f.IsDir() }
-func (f *IsoDriverFile) Size() int64               { return f.f.Size() }
+func (f *IsoDriverFile) Name() string              { return f.e.name }
+func (f *IsoDriverFile) IsDirectory() bool         { return false }
+func (f *IsoDriverFile) Size() int64               { return f.e.size }
 func (f *IsoDriverFile) Open(readonly bool) error {
 	f.readonly = readonly
 	return nil
@@ -109,10 +329,10 @@ func (f *IsoDriverFile) Close() error {
 	}
 }
 func (f *IsoDriverFile) Reader() (*io.SectionReader, error) {
-	return f.f.NewReader(), nil
+	return io.NewSectionReader(f.iso.f, f.e.offset, f.e.size), nil
 }
 func (f *IsoDriverFile) ReadAt(b []byte, off int64) (n int, err error) {
-	return f.f.NewReader().ReadAt(b, off)
+	return io.NewSectionReader(f.iso.f, f.e.offset, f.e.size).ReadAt(b, off)
 }
 func (f *IsoDriverFile) Copy(src io.Reader) error {
 	var b bytes.Buffer
@@ -120,27 +340,23 @@ func (f *IsoDriverFile) Copy(src io.Reader) error {
 		return err
 	}
 	if int64(b.Len()) != f.Size() {
-		return fmt.Errorf("[vfs] [iso] Não suporta mudança de tamanho de arquivo")
+		return fmt.Errorf("[vfs] [iso] Changing file size is not supported")
 	}
 	_, err := f.WriteAt(b.Bytes(), 0)
 	return err
 }
 func (f *IsoDriverFile) WriteAt(b []byte, off int64) (n int, err error) {
 	if f.readonly {
-		return 0, fmt.Errorf("[vfs] [iso] Modo de Somente Leitura ativado")
+		return 0, fmt.Errorf("[vfs] [iso] File opened in read only mode")
 	}
 	if off+int64(len(b)) > f.Size() {
-		return 0, fmt.Errorf("[vfs] [iso] Não suporta mudança de tamanho de arquivo")
-	}
-
-	if f.f.Udf == f.iso.layers[1] {
-		off += f.iso.secondLayerStart
+		return 0, fmt.Errorf("[vfs] [iso] Changing file size is not supported")
 	}
-	return f.iso.f.WriteAt(b, f.f.GetFileOffset()+off)
+	return f.iso.f.WriteAt(b, f.e.offset+off)
 }
 func (f *IsoDriverFile) Sync() error {
 	if f.readonly {
-		return fmt.Errorf("[vfs] [iso] Modo de Somente Leitura ativado")
+		return fmt.Errorf("[vfs] [iso] File opened in read only mode")
 	}
 	return f.iso.Sync()
 }
@@ -0,0 +1,103 @@
+package iso
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+const (
+	ISO9660_MAGIC      = "CD001"
+	ISO9660_PVD_SECTOR = 16
+
+	ISO9660_PVD_TYPE        = 1
+	ISO9660_TERMINATOR_TYPE = 255
+
+	// offset of root directory record inside primary volume descriptor
+	ISO9660_ROOT_RECORD_OFFSET = 156
+
+	ISO9660_FLAG_DIRECTORY = 0x2
+)
+
+// iso9660Record is parsed directory record of ISO9660 filesystem
+type iso9660Record struct {
+	Name   string
+	Dir    bool
+	Extent uint32 // sector of data
+	Size   uint32
+}
+
+func parseIso9660Record(b []byte) (iso9660Record, error) {
+	if len(b) < 34 || int(b[0]) > len(b) || 33+int(b[32]) > int(b[0]) {
+		return iso9660Record{}, fmt.Errorf("[vfs] [iso] Invalid ISO9660 directory record")
+	}
+	rec := iso9660Record{
+		Dir:    b[25]&ISO9660_FLAG_DIRECTORY != 0,
+		Extent: binary.LittleEndian.Uint32(b[2:]),
+		Size:   binary.LittleEndian.Uint32(b[10:]),
+	}
+	name := string(b[33 : 33+int(b[32])])
+	switch name {
+	case "\x00":
+		name = "."
+	case "\x01":
+		name = ".."
+	default:
+		// remove version suffix (";1") and empty extension dot
+		if i := strings.IndexByte(name, ';'); i != -1 {
+			name = name[:i]
+		}
+		name = strings.TrimSuffix(name, ".")
+	}
+	rec.Name = name
+	return rec, nil
+}
+
+// readIso9660Root searches primary volume descriptor and returns root directory record.
+// Used for images without UDF filesystem
+func readIso9660Root(r io.ReaderAt) (iso9660Record, error) {
+	var sector [utils.SECTOR_SIZE]byte
+	for i := int64(ISO9660_PVD_SECTOR); ; i++ {
+		if _, err := r.ReadAt(sector[:], i*utils.SECTOR_SIZE); err != nil {
+			return iso9660Record{}, fmt.Errorf("[vfs] [iso] Cannot read volume descriptor: %v", err)
+		}
+		if string(sector[1:6]) != ISO9660_MAGIC {
+			return iso9660Record{}, fmt.Errorf("[vfs] [iso] ISO9660 volume descriptor not found")
+		}
+		switch sector[0] {
+		case ISO9660_PVD_TYPE:
+			return parseIso9660Record(sector[ISO9660_ROOT_RECORD_OFFSET : ISO9660_ROOT_RECORD_OFFSET+34])
+		case ISO9660_TERMINATOR_TYPE:
+			return iso9660Record{}, fmt.Errorf("[vfs] [iso] ISO9660 primary volume descriptor not found")
+		}
+	}
+}
+
+// readIso9660Dir returns records of directory, without "." and ".." entries.
+// Records never cross sector boundary, rest of sector is zero filled
+func readIso9660Dir(r io.ReaderAt, dir iso9660Record) ([]iso9660Record, error) {
+	buf := make([]byte, dir.Size)
+	if _, err := r.ReadAt(buf, int64(dir.Extent)*utils.SECTOR_SIZE); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("[vfs] [iso] Cannot read directory '%s': %v", dir.Name, err)
+	}
+
+	result := make([]iso9660Record, 0)
+	for pos := 0; pos < len(buf); {
+		if buf[pos] == 0 {
+			pos = (pos/utils.SECTOR_SIZE + 1) * utils.SECTOR_SIZE
+			continue
+		}
+		rec, err := parseIso9660Record(buf[pos:])
+		if err != nil {
+			return nil, err
+		}
+		pos += int(buf[pos])
+		if rec.Name != "." && rec.Name != ".." {
+			result = append(result, rec)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,108 @@
+package iso
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+func (m *memoryFile) Size() int64 { return int64(len(m.data)) }
+
+func putIso9660Record(b []byte, name string, dir bool, extent, size uint32) int {
+	length := 33 + len(name)
+	length += length & 1
+	b[0] = byte(length)
+	binary.LittleEndian.PutUint32(b[2:], extent)
+	binary.BigEndian.PutUint32(b[6:], extent)
+	binary.LittleEndian.PutUint32(b[10:], size)
+	binary.BigEndian.PutUint32(b[14:], size)
+	if dir {
+		b[25] = ISO9660_FLAG_DIRECTORY
+	}
+	b[32] = byte(len(name))
+	copy(b[33:], name)
+	return length
+}
+
+// makeIso9660 creates image without UDF:
+// root with SYSTEM.CNF and STREAMS directory with MOVIE.PSS file
+func makeIso9660() []byte {
+	const sectors = 24
+	img := make([]byte, sectors*utils.SECTOR_SIZE)
+	sector := func(i int) []byte { return img[i*utils.SECTOR_SIZE : (i+1)*utils.SECTOR_SIZE] }
+
+	pvd := sector(16)
+	pvd[0] = ISO9660_PVD_TYPE
+	copy(pvd[1:], ISO9660_MAGIC)
+	binary.LittleEndian.PutUint32(pvd[80:], sectors)
+	putIso9660Record(pvd[ISO9660_ROOT_RECORD_OFFSET:], "\x00", true, 18, utils.SECTOR_SIZE)
+
+	term := sector(17)
+	term[0] = ISO9660_TERMINATOR_TYPE
+	copy(term[1:], ISO9660_MAGIC)
+
+	root := sector(18)
+	pos := putIso9660Record(root, "\x00", true, 18, utils.SECTOR_SIZE)
+	pos += putIso9660Record(root[pos:], "\x01", true, 18, utils.SECTOR_SIZE)
+	pos += putIso9660Record(root[pos:], "STREAMS", true, 19, utils.SECTOR_SIZE)
+	putIso9660Record(root[pos:], "SYSTEM.CNF;1", false, 20, 5)
+
+	streams := sector(19)
+	pos = putIso9660Record(streams, "\x00", true, 19, utils.SECTOR_SIZE)
+	pos += putIso9660Record(streams[pos:], "\x01", true, 18, utils.SECTOR_SIZE)
+	putIso9660Record(streams[pos:], "MOVIE.PSS;1", false, 21, 7)
+
+	copy(sector(20), "BOOT2")
+	copy(sector(21), "PSSDATA")
+	return img
+}
+
+func TestIso9660Fallback(t *testing.T) {
+	iso, err := NewIsoDriver(&memoryFile{data: makeIso9660()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := iso.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(root, []string{"STREAMS", "SYSTEM.CNF"}) {
+		t.Errorf("Wrong root list %v", root)
+	}
+
+	all, err := iso.ListRecursive()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(all, []string{"STREAMS/MOVIE.PSS", "SYSTEM.CNF"}) {
+		t.Errorf("Wrong recursive list %v", all)
+	}
+
+	f, err := vfs.DirectoryGetFile(iso, "streams/movie.pss")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := f.Reader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadAll(r); string(data) != "PSSDATA" {
+		t.Errorf("Wrong file data %q", data)
+	}
+
+	dir, err := iso.GetElement("STREAMS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dir.IsDirectory() {
+		t.Fatalf("STREAMS is not directory")
+	}
+	if _, err := dir.(vfs.Directory).GetElement("MOVIE.PSS"); err != nil {
+		t.Errorf("Cannot get file from subdirectory: %v", err)
+	}
+}
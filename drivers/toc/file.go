@@ -21,14 +21,21 @@ func (f *File) Name() string              { return f.name }
 func (f *File) IsDirectory() bool         { return false }
 
 // interface vfs.File
-func (f *File) Size() int64              { return f.size }
+func (f *File) Size() int64 {
+	f.toc.lock.RLock()
+	defer f.toc.lock.RUnlock()
+	return f.size
+}
 func (f *File) Open(readonly bool) error { return nil }
 func (f *File) Close() error             { return nil }
 func (f *File) Reader() (*io.SectionReader, error) {
-	return io.NewSectionReader(f.toc.pa.NewReaderWriter(f.encounters[0]), 0, f.size), nil
+	return io.NewSectionReader(f, 0, f.Size()), nil
 }
 
+// ReadAt reads from current location of file, which can be changed by shrink between calls
 func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	f.toc.lock.RLock()
+	defer f.toc.lock.RUnlock()
 	return f.toc.pa.NewReaderWriter(f.encounters[0]).ReadAt(b, off)
 }
 
@@ -2,10 +2,10 @@ package toc
 
 import (
 	"bytes"
-	"encoding/binary"
 	"sort"
 
 	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
 )
 
 const GOW1_ENTRY_SIZE = 24
@@ -17,19 +17,34 @@ type RawTocEntryGOW1 struct {
 	Pak    PakIndex
 }
 
+var EntryLayoutGOW1 = structlayout.Register(structlayout.New("gow1_toc_entry", "God of War 1 GODOFWAR.TOC entry", GOW1_ENTRY_SIZE,
+	structlayout.Field{Name: "name", Offset: 0, Kind: structlayout.String, Size: 12},
+	structlayout.Field{Name: "pak", Offset: 12, Kind: structlayout.U32, Doc: "index of PART?.PAK"},
+	structlayout.Field{Name: "size", Offset: 16, Kind: structlayout.U32},
+	structlayout.Field{Name: "offset", Offset: 20, Kind: structlayout.U32, Doc: "in sectors (0x800 bytes)"},
+))
+
+// fields resolved once, entries are parsed for every file
+var (
+	entryGOW1Name   = EntryLayoutGOW1.Field("name")
+	entryGOW1Pak    = EntryLayoutGOW1.Field("pak")
+	entryGOW1Size   = EntryLayoutGOW1.Field("size")
+	entryGOW1Offset = EntryLayoutGOW1.Field("offset")
+)
+
 func (rte *RawTocEntryGOW1) Unmarshal(buffer []byte) {
-	rte.Name = utils.BytesToString(buffer[0:12])
-	rte.Size = int64(binary.LittleEndian.Uint32(buffer[16:20]))
-	rte.Pak = PakIndex(binary.LittleEndian.Uint32(buffer[12:16]))
-	rte.Offset = int64(binary.LittleEndian.Uint32(buffer[20:24])) * utils.SECTOR_SIZE
+	rte.Name = entryGOW1Name.String(buffer)
+	rte.Size = int64(entryGOW1Size.U32(buffer))
+	rte.Pak = PakIndex(entryGOW1Pak.U32(buffer))
+	rte.Offset = int64(entryGOW1Offset.U32(buffer)) * utils.SECTOR_SIZE
 }
 
 func (rte *RawTocEntryGOW1) Marshal() []byte {
 	buf := make([]byte, GOW1_ENTRY_SIZE)
-	copy(buf[:12], utils.StringToBytesBuffer(rte.Name, 12, false))
-	binary.LittleEndian.PutUint32(buf[12:16], uint32(rte.Pak))
-	binary.LittleEndian.PutUint32(buf[16:20], uint32(rte.Size))
-	binary.LittleEndian.PutUint32(buf[20:24], uint32(utils.GetRequiredSectorsCount(rte.Offset)))
+	entryGOW1Name.PutString(buf, rte.Name, false)
+	entryGOW1Pak.PutU32(buf, uint32(rte.Pak))
+	entryGOW1Size.PutU32(buf, uint32(rte.Size))
+	entryGOW1Offset.PutU32(buf, uint32(utils.GetRequiredSectorsCount(rte.Offset)))
 	return buf
 }
 
@@ -5,6 +5,7 @@ import (
 	"sort"
 
 	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
 )
 
 const GOW2_ENTRY_SIZE = 36
@@ -17,19 +18,34 @@ type RawTocEntryGOW2 struct {
 	EntriesStart uint32
 }
 
+var EntryLayoutGOW2 = structlayout.Register(structlayout.New("gow2_toc_entry", "God of War 2 GODOFWAR.TOC file entry", GOW2_ENTRY_SIZE,
+	structlayout.Field{Name: "name", Offset: 0, Kind: structlayout.String, Size: 24},
+	structlayout.Field{Name: "size", Offset: 24, Kind: structlayout.U32},
+	structlayout.Field{Name: "entries_count", Offset: 28, Kind: structlayout.U32, Doc: "count of file replicas"},
+	structlayout.Field{Name: "entries_start", Offset: 32, Kind: structlayout.U32, Doc: "index in sector offsets array"},
+))
+
+// fields resolved once, entries are parsed for every file
+var (
+	entryGOW2Name         = EntryLayoutGOW2.Field("name")
+	entryGOW2Size         = EntryLayoutGOW2.Field("size")
+	entryGOW2EntriesCount = EntryLayoutGOW2.Field("entries_count")
+	entryGOW2EntriesStart = EntryLayoutGOW2.Field("entries_start")
+)
+
 func (rte *RawTocEntryGOW2) Unmarshal(buffer []byte) {
-	rte.Name = utils.BytesToString(buffer[0:24])
-	rte.Size = int64(binary.LittleEndian.Uint32(buffer[24:28]))
-	rte.EntriesCount = binary.LittleEndian.Uint32(buffer[28:32])
-	rte.EntriesStart = binary.LittleEndian.Uint32(buffer[32:36])
+	rte.Name = entryGOW2Name.String(buffer)
+	rte.Size = int64(entryGOW2Size.U32(buffer))
+	rte.EntriesCount = entryGOW2EntriesCount.U32(buffer)
+	rte.EntriesStart = entryGOW2EntriesStart.U32(buffer)
 }
 
 func (rte *RawTocEntryGOW2) Marshal() []byte {
 	buf := make([]byte, GOW2_ENTRY_SIZE)
-	copy(buf[:24], utils.StringToBytesBuffer(rte.Name, 24, false))
-	binary.LittleEndian.PutUint32(buf[24:28], uint32(rte.Size))
-	binary.LittleEndian.PutUint32(buf[28:32], uint32(rte.EntriesCount))
-	binary.LittleEndian.PutUint32(buf[32:36], uint32(rte.EntriesStart))
+	entryGOW2Name.PutString(buf, rte.Name, false)
+	entryGOW2Size.PutU32(buf, uint32(rte.Size))
+	entryGOW2EntriesCount.PutU32(buf, rte.EntriesCount)
+	entryGOW2EntriesStart.PutU32(buf, rte.EntriesStart)
 	return buf
 }
 
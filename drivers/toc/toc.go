@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"strings"
+	"sync"
 
 	"github.com/mogaika/god_of_war_browser/config"
 	"github.com/mogaika/god_of_war_browser/vfs"
@@ -12,7 +13,10 @@ import (
 
 const TOC_FILE_NAME = "GODOFWAR.TOC"
 
+// TableOfContent is directory of files stored in paks. Lock protects files and
+// paks, so reading is not mixed with writing or moving of files by shrink
 type TableOfContent struct {
+	lock               sync.RWMutex
 	dir                vfs.Directory
 	files              map[string]*File
 	paks               []vfs.File
@@ -29,6 +33,8 @@ func (t *TableOfContent) IsDirectory() bool         { return true }
 
 // interface vfs.Directory
 func (t *TableOfContent) List() ([]string, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
 	files := make([]string, 0, 256)
 	for f := range t.files {
 		files = append(files, f)
@@ -37,6 +43,8 @@ func (t *TableOfContent) List() ([]string, error) {
 }
 
 func (t *TableOfContent) GetElement(name string) (vfs.Element, error) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
 	if f, ok := t.files[name]; !ok {
 		return nil, fmt.Errorf("[toc] Cannot find file '%s' in toc", name)
 	} else {
@@ -45,12 +53,14 @@ func (t *TableOfContent) GetElement(name string) (vfs.Element, error) {
 }
 func (t *TableOfContent) Add(e vfs.Element) error { panic("Not implemented") }
 func (t *TableOfContent) Remove(name string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
 	if _, ok := t.files[name]; !ok {
 		return fmt.Errorf("[toc] Cannot find file '%s' in toc", name)
 	}
 	t.dirty = true
 	delete(t.files, name)
-	if err := t.Sync(); err != nil {
+	if err := t.sync(); err != nil {
 		return fmt.Errorf("Sync error: %v", err)
 	}
 	return nil
@@ -4,12 +4,19 @@ import (
 	"fmt"
 	"log"
 
+	"github.com/mogaika/god_of_war_browser/jobs"
 	"github.com/mogaika/god_of_war_browser/status"
 	"github.com/mogaika/god_of_war_browser/utils"
 	"github.com/mogaika/god_of_war_browser/vfs"
 )
 
 func (toc *TableOfContent) Sync() error {
+	toc.lock.Lock()
+	defer toc.lock.Unlock()
+	return toc.sync()
+}
+
+func (toc *TableOfContent) sync() error {
 	var result error
 	for _, f := range toc.paks {
 		if s, ok := f.(vfs.Syncer); ok {
@@ -29,6 +36,9 @@ func (toc *TableOfContent) Sync() error {
 }
 
 func (toc *TableOfContent) UpdateFile(name string, b []byte) error {
+	toc.lock.Lock()
+	defer toc.lock.Unlock()
+
 	f, ok := toc.files[name]
 	if !ok {
 		return fmt.Errorf("[toc] Cannot find file with name: '%s'", name)
@@ -50,14 +60,14 @@ func (toc *TableOfContent) UpdateFile(name string, b []byte) error {
 	fs := toc.findFreeSpaceForFile(newSize)
 	if fs == nil {
 		log.Printf("[toc] There is no free space in paks, trying to remove file replicas (dups)")
-		if err := toc.RemoveReplicas(); err != nil {
+		if err := toc.removeReplicas(nil); err != nil {
 			return fmt.Errorf("[toc] Cannot remove replicas: %v", err)
 		}
 		fs = toc.findFreeSpaceForFile(newSize)
 	}
 	if fs == nil {
 		log.Printf("[toc] There is no free space in paks, trying to shrink data and find place for file")
-		if err := toc.Shrink(); err != nil {
+		if err := toc.shrink(nil); err != nil {
 			return fmt.Errorf("[toc] Cannot shrink files: %v", err)
 		}
 		fs = toc.findFreeSpaceForFile(newSize)
@@ -77,7 +87,7 @@ func (toc *TableOfContent) UpdateFile(name string, b []byte) error {
 		return fmt.Errorf("[toc] size > oldsize, UpdateFile=>WriteAt: %v", err)
 	}
 	toc.dirty = true
-	if err := toc.Sync(); err != nil {
+	if err := toc.sync(); err != nil {
 		return fmt.Errorf("[toc] Sync error: %v", err)
 	}
 	return nil
@@ -96,15 +106,46 @@ func (toc *TableOfContent) findFreeSpaceForFile(size int64) *FreeSpace {
 }
 
 func (t *TableOfContent) RemoveReplicas() error {
+	return t.RemoveReplicasJob(nil)
+}
+
+func (t *TableOfContent) RemoveReplicasJob(j *jobs.Job) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.removeReplicas(j)
+}
+
+func (t *TableOfContent) removeReplicas(j *jobs.Job) error {
+	removed := 0
 	for _, f := range t.files {
 		if len(f.encounters) > 1 {
+			removed += len(f.encounters) - 1
 			f.encounters = f.encounters[:1]
 		}
 	}
+	j.Progress(1, "Removed %d replicas", removed)
+	j.SetResult(removed)
 	return t.updateToc()
 }
 
 func (t *TableOfContent) Shrink() error {
+	return t.ShrinkJob(nil)
+}
+
+// ShrinkJob moves files to the start of paks, so free space is joined at the end.
+// On job cancel toc is synced with files that were already moved.
+// Reading and writing of toc files waits until shrink is finished
+func (t *TableOfContent) ShrinkJob(j *jobs.Job) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.shrink(j)
+}
+
+func (t *TableOfContent) shrink(j *jobs.Job) error {
+	if err := t.openPakStreams(false); err != nil {
+		return fmt.Errorf("[toc] Shrink=>openPakStreams: %v", err)
+	}
+
 	sortedFiles := sortFilesByEncounters(t.files)
 	paksUsage := paksAsFreeSpaces(t.paks)
 	alreadyProcessedFiles := make(map[string]*File)
@@ -119,8 +160,19 @@ func (t *TableOfContent) Shrink() error {
 	}()
 
 	for _, f := range sortedFiles {
+		if j.Cancelled() {
+			if err := dropOverwrittenEncounters(sortedFiles, alreadyProcessedFiles, paksUsage); err != nil {
+				// moved files must be written anyway, otherwise toc points to overwritten data
+				t.dirty = true
+				if syncErr := t.sync(); syncErr != nil {
+					return fmt.Errorf("%v; [toc] Sync error: %v", err, syncErr)
+				}
+				return err
+			}
+			break
+		}
 		if _, already := alreadyProcessedFiles[f.name]; !already {
-			status.Progress(float32(len(alreadyProcessedFiles))/float32(len(t.files)), "Shrinking iso image. Current file '%s'", f.name)
+			j.Progress(float32(len(alreadyProcessedFiles))/float32(len(t.files)), "Shrinking iso image. Current file '%s'", f.name)
 			alreadyProcessedFiles[f.name] = f
 			if len(f.encounters) != 0 {
 				oldsencs := f.encounters
@@ -146,9 +198,32 @@ func (t *TableOfContent) Shrink() error {
 		}
 	}
 	t.dirty = true
-	if err := t.Sync(); err != nil {
+	if err := t.sync(); err != nil {
 		return fmt.Errorf("[toc] Sync error: %v", err)
 	}
+	deferError = false
+	return nil
+}
+
+// dropOverwrittenEncounters removes encounters of not yet moved files
+// which can be overwritten by already moved files
+func dropOverwrittenEncounters(files []*File, processed map[string]*File, paksUsage []FreeSpace) error {
+	for _, f := range files {
+		if _, already := processed[f.name]; already {
+			continue
+		}
+		encounters := make([]Encounter, 0, len(f.encounters))
+		for _, e := range f.encounters {
+			if int(e.Pak) < len(paksUsage) && e.Offset < paksUsage[e.Pak].Start {
+				continue
+			}
+			encounters = append(encounters, e)
+		}
+		if len(encounters) == 0 {
+			return fmt.Errorf("[toc] Shrink cancel: all encounters of file '%s' were overwritten", f.name)
+		}
+		f.encounters = encounters
+	}
 	return nil
 }
 
@@ -0,0 +1,28 @@
+package toc
+
+import "testing"
+
+func TestDropOverwrittenEncounters(t *testing.T) {
+	moved := &File{name: "A", encounters: []Encounter{{Offset: 0, Size: 10}}}
+	replicated := &File{name: "B", encounters: []Encounter{{Offset: 0x800, Size: 10}, {Offset: 0x3000, Size: 10}}}
+	untouched := &File{name: "C", encounters: []Encounter{{Offset: 0x4000, Size: 10}}}
+	files := []*File{moved, replicated, untouched}
+	processed := map[string]*File{"A": moved}
+	// data of moved files written till 0x1000 of first pak
+	paksUsage := []FreeSpace{{Start: 0x1000, End: 0x10000, Pak: 0}}
+
+	if err := dropOverwrittenEncounters(files, processed, paksUsage); err != nil {
+		t.Fatal(err)
+	}
+	if len(replicated.encounters) != 1 || replicated.encounters[0].Offset != 0x3000 {
+		t.Errorf("Overwritten encounter kept %+v", replicated.encounters)
+	}
+	if len(untouched.encounters) != 1 || len(moved.encounters) != 1 {
+		t.Errorf("Not overwritten encounters changed")
+	}
+
+	lost := &File{name: "D", encounters: []Encounter{{Offset: 0x800, Size: 10}}}
+	if err := dropOverwrittenEncounters([]*File{moved, lost}, processed, paksUsage); err == nil {
+		t.Errorf("File without encounters returned nil error")
+	}
+}
@@ -0,0 +1,227 @@
+// Package gamediff compares two game sources (iso, toc, directory or psarc)
+// at file, wad tag and resource level
+package gamediff
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mogaika/god_of_war_browser/drivers/iso"
+	"github.com/mogaika/god_of_war_browser/drivers/psarc"
+	"github.com/mogaika/god_of_war_browser/drivers/toc"
+	"github.com/mogaika/god_of_war_browser/jobs"
+	"github.com/mogaika/god_of_war_browser/pack"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+const (
+	STATE_ADDED   = "added"
+	STATE_REMOVED = "removed"
+	STATE_CHANGED = "changed"
+)
+
+type FileDiff struct {
+	Name  string
+	State string
+	SizeA int64
+	SizeB int64
+	Wad   *WadDiff `json:",omitempty"`
+	Error string   `json:",omitempty"`
+}
+
+type Report struct {
+	A       string
+	B       string
+	Created time.Time
+	Files   []FileDiff
+	Same    int // count of equal files
+}
+
+type noClose struct{}
+
+func (noClose) Close() error { return nil }
+
+// OpenSource opens game source described as kind:path,
+// where kind is one of iso, toc, dir, psarc. Source is opened read only,
+// closer must be closed when diff is done
+func OpenSource(spec string) (vfs.Directory, io.Closer, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 {
+		return nil, nil, fmt.Errorf("[gamediff] Source '%s' must be in format kind:path (iso, toc, dir, psarc)", spec)
+	}
+
+	kind, path := parts[0], parts[1]
+	switch kind {
+	case "dir":
+		return vfs.NewDirectoryDriver(path), noClose{}, nil
+	case "toc":
+		d, err := toc.NewTableOfContent(vfs.NewDirectoryDriver(path))
+		if err != nil {
+			return nil, nil, err
+		}
+		return d, noClose{}, nil
+	case "iso":
+		f := vfs.NewDirectoryDriverFile(path)
+		if err := f.Open(true); err != nil {
+			return nil, nil, err
+		}
+		driver, err := iso.NewIsoDriver(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		d, err := toc.NewTableOfContent(driver)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return d, f, nil
+	case "psarc":
+		f := vfs.NewDirectoryDriverFile(path)
+		if err := f.Open(true); err != nil {
+			return nil, nil, err
+		}
+		d, err := psarc.NewPsarcDriver(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		return d, f, nil
+	default:
+		return nil, nil, fmt.Errorf("[gamediff] Unknown source kind '%s'", kind)
+	}
+}
+
+func fileInfo(d vfs.Directory, name string) (size int64, crc uint32, err error) {
+	f, err := vfs.DirectoryGetFile(d, name)
+	if err != nil {
+		return 0, 0, err
+	}
+	r, err := vfs.OpenFileAndGetReader(f, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, r); err != nil {
+		return 0, 0, err
+	}
+	return r.Size(), h.Sum32(), nil
+}
+
+func fileSize(d vfs.Directory, name string) int64 {
+	if f, err := vfs.DirectoryGetFile(d, name); err == nil {
+		return f.Size()
+	}
+	return 0
+}
+
+func openWad(d vfs.Directory, name string) (*wad.Wad, error) {
+	inst, err := pack.GetInstanceHandler(d, name)
+	if err != nil {
+		return nil, err
+	}
+	if w, ok := inst.(*wad.Wad); ok {
+		return w, nil
+	}
+	return nil, nil
+}
+
+func compareFile(a, b vfs.Directory, name string) (*FileDiff, error) {
+	fd := &FileDiff{Name: name, State: STATE_CHANGED}
+
+	sizeA, crcA, err := fileInfo(a, name)
+	if err != nil {
+		return nil, err
+	}
+	sizeB, crcB, err := fileInfo(b, name)
+	if err != nil {
+		return nil, err
+	}
+	fd.SizeA, fd.SizeB = sizeA, sizeB
+	if sizeA == sizeB && crcA == crcB {
+		return nil, nil
+	}
+
+	wa, err := openWad(a, name)
+	if err != nil {
+		fd.Error = err.Error()
+		return fd, nil
+	}
+	wb, err := openWad(b, name)
+	if err != nil {
+		fd.Error = err.Error()
+		return fd, nil
+	}
+	if wa != nil && wb != nil {
+		fd.Wad = CompareWads(wa, wb)
+	}
+	return fd, nil
+}
+
+// Compare lists files of both sources, finds added, removed and changed files
+// and compares tags and resources of changed wads
+func Compare(j *jobs.Job, a, b vfs.Directory, nameA, nameB string) (*Report, error) {
+	listA, err := a.List()
+	if err != nil {
+		return nil, fmt.Errorf("[gamediff] Cannot list '%s': %v", nameA, err)
+	}
+	listB, err := b.List()
+	if err != nil {
+		return nil, fmt.Errorf("[gamediff] Cannot list '%s': %v", nameB, err)
+	}
+
+	inA := make(map[string]bool)
+	for _, name := range listA {
+		inA[name] = true
+	}
+	inB := make(map[string]bool)
+	for _, name := range listB {
+		inB[name] = true
+	}
+
+	names := append([]string{}, listA...)
+	for _, name := range listB {
+		if !inA[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	r := &Report{A: nameA, B: nameB, Created: time.Now(), Files: make([]FileDiff, 0)}
+	for i, name := range names {
+		if j.Cancelled() {
+			return nil, fmt.Errorf("[gamediff] Cancelled")
+		}
+		j.Progress(float32(i)/float32(len(names)), "Comparing '%s'", name)
+
+		if !inB[name] {
+			fd := FileDiff{Name: name, State: STATE_REMOVED}
+			fd.SizeA = fileSize(a, name)
+			r.Files = append(r.Files, fd)
+			continue
+		}
+		if !inA[name] {
+			fd := FileDiff{Name: name, State: STATE_ADDED}
+			fd.SizeB = fileSize(b, name)
+			r.Files = append(r.Files, fd)
+			continue
+		}
+
+		fd, err := compareFile(a, b, name)
+		if err != nil {
+			r.Files = append(r.Files, FileDiff{Name: name, State: STATE_CHANGED, Error: err.Error()})
+		} else if fd != nil {
+			r.Files = append(r.Files, *fd)
+		} else {
+			r.Same++
+		}
+	}
+	return r, nil
+}
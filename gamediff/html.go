@@ -0,0 +1,57 @@
+package gamediff
+
+import (
+	"bytes"
+	"html/template"
+)
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Diff {{.A}} / {{.B}}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; }
+table { border-collapse: collapse; margin-bottom: 8px; }
+td, th { border: 1px solid #ccc; padding: 2px 6px; text-align: left; vertical-align: top; }
+.added { color: #070; }
+.removed { color: #a00; }
+.changed { color: #a60; }
+pre { margin: 0; }
+</style>
+</head>
+<body>
+<h2>{{.A}} &rarr; {{.B}}</h2>
+<p>Created {{.Created.Format "2006-01-02 15:04:05"}}, {{len .Files}} different files, {{.Same}} equal files</p>
+<table>
+<tr><th>File</th><th>State</th><th>Size A</th><th>Size B</th></tr>
+{{range .Files}}<tr class="{{.State}}"><td><a href="#{{.Name}}">{{.Name}}</a></td><td>{{.State}}</td><td>{{.SizeA}}</td><td>{{.SizeB}}</td></tr>
+{{end}}</table>
+{{range .Files}}{{if or .Wad .Error}}
+<h3 id="{{.Name}}">{{.Name}}</h3>
+{{if .Error}}<p class="removed">{{.Error}}</p>{{end}}
+{{with .Wad}}<p>{{len .Tags}} different tags, {{.Same}} equal tags</p>
+<table>
+<tr><th>Tag</th><th>State</th><th>Type</th><th>Size A</th><th>Size B</th><th>Diff bytes</th><th>First diff</th><th>Details</th></tr>
+{{range .Tags}}<tr class="{{.State}}">
+<td>{{.Name}}</td><td>{{.State}}</td><td>{{.Type}}</td><td>{{.SizeA}}</td><td>{{.SizeB}}</td>
+<td>{{if eq .State "changed"}}{{.DiffBytes}}{{end}}</td><td>{{if eq .State "changed"}}{{printf "0x%x" .FirstDiff}}{{end}}</td>
+<td>{{with .Text}}{{.RemovedCount}} lines removed, {{.AddedCount}} lines added
+<pre class="removed">{{range .Removed}}- {{.}}
+{{end}}</pre><pre class="added">{{range .Added}}+ {{.}}
+{{end}}</pre>{{end}}{{with .Pixels}}{{if .Error}}<span class="removed">{{.Error}}</span>{{else}}images {{.ImagesA}} / {{.ImagesB}}, {{.ChangedImages}} changed, {{.ChangedPixels}} pixels changed{{if .ResolutionsDiff}}, resolution changed{{end}}{{end}}{{end}}</td>
+</tr>
+{{end}}</table>
+{{end}}{{end}}{{end}}
+</body>
+</html>
+`))
+
+// HTML renders report as standalone html page
+func (r *Report) HTML() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := reportTemplate.Execute(&buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,264 @@
+package gamediff
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"reflect"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/txr"
+)
+
+// how many added and removed lines are kept in text diff of resource
+const TEXT_LINES_LIMIT = 100
+
+type TextDiff struct {
+	Added        []string
+	Removed      []string
+	AddedCount   int
+	RemovedCount int
+}
+
+type PixelsDiff struct {
+	ImagesA         int
+	ImagesB         int
+	ChangedImages   int
+	ChangedPixels   int
+	ResolutionsDiff bool
+	Error           string `json:",omitempty"`
+}
+
+type TagDiff struct {
+	Name      string
+	Tag       uint16
+	State     string
+	SizeA     int
+	SizeB     int
+	DiffBytes int         // count of different bytes, including size difference
+	FirstDiff int         // offset of first different byte, -1 if data is equal
+	Type      string      `json:",omitempty"` // type of parsed resource
+	Text      *TextDiff   `json:",omitempty"`
+	Pixels    *PixelsDiff `json:",omitempty"`
+}
+
+type WadDiff struct {
+	Tags []TagDiff
+	Same int // count of equal named tags
+}
+
+// tags are matched by name and index among tags with same name,
+// unnamed tags (group start and end) are skipped
+func tagsByKey(w *wad.Wad) (map[string]*wad.Tag, []string) {
+	tags := make(map[string]*wad.Tag)
+	keys := make([]string, 0)
+	counts := make(map[string]int)
+	for i := range w.Tags {
+		t := &w.Tags[i]
+		if t.Name == "" {
+			continue
+		}
+		key := fmt.Sprintf("%s#%d", t.Name, counts[t.Name])
+		counts[t.Name]++
+		tags[key] = t
+		keys = append(keys, key)
+	}
+	return tags, keys
+}
+
+func bytesDiff(a, b []byte) (count int, first int) {
+	first = -1
+	l := len(a)
+	if len(b) < l {
+		l = len(b)
+	}
+	for i := 0; i < l; i++ {
+		if a[i] != b[i] {
+			if first == -1 {
+				first = i
+			}
+			count++
+		}
+	}
+	if len(a) != len(b) && first == -1 {
+		first = l
+	}
+	if len(a) > len(b) {
+		count += len(a) - len(b)
+	} else {
+		count += len(b) - len(a)
+	}
+	return count, first
+}
+
+func instance(w *wad.Wad, t *wad.Tag) (inst wad.File) {
+	if t.NodeId == wad.NODE_INVALID || len(t.Data) == 0 {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[gamediff] Panic when parsing %s:%s: %v", w.Name(), t.Name, r)
+			inst = nil
+		}
+	}()
+	inst, _, _ = w.GetInstanceFromNode(t.NodeId)
+	return inst
+}
+
+func textDiff(a, b []string) *TextDiff {
+	count := make(map[string]int)
+	for _, line := range a {
+		count[line]++
+	}
+	for _, line := range b {
+		count[line]--
+	}
+
+	d := &TextDiff{Added: make([]string, 0), Removed: make([]string, 0)}
+	for _, line := range a {
+		if count[line] > 0 {
+			count[line]--
+			d.RemovedCount++
+			if len(d.Removed) < TEXT_LINES_LIMIT {
+				d.Removed = append(d.Removed, line)
+			}
+		}
+	}
+	for _, line := range b {
+		if count[line] < 0 {
+			count[line]++
+			d.AddedCount++
+			if len(d.Added) < TEXT_LINES_LIMIT {
+				d.Added = append(d.Added, line)
+			}
+		}
+	}
+	return d
+}
+
+func textureImages(w *wad.Wad, t *wad.Tag, tex *txr.Texture) (result []image.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	data, err := tex.Marshal(w.GetNodeResourceByTagId(t.Id))
+	if err != nil {
+		return nil, err
+	}
+	for _, img := range data.(*txr.Ajax).Images {
+		decoded, err := png.Decode(bytes.NewReader(img.Image))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, decoded)
+	}
+	return result, nil
+}
+
+func pixelsDiff(wa *wad.Wad, ta *wad.Tag, texA *txr.Texture, wb *wad.Wad, tb *wad.Tag, texB *txr.Texture) *PixelsDiff {
+	d := &PixelsDiff{}
+	imagesA, err := textureImages(wa, ta, texA)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	imagesB, err := textureImages(wb, tb, texB)
+	if err != nil {
+		d.Error = err.Error()
+		return d
+	}
+	d.ImagesA, d.ImagesB = len(imagesA), len(imagesB)
+
+	for i := 0; i < len(imagesA) && i < len(imagesB); i++ {
+		a, b := imagesA[i], imagesB[i]
+		if a.Bounds() != b.Bounds() {
+			d.ResolutionsDiff = true
+			d.ChangedImages++
+			continue
+		}
+
+		changed := 0
+		bounds := a.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r1, g1, b1, a1 := a.At(x, y).RGBA()
+				r2, g2, b2, a2 := b.At(x, y).RGBA()
+				if r1 != r2 || g1 != g2 || b1 != b2 || a1 != a2 {
+					changed++
+				}
+			}
+		}
+		if changed != 0 {
+			d.ChangedImages++
+			d.ChangedPixels += changed
+		}
+	}
+	return d
+}
+
+// CompareWads matches tags of wads by name and compares their data.
+// Changed resources which can be represented as text are compared line by line,
+// textures are compared by pixels (also when only used gfx or palette changed)
+func CompareWads(a, b *wad.Wad) *WadDiff {
+	d := &WadDiff{Tags: make([]TagDiff, 0)}
+
+	tagsA, keysA := tagsByKey(a)
+	tagsB, keysB := tagsByKey(b)
+
+	changedNames := make(map[string]bool)
+	for _, key := range keysA {
+		ta, tb := tagsA[key], tagsB[key]
+		if tb != nil && !bytes.Equal(ta.Data, tb.Data) {
+			changedNames[ta.Name] = true
+		}
+	}
+
+	for _, key := range keysA {
+		ta, tb := tagsA[key], tagsB[key]
+		if tb == nil {
+			d.Tags = append(d.Tags, TagDiff{Name: ta.Name, Tag: ta.Tag, State: STATE_REMOVED, SizeA: len(ta.Data)})
+			continue
+		}
+
+		td := TagDiff{Name: ta.Name, Tag: ta.Tag, State: STATE_CHANGED, SizeA: len(ta.Data), SizeB: len(tb.Data)}
+		changed := changedNames[ta.Name] || ta.Tag != tb.Tag
+
+		instA := instance(a, ta)
+		if texA, ok := instA.(*txr.Texture); ok {
+			dependencyChanged := false
+			for _, ref := range texA.References() {
+				dependencyChanged = dependencyChanged || changedNames[ref]
+			}
+			if texB, ok := instance(b, tb).(*txr.Texture); ok && (changed || dependencyChanged) {
+				td.Type = reflect.TypeOf(instA).String()
+				td.Pixels = pixelsDiff(a, ta, texA, b, tb, texB)
+				changed = changed || td.Pixels.ChangedImages != 0 || td.Pixels.ImagesA != td.Pixels.ImagesB || td.Pixels.Error != ""
+			}
+		} else if changed && instA != nil {
+			td.Type = reflect.TypeOf(instA).String()
+			if dumperA, ok := instA.(wad.TextDumper); ok {
+				if dumperB, ok := instance(b, tb).(wad.TextDumper); ok {
+					td.Text = textDiff(dumperA.DumpText(), dumperB.DumpText())
+				}
+			}
+		}
+
+		if !changed {
+			d.Same++
+			continue
+		}
+		td.DiffBytes, td.FirstDiff = bytesDiff(ta.Data, tb.Data)
+		d.Tags = append(d.Tags, td)
+	}
+
+	for _, key := range keysB {
+		if tb := tagsB[key]; tagsA[key] == nil {
+			d.Tags = append(d.Tags, TagDiff{Name: tb.Name, Tag: tb.Tag, State: STATE_ADDED, SizeB: len(tb.Data)})
+		}
+	}
+	return d
+}
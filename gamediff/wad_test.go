@@ -0,0 +1,32 @@
+package gamediff
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBytesDiff(t *testing.T) {
+	for _, c := range []struct {
+		a, b         []byte
+		count, first int
+	}{
+		{[]byte{1, 2, 3}, []byte{1, 2, 3}, 0, -1},
+		{[]byte{1, 2, 3}, []byte{1, 5, 6}, 2, 1},
+		{[]byte{1, 2}, []byte{1, 2, 3, 4}, 2, 2},
+		{[]byte{9, 2, 3}, []byte{1}, 3, 0},
+	} {
+		if count, first := bytesDiff(c.a, c.b); count != c.count || first != c.first {
+			t.Errorf("bytesDiff(%v, %v)=%d,%d; expected %d,%d", c.a, c.b, count, first, c.count, c.first)
+		}
+	}
+}
+
+func TestTextDiff(t *testing.T) {
+	d := textDiff([]string{"a", "b", "b", "c"}, []string{"b", "c", "d"})
+	if !reflect.DeepEqual(d.Removed, []string{"a", "b"}) || !reflect.DeepEqual(d.Added, []string{"d"}) {
+		t.Errorf("textDiff: removed %v, added %v", d.Removed, d.Added)
+	}
+	if d.RemovedCount != 2 || d.AddedCount != 1 {
+		t.Errorf("textDiff: removed count %d, added count %d", d.RemovedCount, d.AddedCount)
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/mogaika/god_of_war_browser/jobs"
+	"github.com/mogaika/god_of_war_browser/searchindex"
 	"github.com/mogaika/god_of_war_browser/status"
 
 	"github.com/mogaika/god_of_war_browser/config"
@@ -21,7 +23,7 @@ import (
 	_ "github.com/mogaika/god_of_war_browser/pack/txt"
 	_ "github.com/mogaika/god_of_war_browser/pack/vag"
 	_ "github.com/mogaika/god_of_war_browser/pack/vpk"
-	_ "github.com/mogaika/god_of_war_browser/pack/wad"
+	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
 
 	_ "github.com/mogaika/god_of_war_browser/pack/wad/anm"
 	_ "github.com/mogaika/god_of_war_browser/pack/wad/cam"
@@ -44,7 +46,7 @@ import (
 )
 
 func main() {
-	var addr, tocpath, dirpath, isopath, psarcpath, psversion, encoding string
+	var addr, tocpath, dirpath, isopath, psarcpath, psversion, encoding, searchindexpath, transplantarg, budgetarg, originalpath, diffarg, diffout, diffdir, patchdir string
 	var gowversion int
 	var parsecheck, listencodings bool
 	flag.StringVar(&addr, "i", ":8000", "Address of server")
@@ -57,6 +59,14 @@ func main() {
 	flag.BoolVar(&parsecheck, "parsecheck", false, "Check every file for parse errors (for devs)")
 	flag.BoolVar(&listencodings, "listencodings", false, "List text encodings")
 	flag.StringVar(&encoding, "encoding", "Windows 1252", "Select text encodings")
+	flag.StringVar(&transplantarg, "transplant", "", "Copy node with dependencies between wads and exit (SOURCE.WAD:NODE_NAME:TARGET.WAD)")
+	flag.StringVar(&budgetarg, "budget", "", "Print memory heaps usage of wad and exit")
+	flag.StringVar(&originalpath, "original", "", "Path to unmodified wads used as reference by memory budget estimation")
+	flag.StringVar(&diffarg, "diff", "", "Compare game with other source (iso:PATH, toc:PATH, dir:PATH, psarc:PATH) and exit")
+	flag.StringVar(&diffout, "diffout", "diff", "Report path for -diff, .json and .html files are written")
+	flag.StringVar(&diffdir, "diffdir", "", "Folder with game sources which can be compared by diff api (empty to disable)")
+	flag.StringVar(&patchdir, "patchdir", "", "Folder with original images and patched results of patch api (empty to disable)")
+	flag.StringVar(&searchindexpath, "searchindex", "", "Path to global search index file, enables background indexing of all wads")
 	flag.Parse()
 
 	var err error
@@ -132,10 +142,48 @@ func main() {
 		defer f.Close()
 	}
 
+	file_wad.SetGameDirectory(gameDir)
+
 	// parsecheck = true
 	if parsecheck {
-		parseCheck(gameDir)
+		if err := parseCheck(nil, gameDir); err != nil {
+			log.Fatalf("Parsecheck failed: %v", err)
+		}
+	}
+	if originalpath != "" {
+		setOriginalsDirectory(originalpath)
+	}
+	if budgetarg != "" {
+		if err := printBudget(gameDir, budgetarg); err != nil {
+			log.Fatalf("Budget failed: %v", err)
+		}
+		return
+	}
+	if diffarg != "" {
+		rootName := isopath + tocpath + dirpath + psarcpath
+		if err := diffSources(gameDir, rootName, diffarg, diffout); err != nil {
+			log.Fatalf("Diff failed: %v", err)
+		}
+		return
+	}
+	if transplantarg != "" {
+		if err := transplant(gameDir, transplantarg); err != nil {
+			log.Fatalf("Transplant failed: %v", err)
+		}
+		return
+	}
+	web.SetJobOperation("parsecheck", parseCheck)
+
+	if searchindexpath != "" {
+		if err := searchindex.Load(searchindexpath); err != nil {
+			log.Printf("Failed to load search index: %v", err)
+		}
+		jobs.Start("searchindex", func(j *jobs.Job) error {
+			return searchindex.Build(j, gameDir)
+		})
 	}
+	web.PatchDirectory = patchdir
+	web.DiffDirectory = diffdir
 	status.Info("Starting web server on address '%s'", addr)
 
 	if err := web.StartServer(addr, gameDir, driverDir, "web"); err != nil {
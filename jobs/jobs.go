@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mogaika/god_of_war_browser/status"
+)
+
+const (
+	STATE_RUNNING = iota
+	STATE_DONE
+	STATE_FAILED
+	STATE_CANCELLED
+)
+
+// how many finished jobs we keep in memory together with their artifacts
+const FINISHED_JOBS_LIMIT = 32
+
+type JobFunc func(j *Job) error
+
+type Info struct {
+	Id           int
+	Name         string
+	State        int
+	Progress     float32
+	Message      string
+	Error        string `json:",omitempty"`
+	Result       interface{}
+	ArtifactName string `json:",omitempty"`
+	Started      time.Time
+	Finished     time.Time
+}
+
+type Job struct {
+	lock      sync.Mutex
+	info      Info
+	cancelled bool
+	artifact  []byte
+}
+
+var globalLock sync.Mutex
+var jobsList []*Job
+var lastJobId int
+
+// Progress updates job progress and broadcasts it over status websocket.
+// Safe to call on nil job, so long operations can be used without job manager.
+func (j *Job) Progress(progress float32, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if j == nil {
+		status.Progress(progress, "%s", msg)
+		return
+	}
+
+	j.lock.Lock()
+	j.info.Progress = progress
+	j.info.Message = msg
+	id, name := j.info.Id, j.info.Name
+	j.lock.Unlock()
+
+	status.Progress(progress, "[job %d %s] %s", id, name, msg)
+}
+
+// Cancelled must be checked periodically by job function.
+// If it returns true, function should stop as soon as data is in consistent state
+func (j *Job) Cancelled() bool {
+	if j == nil {
+		return false
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.cancelled
+}
+
+func (j *Job) SetResult(result interface{}) {
+	if j == nil {
+		return
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.info.Result = result
+}
+
+func (j *Job) SetArtifact(name string, data []byte) {
+	if j == nil {
+		return
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.info.ArtifactName = name
+	j.artifact = data
+}
+
+func (j *Job) Artifact() (string, []byte) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.info.ArtifactName, j.artifact
+}
+
+func (j *Job) Info() Info {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.info
+}
+
+func (j *Job) Id() int {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	return j.info.Id
+}
+
+func (j *Job) run(f JobFunc) {
+	var err error
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}()
+		err = f(j)
+	}()
+
+	j.lock.Lock()
+	j.info.Finished = time.Now()
+	if j.cancelled {
+		j.info.State = STATE_CANCELLED
+	} else if err != nil {
+		j.info.State = STATE_FAILED
+		j.info.Error = err.Error()
+	} else {
+		j.info.State = STATE_DONE
+		j.info.Progress = 1
+	}
+	info := j.info
+	j.lock.Unlock()
+
+	switch info.State {
+	case STATE_DONE:
+		status.Info("[job %d %s] Done", info.Id, info.Name)
+	case STATE_CANCELLED:
+		status.Info("[job %d %s] Cancelled", info.Id, info.Name)
+	case STATE_FAILED:
+		log.Printf("[jobs] Job %d %q failed: %v", info.Id, info.Name, err)
+		status.Error("[job %d %s] Failed: %v", info.Id, info.Name, err)
+	}
+
+	cleanupFinished()
+}
+
+// Start runs f in background and returns created job
+func Start(name string, f JobFunc) *Job {
+	globalLock.Lock()
+	lastJobId++
+	j := &Job{info: Info{
+		Id:      lastJobId,
+		Name:    name,
+		State:   STATE_RUNNING,
+		Started: time.Now(),
+	}}
+	jobsList = append(jobsList, j)
+	globalLock.Unlock()
+
+	log.Printf("[jobs] Starting job %d %q", j.info.Id, name)
+	go j.run(f)
+	return j
+}
+
+func cleanupFinished() {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+
+	finished := 0
+	for _, j := range jobsList {
+		if j.Info().State != STATE_RUNNING {
+			finished++
+		}
+	}
+
+	result := jobsList[:0]
+	for _, j := range jobsList {
+		if finished > FINISHED_JOBS_LIMIT && j.Info().State != STATE_RUNNING {
+			finished--
+			continue
+		}
+		result = append(result, j)
+	}
+	jobsList = result
+}
+
+func Get(id int) *Job {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	for _, j := range jobsList {
+		if j.Id() == id {
+			return j
+		}
+	}
+	return nil
+}
+
+func List() []Info {
+	globalLock.Lock()
+	defer globalLock.Unlock()
+	result := make([]Info, len(jobsList))
+	for i, j := range jobsList {
+		result[i] = j.Info()
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id > result[j].Id })
+	return result
+}
+
+func Cancel(id int) error {
+	j := Get(id)
+	if j == nil {
+		return fmt.Errorf("[jobs] Cannot find job %d", id)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.info.State != STATE_RUNNING {
+		return fmt.Errorf("[jobs] Job %d is not running", id)
+	}
+	j.cancelled = true
+	return nil
+}
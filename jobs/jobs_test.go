@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func waitFinished(t *testing.T, j *Job) Info {
+	for i := 0; i < 500; i++ {
+		if info := j.Info(); info.State != STATE_RUNNING {
+			return info
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Job %d is not finished", j.Id())
+	return Info{}
+}
+
+func TestJobProgressAndResult(t *testing.T) {
+	step := make(chan bool)
+	j := Start("progress", func(j *Job) error {
+		j.Progress(0.5, "file %d", 3)
+		step <- true
+		<-step
+		j.SetResult(42)
+		j.SetArtifact("a.bin", []byte{1})
+		return nil
+	})
+
+	<-step
+	if info := j.Info(); info.State != STATE_RUNNING || info.Progress != 0.5 || info.Message != "file 3" {
+		t.Errorf("Wrong info of running job %+v", info)
+	}
+	step <- true
+
+	info := waitFinished(t, j)
+	if info.State != STATE_DONE || info.Progress != 1 || info.Result != 42 || info.ArtifactName != "a.bin" {
+		t.Errorf("Wrong info of finished job %+v", info)
+	}
+	if Get(j.Id()) != j {
+		t.Errorf("Get(%d) returned other job", j.Id())
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	started := make(chan bool)
+	j := Start("cancel", func(j *Job) error {
+		started <- true
+		for !j.Cancelled() {
+			time.Sleep(time.Millisecond)
+		}
+		// error of cancelled job is not failure
+		return fmt.Errorf("stopped")
+	})
+
+	<-started
+	if err := Cancel(j.Id()); err != nil {
+		t.Fatal(err)
+	}
+	if info := waitFinished(t, j); info.State != STATE_CANCELLED || info.Error != "" {
+		t.Errorf("Wrong info of cancelled job %+v", info)
+	}
+	if err := Cancel(j.Id()); err == nil {
+		t.Errorf("Cancel of finished job returned nil")
+	}
+	if err := Cancel(-1); err == nil {
+		t.Errorf("Cancel of unknown job returned nil")
+	}
+}
+
+func TestJobFailure(t *testing.T) {
+	j := Start("fail", func(j *Job) error {
+		panic("broken")
+	})
+	if info := waitFinished(t, j); info.State != STATE_FAILED || info.Error != "panic: broken" {
+		t.Errorf("Wrong info of failed job %+v", info)
+	}
+}
+
+func TestNilJob(t *testing.T) {
+	var j *Job
+	j.Progress(0.1, "without job manager")
+	j.SetResult(1)
+	j.SetArtifact("a", nil)
+	if j.Cancelled() {
+		t.Errorf("Nil job is cancelled")
+	}
+}
@@ -41,6 +41,11 @@ func (s *PackResSrc) Size() int64 {
 	return s.pf.Size()
 }
 
+// Directory returns directory file was opened from
+func (s *PackResSrc) Directory() vfs.Directory {
+	return s.d
+}
+
 func (s *PackResSrc) Save(in *io.SectionReader) error {
 	if f, err := vfs.DirectoryGetFile(s.d, s.pf.Name()); err != nil {
 		return fmt.Errorf("[pack] Cannot get file '%s': %v", s.pf.Name(), err)
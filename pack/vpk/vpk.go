@@ -2,98 +2,177 @@ package vpk
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"log"
 
 	"github.com/mogaika/god_of_war_browser/pack"
 	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
 	"github.com/mogaika/god_of_war_browser/utils"
 )
 
+const (
+	VPK_MAGIC       = " KPV"
+	VPK_HEADER_SIZE = 0x20
+
+	VPK_DEFAULT_START      = utils.SECTOR_SIZE
+	VPK_DEFAULT_INTERLEAVE = 0x1000
+	VPK_MAX_CHANNELS       = 8
+)
+
+// adpcm block used to fill space to end of interleave block, skipped by decoder
+var vpkFillBlock = [adpcm.BLOCK_SIZE]byte{0xc0}
+
 type VPK struct {
 	SampleRate uint32
 	Channels   uint32
 	DataSize   uint32 // of one channel
+	DataStart  uint32
+	Interleave uint32 // bytes of one channel before next channel data
 }
 
 func NewVPKFromReader(r io.ReaderAt) (*VPK, error) {
-	var header [0x20]byte
+	var header [VPK_HEADER_SIZE]byte
 	if _, err := r.ReadAt(header[:], 0); err != nil {
 		return nil, err
 	}
 
+	if string(header[:4]) != VPK_MAGIC {
+		log.Printf("[vpk] Unexpected magic %q", header[:4])
+	}
+
 	vpk := &VPK{
 		DataSize:   binary.LittleEndian.Uint32(header[0x4:0x8]),
+		DataStart:  binary.LittleEndian.Uint32(header[0x8:0xc]),
+		Interleave: binary.LittleEndian.Uint32(header[0xc:0x10]) / 2,
 		SampleRate: binary.LittleEndian.Uint32(header[0x10:0x14]),
-		Channels:   binary.LittleEndian.Uint32(header[0x14:0x18]), // probably incorrect
+		Channels:   binary.LittleEndian.Uint32(header[0x14:0x18]),
+	}
+	if vpk.DataStart == 0 {
+		vpk.DataStart = VPK_DEFAULT_START
+	}
+	if vpk.Interleave == 0 {
+		vpk.Interleave = VPK_DEFAULT_INTERLEAVE
+	}
+
+	if vpk.Channels == 0 || vpk.Channels > VPK_MAX_CHANNELS {
+		return nil, fmt.Errorf("[vpk] Invalid channels count %d", vpk.Channels)
+	}
+	if vpk.SampleRate == 0 {
+		return nil, fmt.Errorf("[vpk] Invalid sample rate 0")
+	}
+	if vpk.Interleave%adpcm.BLOCK_SIZE != 0 {
+		return nil, fmt.Errorf("[vpk] Invalid interleave 0x%x", vpk.Interleave)
 	}
 
 	return vpk, nil
 }
 
 func (vpk *VPK) AsWave(r io.Reader, w io.Writer) (int, error) {
-	if vpk.Channels > 4 {
-		panic(vpk.Channels)
-	}
-
-	var inBlockSize = 0x1000 * vpk.Channels
+	interleave := int(vpk.Interleave)
+	channels := int(vpk.Channels)
 
-	var in = make([]byte, inBlockSize)
-	var out = make([]byte, adpcm.AdpcmSizeToWaveSize(int(inBlockSize)))
+	var in = make([]byte, interleave*channels)
+	var out = make([]byte, adpcm.AdpcmSizeToWaveSize(len(in)))
 
-	// skip first sector
-	if _, err := r.Read(in[:utils.SECTOR_SIZE]); err != nil {
+	// skip header
+	if _, err := io.CopyN(ioutil.Discard, r, int64(vpk.DataStart)); err != nil {
 		return 0, err
 	}
 
-	var adpcmStream = make([]*adpcm.AdpcmStream, vpk.Channels)
+	var adpcmStream = make([]*adpcm.AdpcmStream, channels)
 	for i := range adpcmStream {
 		adpcmStream[i] = adpcm.NewAdpcmStream()
 	}
 
-	if err := utils.WaveWriteHeader(w, uint16(vpk.Channels), vpk.SampleRate, uint32(adpcm.AdpcmSizeToWaveSize(int(vpk.DataSize))*2)); err != nil {
+	// fill blocks are included into data size, so size of wav can be less than written to header
+	if err := utils.WaveWriteHeader(w, uint16(channels), vpk.SampleRate, uint32(adpcm.AdpcmSizeToWaveSize(int(vpk.DataSize))*channels)); err != nil {
 		return 0, err
 	}
 
 	inLeft := int(vpk.DataSize)
 	n := 0
 	for inLeft > 0 {
-		_, err := r.Read(in)
-		if err != nil {
-			return 0, err
+		if _, err := io.ReadFull(r, in); err != nil && err != io.ErrUnexpectedEOF {
+			return n, err
 		}
 
-		datalen := 0x1000
-		if inLeft < 0x1000 {
+		datalen := interleave
+		if inLeft < interleave {
 			datalen = inLeft
 		}
 
+		outlen := 0
 		for i, s := range adpcmStream {
-			buf, err := s.Unpack(in[i*0x1000 : i*0x1000+datalen])
+			buf, err := s.Unpack(in[i*interleave : i*interleave+datalen])
 			if err != nil {
-				return 0, err
+				return n, err
 			}
 
 			for k := 0; k < len(buf)/2; k++ {
-				j := uint32(k * 2) // 16bit
-				outchpos := j*vpk.Channels + uint32(i*2)
-				out[outchpos] = buf[j]
-				out[outchpos+1] = buf[j+1]
+				outchpos := (k*channels + i) * 2
+				out[outchpos] = buf[k*2]
+				out[outchpos+1] = buf[k*2+1]
 			}
-
+			outlen = len(buf) * channels
 		}
 
-		if wn, err := w.Write(out); err != nil {
+		if wn, err := w.Write(out[:outlen]); err != nil {
 			return n, err
 		} else {
 			n += wn
 		}
 
-		inLeft -= 0x1000
+		inLeft -= interleave
 	}
 
 	return n, nil
 }
 
+// EncodeWave writes vpk stream of wave, channels interleaved by default interleave size
+func EncodeWave(wav *utils.Wave, w io.Writer) (*VPK, error) {
+	if wav.Channels == 0 || wav.Channels > VPK_MAX_CHANNELS {
+		return nil, fmt.Errorf("[vpk] Unsupported channels count %d", wav.Channels)
+	}
+
+	vpk := &VPK{
+		SampleRate: wav.SampleRate,
+		Channels:   uint32(wav.Channels),
+		DataStart:  VPK_DEFAULT_START,
+		Interleave: VPK_DEFAULT_INTERLEAVE,
+	}
+
+	streams := make([][]byte, wav.Channels)
+	for i := range streams {
+		streams[i] = adpcm.NewAdpcmEncoder().Pack(wav.Samples[i])
+		for len(streams[i])%int(vpk.Interleave) != 0 {
+			streams[i] = append(streams[i], vpkFillBlock[:]...)
+		}
+	}
+	vpk.DataSize = uint32(len(streams[0]))
+
+	header := make([]byte, vpk.DataStart)
+	copy(header, VPK_MAGIC)
+	binary.LittleEndian.PutUint32(header[0x4:], vpk.DataSize)
+	binary.LittleEndian.PutUint32(header[0x8:], vpk.DataStart)
+	binary.LittleEndian.PutUint32(header[0xc:], vpk.Interleave*2)
+	binary.LittleEndian.PutUint32(header[0x10:], vpk.SampleRate)
+	binary.LittleEndian.PutUint32(header[0x14:], vpk.Channels)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	for pos := 0; pos < len(streams[0]); pos += int(vpk.Interleave) {
+		for _, stream := range streams {
+			if _, err := w.Write(stream[pos : pos+int(vpk.Interleave)]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return vpk, nil
+}
+
 func init() {
 	h := func(p utils.ResourceSource, r *io.SectionReader) (interface{}, error) {
 		return NewVPKFromReader(r)
@@ -0,0 +1,49 @@
+package vpk
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	const channels = 6
+	wav := &utils.Wave{Channels: channels, SampleRate: 48000, LoopStart: -1, Samples: make([][]int16, channels)}
+	for ch := range wav.Samples {
+		wav.Samples[ch] = make([]int16, 10000)
+		for i := range wav.Samples[ch] {
+			wav.Samples[ch][i] = int16(ch * 1000)
+		}
+	}
+
+	var buf bytes.Buffer
+	if _, err := EncodeWave(wav, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	vpk, err := NewVPKFromReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vpk.Channels != channels || vpk.SampleRate != 48000 || vpk.Interleave != VPK_DEFAULT_INTERLEAVE {
+		t.Fatalf("Wrong header %+v", vpk)
+	}
+
+	var out bytes.Buffer
+	if _, err := vpk.AsWave(bytes.NewReader(buf.Bytes()), &out); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := utils.WaveRead(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SamplesCount() < 10000 {
+		t.Fatalf("Decoded only %d samples", decoded.SamplesCount())
+	}
+	for ch := range decoded.Samples {
+		if v := int(decoded.Samples[ch][5000]); v-ch*1000 > 50 || ch*1000-v > 50 {
+			t.Errorf("Channel %d decoded as %d", ch, v)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package wad
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/status"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+// HeapUsage describes memory heap of wad. Heap is declared by entity count tag,
+// all following tags up to next entity count or header pop tag are loaded into it
+type HeapUsage struct {
+	Name      string
+	TagId     TagId
+	Namespace string // name of header start tag which heap belongs to
+	Declared  uint32 // heap size stored in entity count tag
+	Used      uint32 // size of tags loaded into heap
+	Tags      int
+}
+
+type HeapBudget struct {
+	HeapUsage
+	Original *HeapUsage `json:",omitempty"` // same heap of original wad
+	Limit    uint32     `json:",omitempty"`
+}
+
+type Budget struct {
+	Wad          string
+	Original     string // source of original sizes
+	Heaps        []HeapBudget
+	Size         uint32
+	OriginalSize uint32
+	Limit        uint32 `json:",omitempty"`
+	Warnings     []string
+}
+
+// OriginalLoader returns unmodified version of wad
+type OriginalLoader func(name string) (*Wad, error)
+
+var gOriginalLoader OriginalLoader
+
+// SetOriginalLoader sets source of unmodified wads used as reference by budget
+// estimation. Without it sizes of wad at first opening in this session are used
+func SetOriginalLoader(ldr OriginalLoader) {
+	gOriginalLoader = ldr
+}
+
+var gBaselinesLock sync.Mutex
+var gBaselines = make(map[string][]HeapUsage)
+
+// directorySource is implemented by sources of wads opened from directory
+type directorySource interface {
+	Directory() vfs.Directory
+}
+
+var gGameDirectory vfs.Directory
+
+// SetGameDirectory sets directory of game. Baselines are kept only for wads
+// of it, so wads with same names from other sources (diff, originals) do not
+// replace them
+func SetGameDirectory(d vfs.Directory) {
+	gGameDirectory = d
+}
+
+// hasBaseline reports if baseline of wad is kept. Wads not opened from
+// directory (created in memory) have it too
+func (w *Wad) hasBaseline() bool {
+	if src, ok := w.Source.(directorySource); ok && gGameDirectory != nil {
+		return src.Directory() == gGameDirectory
+	}
+	return true
+}
+
+// recordBaseline remembers heaps of wad at first opening, or before first
+// modification of wad not loaded from file. Wads are reopened on every
+// request, so baseline is kept by name
+func (w *Wad) recordBaseline() {
+	if !w.hasBaseline() {
+		return
+	}
+	gBaselinesLock.Lock()
+	defer gBaselinesLock.Unlock()
+	if _, ok := gBaselines[w.Name()]; !ok {
+		gBaselines[w.Name()] = heapsUsage(w.Tags, w.HeapSizes)
+	}
+}
+
+func tagWadSize(t *Tag) uint32 {
+	return uint32(WAD_ITEM_SIZE + alignToWadTag(len(t.Data)))
+}
+
+func heapsUsage(tags []Tag, heapSizes map[string]uint32) []HeapUsage {
+	heaps := make([]HeapUsage, 0)
+	if v := config.GetGOWVersion(); v != config.GOW1 && v != config.GOW2 {
+		return heaps
+	}
+	namespaces := make([]string, 0)
+	current := -1
+
+	for i := range tags {
+		t := &tags[i]
+		switch {
+		case t.Tag == GetHeaderStartTag():
+			namespaces = append(namespaces, t.Name)
+			current = -1
+		case t.Tag == GetHeaderPopTag():
+			if len(namespaces) != 0 {
+				namespaces = namespaces[:len(namespaces)-1]
+			}
+			current = -1
+		case t.Tag == GetEntityCountTag() && isZeroSizedTag(t):
+			h := HeapUsage{Name: t.Name, TagId: TagId(i), Declared: heapSizes[t.Name]}
+			if len(namespaces) != 0 {
+				h.Namespace = namespaces[len(namespaces)-1]
+			}
+			heaps = append(heaps, h)
+			current = len(heaps) - 1
+		}
+
+		if current != -1 {
+			heaps[current].Used += tagWadSize(t)
+			heaps[current].Tags++
+		}
+	}
+	return heaps
+}
+
+func (w *Wad) originalHeaps() ([]HeapUsage, string) {
+	if gOriginalLoader != nil {
+		if orig, err := gOriginalLoader(w.Name()); err != nil {
+			log.Printf("[wad] Cannot load original of %s: %v", w.Name(), err)
+		} else {
+			return heapsUsage(orig.Tags, orig.HeapSizes), "original wad"
+		}
+	}
+
+	gBaselinesLock.Lock()
+	defer gBaselinesLock.Unlock()
+	if heaps, ok := gBaselines[w.Name()]; ok && w.hasBaseline() {
+		return heaps, "first opening in this session"
+	}
+	return heapsUsage(w.Tags, w.HeapSizes), "current wad file"
+}
+
+// EstimateBudget calculates heaps usage of tags and compares it with original wad
+// and limits from config.
+// Heap growth which is not followed by growth of declared heap size is reported
+func (w *Wad) EstimateBudget(tags []Tag) *Budget {
+	b := &Budget{Wad: w.Name(), Heaps: make([]HeapBudget, 0), Warnings: make([]string, 0)}
+
+	limits, err := config.GetHeapLimits()
+	if err != nil {
+		b.Warnings = append(b.Warnings, err.Error())
+	}
+	b.Limit = limits.Total
+
+	original, source := w.originalHeaps()
+	b.Original = source
+	originalByName := make(map[string]*HeapUsage)
+	for i := range original {
+		originalByName[original[i].Name] = &original[i]
+		b.OriginalSize += original[i].Used
+	}
+
+	for _, h := range heapsUsage(tags, w.HeapSizes) {
+		hb := HeapBudget{HeapUsage: h, Original: originalByName[h.Name], Limit: limits.Heaps[h.Name]}
+		b.Size += h.Used
+
+		if hb.Original != nil {
+			grow := int64(h.Used) - int64(hb.Original.Used)
+			declaredGrow := int64(h.Declared) - int64(hb.Original.Declared)
+			if grow > declaredGrow {
+				b.Warnings = append(b.Warnings, fmt.Sprintf(
+					"Heap '%s' grew by %d bytes, but declared size grew only by %d bytes", h.Name, grow, declaredGrow))
+			}
+		} else if h.Used > h.Declared {
+			b.Warnings = append(b.Warnings, fmt.Sprintf(
+				"Heap '%s' uses %d bytes, but declared size is %d bytes", h.Name, h.Used, h.Declared))
+		}
+		if hb.Limit != 0 && (h.Used > hb.Limit || h.Declared > hb.Limit) {
+			b.Warnings = append(b.Warnings, fmt.Sprintf(
+				"Heap '%s' (used %d, declared %d bytes) exceeds limit of %d bytes", h.Name, h.Used, h.Declared, hb.Limit))
+		}
+		b.Heaps = append(b.Heaps, hb)
+	}
+
+	if b.Limit != 0 && b.Size > b.Limit {
+		b.Warnings = append(b.Warnings, fmt.Sprintf(
+			"Wad data size %d bytes exceeds limit of %d bytes", b.Size, b.Limit))
+	}
+	return b
+}
+
+// Budget estimates current state of wad
+func (w *Wad) Budget() *Budget {
+	return w.EstimateBudget(w.Tags)
+}
+
+func (w *Wad) warnBudget(tags []Tag) {
+	for _, warn := range w.EstimateBudget(tags).Warnings {
+		log.Printf("[wad] Budget warning for %s: %s", w.Name(), warn)
+		status.Error("Budget warning for '%s': %s", w.Name(), warn)
+	}
+}
@@ -0,0 +1,85 @@
+package wad
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+// testWadFile marshals tags same way as Save, heap sizes are stored in entity count tags
+func testWadFile(tags []Tag, heapSizes map[string]uint32) []byte {
+	var buf bytes.Buffer
+	for _, t := range tags {
+		t.Size = uint32(len(t.Data))
+		if isZeroSizedTag(&t) {
+			t.Size = heapSizes[t.Name]
+		}
+		buf.Write(MarshalTag(&t))
+		buf.Write(t.Data)
+		buf.Write(make([]byte, alignToWadTag(buf.Len())-buf.Len()))
+	}
+	return buf.Bytes()
+}
+
+func TestBudgetFirstUpdateWarns(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+
+	tags := []Tag{
+		{Tag: TAG_GOW1_ENTITY_COUNT, Name: "heap"},
+		testResourceTag("TXR_a", testKindDependent),
+	}
+	// heap holds exactly entity count tag and texture
+	heapSizes := map[string]uint32{"heap": 2*WAD_ITEM_SIZE + 0x10}
+	data := testWadFile(tags, heapSizes)
+
+	w, err := NewWad(bytes.NewReader(data), &testSource{name: "BUDGET.WAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warns := w.Budget().Warnings; len(warns) != 0 {
+		t.Fatalf("Unexpected warnings of loaded wad: %v", warns)
+	}
+
+	newData := append(append([]byte{}, w.Tags[1].Data...), make([]byte, 0x100)...)
+	if err := w.UpdateTagsData(map[TagId][]byte{1: newData}); err != nil {
+		t.Fatal(err)
+	}
+	if warns := w.Budget().Warnings; len(warns) != 1 {
+		t.Errorf("Expected heap growth warning after first oversized update, got %v", warns)
+	}
+}
+
+type testDirectorySource struct {
+	testSource
+	dir vfs.Directory
+}
+
+func (s *testDirectorySource) Directory() vfs.Directory { return s.dir }
+
+func TestBudgetBaselineOfOtherDirectory(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+	game, other := vfs.NewDirectoryDriver("game"), vfs.NewDirectoryDriver("other")
+	SetGameDirectory(game)
+	defer SetGameDirectory(nil)
+
+	heapSizes := map[string]uint32{"heap": 0x100}
+	small := testWadFile([]Tag{{Tag: TAG_GOW1_ENTITY_COUNT, Name: "heap"}}, heapSizes)
+	big := testWadFile([]Tag{
+		{Tag: TAG_GOW1_ENTITY_COUNT, Name: "heap"},
+		testResourceTag("TXR_a", testKindDependent),
+	}, heapSizes)
+
+	// wad with same name from other source is opened first
+	if _, err := NewWad(bytes.NewReader(small), &testDirectorySource{testSource{name: "OTHER_DIR.WAD"}, other}); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWad(bytes.NewReader(big), &testDirectorySource{testSource{name: "OTHER_DIR.WAD"}, game})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := w.Budget(); b.OriginalSize != b.Size {
+		t.Errorf("Baseline of game wad is taken from other source: size %d, original %d", b.Size, b.OriginalSize)
+	}
+}
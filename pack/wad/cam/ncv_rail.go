@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 
 	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
 
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -14,12 +15,20 @@ type Rail struct {
 	Floats   []float32
 }
 
+var Layout = structlayout.Register(structlayout.New("gow_cam_rail", "God of War PS2 camera rail (tag 112)", 0,
+	structlayout.Field{Name: "count", Offset: 0x00, Kind: structlayout.U32},
+	structlayout.Field{Name: "unk04", Offset: 0x04, Kind: structlayout.U32, Doc: "always 0"},
+	structlayout.Field{Name: "matrices", Offset: 0x08, Kind: structlayout.F32, Count: 16, CountField: "count",
+		Doc: "4x4 matrices, first 8 bytes are always 0xffffffff"},
+	structlayout.Field{Name: "floats", Offset: structlayout.OFFSET_FOLLOWING, Kind: structlayout.F32, CountField: "count"},
+))
+
 func (r *Rail) FromData(data []byte) error {
-	count := binary.LittleEndian.Uint32(data[0:])
+	count := Layout.Field("count").U32(data)
 	r.Matrices = make([]mgl32.Mat4, count)
 	r.Floats = make([]float32, count)
 
-	unk04 := binary.LittleEndian.Uint32(data[4:])
+	unk04 := Layout.Field("unk04").U32(data)
 	unk08 := binary.LittleEndian.Uint32(data[8:])
 	unk0c := binary.LittleEndian.Uint32(data[0xc:])
 	if unk04 != 0 || unk08 != 0xffff_ffff || unk0c != 0xffff_ffff {
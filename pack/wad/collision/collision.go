@@ -137,7 +137,7 @@ func init() {
 
 		// f := ioutil.Discard
 
-		bs := utils.NewBufStack("collision", wrsrc.Tag.Data)
+		bs := wrsrc.NewBufStack("collision")
 
 		return NewFromData(bs, f)
 	})
@@ -2,6 +2,7 @@ package cxt
 
 import (
 	"bytes"
+	"fmt"
 	"log"
 	"net/http"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/mogaika/fbx/builders/bfbx73"
 
+	"github.com/mogaika/god_of_war_browser/jobs"
 	"github.com/mogaika/god_of_war_browser/pack/wad"
 	"github.com/mogaika/god_of_war_browser/utils/fbxbuilder"
 	"github.com/mogaika/god_of_war_browser/utils/gltfutils"
@@ -27,28 +29,38 @@ func (cxt *Chunk) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *h
 			}
 		}
 	case "gltf_all":
-		gltfCacher := gltfutils.NewCacher()
-		doc := gltfCacher.Doc
+		wad := wrsrc.Wad
+		j := jobs.Start("gltf_all "+wad.Name(), func(j *jobs.Job) error {
+			gltfCacher := gltfutils.NewCacher()
+			doc := gltfCacher.Doc
 
-		for _, node := range wrsrc.Wad.Nodes {
-			if !strings.HasPrefix(node.Tag.Name, "CXT_") {
-				continue
-			}
-			inst, _, err := wrsrc.Wad.GetInstanceFromNode(node.Id)
-			if err != nil {
-				log.Panicf("Failed to load cxt %s: %v", node.Tag.Name, err)
-			}
+			for iNode, node := range wad.Nodes {
+				if j.Cancelled() {
+					return nil
+				}
+				if !strings.HasPrefix(node.Tag.Name, "CXT_") {
+					continue
+				}
+				j.Progress(float32(iNode)/float32(len(wad.Nodes)), "Exporting %s", node.Tag.Name)
+				inst, _, err := wad.GetInstanceFromNode(node.Id)
+				if err != nil {
+					return fmt.Errorf("Failed to load cxt %s: %v", node.Tag.Name, err)
+				}
 
-			_, err = inst.(*Chunk).ExportGLTF(wrsrc.Wad.GetNodeResourceByNodeId(node.Id), gltfCacher)
-			if err != nil {
-				log.Panicf("Failed to encode %q: %v", node.Tag.Name, err)
+				_, err = inst.(*Chunk).ExportGLTF(wad.GetNodeResourceByNodeId(node.Id), gltfCacher)
+				if err != nil {
+					return fmt.Errorf("Failed to encode %q: %v", node.Tag.Name, err)
+				}
 			}
-		}
 
-		webutils.WriteFileHeaders(w, wrsrc.Wad.Name()+".glb")
-		if err := gltfutils.ExportBinary(w, doc); err != nil {
-			log.Printf("Failed to encode gltf: %v", err)
-		}
+			var buf bytes.Buffer
+			if err := gltfutils.ExportBinary(&buf, doc); err != nil {
+				return fmt.Errorf("Failed to encode gltf: %v", err)
+			}
+			j.SetArtifact(wad.Name()+".glb", buf.Bytes())
+			return nil
+		})
+		webutils.WriteJson(w, j.Info())
 	case "fbx":
 		var buf bytes.Buffer
 		// Export zip
@@ -56,24 +68,34 @@ func (cxt *Chunk) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *h
 		// log.Printf("Error when exporting cxt: %v", cxt.ExportFbxDefault(wrsrc).Export(&buf))
 		webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), wrsrc.Tag.Name+".zip")
 	case "fbx_all":
-		f := fbxbuilder.NewFBXBuilder(filepath.Join(wrsrc.Wad.Name(), wrsrc.Name()))
+		wad := wrsrc.Wad
+		j := jobs.Start("fbx_all "+wad.Name(), func(j *jobs.Job) error {
+			f := fbxbuilder.NewFBXBuilder(filepath.Join(wad.Name(), wrsrc.Name()))
 
-		for _, node := range wrsrc.Wad.Nodes {
-			if !strings.HasPrefix(node.Tag.Name, "CXT_") {
-				continue
-			}
-			inst, _, err := wrsrc.Wad.GetInstanceFromNode(node.Id)
-			if err != nil {
-				log.Panicf("Can't load cxt %s: %v", node.Tag.Name, err)
-			}
+			for iNode, node := range wad.Nodes {
+				if j.Cancelled() {
+					return nil
+				}
+				if !strings.HasPrefix(node.Tag.Name, "CXT_") {
+					continue
+				}
+				j.Progress(float32(iNode)/float32(len(wad.Nodes)), "Exporting %s", node.Tag.Name)
+				inst, _, err := wad.GetInstanceFromNode(node.Id)
+				if err != nil {
+					return fmt.Errorf("Can't load cxt %s: %v", node.Tag.Name, err)
+				}
 
-			fe := inst.(*Chunk).ExportFbx(wrsrc.Wad.GetNodeResourceByNodeId(node.Id), f)
-			f.AddConnections(bfbx73.C("OO", fe.FbxModelId, 0))
-		}
+				fe := inst.(*Chunk).ExportFbx(wad.GetNodeResourceByNodeId(node.Id), f)
+				f.AddConnections(bfbx73.C("OO", fe.FbxModelId, 0))
+			}
 
-		var buf bytes.Buffer
-		// Export zip
-		log.Printf("Error when exporting wad(cxt array): %v", f.WriteZip(&buf, wrsrc.Wad.Name()+".fbx"))
-		webutils.WriteFile(w, bytes.NewReader(buf.Bytes()), wrsrc.Wad.Name()+".zip")
+			var buf bytes.Buffer
+			if err := f.WriteZip(&buf, wad.Name()+".fbx"); err != nil {
+				return fmt.Errorf("Error when exporting wad(cxt array): %v", err)
+			}
+			j.SetArtifact(wad.Name()+".zip", buf.Bytes())
+			return nil
+		})
+		webutils.WriteJson(w, j.Info())
 	}
 }
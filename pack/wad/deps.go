@@ -0,0 +1,245 @@
+package wad
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+const (
+	DEPENDENCY_GROUP = "group" // resource contains other node inside its group
+	DEPENDENCY_NAME  = "name"  // resource refers other node by name
+)
+
+type DependencyNode struct {
+	TagId    TagId
+	Tag      uint16
+	Name     string
+	Root     bool   // node is not inside group, so it can be found by name
+	ServerId uint32 `json:",omitempty"`
+	Type     string `json:",omitempty"` // type of parsed resource
+}
+
+type Dependency struct {
+	From TagId
+	To   TagId
+	Kind string
+}
+
+type ExternalDependency struct {
+	From TagId
+	Wad  string
+	To   TagId
+	Name string
+}
+
+type UnresolvedReference struct {
+	From TagId
+	Name string
+}
+
+// ParseFailure is node which resource can't be parsed, so its references are unknown
+type ParseFailure struct {
+	TagId TagId
+	Name  string
+	Error string
+}
+
+type DependencyGraph struct {
+	Wad        string
+	Nodes      []DependencyNode
+	Edges      []Dependency
+	External   []ExternalDependency  `json:",omitempty"`
+	Unresolved []UnresolvedReference `json:",omitempty"`
+	Wads       []string              `json:",omitempty"` // wads required by RSRCS-like resources
+	Failed     []ParseFailure        `json:",omitempty"`
+}
+
+// nodeInstance returns parsed resource of node. Error is returned for server
+// instances which have data but can't be parsed or have no handler
+func (w *Wad) nodeInstance(n *Node) (inst File, serverId uint32, err error) {
+	if len(n.Tag.Data) == 0 {
+		return nil, 0, nil
+	}
+	if h, _ := findHandler(n); h == nil && n.Tag.Tag != GetServerInstanceTag() {
+		return nil, 0, nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[wad] Panic when parsing %s:%s for dependencies: %v", w.Name(), n.Tag.Name, r)
+			inst, err = nil, fmt.Errorf("Panic: %v", r)
+		}
+	}()
+	return w.GetInstanceFromNode(n.Id)
+}
+
+// Dependencies parses every node of wad and collects references between them
+func (w *Wad) Dependencies() *DependencyGraph {
+	g := &DependencyGraph{
+		Wad:        w.Name(),
+		Nodes:      make([]DependencyNode, 0, len(w.Nodes)),
+		Edges:      make([]Dependency, 0),
+		External:   make([]ExternalDependency, 0),
+		Unresolved: make([]UnresolvedReference, 0),
+		Wads:       make([]string, 0),
+		Failed:     make([]ParseFailure, 0),
+	}
+
+	for _, n := range w.Nodes {
+		dn := DependencyNode{
+			TagId: n.Tag.Id,
+			Tag:   n.Tag.Tag,
+			Name:  n.Tag.Name,
+			Root:  n.Parent == NODE_INVALID,
+		}
+
+		if linked := w.GetNodeById(n.Id); linked != n {
+			// zero sized server instance refers previous node with same name
+			g.Edges = append(g.Edges, Dependency{From: n.Tag.Id, To: linked.Tag.Id, Kind: DEPENDENCY_NAME})
+		}
+		for _, subId := range n.SubGroupNodes {
+			g.Edges = append(g.Edges, Dependency{From: n.Tag.Id, To: w.GetNodeById(subId).Tag.Id, Kind: DEPENDENCY_GROUP})
+		}
+
+		inst, serverId, err := w.nodeInstance(n)
+		dn.ServerId = serverId
+		if err != nil {
+			g.Failed = append(g.Failed, ParseFailure{TagId: n.Tag.Id, Name: n.Tag.Name, Error: err.Error()})
+		}
+		if inst != nil {
+			dn.Type = reflect.TypeOf(inst).String()
+
+			if r, ok := inst.(Referencer); ok {
+				for _, name := range r.References() {
+					if name == "" {
+						continue
+					}
+					// search starts before node, same way as parsers do
+					if ref := w.GetNodeByName(name, n.Id-1, false); ref != nil {
+						g.Edges = append(g.Edges, Dependency{From: n.Tag.Id, To: ref.Tag.Id, Kind: DEPENDENCY_NAME})
+					} else {
+						g.Unresolved = append(g.Unresolved, UnresolvedReference{From: n.Tag.Id, Name: name})
+					}
+				}
+			}
+			if r, ok := inst.(WadReferencer); ok {
+				for _, name := range r.WadReferences() {
+					if name != "" {
+						g.Wads = append(g.Wads, name)
+					}
+				}
+			}
+		}
+		g.Nodes = append(g.Nodes, dn)
+	}
+	return g
+}
+
+// rootNames returns nodes which can be found by other wads
+func (g *DependencyGraph) rootNames() map[string]TagId {
+	names := make(map[string]TagId)
+	for _, n := range g.Nodes {
+		if n.Root && n.Tag != 0 {
+			names[n.Name] = n.TagId
+		}
+	}
+	return names
+}
+
+// ResolveExternal searches unresolved references among root nodes of other wad
+func (g *DependencyGraph) ResolveExternal(other *DependencyGraph) {
+	names := other.rootNames()
+
+	unresolved := make([]UnresolvedReference, 0, len(g.Unresolved))
+	for _, ref := range g.Unresolved {
+		if id, ok := names[ref.Name]; ok {
+			g.External = append(g.External, ExternalDependency{From: ref.From, Wad: other.Wad, To: id, Name: ref.Name})
+		} else {
+			unresolved = append(unresolved, ref)
+		}
+	}
+	g.Unresolved = unresolved
+}
+
+func (g *DependencyGraph) walk(start TagId, forward bool) []TagId {
+	visited := map[TagId]bool{start: true}
+	queue := []TagId{start}
+	result := make([]TagId, 0)
+	for len(queue) != 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range g.Edges {
+			from, to := e.From, e.To
+			if !forward {
+				from, to = to, from
+			}
+			if from == id && !visited[to] {
+				visited[to] = true
+				result = append(result, to)
+				queue = append(queue, to)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// Uses returns all nodes required by node (transitive)
+func (g *DependencyGraph) Uses(id TagId) []TagId {
+	return g.walk(id, true)
+}
+
+// UsedBy returns all nodes which require node (transitive)
+func (g *DependencyGraph) UsedBy(id TagId) []TagId {
+	return g.walk(id, false)
+}
+
+// Dot generates Graphviz description of graph. Nodes without any
+// dependencies are skipped to keep graph readable
+func (g *DependencyGraph) Dot() []byte {
+	used := make(map[TagId]bool)
+	for _, e := range g.Edges {
+		used[e.From] = true
+		used[e.To] = true
+	}
+	for _, e := range g.External {
+		used[e.From] = true
+	}
+	for _, ref := range g.Unresolved {
+		used[ref.From] = true
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "digraph %s {\n", strconv.Quote(g.Wad))
+	fmt.Fprintf(&b, "  rankdir=LR;\n  node [shape=box, fontsize=10];\n")
+	for _, n := range g.Nodes {
+		if !used[n.TagId] {
+			continue
+		}
+		label := n.Name
+		if n.Type != "" {
+			label += "\n" + n.Type
+		}
+		fmt.Fprintf(&b, "  t%d [label=%s];\n", n.TagId, strconv.Quote(label))
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.Kind == DEPENDENCY_GROUP {
+			style = " [style=dashed]"
+		}
+		fmt.Fprintf(&b, "  t%d -> t%d%s;\n", e.From, e.To, style)
+	}
+	for _, e := range g.External {
+		fmt.Fprintf(&b, "  %s [shape=ellipse];\n", strconv.Quote(e.Wad+":"+e.Name))
+		fmt.Fprintf(&b, "  t%d -> %s [color=blue];\n", e.From, strconv.Quote(e.Wad+":"+e.Name))
+	}
+	for _, ref := range g.Unresolved {
+		fmt.Fprintf(&b, "  %s [shape=ellipse, color=red];\n", strconv.Quote("?"+ref.Name))
+		fmt.Fprintf(&b, "  t%d -> %s [color=red];\n", ref.From, strconv.Quote("?"+ref.Name))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
@@ -60,6 +60,8 @@ type FLP struct {
 	Transformations       []Transformation
 	BlendColors           []BlendColor
 	Strings               []string `json:"-"`
+
+	name string // name of node, model of flp is found by it
 }
 
 type GlobalHandler uint16
@@ -308,12 +310,63 @@ func (f *FLP) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 	return mrsh, nil
 }
 
+// References returns names of model and textures used by meshes of fonts and labels
+func (f *FLP) References() []string {
+	refs := make([]string, 0)
+	if f.name != "" {
+		// same lookup as Marshal does
+		refs = append(refs, strings.Replace(f.name, "FLP_", "MDL_", 1))
+	}
+	addRefs := func(mpr *MeshPartReference) {
+		for _, slot := range mpr.Materials {
+			if slot.TextureName != "" {
+				refs = append(refs, slot.TextureName)
+			}
+		}
+	}
+	for i := range f.Fonts {
+		for j := range f.Fonts[i].MeshesRefs {
+			addRefs(&f.Fonts[i].MeshesRefs[j])
+		}
+	}
+	for i := range f.MeshPartReferences {
+		addRefs(&f.MeshPartReferences[i])
+	}
+	return refs
+}
+
+// RenameReferences renames textures of materials. Names are stored in strings
+// sector, so flp is parsed from data and marshaled again
+func (f *FLP) RenameReferences(data []byte, rename map[string]string) []byte {
+	renamed, err := NewFromData(data)
+	if err != nil {
+		log.Panicf("Cannot parse flp: %v", err)
+	}
+	renameRefs := func(mpr *MeshPartReference) {
+		for i := range mpr.Materials {
+			if newName, ok := rename[mpr.Materials[i].TextureName]; ok {
+				mpr.Materials[i].TextureName = newName
+			}
+		}
+	}
+	for i := range renamed.Fonts {
+		for j := range renamed.Fonts[i].MeshesRefs {
+			renameRefs(&renamed.Fonts[i].MeshesRefs[j])
+		}
+	}
+	for i := range renamed.MeshPartReferences {
+		renameRefs(&renamed.MeshPartReferences[i])
+	}
+	return renamed.marshalBufferWithHeader().Bytes()
+}
+
 func init() {
 	wad.SetHandler(config.GOW1, FLP_MAGIC, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
 		inst, err := NewFromData(wrsrc.Tag.Data)
 		if err != nil {
 			return nil, err
 		}
+		inst.name = wrsrc.Name()
 
 		return inst, nil
 	})
@@ -322,6 +375,7 @@ func init() {
 		if err != nil {
 			return nil, err
 		}
+		inst.name = wrsrc.Name()
 
 		/*
 			inst, err = NewFromData(inst.marshalBufferWithHeader().Bytes())
@@ -0,0 +1,63 @@
+package flp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/pack/wad/mdl"
+)
+
+type memorySource struct {
+	data []byte
+}
+
+func (s *memorySource) Name() string { return "FLP.WAD" }
+func (s *memorySource) Size() int64  { return int64(len(s.data)) }
+func (s *memorySource) Save(in *io.SectionReader) (err error) {
+	s.data, err = ioutil.ReadAll(in)
+	return err
+}
+
+func testModelTag(name string) wad.Tag {
+	data := make([]byte, 0x48)
+	binary.LittleEndian.PutUint32(data, mdl.MODEL_MAGIC)
+	return wad.Tag{Tag: wad.TAG_GOW1_SERVER_INSTANCE, Name: name, Data: data}
+}
+
+func TestCompactKeepsModel(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+
+	tags := []wad.Tag{
+		testModelTag("MDL_hud"),
+		testModelTag("MDL_unused"),
+		{Tag: wad.TAG_GOW1_SERVER_INSTANCE, Name: "FLP_hud", Data: (&FLP{}).marshalBufferWithHeader().Bytes()},
+	}
+	var buf bytes.Buffer
+	for _, tag := range tags {
+		tag.Size = uint32(len(tag.Data))
+		buf.Write(wad.MarshalTag(&tag))
+		buf.Write(tag.Data)
+		// tags are aligned to 16 bytes
+		buf.Write(make([]byte, (16-buf.Len()%16)%16))
+	}
+	w, err := wad.NewWad(bytes.NewReader(buf.Bytes()), &memorySource{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := w.Compact(nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Nodes) != 1 || report.Nodes[0].Name != "MDL_unused" {
+		t.Fatalf("Compact() removed %+v", report.Nodes)
+	}
+	if len(w.Tags) != 2 || w.Tags[0].Name != "MDL_hud" || w.Tags[1].Name != "FLP_hud" {
+		t.Errorf("Compact() left %d tags", len(w.Tags))
+	}
+}
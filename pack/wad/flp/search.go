@@ -0,0 +1,76 @@
+package flp
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/config"
+)
+
+// StaticLabelText converts glyphs of static label back to text
+// using font char maps (same way as web viewer do)
+func (f *FLP) StaticLabelText(sl *StaticLabel, aliases config.FontCharToAsciiByteAssoc) string {
+	var b strings.Builder
+	var font *Font
+
+	for _, cmd := range sl.RenderCommandsList {
+		if cmd.Flags&8 != 0 && int(cmd.FontHandler) < len(f.GlobalHandlersIndexes) {
+			if fontId := int(f.GlobalHandlersIndexes[cmd.FontHandler].IdInThatTypeArray); fontId < len(f.Fonts) {
+				font = &f.Fonts[fontId]
+			}
+		}
+		for _, glyph := range cmd.Glyphs {
+			char := -1
+			if font != nil {
+				for i, symbolId := range font.CharNumberToSymbolIdMap {
+					if symbolId == int16(glyph.GlyphId) {
+						char = i
+						break
+					}
+				}
+			}
+
+			if char > 0 {
+				r := rune(char)
+				for alias, aliasChar := range aliases {
+					if int(aliasChar) == char {
+						r = alias
+						break
+					}
+				}
+				b.WriteRune(r)
+			} else {
+				fmt.Fprintf(&b, "$$%d", glyph.GlyphId)
+			}
+		}
+	}
+	return b.String()
+}
+
+// SearchTexts returns strings section content (dynamic labels, frame labels,
+// texture names) and decoded text of static labels
+func (f *FLP) SearchTexts() []string {
+	texts := make([]string, 0, len(f.Strings)+len(f.StaticLabels))
+	for _, s := range f.Strings {
+		if s != "" {
+			texts = append(texts, s)
+		}
+	}
+
+	aliases, err := config.GetFontAliases()
+	if err != nil {
+		log.Printf("[flp] Error loading fontaliases: %v", err)
+	}
+	for i := range f.StaticLabels {
+		if text := f.StaticLabelText(&f.StaticLabels[i], aliases); text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return texts
+}
+
+// DumpText returns same texts as SearchTexts
+func (f *FLP) DumpText() []string {
+	return f.SearchTexts()
+}
@@ -36,8 +36,8 @@ const (
 	GS_PSM_PSMT8    = 0x13 // 8 bits per pixel, palettized.
 	GS_PSM_PSMT4    = 0x14 // 4 bits per pixel, palettized.
 	GS_PSM_PSMT8H   = 0x1B // 8 bits per pixel, 24 to 32
-	GS_PSM_PSMT4HL  = 0x24 // 4 bits per pixel, 28 to 32
-	GS_PSM_PSMT4HH  = 0x2C // 4 bits per pixel, 24 to 27
+	GS_PSM_PSMT4HL  = 0x24 // 4 bits per pixel, 24 to 27
+	GS_PSM_PSMT4HH  = 0x2C // 4 bits per pixel, 28 to 32
 	GS_PSM_PSMZ32   = 0x30 // 32 bits per pixel.
 	GS_PSM_PSMZ24   = 0x31 // 24 bits per pixel.
 	GS_PSM_PSMZ16   = 0x32 // 16 bits per pixel.
@@ -68,47 +68,55 @@ func IndexSwizzlePalette(i int) int {
 	return blockpos + (remap[blockid%4]+(blockid/4)*4)*8
 }
 
+// AsRawPalette returns colors of palette (clut) in PS2 format (alpha 0-0x80).
+// Supports PSMCT32 and PSMCT16 palettes, 256 colors palette of CSM1 mode is swizzled
 func (gfx *GFX) AsRawPalette(idx int) ([]uint32, error) {
+	return gfx.AsRawPaletteCsm(idx, GS_CSM1)
+}
+
+// AsRawPaletteCsm returns colors of palette stored in clut storage mode csm
+func (gfx *GFX) AsRawPaletteCsm(idx int, csm int) ([]uint32, error) {
 	palbuf := gfx.Data[idx]
+	psm := gfx.GetPSM()
+	if err := checkClutMode(psm, csm); err != nil {
+		return nil, err
+	}
+	bpp := PsmBpp(psm) / 8
 
 	colors := gfx.Width * gfx.RealHeight
+	if uint32(len(palbuf)) < colors*uint32(bpp) {
+		return nil, fmt.Errorf("Palette data is too small: %d", len(palbuf))
+	}
 
 	palette := make([]uint32, colors)
 
 	for i := range palette {
-		clr := binary.LittleEndian.Uint32(palbuf[i*4 : i*4+4])
-		switch gfx.Height {
-		case 2:
-			palette[i] = clr
-		case 32:
-			fallthrough
-		case 16:
+		clr, err := DecodeColor(psm, palbuf[i*bpp:])
+		if err != nil {
+			return nil, err
+		}
+		if gfx.isClutSwizzled(csm) {
 			palette[IndexSwizzlePalette(i)] = clr
-		default:
-			return nil, fmt.Errorf("Wrong palette height: %d", gfx.Height)
+		} else {
+			palette[i] = clr
 		}
 	}
 	return palette, nil
 }
 
 func (gfx *GFX) AsPalette(idx int, convertAlphaToPCformat bool) ([]color.NRGBA, error) {
-	rawPal, err := gfx.AsRawPalette(idx)
+	return gfx.AsPaletteCsm(idx, GS_CSM1, convertAlphaToPCformat)
+}
+
+func (gfx *GFX) AsPaletteCsm(idx int, csm int, convertAlphaToPCformat bool) ([]color.NRGBA, error) {
+	rawPal, err := gfx.AsRawPaletteCsm(idx, csm)
 	if err != nil {
 		return nil, err
 	}
 
 	palette := make([]color.NRGBA, len(rawPal))
 	for i, raw := range rawPal {
-		clr := color.NRGBA{
-			R: uint8(raw),
-			G: uint8(raw >> 8),
-			B: uint8(raw >> 16),
-			A: uint8(raw >> 24),
-		}
-		if convertAlphaToPCformat {
-			clr.A = uint8(float32(clr.A) * (255.0 / 128.0))
-		}
-		palette[i] = clr
+		palette[i] = PS2ColorToNRGBA(raw, convertAlphaToPCformat)
 	}
 
 	return palette, nil
@@ -124,43 +132,62 @@ func IndexUnswizzleTexture(x, y, width uint32) uint32 {
 	return block_location + column_location + byte_num
 }
 
-func (gfx *GFX) AsPaletteIndexes(idx int) []byte {
+// AsPaletteIndexes returns palette index for every pixel, mode is detected from header.
+// 8 bit textures are usually uploaded as PSMCT32 image. 4 bit textures of game
+// are linear, encoding is not checked for them
+func (gfx *GFX) AsPaletteIndexes(idx int) ([]byte, error) {
+	return gfx.AsPaletteIndexesMode(idx, gfx.DefaultMode())
+}
+
+// AsPaletteIndexesMode returns palette index for every pixel of gfx stored in mode.
+// Indexes of PSMT8H, PSMT4HL, PSMT4HH are taken from upper bits of 32 bit gfx,
+// for 8 and 4 bit gfx uploaded data of them is same as PSMT8/PSMT4
+func (gfx *GFX) AsPaletteIndexesMode(idx int, mode GsMode) ([]byte, error) {
+	if err := gfx.checkIndexesMode(mode); err != nil {
+		return nil, err
+	}
 	data := gfx.Data[idx]
+	width, height := gfx.Width, gfx.RealHeight
 
-	indexes := make([]byte, gfx.Width*gfx.RealHeight)
-	switch gfx.GetPSM() {
-	case GS_PSM_PSMT8H:
-		fallthrough
-	case GS_PSM_PSMT8:
-		for y := uint32(0); y < gfx.RealHeight; y++ {
-			for x := uint32(0); x < gfx.Width; x++ {
-				if gfx.Encoding&2 == 0 {
-					pos := IndexUnswizzleTexture(x, y, gfx.Width)
+	indexes := make([]byte, width*height)
+	switch {
+	case gfx.isHighIndexes(mode.Psm):
+		if uint32(len(data)) < width*height*4 {
+			return nil, fmt.Errorf("Gfx data is too small: %d", len(data))
+		}
+		for i := range indexes {
+			indexes[i] = IndexFromPixel32(mode.Psm, binary.LittleEndian.Uint32(data[i*4:]))
+		}
+	case PsmBpp(mode.Psm) == 8:
+		for y := uint32(0); y < height; y++ {
+			for x := uint32(0); x < width; x++ {
+				if mode.Swizzled {
+					pos := IndexUnswizzleTexture(x, y, width)
 					if pos < uint32(len(data)) {
-						indexes[x+y*gfx.Width] = data[pos]
+						indexes[x+y*width] = data[pos]
 					} else {
 						//log.Printf("Warning: Texture missed var: len=%v < pos=%v, x=%v, y=%v. w=%v h=%v", len(data), pos, x, y, gfx.Width, gfx.Height)
 					}
 				} else {
-					indexes[x+y*gfx.Width] = data[x+y*gfx.Width]
+					indexes[x+y*width] = data[x+y*width]
 				}
 			}
 		}
-	case GS_PSM_PSMT4:
-		for y := uint32(0); y < gfx.RealHeight; y++ {
-			for x := uint32(0); x < gfx.Width; x++ {
-				val := data[(x+y*gfx.Width)/2]
+	case mode.Swizzled:
+		return UnswizzleIndexes(data, int(width), int(height), 4), nil
+	default:
+		for y := uint32(0); y < height; y++ {
+			for x := uint32(0); x < width; x++ {
+				val := data[(x+y*width)/2]
 				if x&1 == 0 {
-					indexes[x+y*gfx.Width] = val & 0xf
+					indexes[x+y*width] = val & 0xf
 				} else {
-					indexes[x+y*gfx.Width] = val >> 4
+					indexes[x+y*width] = val >> 4
 				}
 			}
 		}
-	default:
-		panic("Unknown palette indexes encoding case")
 	}
-	return indexes
+	return indexes, nil
 }
 
 func (gfx *GFX) String() string {
@@ -246,6 +273,8 @@ func (gfx *GFX) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 }
 
 func init() {
+	wad.SetDependentResource((*GFX)(nil))
+
 	h := func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
 		gfx, err := NewFromData(wrsrc.Name(), wrsrc.Tag.Data)
 		if err != nil {
@@ -0,0 +1,154 @@
+package gfx
+
+// GS local memory layout, used to convert textures uploaded as PSMCT32 image
+// to indexes of PSMT8/PSMT4 textures and back.
+// Memory divided into pages (8KB) of 32 blocks, block consists of 4 columns,
+// every column is 16 words. Block and column arrangement depends on pixel format
+
+const (
+	GS_PAGE_BLOCKS   = 32
+	GS_BLOCK_COLUMNS = 4
+	GS_COLUMN_WORDS  = 16
+)
+
+// block number by position of block inside page
+var gsBlockTable32 = [4][8]int{
+	{0, 1, 4, 5, 16, 17, 20, 21},
+	{2, 3, 6, 7, 18, 19, 22, 23},
+	{8, 9, 12, 13, 24, 25, 28, 29},
+	{10, 11, 14, 15, 26, 27, 30, 31},
+}
+
+var gsBlockTable4 = [8][4]int{
+	{0, 2, 8, 10},
+	{1, 3, 9, 11},
+	{4, 6, 12, 14},
+	{5, 7, 13, 15},
+	{16, 18, 24, 26},
+	{17, 19, 25, 27},
+	{20, 22, 28, 30},
+	{21, 23, 29, 31},
+}
+
+// word of PSMCT32 column (8x2 pixels)
+var gsColumnTable32 = [2][8]int{
+	{0, 1, 4, 5, 8, 9, 12, 13},
+	{2, 3, 6, 7, 10, 11, 14, 15},
+}
+
+// gsFormat describes geometry of paletted format
+type gsFormat struct {
+	bpp                     int
+	pageWidth, pageHeight   int
+	blockWidth, blockHeight int
+	blockNumber             func(bx, by int) int
+}
+
+var (
+	gsFormat32 = gsFormat{32, 64, 32, 8, 8, func(bx, by int) int { return gsBlockTable32[by][bx] }}
+	gsFormat8  = gsFormat{8, 128, 64, 16, 16, func(bx, by int) int { return gsBlockTable32[by][bx] }}
+	gsFormat4  = gsFormat{4, 128, 128, 32, 16, func(bx, by int) int { return gsBlockTable4[by][bx] }}
+)
+
+// block position of PSMCT32 by block number
+var gsBlockPosition32 [GS_PAGE_BLOCKS][2]int
+
+// pixel position of PSMCT32 column by word
+var gsColumnPosition32 [GS_COLUMN_WORDS][2]int
+
+func init() {
+	for by, row := range gsBlockTable32 {
+		for bx, n := range row {
+			gsBlockPosition32[n] = [2]int{bx, by}
+		}
+	}
+	for y, row := range gsColumnTable32 {
+		for x, w := range row {
+			gsColumnPosition32[w] = [2]int{x, y}
+		}
+	}
+}
+
+// gsColumnUnit returns word of column and unit (byte for PSMT8, nibble for PSMT4) inside word
+// for pixel of paletted column. Column is 16x4 pixels for PSMT8 and 32x4 for PSMT4.
+// Every second row pair of column is shifted by 4 words, shift swapped for odd columns
+func gsColumnUnit(x, y, column int) (int, int) {
+	swap := ((y >> 1) ^ column) & 1
+	word := gsColumnTable32[y&1][(x+swap*4)&7]
+	unit := (x>>3)*2 + (y>>1)&1
+	return word, unit
+}
+
+// gsIndexAddress returns address in units (bpp bits) of pixel of paletted texture
+// inside data uploaded as PSMCT32 image. Width must be multiple of page width
+// of format, PSMCT32 image has same count of pages in row
+func gsIndexAddress(f *gsFormat, x, y, width int) int {
+	pagesInRow := width / f.pageWidth
+	page := (y/f.pageHeight)*pagesInRow + x/f.pageWidth
+	px, py := x%f.pageWidth, y%f.pageHeight
+
+	block := f.blockNumber(px/f.blockWidth, py/f.blockHeight)
+	bx, by := px%f.blockWidth, py%f.blockHeight
+	column := by / 4
+	word, unit := gsColumnUnit(bx, by%4, column)
+
+	// position of word in PSMCT32 image
+	bp := gsBlockPosition32[block]
+	cp := gsColumnPosition32[word]
+	x32 := (page%pagesInRow)*gsFormat32.pageWidth + bp[0]*gsFormat32.blockWidth + cp[0]
+	y32 := (page/pagesInRow)*gsFormat32.pageHeight + bp[1]*gsFormat32.blockHeight + column*2 + cp[1]
+
+	width32 := pagesInRow * gsFormat32.pageWidth
+	return (y32*width32+x32)*(32/f.bpp) + unit
+}
+
+func gsFormatByBpp(bpp int) *gsFormat {
+	switch bpp {
+	case 8:
+		return &gsFormat8
+	case 4:
+		return &gsFormat4
+	}
+	return nil
+}
+
+// CanSwizzleIndexes reports if texture fits pages of GS memory of paletted format
+func CanSwizzleIndexes(width, height, bpp int) bool {
+	f := gsFormatByBpp(bpp)
+	return f != nil && width%f.pageWidth == 0 && height%f.pageHeight == 0
+}
+
+// UnswizzleIndexes converts paletted texture uploaded as PSMCT32 image
+// to linear array of indexes (one byte per pixel)
+func UnswizzleIndexes(data []byte, width, height, bpp int) []byte {
+	f := gsFormatByBpp(bpp)
+	indexes := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			addr := gsIndexAddress(f, x, y, width)
+			if bpp == 8 {
+				indexes[y*width+x] = data[addr]
+			} else {
+				indexes[y*width+x] = (data[addr/2] >> uint((addr&1)*4)) & 0xf
+			}
+		}
+	}
+	return indexes
+}
+
+// SwizzleIndexes is inverse of UnswizzleIndexes
+func SwizzleIndexes(indexes []byte, width, height, bpp int) []byte {
+	f := gsFormatByBpp(bpp)
+	data := make([]byte, width*height*bpp/8)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			addr := gsIndexAddress(f, x, y, width)
+			if bpp == 8 {
+				data[addr] = indexes[y*width+x]
+			} else {
+				data[addr/2] |= (indexes[y*width+x] & 0xf) << uint((addr&1)*4)
+			}
+		}
+	}
+	return data
+}
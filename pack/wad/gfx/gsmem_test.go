@@ -0,0 +1,40 @@
+package gfx
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSwizzle8MatchesUnswizzleTexture(t *testing.T) {
+	for _, size := range [][2]int{{128, 64}, {256, 128}, {128, 128}} {
+		w, h := size[0], size[1]
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				expected := int(IndexUnswizzleTexture(uint32(x), uint32(y), uint32(w)))
+				if addr := gsIndexAddress(&gsFormat8, x, y, w); addr != expected {
+					t.Fatalf("%dx%d: pixel %d,%d address %d instead of %d", w, h, x, y, addr, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestSwizzleRoundTrip(t *testing.T) {
+	for _, bpp := range []int{4, 8} {
+		w, h := 256, 128
+		indexes := make([]byte, w*h)
+		for i := range indexes {
+			indexes[i] = byte(i*7+i/w) & byte(1<<uint(bpp)-1)
+		}
+		if !CanSwizzleIndexes(w, h, bpp) {
+			t.Fatalf("Cannot swizzle %dx%d %d bpp", w, h, bpp)
+		}
+		data := SwizzleIndexes(indexes, w, h, bpp)
+		if len(data) != w*h*bpp/8 {
+			t.Fatalf("Wrong size of swizzled data %d", len(data))
+		}
+		if result := UnswizzleIndexes(data, w, h, bpp); !bytes.Equal(result, indexes) {
+			t.Errorf("Swizzle round trip of %d bpp failed", bpp)
+		}
+	}
+}
@@ -0,0 +1,352 @@
+package gfx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+)
+
+// Data of gfx stored the way it uploaded to GS:
+// PSMCT32 - RGBA, 4 bytes per pixel
+// PSMCT24 - RGB, 3 bytes per pixel, alpha taken from TEXA (0x80)
+// PSMCT16 - RGBA 5551, alpha bit selects between 0 and 0x80
+// PSMT8, PSMT4 - palette indexes. PSMT8H, PSMT4HL, PSMT4HH are same indexes placed
+// in upper bits of PSMCT32 pixels in GS memory, uploaded data is same as PSMT8/PSMT4.
+// Gfx header do not distinguish them, so they are decoded only by GsMode
+// selected explicitly (see AsPaletteIndexesMode)
+// Alpha of PS2 colors is 0-0x80
+
+const (
+	GS_ALPHA_ONE = 0x80
+
+	// encoding flag of gfx: data is linear, not uploaded as PSMCT32 image
+	GFX_ENCODING_LINEAR = 2
+
+	// clut storage modes
+	GS_CSM1 = 0 // 256 colors palette is arranged by 8x2 blocks
+	GS_CSM2 = 1 // linear palette, only PSMCT16 colors
+)
+
+// GsMode is storage of paletted gfx in GS memory, which can't be detected from gfx header
+type GsMode struct {
+	Psm      int  // pixel storage mode of texture
+	Csm      int  // clut storage mode of palette
+	Swizzled bool // data uploaded as PSMCT32 image, so indexes are arranged as in GS memory
+}
+
+// DefaultMode returns mode detected from header: 8 bit textures are swizzled
+// unless encoding is linear, 4 bit textures of game are linear
+func (gfx *GFX) DefaultMode() GsMode {
+	psm := gfx.GetPSM()
+	return GsMode{
+		Psm:      psm,
+		Csm:      GS_CSM1,
+		Swizzled: PsmBpp(psm) == 8 && gfx.Encoding&GFX_ENCODING_LINEAR == 0,
+	}
+}
+
+// PsmByName returns pixel storage mode by name of GsPsm
+func PsmByName(name string) (int, bool) {
+	for psm, psmName := range GsPsm {
+		if psmName == name {
+			return psm, true
+		}
+	}
+	return -1, false
+}
+
+func IsPalettedPsm(psm int) bool {
+	switch psm {
+	case GS_PSM_PSMT8, GS_PSM_PSMT8H, GS_PSM_PSMT4, GS_PSM_PSMT4HL, GS_PSM_PSMT4HH:
+		return true
+	}
+	return false
+}
+
+// IndexFromPixel32 extracts palette index of PSMT8H, PSMT4HL, PSMT4HH from PSMCT32 pixel
+func IndexFromPixel32(psm int, pixel uint32) byte {
+	switch psm {
+	case GS_PSM_PSMT8H:
+		return byte(pixel >> 24)
+	case GS_PSM_PSMT4HL:
+		return byte(pixel>>24) & 0xf
+	case GS_PSM_PSMT4HH:
+		return byte(pixel >> 28)
+	}
+	return byte(pixel)
+}
+
+// IndexToPixel32 places palette index of PSMT8H, PSMT4HL, PSMT4HH into upper bits of
+// PSMCT32 pixel, other bits of pixel are kept
+func IndexToPixel32(psm int, pixel uint32, index byte) uint32 {
+	switch psm {
+	case GS_PSM_PSMT8H:
+		return pixel&0x00ffffff | uint32(index)<<24
+	case GS_PSM_PSMT4HL:
+		return pixel&^0x0f000000 | uint32(index&0xf)<<24
+	case GS_PSM_PSMT4HH:
+		return pixel&^0xf0000000 | uint32(index&0xf)<<28
+	}
+	return pixel
+}
+
+// isHighIndexes reports if indexes are stored in upper bits of 32 bit gfx.
+// Texture of such mode shares GS memory with 24 bit image
+func (gfx *GFX) isHighIndexes(psm int) bool {
+	return gfx.Bpi == 32 && (psm == GS_PSM_PSMT8H || psm == GS_PSM_PSMT4HL || psm == GS_PSM_PSMT4HH)
+}
+
+// checkIndexesMode returns error if data of gfx can't be stored in mode
+func (gfx *GFX) checkIndexesMode(mode GsMode) error {
+	if !IsPalettedPsm(mode.Psm) {
+		return fmt.Errorf("Psm %s is not paletted", GsPsm[mode.Psm])
+	}
+	if gfx.isHighIndexes(mode.Psm) {
+		if mode.Swizzled {
+			return fmt.Errorf("Swizzling of 32 bit gfx is not supported")
+		}
+		return nil
+	}
+	bpp := PsmBpp(mode.Psm)
+	if int(gfx.Bpi) != bpp {
+		return fmt.Errorf("Gfx with %d bpi can't be stored as %s", gfx.Bpi, GsPsm[mode.Psm])
+	}
+	if mode.Swizzled && bpp == 4 {
+		if mode.Psm != GS_PSM_PSMT4 {
+			// upload as PSMCT32 image overwrites lower bits of pixels
+			return fmt.Errorf("%s texture can't be uploaded as PSMCT32 image", GsPsm[mode.Psm])
+		}
+		if !CanSwizzleIndexes(int(gfx.Width), int(gfx.RealHeight), bpp) {
+			return fmt.Errorf("Size %dx%d do not fit GS pages of %s", gfx.Width, gfx.RealHeight, GsPsm[mode.Psm])
+		}
+	}
+	return nil
+}
+
+func IsTrueColorPsm(psm int) bool {
+	switch psm {
+	case GS_PSM_PSMCT32, GS_PSM_PSMCT24, GS_PSM_PSMCT16, GS_PSM_PSMCT16S,
+		GS_PSM_PSMZ32, GS_PSM_PSMZ24, GS_PSM_PSMZ16, GS_PSM_PSMZ16S:
+		return true
+	}
+	return false
+}
+
+// PsmBpp returns bits per pixel of uploaded data
+func PsmBpp(psm int) int {
+	switch psm {
+	case GS_PSM_PSMCT32, GS_PSM_PSMZ32:
+		return 32
+	case GS_PSM_PSMCT24, GS_PSM_PSMZ24, GS_PSM_PSGPU24:
+		return 24
+	case GS_PSM_PSMCT16, GS_PSM_PSMCT16S, GS_PSM_PSMZ16, GS_PSM_PSMZ16S:
+		return 16
+	case GS_PSM_PSMT8, GS_PSM_PSMT8H:
+		return 8
+	case GS_PSM_PSMT4, GS_PSM_PSMT4HL, GS_PSM_PSMT4HH:
+		return 4
+	}
+	return 0
+}
+
+// DecodeColor reads pixel of true color format, returns PS2 color (alpha 0-0x80)
+func DecodeColor(psm int, b []byte) (uint32, error) {
+	switch PsmBpp(psm) {
+	case 32:
+		return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24, nil
+	case 24:
+		return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | GS_ALPHA_ONE<<24, nil
+	case 16:
+		v := uint32(b[0]) | uint32(b[1])<<8
+		expand := func(c uint32) uint32 { return c<<3 | c>>2 }
+		clr := expand(v&0x1f) | expand((v>>5)&0x1f)<<8 | expand((v>>10)&0x1f)<<16
+		if v&0x8000 != 0 {
+			clr |= GS_ALPHA_ONE << 24
+		}
+		return clr, nil
+	}
+	return 0, fmt.Errorf("Psm 0x%x is not true color", psm)
+}
+
+// EncodeColor writes PS2 color (alpha 0-0x80) as pixel of true color format
+func EncodeColor(psm int, clr uint32, b []byte) error {
+	switch PsmBpp(psm) {
+	case 32:
+		b[0], b[1], b[2], b[3] = byte(clr), byte(clr>>8), byte(clr>>16), byte(clr>>24)
+	case 24:
+		b[0], b[1], b[2] = byte(clr), byte(clr>>8), byte(clr>>16)
+	case 16:
+		v := uint16(clr>>3)&0x1f | uint16(clr>>11)&0x1f<<5 | uint16(clr>>19)&0x1f<<10
+		if clr>>24 >= GS_ALPHA_ONE/2 {
+			v |= 0x8000
+		}
+		b[0], b[1] = byte(v), byte(v>>8)
+	default:
+		return fmt.Errorf("Psm 0x%x is not true color", psm)
+	}
+	return nil
+}
+
+func PS2ColorToNRGBA(raw uint32, convertAlphaToPCformat bool) color.NRGBA {
+	clr := color.NRGBA{
+		R: uint8(raw),
+		G: uint8(raw >> 8),
+		B: uint8(raw >> 16),
+		A: uint8(raw >> 24),
+	}
+	if convertAlphaToPCformat {
+		a := float32(clr.A) * (255.0 / 128.0)
+		if a > 255 {
+			a = 255
+		}
+		clr.A = uint8(a)
+	}
+	return clr
+}
+
+func NRGBAToPS2Color(clr color.NRGBA) uint32 {
+	a := uint32(float32(clr.A)*(128.0/255.0) + 0.5)
+	return uint32(clr.R) | uint32(clr.G)<<8 | uint32(clr.B)<<16 | a<<24
+}
+
+// AsColors decodes true color gfx
+func (gfx *GFX) AsColors(idx int, convertAlphaToPCformat bool) ([]color.NRGBA, error) {
+	psm := gfx.GetPSM()
+	if !IsTrueColorPsm(psm) {
+		return nil, fmt.Errorf("Gfx with psm %s is not true color", GsPsm[psm])
+	}
+	bpp := PsmBpp(psm) / 8
+	data := gfx.Data[idx]
+
+	colors := make([]color.NRGBA, gfx.Width*gfx.RealHeight)
+	if len(data) < len(colors)*bpp {
+		return nil, fmt.Errorf("Gfx data is too small: %d < %d", len(data), len(colors)*bpp)
+	}
+	for i := range colors {
+		raw, err := DecodeColor(psm, data[i*bpp:])
+		if err != nil {
+			return nil, err
+		}
+		colors[i] = PS2ColorToNRGBA(raw, convertAlphaToPCformat)
+	}
+	return colors, nil
+}
+
+// SetColors encodes true color gfx data
+func (gfx *GFX) SetColors(idx int, colors []color.NRGBA) error {
+	psm := gfx.GetPSM()
+	if !IsTrueColorPsm(psm) {
+		return fmt.Errorf("Gfx with psm %s is not true color", GsPsm[psm])
+	}
+	if len(colors) != int(gfx.Width*gfx.RealHeight) {
+		return fmt.Errorf("Colors count %d do not match size %dx%d", len(colors), gfx.Width, gfx.RealHeight)
+	}
+	bpp := PsmBpp(psm) / 8
+	data := make([]byte, len(colors)*bpp)
+	for i, clr := range colors {
+		if err := EncodeColor(psm, NRGBAToPS2Color(clr), data[i*bpp:]); err != nil {
+			return err
+		}
+	}
+	gfx.Data[idx] = data
+	gfx.DataSize = uint32(len(data))
+	return nil
+}
+
+// SetPaletteIndexes encodes indexes of paletted gfx, inverse of AsPaletteIndexes
+func (gfx *GFX) SetPaletteIndexes(idx int, indexes []byte) error {
+	return gfx.SetPaletteIndexesMode(idx, indexes, gfx.DefaultMode())
+}
+
+// SetPaletteIndexesMode encodes indexes of paletted gfx stored in mode, inverse of
+// AsPaletteIndexesMode. Indexes of 32 bit gfx are placed over existing data
+func (gfx *GFX) SetPaletteIndexesMode(idx int, indexes []byte, mode GsMode) error {
+	width, height := int(gfx.Width), int(gfx.RealHeight)
+	if len(indexes) != width*height {
+		return fmt.Errorf("Indexes count %d do not match size %dx%d", len(indexes), width, height)
+	}
+	if err := gfx.checkIndexesMode(mode); err != nil {
+		return err
+	}
+
+	var data []byte
+	switch {
+	case gfx.isHighIndexes(mode.Psm):
+		if len(gfx.Data[idx]) < width*height*4 {
+			return fmt.Errorf("Gfx data is too small: %d", len(gfx.Data[idx]))
+		}
+		data = append([]byte{}, gfx.Data[idx]...)
+		for i, index := range indexes {
+			binary.LittleEndian.PutUint32(data[i*4:], IndexToPixel32(mode.Psm, binary.LittleEndian.Uint32(data[i*4:]), index))
+		}
+	case PsmBpp(mode.Psm) == 8 && mode.Swizzled:
+		data = make([]byte, width*height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				if pos := IndexUnswizzleTexture(uint32(x), uint32(y), uint32(width)); int(pos) < len(data) {
+					data[pos] = indexes[x+y*width]
+				}
+			}
+		}
+	case PsmBpp(mode.Psm) == 8:
+		data = append([]byte{}, indexes...)
+	case mode.Swizzled:
+		data = SwizzleIndexes(indexes, width, height, 4)
+	default:
+		data = make([]byte, (width*height+1)/2)
+		for i, index := range indexes {
+			data[i/2] |= (index & 0xf) << uint((i&1)*4)
+		}
+	}
+	gfx.Data[idx] = data
+	gfx.DataSize = uint32(len(data))
+	return nil
+}
+
+// SetRawPalette encodes palette of PS2 colors, inverse of AsRawPalette
+func (gfx *GFX) SetRawPalette(idx int, palette []uint32) error {
+	return gfx.SetRawPaletteCsm(idx, palette, GS_CSM1)
+}
+
+// SetRawPaletteCsm encodes palette of PS2 colors stored in clut storage mode csm
+func (gfx *GFX) SetRawPaletteCsm(idx int, palette []uint32, csm int) error {
+	if len(palette) != int(gfx.Width*gfx.RealHeight) {
+		return fmt.Errorf("Palette size %d do not match size %dx%d", len(palette), gfx.Width, gfx.RealHeight)
+	}
+	psm := gfx.GetPSM()
+	if err := checkClutMode(psm, csm); err != nil {
+		return err
+	}
+	bpp := PsmBpp(psm) / 8
+
+	data := make([]byte, len(palette)*bpp)
+	for i, clr := range palette {
+		pos := i
+		if gfx.isClutSwizzled(csm) {
+			pos = IndexSwizzlePalette(i)
+		}
+		EncodeColor(psm, clr, data[pos*bpp:])
+	}
+	gfx.Data[idx] = data
+	gfx.DataSize = uint32(len(data))
+	return nil
+}
+
+func checkClutMode(psm int, csm int) error {
+	switch {
+	case psm != GS_PSM_PSMCT32 && psm != GS_PSM_PSMCT16:
+		return fmt.Errorf("Palette psm %s is not supported", GsPsm[psm])
+	case csm != GS_CSM1 && csm != GS_CSM2:
+		return fmt.Errorf("Unknown clut storage mode %d", csm)
+	case csm == GS_CSM2 && psm != GS_PSM_PSMCT16:
+		return fmt.Errorf("CSM2 palette must be PSMCT16, not %s", GsPsm[psm])
+	}
+	return nil
+}
+
+// isClutSwizzled reports if palette is 256 colors palette of CSM1 mode, 16 colors
+// palette (8x2) of CSM1 and CSM2 palettes are linear. Gfx header has no clut
+// storage mode, so palettes of game are treated as CSM1
+func (gfx *GFX) isClutSwizzled(csm int) bool {
+	return csm == GS_CSM1 && gfx.Width == 16 && gfx.RealHeight == 16
+}
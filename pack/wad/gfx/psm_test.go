@@ -0,0 +1,161 @@
+package gfx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"testing"
+)
+
+func TestTrueColorRoundTrip(t *testing.T) {
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 0}, {8, 16, 248, 255}, {40, 80, 120, 255}}
+	for _, bpi := range []uint32{32, 24, 16} {
+		gfx := &GFX{Width: 2, Height: 2, RealHeight: 2, Bpi: bpi, Data: make([][]byte, 1)}
+		if err := gfx.SetColors(0, colors); err != nil {
+			t.Fatal(err)
+		}
+		if gfx.DataSize != 4*bpi/8 {
+			t.Errorf("Wrong data size %d for %d bpi", gfx.DataSize, bpi)
+		}
+		result, err := gfx.AsColors(0, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, clr := range result {
+			expected := colors[i]
+			if bpi == 24 {
+				expected.A = 255
+			}
+			if bpi == 16 {
+				// 5 bits per channel
+				switch i {
+				case 2:
+					expected = color.NRGBA{8, 16, 255, 255}
+				case 3:
+					expected = color.NRGBA{41, 82, 123, 255}
+				}
+			}
+			if clr != expected {
+				t.Errorf("%d bpi: color %d is %v instead of %v", bpi, i, clr, expected)
+			}
+		}
+	}
+}
+
+func TestPaletteRoundTrip(t *testing.T) {
+	for _, height := range []uint32{2, 16} {
+		width := uint32(256) / height
+		if height == 2 {
+			width = 8
+		}
+		pal := &GFX{Width: width, Height: height, RealHeight: height, Bpi: 32, Data: make([][]byte, 1)}
+		raw := make([]uint32, width*height)
+		for i := range raw {
+			raw[i] = uint32(i) * 0x01020304
+		}
+		if err := pal.SetRawPalette(0, raw); err != nil {
+			t.Fatal(err)
+		}
+		result, err := pal.AsRawPalette(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range raw {
+			if raw[i] != result[i] {
+				t.Fatalf("Palette %dx%d: color %d is %x instead of %x", width, height, i, result[i], raw[i])
+			}
+		}
+	}
+}
+
+func TestHighIndexes(t *testing.T) {
+	for psm, expected := range map[int][]byte{
+		GS_PSM_PSMT8H:  {0xa5, 0x3c},
+		GS_PSM_PSMT4HL: {0x5, 0xc},
+		GS_PSM_PSMT4HH: {0xa, 0x3},
+	} {
+		gfx := &GFX{Width: 2, Height: 1, RealHeight: 1, Bpi: 32, Data: [][]byte{{
+			0x11, 0x22, 0x33, 0xa5,
+			0x44, 0x55, 0x66, 0x3c,
+		}}}
+		mode := GsMode{Psm: psm}
+		indexes, err := gfx.AsPaletteIndexesMode(0, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(indexes, expected) {
+			t.Errorf("%s: indexes %v instead of %v", GsPsm[psm], indexes, expected)
+		}
+		// lower bits of 24 bit image must stay
+		if err := gfx.SetPaletteIndexesMode(0, []byte{0x1, 0x2}, mode); err != nil {
+			t.Fatal(err)
+		}
+		if gfx.Data[0][0] != 0x11 || gfx.Data[0][6] != 0x66 {
+			t.Errorf("%s: color bits changed %v", GsPsm[psm], gfx.Data[0])
+		}
+		if indexes, _ := gfx.AsPaletteIndexesMode(0, mode); indexes[0] != 0x1 || indexes[1] != 0x2 {
+			t.Errorf("%s: set indexes %v", GsPsm[psm], indexes)
+		}
+	}
+	gfx := &GFX{Width: 2, Height: 1, RealHeight: 1, Bpi: 32, Data: [][]byte{make([]byte, 8)}}
+	if _, err := gfx.AsPaletteIndexesMode(0, GsMode{Psm: GS_PSM_PSMT4}); err == nil {
+		t.Errorf("PSMT4 of 32 bit gfx must fail")
+	}
+}
+
+func TestSwizzledPsmt4RoundTrip(t *testing.T) {
+	gfx := &GFX{Width: 128, Height: 128, RealHeight: 128, Bpi: 4, Data: make([][]byte, 1)}
+	indexes := make([]byte, 128*128)
+	for i := range indexes {
+		indexes[i] = byte(i*7+i/128) & 0xf
+	}
+	mode := GsMode{Psm: GS_PSM_PSMT4, Swizzled: true}
+	if err := gfx.SetPaletteIndexesMode(0, indexes, mode); err != nil {
+		t.Fatal(err)
+	}
+	if gfx.DataSize != 128*128/2 {
+		t.Errorf("Wrong data size %d", gfx.DataSize)
+	}
+	result, err := gfx.AsPaletteIndexesMode(0, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(result, indexes) {
+		t.Errorf("Swizzled indexes do not match")
+	}
+	if linear, _ := gfx.AsPaletteIndexes(0); bytes.Equal(linear, indexes) {
+		t.Errorf("Swizzled data must differ from linear")
+	}
+	if _, err := gfx.AsPaletteIndexesMode(0, GsMode{Psm: GS_PSM_PSMT4HL, Swizzled: true}); err == nil {
+		t.Errorf("Swizzled PSMT4HL must fail")
+	}
+}
+
+func TestCsm2Palette(t *testing.T) {
+	pal := &GFX{Width: 16, Height: 16, RealHeight: 16, Bpi: 16, Data: make([][]byte, 1)}
+	data := make([]byte, 256*2)
+	for i := 0; i < 256; i++ {
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(i*0x81))
+	}
+	pal.Data[0] = data
+	raw, err := pal.AsRawPaletteCsm(0, GS_CSM2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// CSM2 is linear
+	for i := range raw {
+		if expected, _ := DecodeColor(GS_PSM_PSMCT16, data[i*2:]); raw[i] != expected {
+			t.Fatalf("Color %d is %x instead of %x", i, raw[i], expected)
+		}
+	}
+	if err := pal.SetRawPaletteCsm(0, raw, GS_CSM2); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pal.Data[0], data) {
+		t.Errorf("CSM2 palette round trip do not match")
+	}
+	pal.Bpi = 32
+	if err := pal.SetRawPaletteCsm(0, make([]uint32, 256), GS_CSM2); err == nil {
+		t.Errorf("CSM2 of PSMCT32 must fail")
+	}
+}
@@ -27,3 +27,68 @@ func isZeroSizedTag(tag *Tag) bool {
 		panic("unknwn")
 	}
 }
+
+func GetGroupStartTag() uint16 {
+	switch config.GetGOWVersion() {
+	case config.GOW1:
+		return TAG_GOW1_FILE_GROUP_START
+	case config.GOW2:
+		return TAG_GOW2_FILE_GROUP_START
+	case config.GOW3:
+		return TAG_GOW3_FILE_GROUP_START
+	default:
+		panic("unknwn")
+	}
+}
+
+func GetGroupEndTag() uint16 {
+	switch config.GetGOWVersion() {
+	case config.GOW1:
+		return TAG_GOW1_FILE_GROUP_END
+	case config.GOW2:
+		return TAG_GOW2_FILE_GROUP_END
+	case config.GOW3:
+		return TAG_GOW3_FILE_GROUP_END
+	default:
+		panic("unknwn")
+	}
+}
+
+func GetEntityCountTag() uint16 {
+	switch config.GetGOWVersion() {
+	case config.GOW1:
+		return TAG_GOW1_ENTITY_COUNT
+	case config.GOW2:
+		return TAG_GOW2_ENTITY_COUNT
+	case config.GOW3:
+		return TAG_GOW3_ENTITY_COUNT
+	default:
+		panic("unknwn")
+	}
+}
+
+func GetHeaderStartTag() uint16 {
+	switch config.GetGOWVersion() {
+	case config.GOW1:
+		return TAG_GOW1_HEADER_START
+	case config.GOW2:
+		return TAG_GOW2_HEADER_START
+	case config.GOW3:
+		return TAG_GOW3_HEADER_START
+	default:
+		panic("unknwn")
+	}
+}
+
+func GetHeaderPopTag() uint16 {
+	switch config.GetGOWVersion() {
+	case config.GOW1:
+		return TAG_GOW1_HEADER_POP
+	case config.GOW2:
+		return TAG_GOW2_HEADER_POP
+	case config.GOW3:
+		return TAG_GOW3_HEADER_POP
+	default:
+		panic("unknwn")
+	}
+}
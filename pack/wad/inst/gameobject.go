@@ -1,8 +1,6 @@
 package inst
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 
 	"github.com/mogaika/god_of_war_browser/config"
@@ -11,7 +9,7 @@ import (
 
 	"github.com/mogaika/god_of_war_browser/pack/wad"
 	file_scr "github.com/mogaika/god_of_war_browser/pack/wad/scr"
-	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
 )
 
 const INSTANCE_MAGIC = 0x00020001
@@ -27,25 +25,44 @@ type Instance struct {
 	Unk       [3]uint32
 }
 
+var Layout = structlayout.Register(structlayout.New("gow_inst", "God of War PS2 game object instance", FILE_SIZE,
+	structlayout.Field{Name: "magic", Offset: 0x00, Kind: structlayout.U32, Doc: "0x00020001"},
+	structlayout.Field{Name: "object", Offset: 0x04, Kind: structlayout.String, Size: 24, Doc: "name of OBJ_ node"},
+	structlayout.Field{Name: "id", Offset: 0x1c, Kind: structlayout.U16},
+	structlayout.Field{Name: "params", Offset: 0x1e, Kind: structlayout.U16},
+	structlayout.Field{Name: "position1", Offset: 0x20, Kind: structlayout.F32, Count: 4, Doc: "object translation"},
+	structlayout.Field{Name: "rotation", Offset: 0x30, Kind: structlayout.F32, Count: 4, Doc: "euler rotation (rads), last element is scale"},
+	structlayout.Field{Name: "position2", Offset: 0x40, Kind: structlayout.F32, Count: 4, Doc: "world-relative position"},
+	structlayout.Field{Name: "unk", Offset: 0x50, Kind: structlayout.U32, Count: 3},
+))
+
 func NewFromData(buf []byte) (*Instance, error) {
 	inst := &Instance{
-		Object: utils.BytesToString(buf[0x4:0x1c]),
-		Id:     binary.LittleEndian.Uint16(buf[0x1c:0x1e]),
-		Params: binary.LittleEndian.Uint16(buf[0x1e:0x20]),
-		Unk: [3]uint32{
-			binary.LittleEndian.Uint32(buf[0x50:0x54]),
-			binary.LittleEndian.Uint32(buf[0x54:0x58]),
-			binary.LittleEndian.Uint32(buf[0x58:0x5C]),
-		},
+		Object: Layout.Field("object").String(buf),
+		Id:     Layout.Field("id").U16(buf),
+		Params: Layout.Field("params").U16(buf),
 	}
 
-	binary.Read(bytes.NewReader(buf[0x20:0x30]), binary.LittleEndian, &inst.Position1)
-	binary.Read(bytes.NewReader(buf[0x30:0x40]), binary.LittleEndian, &inst.Rotation)
-	binary.Read(bytes.NewReader(buf[0x40:0x50]), binary.LittleEndian, &inst.Position2)
+	Layout.Field("unk").U32s(buf, inst.Unk[:])
+	Layout.Field("position1").F32s(buf, inst.Position1[:])
+	Layout.Field("rotation").F32s(buf, inst.Rotation[:])
+	Layout.Field("position2").F32s(buf, inst.Position2[:])
 
 	return inst, nil
 }
 
+func (inst *Instance) References() []string {
+	return []string{inst.Object}
+}
+
+func (inst *Instance) RenameReferences(data []byte, rename map[string]string) []byte {
+	result := append([]byte(nil), data...)
+	if newName, ok := rename[inst.Object]; ok {
+		Layout.Field("object").PutString(result, newName, true)
+	}
+	return result
+}
+
 type Ajax struct {
 	Instance
 	Scripts []interface{}
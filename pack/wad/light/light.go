@@ -1,14 +1,11 @@
 package light
 
 import (
-	"bytes"
-	"encoding/binary"
-	"math"
-
 	"github.com/pkg/errors"
 
 	"github.com/mogaika/god_of_war_browser/config"
 	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
 
 	"github.com/go-gl/mathgl/mgl32"
 )
@@ -36,28 +33,47 @@ type Light struct {
 	Unk54    float32 // == 0 ?
 }
 
-func (l *Light) FromWad(data []byte, gow2 bool) error {
-	l.Unk04 = binary.LittleEndian.Uint32(data[0x04:])
-	l.Flags = binary.LittleEndian.Uint32(data[0x08:])
+var Layout = structlayout.Register(structlayout.New("gow_light", "God of War PS2 light", FILE_SIZE,
+	structlayout.Field{Name: "magic", Offset: 0x00, Kind: structlayout.U32, Doc: "always 6"},
+	structlayout.Field{Name: "unk04", Offset: 0x04, Kind: structlayout.U32},
+	structlayout.Field{Name: "flags", Offset: 0x08, Kind: structlayout.U32, Doc: "0 - ambient, 1 - point, 2/6 - directional"},
+	structlayout.Field{Name: "position", Offset: 0x0c, Kind: structlayout.F32, Count: 4},
+	structlayout.Field{Name: "rotation", Offset: 0x1c, Kind: structlayout.F32, Count: 4},
+	structlayout.Field{Name: "color", Offset: 0x2c, Kind: structlayout.F32, Count: 4, Doc: "last element is intensity?"},
+	structlayout.Field{Name: "unk3c", Offset: 0x3c, Kind: structlayout.F32},
+	structlayout.Field{Name: "unk40", Offset: 0x40, Kind: structlayout.F32},
+	structlayout.Field{Name: "unk44", Offset: 0x44, Kind: structlayout.F32},
+	structlayout.Field{Name: "unk48", Offset: 0x48, Kind: structlayout.U32},
+	structlayout.Field{Name: "unk4c", Offset: 0x4c, Kind: structlayout.F32},
+	structlayout.Field{Name: "unk50", Offset: 0x50, Kind: structlayout.F32},
+	structlayout.Field{Name: "unk54", Offset: 0x54, Kind: structlayout.F32, Doc: "not present in gow2"},
+))
 
-	if err := binary.Read(bytes.NewReader(data[0x0c:]), binary.LittleEndian, &l.Position); err != nil {
-		return errors.Wrapf(err, "Can't parse Position")
-	}
-	if err := binary.Read(bytes.NewReader(data[0x1c:]), binary.LittleEndian, &l.Rotation); err != nil {
-		return errors.Wrapf(err, "Can't parse Rotation")
+func (l *Light) FromWad(data []byte, gow2 bool) error {
+	// gow2 lights end before unk54
+	last := Layout.Field("unk54")
+	if gow2 {
+		last = Layout.Field("unk50")
 	}
-	if err := binary.Read(bytes.NewReader(data[0x2c:]), binary.LittleEndian, &l.Color); err != nil {
-		return errors.Wrapf(err, "Can't parse Color")
+	if len(data) < last.Offset+last.TotalSize() {
+		return errors.Errorf("Light data is too small: 0x%x", len(data))
 	}
 
-	l.Unk3c = math.Float32frombits(binary.LittleEndian.Uint32(data[0x3c:]))
-	l.Unk40 = math.Float32frombits(binary.LittleEndian.Uint32(data[0x40:]))
-	l.Unk44 = math.Float32frombits(binary.LittleEndian.Uint32(data[0x44:]))
-	l.Unk48 = binary.LittleEndian.Uint32(data[0x48:])
-	l.Unk4c = math.Float32frombits(binary.LittleEndian.Uint32(data[0x4c:]))
-	l.Unk50 = math.Float32frombits(binary.LittleEndian.Uint32(data[0x50:]))
+	l.Unk04 = Layout.Field("unk04").U32(data)
+	l.Flags = Layout.Field("flags").U32(data)
+
+	Layout.Field("position").F32s(data, l.Position[:])
+	Layout.Field("rotation").F32s(data, l.Rotation[:])
+	Layout.Field("color").F32s(data, l.Color[:])
+
+	l.Unk3c = Layout.Field("unk3c").F32(data)
+	l.Unk40 = Layout.Field("unk40").F32(data)
+	l.Unk44 = Layout.Field("unk44").F32(data)
+	l.Unk48 = Layout.Field("unk48").U32(data)
+	l.Unk4c = Layout.Field("unk4c").F32(data)
+	l.Unk50 = Layout.Field("unk50").F32(data)
 	if !gow2 {
-		l.Unk54 = math.Float32frombits(binary.LittleEndian.Uint32(data[0x54:]))
+		l.Unk54 = Layout.Field("unk54").F32(data)
 	}
 
 	return nil
@@ -0,0 +1,19 @@
+package light
+
+import "testing"
+
+func TestFromWadSize(t *testing.T) {
+	var l Light
+	if err := l.FromWad(make([]byte, 0x54), false); err == nil {
+		t.Errorf("0x54 bytes must be too small for gow1 light")
+	}
+	if err := l.FromWad(make([]byte, 0x58), false); err != nil {
+		t.Error(err)
+	}
+	if err := l.FromWad(make([]byte, 0x54), true); err != nil {
+		t.Error(err)
+	}
+	if err := l.FromWad(make([]byte, 0x50), true); err == nil {
+		t.Errorf("0x50 bytes must be too small for gow2 light")
+	}
+}
@@ -1,10 +1,8 @@
 package mat
 
 import (
-	"encoding/binary"
 	"fmt"
 	"github.com/pkg/errors"
-	"math"
 
 	"github.com/mogaika/god_of_war_browser/config"
 
@@ -12,6 +10,7 @@ import (
 	file_anm "github.com/mogaika/god_of_war_browser/pack/wad/anm"
 	file_txr "github.com/mogaika/god_of_war_browser/pack/wad/txr"
 	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
 )
 
 /*
@@ -83,47 +82,50 @@ func (l *Layer) ParseFlags() error {
 	return nil
 }
 
+var LayerLayout = structlayout.New("gow_mat_layer", "Material layer", LAYER_SIZE,
+	structlayout.Field{Name: "flags", Offset: 0x00, Kind: structlayout.U32, Count: 4},
+	structlayout.Field{Name: "texture", Offset: 0x10, Kind: structlayout.String, Size: 24},
+	structlayout.Field{Name: "blend_color", Offset: 0x28, Kind: structlayout.F32, Count: 4},
+	structlayout.Field{Name: "float_unk", Offset: 0x38, Kind: structlayout.F32},
+	structlayout.Field{Name: "game_flags", Offset: 0x3c, Kind: structlayout.U32, Doc: "1 - uv animation, 2 - color animation"},
+)
+
+var Layout = structlayout.Register(structlayout.New("gow_mat", "God of War PS2 material (MAT_)", 0,
+	structlayout.Field{Name: "magic", Offset: 0x00, Kind: structlayout.U32, Doc: "always 8"},
+	structlayout.Field{Name: "color", Offset: 0x08, Kind: structlayout.F32, Count: 3},
+	structlayout.Field{Name: "layers_count", Offset: 0x34, Kind: structlayout.U32},
+	structlayout.Field{Name: "layers", Offset: HEADER_SIZE, Kind: structlayout.Struct, Sub: LayerLayout, CountField: "layers_count"},
+))
+
 func NewFromData(buf []byte) (*Material, error) {
-	magic := binary.LittleEndian.Uint32(buf[:4])
+	magic := Layout.Field("magic").U32(buf)
 	if magic != MAT_MAGIC {
 		return nil, errors.New("Wrong magic.")
 	}
 
 	mat := &Material{
-		Layers: make([]Layer, binary.LittleEndian.Uint32(buf[0x34:0x38])),
+		Layers: make([]Layer, Layout.Field("layers_count").U32(buf)),
 	}
 
-	mat.Color = utils.NewColorFloat([]float32{
-		math.Float32frombits(binary.LittleEndian.Uint32(buf[8:12])),
-		math.Float32frombits(binary.LittleEndian.Uint32(buf[12:16])),
-		math.Float32frombits(binary.LittleEndian.Uint32(buf[16:20])),
-	})
+	var color [3]float32
+	Layout.Field("color").F32s(buf, color[:])
+	mat.Color = utils.NewColorFloat(color[:])
 
 	for iTex := range mat.Layers {
-		start := iTex*LAYER_SIZE + HEADER_SIZE
+		start := iTex*LAYER_SIZE + Layout.Field("layers").Offset
 		tbuf := buf[start : start+LAYER_SIZE]
 
-		mat.Layers[iTex].Flags = [4]uint32{
-			binary.LittleEndian.Uint32(tbuf[0:4]),
-			binary.LittleEndian.Uint32(tbuf[4:8]),
-			binary.LittleEndian.Uint32(tbuf[8:12]),
-			binary.LittleEndian.Uint32(tbuf[12:16]),
-		}
-		mat.Layers[iTex].Texture = utils.BytesToString(tbuf[16:40])
-
-		mat.Layers[iTex].BlendColor = [4]float32{
-			math.Float32frombits(binary.LittleEndian.Uint32(tbuf[40:44])),
-			math.Float32frombits(binary.LittleEndian.Uint32(tbuf[44:48])),
-			math.Float32frombits(binary.LittleEndian.Uint32(tbuf[48:52])),
-			math.Float32frombits(binary.LittleEndian.Uint32(tbuf[52:56])),
-		}
+		layer := &mat.Layers[iTex]
+		LayerLayout.Field("flags").U32s(tbuf, layer.Flags[:])
+		layer.Texture = LayerLayout.Field("texture").String(tbuf)
+		LayerLayout.Field("blend_color").F32s(tbuf, layer.BlendColor[:])
 
-		mat.Layers[iTex].FloatUnk = math.Float32frombits(binary.LittleEndian.Uint32(tbuf[56:60]))
-		if mat.Layers[iTex].FloatUnk != 1.0 {
+		layer.FloatUnk = LayerLayout.Field("float_unk").F32(tbuf)
+		if layer.FloatUnk != 1.0 {
 			// Transparency of layer when using multi-layer?
 		}
 
-		mat.Layers[iTex].GameFlags = binary.LittleEndian.Uint32(tbuf[60:64])
+		layer.GameFlags = LayerLayout.Field("game_flags").U32(tbuf)
 
 		if err := mat.Layers[iTex].ParseFlags(); err != nil {
 			return nil, fmt.Errorf("Error paring layer %d: %v", iTex, err)
@@ -133,6 +135,28 @@ func NewFromData(buf []byte) (*Material, error) {
 	return mat, nil
 }
 
+func (mat *Material) References() []string {
+	refs := make([]string, 0, len(mat.Layers))
+	for _, layer := range mat.Layers {
+		if layer.Texture != "" {
+			refs = append(refs, layer.Texture)
+		}
+	}
+	return refs
+}
+
+func (mat *Material) RenameReferences(data []byte, rename map[string]string) []byte {
+	result := append([]byte(nil), data...)
+	texture := LayerLayout.Field("texture")
+	for iLayer := range mat.Layers {
+		if newName, ok := rename[mat.Layers[iLayer].Texture]; ok {
+			start := iLayer*LAYER_SIZE + Layout.Field("layers").Offset
+			texture.PutString(result[start:start+LAYER_SIZE], newName, true)
+		}
+	}
+	return result
+}
+
 type Ajax struct {
 	Mat             *Material
 	Textures        map[int]interface{}
@@ -193,6 +217,8 @@ func (mat *Material) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 }
 
 func init() {
+	wad.SetDependentResource((*Material)(nil))
+
 	h := func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
 		return NewFromData(wrsrc.Tag.Data)
 	}
@@ -115,6 +115,8 @@ func (mdl *Model) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 }
 
 func init() {
+	wad.SetDependentResource((*Model)(nil))
+
 	wad.SetHandler(config.GOW1, MODEL_MAGIC, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
 		mdl, err := NewFromData(wrsrc.Tag.Data)
 		if err == nil {
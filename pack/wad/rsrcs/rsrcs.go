@@ -43,6 +43,10 @@ func (rsrcs *RSRCS) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 	return rsrcs, nil
 }
 
+func (rsrcs *RSRCS) WadReferences() []string {
+	return rsrcs.Wads
+}
+
 func (rsrcs *RSRCS) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
 	switch action {
 	case "update":
@@ -62,6 +66,6 @@ func (rsrcs *RSRCS) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r
 
 func init() {
 	wad.SetTagHandler(RSRCS_Tag, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
-		return NewRSRCSFromData(utils.NewBufStack("rsrcs", wrsrc.Tag.Data))
+		return NewRSRCSFromData(wrsrc.NewBufStack("rsrcs"))
 	})
 }
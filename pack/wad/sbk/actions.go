@@ -0,0 +1,105 @@
+package sbk
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
+	"github.com/mogaika/god_of_war_browser/ps2/vagp"
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+// readWav reads uploaded wav from "data" form field
+func readWav(r *http.Request) (*utils.Wave, error) {
+	f, _, err := r.FormFile("data")
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to open file")
+	}
+	defer f.Close()
+	wav, err := utils.WaveRead(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to read wav")
+	}
+	return wav, nil
+}
+
+// encodeSample encodes wav as mono bank sample, loop of wav is kept
+func encodeSample(wav *utils.Wave) []byte {
+	return adpcm.Encode(wav.Mono(), wav.LoopStart, wav.LoopEnd)
+}
+
+// httpEdit applies change to copy of sbk and writes result into tag.
+// Cached sbk and data of tag are not changed if edit fails
+func (sbk *SBK) httpEdit(wrsrc *wad.WadNodeRsrc, r *http.Request, action string) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("Action %s requires POST request", action)
+	}
+	q := r.URL.Query()
+
+	// writer changes sample data in place, so parse from copy of tag data
+	edit, err := NewFromData(utils.NewBufStack("sbk_edit", append([]byte(nil), wrsrc.Tag.Data...)), !sbk.IsVagFiles)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to parse sbk copy")
+	}
+
+	switch action {
+	case "replacesmpd":
+		if edit.IsVagFiles {
+			return fmt.Errorf("Sound bank is not present")
+		}
+		var offset uint32
+		if _, err := fmt.Sscan(q.Get("offset"), &offset); err != nil {
+			return errors.Wrapf(err, "Invalid offset")
+		}
+		wav, err := readWav(r)
+		if err != nil {
+			return err
+		}
+		if err := edit.Bank.ReplaceSample(offset, encodeSample(wav)); err != nil {
+			return err
+		}
+	case "replacevag":
+		wav, err := readWav(r)
+		if err != nil {
+			return err
+		}
+		vag, err := vagp.NewVAGPFromWave(wav, q.Get("snd"))
+		if err != nil {
+			return err
+		}
+		if err := edit.ReplaceVag(q.Get("snd"), vag); err != nil {
+			return err
+		}
+	case "addsound":
+		wav, err := readWav(r)
+		if err != nil {
+			return err
+		}
+		if err := edit.AddSound(r.FormValue("name"), r.FormValue("like"), encodeSample(wav)); err != nil {
+			return err
+		}
+	case "asm":
+		if err := edit.SetCommands(q.Get("snd"), r.FormValue("text")); err != nil {
+			return err
+		}
+	case "removesound":
+		if err := edit.RemoveSound(q.Get("snd")); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unknown action: %v", action)
+	}
+
+	data, err := edit.MarshalData()
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshal sbk")
+	}
+	// sanity check
+	if _, err := NewFromData(utils.NewBufStack("sbk_check", data), !edit.IsVagFiles); err != nil {
+		return errors.Wrapf(err, "Failed to parse produced sbk")
+	}
+	return wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{wrsrc.Tag.Id: data})
+}
@@ -0,0 +1,307 @@
+package sbk
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+// Text form of command list, one command per line:
+//   name key=value key=value // comment
+// Operands of most commands are bytes B1, B2, B3 of first word (b1, b2, b3)
+// and second word (u4). Commands with reference (play, unk_ref, play_vag, goto_bank)
+// use address of smpd block entry (ref) instead of bytes. play command also
+// accepts fields of sample ref (b0..b15, w4, w12, offset, size), play without
+// ref creates new sample ref. Unknown opcodes are written as op_<number>
+
+type opcode struct {
+	name string
+	ref  bool // low 24 bits of first word are address in smpd block
+	doc  string
+}
+
+var opcodes = map[uint8]opcode{
+	1:  {"play", true, "play sample of bank stream"},
+	5:  {"unk_ref", true, "unknown, references stream id"},
+	7:  {"play_vag", true, "play sample from external bank"},
+	8:  {"goto_bank", true, "go to other bank depending on result of select"},
+	20: {"delay", false, "u4 - delay?"},
+	21: {"volume", false, "b1 - volume? (0-100)"},
+	22: {"end", false, "end of list"},
+	24: {"op_24", false, ""},
+	25: {"random", false, "b1 - random max, b2 - always 1"},
+	26: {"op_26", false, "b3, u4"},
+	27: {"op_27", false, "b1 (100)"},
+	30: {"op_30", false, "b2"},
+	31: {"op_31", false, "b1, b2, b3"},
+	34: {"select", false, "b2 - always 1, b3 - stream index, paired with goto_bank"},
+	35: {"random_end", false, "end of random choice?"},
+	36: {"op_36", false, ""},
+	39: {"op_39", false, "b1, b2"},
+	40: {"op_40", false, "b1"},
+}
+
+func opcodeByName(name string) (uint8, bool) {
+	for code, op := range opcodes {
+		if op.name == name {
+			return code, true
+		}
+	}
+	if strings.HasPrefix(name, "op_") {
+		if code, err := strconv.ParseUint(name[3:], 10, 8); err == nil {
+			return uint8(code), true
+		}
+	}
+	return 0, false
+}
+
+func opcodeName(code uint8) string {
+	if op, ok := opcodes[code]; ok {
+		return op.name
+	}
+	return fmt.Sprintf("op_%d", code)
+}
+
+type refField struct {
+	name string
+	get  func() uint32
+	set  func(uint32)
+}
+
+// sampleRefFields used for reading and writing fields of sample ref by name
+func sampleRefFields(s *SampleRef) []refField {
+	b := func(name string, p *uint8) refField {
+		return refField{name, func() uint32 { return uint32(*p) }, func(v uint32) { *p = uint8(v) }}
+	}
+	w := func(name string, p *uint16) refField {
+		return refField{name, func() uint32 { return uint32(*p) }, func(v uint32) { *p = uint16(v) }}
+	}
+	d := func(name string, p *uint32) refField {
+		return refField{name, func() uint32 { return *p }, func(v uint32) { *p = v }}
+	}
+	return []refField{
+		d("offset", &s.AdpcmOffset), d("size", &s.AdpcmSize),
+		b("b0", &s.B0), b("b1", &s.B1), b("b2", &s.B2), b("b3", &s.B3), w("w4", &s.W4),
+		b("b6", &s.B6), b("b7", &s.B7), b("b8", &s.B8), b("b9", &s.B9), b("b10", &s.B10),
+		b("b11", &s.B11), w("w12", &s.W12), b("b14", &s.B14), b("b15", &s.B15),
+	}
+}
+
+// Disassemble returns text of command
+func (c *Command) Disassemble() string {
+	parts := []string{opcodeName(c.Cmd)}
+	if opcodes[c.Cmd].ref {
+		parts = append(parts, fmt.Sprintf("ref=0x%x", c.U0&COMMAND_ADDR_MASK))
+	} else {
+		for i := 1; i < 4; i++ {
+			if c.Bytes[i] != 0 {
+				parts = append(parts, fmt.Sprintf("b%d=%d", i, c.Bytes[i]))
+			}
+		}
+	}
+	if c.U4 != 0 {
+		parts = append(parts, fmt.Sprintf("u4=%d", c.U4))
+	}
+
+	switch {
+	case c.SampleRef != nil:
+		for _, f := range sampleRefFields(c.SampleRef) {
+			switch v := f.get(); {
+			case f.name == "offset":
+				parts = append(parts, fmt.Sprintf("%s=0x%x", f.name, v))
+			case v != 0 || f.name == "size":
+				parts = append(parts, fmt.Sprintf("%s=%d", f.name, v))
+			}
+		}
+	case c.VagRef != nil:
+		return fmt.Sprintf("%-20s // vag %s", strings.Join(parts, " "), c.VagRef.Name)
+	case c.UnkRef != nil:
+		return fmt.Sprintf("%-20s // stream %d", strings.Join(parts, " "), c.UnkRef.StreamId)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Disassemble returns text of command list of sound
+func (d *BankSound) Disassemble() []string {
+	result := make([]string, 0, len(d.Commands)+1)
+	result = append(result, fmt.Sprintf("// sound %s (B0=%d B1=%d B5=%d B6=%d)", d.name, d.B0, d.B1, d.B5, d.B6))
+	for i := range d.Commands {
+		result = append(result, d.Commands[i].Disassemble())
+	}
+	return result
+}
+
+func parseOperand(s string) (string, uint32, error) {
+	kv := strings.SplitN(s, "=", 2)
+	if len(kv) != 2 {
+		return "", 0, fmt.Errorf("Operand '%s' is not key=value", s)
+	}
+	v, err := strconv.ParseUint(kv[1], 0, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("Operand '%s' value: %v", s, err)
+	}
+	return strings.ToLower(kv[0]), uint32(v), nil
+}
+
+// AssembleCommands converts text of command list to commands. References to smpd
+// block are resolved with current bank data
+func (b *Bank) AssembleCommands(text string) ([]Command, error) {
+	smpd := b.raw[b.HeaderBlockStart+b.SmpdStart : b.HeaderBlockStart+b.HeaderBlockSize]
+	bsRefs := utils.NewBufStack("smpd", smpd)
+
+	result := make([]Command, 0)
+	for iLine, line := range strings.Split(text, "\n") {
+		if i := strings.Index(line, "//"); i != -1 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		lineErr := func(err error) error {
+			return fmt.Errorf("Line %d: %v", iLine+1, err)
+		}
+
+		code, ok := opcodeByName(fields[0])
+		if !ok {
+			return nil, lineErr(fmt.Errorf("Unknown command '%s'", fields[0]))
+		}
+
+		var bytes [4]byte
+		var u4 uint32
+		ref := -1
+		refFields := make(map[string]uint32)
+		for _, operand := range fields[1:] {
+			key, v, err := parseOperand(operand)
+			if err != nil {
+				return nil, lineErr(err)
+			}
+			switch {
+			case key == "u4":
+				u4 = v
+			case key == "ref" && opcodes[code].ref:
+				// vag and unk refs are shorter than sample ref
+				refSize := 17
+				if code == COMMAND_PLAY_SAMPLE {
+					refSize = SAMPLE_REF_SIZE
+				}
+				if int(v)+refSize > len(smpd) {
+					return nil, lineErr(fmt.Errorf("Reference 0x%x is out of smpd block", v))
+				}
+				ref = int(v)
+			case code == COMMAND_PLAY_SAMPLE:
+				refFields[key] = v
+			case (key == "b1" || key == "b2" || key == "b3") && !opcodes[code].ref:
+				if v > 0xff {
+					return nil, lineErr(fmt.Errorf("Operand '%s' is not byte", operand))
+				}
+				bytes[key[1]-'0'] = byte(v)
+			default:
+				return nil, lineErr(fmt.Errorf("Unknown operand '%s' of '%s'", key, fields[0]))
+			}
+		}
+		if opcodes[code].ref && ref < 0 && code != COMMAND_PLAY_SAMPLE {
+			return nil, lineErr(fmt.Errorf("Command '%s' requires ref", fields[0]))
+		}
+
+		bytes[0] = code
+		u0 := binary.BigEndian.Uint32(bytes[:])
+		if ref >= 0 {
+			u0 |= uint32(ref)
+		}
+
+		var raw [COMMAND_SIZE]byte
+		b.bo.PutUint32(raw[0:], u0)
+		b.bo.PutUint32(raw[4:], u4)
+		var c Command
+		if code == COMMAND_PLAY_SAMPLE && ref < 0 {
+			// new sample ref
+			c.U0, c.U4, c.Cmd = u0, u4, code
+			binary.BigEndian.PutUint32(c.Bytes[:], u0)
+			c.SampleRef = &SampleRef{addr: -1}
+			if _, ok := refFields["size"]; !ok {
+				return nil, lineErr(fmt.Errorf("Play of new sample requires size"))
+			}
+		} else {
+			c.Parse(b.bo, bsRefs, raw[:])
+		}
+
+		if c.SampleRef != nil {
+			original := *c.SampleRef
+			known := make(map[string]bool)
+			for _, f := range sampleRefFields(c.SampleRef) {
+				known[f.name] = true
+				if v, ok := refFields[f.name]; ok {
+					f.set(v)
+				}
+			}
+			keys := make([]string, 0)
+			for key := range refFields {
+				if !known[key] {
+					keys = append(keys, key)
+				}
+			}
+			if len(keys) != 0 {
+				sort.Strings(keys)
+				return nil, lineErr(fmt.Errorf("Unknown sample fields %v", keys))
+			}
+			if *c.SampleRef != original {
+				// ref can be used by other commands, so changed ref is written as new one
+				c.SampleRef.addr = -1
+			}
+		}
+		result = append(result, c)
+	}
+	if len(result) > 0xff {
+		return nil, fmt.Errorf("Too many commands (%d)", len(result))
+	}
+	return result, nil
+}
+
+// SetCommands assembles text and replaces command list of sound
+func (sbk *SBK) SetCommands(name string, text string) error {
+	bs, err := sbk.bankSound(name)
+	if err != nil {
+		return err
+	}
+	commands, err := sbk.Bank.AssembleCommands(text)
+	if err != nil {
+		return err
+	}
+	bs.Commands = commands
+	return nil
+}
+
+// CommandsHelp returns description of known opcodes as comments
+func CommandsHelp() []string {
+	codes := make([]int, 0, len(opcodes))
+	for code := range opcodes {
+		codes = append(codes, int(code))
+	}
+	sort.Ints(codes)
+
+	result := make([]string, 0, len(codes))
+	for _, code := range codes {
+		op := opcodes[uint8(code)]
+		result = append(result, fmt.Sprintf("// %2d %-12s %s", code, op.name, op.doc))
+	}
+	return result
+}
+
+func (sbk *SBK) DumpText() []string {
+	result := make([]string, 0)
+	if sbk.IsVagFiles {
+		for _, snd := range sbk.Sounds {
+			result = append(result, fmt.Sprintf("// vag %s", snd.Name))
+		}
+	} else {
+		for i := range sbk.Bank.BankSounds {
+			result = append(result, sbk.Bank.BankSounds[i].Disassemble()...)
+		}
+	}
+	return result
+}
@@ -0,0 +1,60 @@
+package sbk
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCommandsRoundTrip(t *testing.T) {
+	orig := makeSblk()
+	sbk := parse(t, orig)
+	for _, snd := range sbk.Sounds {
+		text := strings.Join(sbk.Bank.BankSounds[snd.StreamId].Disassemble(), "\n")
+		if err := sbk.SetCommands(snd.Name, text); err != nil {
+			t.Fatalf("Failed to assemble %q: %v", text, err)
+		}
+	}
+	if data := marshal(t, sbk); !bytes.Equal(data, orig) {
+		t.Fatalf("Reassembled bank differs from original:\n%x\n%x", data, orig)
+	}
+}
+
+func TestCommandsEdit(t *testing.T) {
+	sbk := parse(t, makeSblk())
+	text := `
+		random b1=3 b2=1
+		delay u4=100 // changed delay
+		play ref=0x0 b2=0x41
+		play offset=0x10 size=16 b2=0x30
+		op_99 b3=7
+		end`
+	if err := sbk.SetCommands("snd_b", text); err != nil {
+		t.Fatal(err)
+	}
+	sbk = parse(t, marshal(t, sbk))
+
+	cmds := sbk.Bank.BankSounds[1].Commands
+	if len(cmds) != 6 {
+		t.Fatalf("Wrong commands count %d", len(cmds))
+	}
+	if cmds[0].Cmd != 25 || cmds[0].Bytes[1] != 3 || cmds[0].Bytes[2] != 1 || cmds[1].U4 != 100 || cmds[4].Cmd != 99 || cmds[4].Bytes[3] != 7 {
+		t.Errorf("Wrong commands %+v", cmds)
+	}
+	// changed ref is written as new one, original is used by first sound
+	if ref := cmds[2].SampleRef; ref.B2 != 0x41 || ref.AdpcmSize != 32 || ref.addr == 0 {
+		t.Errorf("Wrong changed sample ref %+v", ref)
+	}
+	if ref := sbk.Bank.BankSounds[0].Commands[0].SampleRef; ref.B2 != 0x40 {
+		t.Errorf("Sample ref of other sound changed %+v", ref)
+	}
+	if ref := cmds[3].SampleRef; ref.AdpcmOffset != 0x10 || ref.AdpcmSize != 16 {
+		t.Errorf("Wrong new sample ref %+v", ref)
+	}
+
+	for _, bad := range []string{"unknown_op", "play_vag", "delay b1=300", "play ref=0x1000", "delay x=1"} {
+		if err := sbk.SetCommands("snd_b", bad); err == nil {
+			t.Errorf("No error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package sbk
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+
+	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
+	"github.com/mogaika/god_of_war_browser/ps2/vagp"
+)
+
+// Sbk as sampler instrument: every sound mapped to own key, sounds above
+// 128 go to next instrument. Samples played by sound are regions of the key,
+// samples between random and random_end commands are alternatives of choice
+
+const (
+	COMMAND_VOLUME     = 21
+	COMMAND_RANDOM     = 25
+	COMMAND_RANDOM_END = 35
+
+	INSTRUMENT_KEYS = 128
+
+	// envelope time used for infinite or unknown rates
+	ENVELOPE_MAX_TIME = 100.0
+)
+
+// InstrumentSample is decoded mono sample
+type InstrumentSample struct {
+	Name      string
+	Rate      uint32
+	Pcm       []int16
+	LoopStart int // -1 if sample is not looped
+	LoopEnd   int // exclusive
+}
+
+// InstrumentRegion is sample played on key of sound
+type InstrumentRegion struct {
+	Sound       string
+	Key         int
+	Instrument  int
+	Sample      *InstrumentSample
+	Volume      float64 // dB
+	Attack      float64 // seconds
+	Release     float64 // seconds
+	RandomIndex int
+	RandomCount int // 0 if region played always
+}
+
+func decodeSample(name string, rate uint32, data []byte) (*InstrumentSample, error) {
+	pcm, loopStart, loopEnd, err := adpcm.UnpackLooped(data, 1)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot decode sample %s: %v", name, err)
+	}
+	smp := &InstrumentSample{
+		Name:      name,
+		Rate:      rate,
+		Pcm:       make([]int16, len(pcm)/2),
+		LoopStart: loopStart,
+		LoopEnd:   loopEnd,
+	}
+	for i := range smp.Pcm {
+		smp.Pcm[i] = int16(uint16(pcm[i*2]) | uint16(pcm[i*2+1])<<8)
+	}
+	return smp, nil
+}
+
+// envelopeTime estimates time of SPU envelope phase in seconds.
+// rate is 7 bit rate of ADSR (shift<<2 | step), level change is from max to zero,
+// exponential decrease estimated to -60 dB
+func envelopeTime(rate int, increase bool, exponential bool) float64 {
+	if rate >= 0x7f {
+		return ENVELOPE_MAX_TIME
+	}
+	shift, step := rate>>2, rate&3
+	var stepValue float64
+	if increase {
+		stepValue = float64(7 - step)
+	} else {
+		stepValue = float64(8 - step)
+	}
+	cycles := 1.0
+	if shift < 11 {
+		stepValue *= float64(int(1) << uint(11-shift))
+	} else {
+		cycles = float64(int(1) << uint(shift-11))
+	}
+
+	samples := 0x7fff / stepValue * cycles
+	if exponential && !increase {
+		samples = math.Log(1000) * 0x8000 / stepValue * cycles
+	}
+	t := samples / SPU_BASE_RATE
+	if t > ENVELOPE_MAX_TIME {
+		t = ENVELOPE_MAX_TIME
+	}
+	return t
+}
+
+// Envelope returns attack and release time of sample in seconds.
+// B10,B11 treated as ADSR1 register and W12 as ADSR2 register of SPU
+func (s *SampleRef) Envelope() (attack float64, release float64) {
+	adsr1 := uint16(s.B10)<<8 | uint16(s.B11)
+	adsr2 := s.W12
+	attack = envelopeTime(int(adsr1>>8)&0x7f, true, adsr1&0x8000 != 0)
+	release = envelopeTime(int(adsr2&0x1f)<<2, false, adsr2&0x20 != 0)
+	return attack, release
+}
+
+func volumeDb(v, max uint8) float64 {
+	if v == 0 || v >= max {
+		return 0
+	}
+	return 20 * math.Log10(float64(v)/float64(max))
+}
+
+// Instrument decodes samples of sbk and maps sounds to keys
+func (sbk *SBK) Instrument() ([]*InstrumentSample, []InstrumentRegion, error) {
+	samples := make([]*InstrumentSample, 0)
+	regions := make([]InstrumentRegion, 0)
+
+	if sbk.IsVagFiles {
+		for i, data := range sbk.vags() {
+			vag, err := vagp.NewVAGPFromReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, nil, fmt.Errorf("Cannot read vag of sound %s: %v", sbk.Sounds[i].Name, err)
+			}
+			smp, err := decodeSample(sbk.Sounds[i].Name, vag.SampleRate, vag.ChannelData(0))
+			if err != nil {
+				return nil, nil, err
+			}
+			samples = append(samples, smp)
+			regions = append(regions, InstrumentRegion{
+				Sound:      sbk.Sounds[i].Name,
+				Key:        i % INSTRUMENT_KEYS,
+				Instrument: i / INSTRUMENT_KEYS,
+				Sample:     smp,
+			})
+		}
+		return samples, regions, nil
+	}
+
+	type sampleKey struct{ offset, size uint32 }
+	decoded := make(map[sampleKey]*InstrumentSample)
+
+	for i, snd := range sbk.Sounds {
+		bs := &sbk.Bank.BankSounds[snd.StreamId]
+		volume := 0.0
+		random := -1 // index of first region of random choice
+
+		for _, c := range bs.Commands {
+			switch c.Cmd {
+			case COMMAND_VOLUME:
+				volume = volumeDb(c.Bytes[1], 100)
+			case COMMAND_RANDOM:
+				random = len(regions)
+			case COMMAND_RANDOM_END:
+				if random >= 0 {
+					for j := random; j < len(regions); j++ {
+						regions[j].RandomIndex = j - random
+						regions[j].RandomCount = len(regions) - random
+					}
+				}
+				random = -1
+			case COMMAND_PLAY_SAMPLE:
+				ref := c.SampleRef
+				if ref == nil {
+					continue
+				}
+				key := sampleKey{ref.AdpcmOffset, ref.AdpcmSize}
+				smp, ok := decoded[key]
+				if !ok {
+					if int(ref.AdpcmOffset+ref.AdpcmSize) > len(sbk.Bank.stream) {
+						return nil, nil, fmt.Errorf("Sample 0x%x of sound %s is out of stream block", ref.AdpcmOffset, snd.Name)
+					}
+					var err error
+					smp, err = decodeSample(fmt.Sprintf("smp_%06x_%x", ref.AdpcmOffset, ref.AdpcmSize), ref.SampleRate(),
+						sbk.Bank.stream[ref.AdpcmOffset:ref.AdpcmOffset+ref.AdpcmSize])
+					if err != nil {
+						return nil, nil, err
+					}
+					decoded[key] = smp
+					samples = append(samples, smp)
+				}
+				attack, release := ref.Envelope()
+				regions = append(regions, InstrumentRegion{
+					Sound:      snd.Name,
+					Key:        i % INSTRUMENT_KEYS,
+					Instrument: i / INSTRUMENT_KEYS,
+					Sample:     smp,
+					Volume:     volume + volumeDb(ref.B1, 127),
+					Attack:     attack,
+					Release:    release,
+				})
+			}
+		}
+	}
+	return samples, regions, nil
+}
@@ -0,0 +1,55 @@
+package sbk
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestInstrumentExport(t *testing.T) {
+	sbk := parse(t, makeSblk())
+
+	samples, regions, err := sbk.Instrument()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(samples) != 2 || len(regions) != 2 {
+		t.Fatalf("Wrong count of samples %d or regions %d", len(samples), len(regions))
+	}
+	if regions[0].Key != 0 || regions[1].Key != 1 || regions[1].Sound != "snd_b" {
+		t.Errorf("Wrong keys of sounds %+v", regions)
+	}
+	// rate is heuristic (see SampleRef.SampleRate), checked only to catch unintended changes
+	if rate := samples[0].Rate; rate != 38098 {
+		t.Errorf("Wrong rate of sample %d", rate)
+	}
+
+	var buf bytes.Buffer
+	if err := sbk.ExportSfz(&buf, "test"); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 3 || zr.File[2].Name != "test.sfz" {
+		t.Fatalf("Wrong files in archive")
+	}
+	f, _ := zr.File[2].Open()
+	sfz, _ := ioutil.ReadAll(f)
+	if !strings.Contains(string(sfz), "sample=samples/smp_000020_10.wav key=1 pitch_keycenter=1") {
+		t.Errorf("Wrong sfz:\n%s", sfz)
+	}
+
+	buf.Reset()
+	if err := sbk.ExportSf2(&buf, "test"); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	if string(data[0:4]) != "RIFF" || string(data[8:12]) != "sfbk" || int(binary.LittleEndian.Uint32(data[4:]))+8 != len(data) {
+		t.Errorf("Wrong sf2 header %q", data[:12])
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"encoding/binary"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -21,6 +23,14 @@ const SBK_SBLK_MAGIC = 0x18
 const SBK_VAG_MAGIC = 0x40018
 const GOW2_SBP_MAGIC = 0x00000015
 
+const (
+	SPU_BASE_RATE       = 48000
+	SAMPLE_DEFAULT_RATE = 22050
+	SAMPLE_MIN_RATE     = 1000
+	SAMPLE_MAX_RATE     = 96000
+	SAMPLE_MAX_LOOPS    = 16 // limit of loops of sample played by web ui
+)
+
 type Sound struct {
 	Name     string
 	StreamId uint32 // file offset for vag
@@ -49,8 +59,8 @@ type SampleRef struct {
 	// https://github.com/PCSX2/pcsx2/blob/master/pcsx2/SPU2/defs.h#L115
 	B0  uint8
 	B1  uint8
-	B2  uint8 // Pitch or speed related
-	B3  uint8
+	B2  uint8 // Pitch or speed related, looks like center note of tone (see SampleRate)
+	B3  uint8 // Fine tune of center note?
 	W4  uint16
 	B6  uint8 // 0
 	B7  uint8 // 0
@@ -64,6 +74,24 @@ type SampleRef struct {
 
 	AdpcmOffset uint32
 	AdpcmSize   uint32
+
+	GuessedRate uint32 // filled by Marshal for web ui, see SampleRate
+
+	addr int // offset in smpd block, -1 for new refs
+}
+
+// SampleRate returns guessed playback rate of sample. This is heuristic, not taken
+// from game code and not checked against game: B2 and B3 are treated as center note
+// and fine tune (1/128 of semitone) of tone, and note 60 assumed to be played at
+// SPU base rate 48000. Web ui allows to override it.
+// Falls back to SAMPLE_DEFAULT_RATE if result is not sane
+func (s *SampleRef) SampleRate() uint32 {
+	semitones := 60 - (float64(s.B2) + float64(s.B3)/128)
+	rate := SPU_BASE_RATE * math.Pow(2, semitones/12)
+	if rate < SAMPLE_MIN_RATE || rate > SAMPLE_MAX_RATE {
+		return SAMPLE_DEFAULT_RATE
+	}
+	return uint32(rate + 0.5)
 }
 
 func (s *SampleRef) Parse(bo binary.ByteOrder, b []byte) {
@@ -85,6 +113,25 @@ func (s *SampleRef) Parse(bo binary.ByteOrder, b []byte) {
 	s.AdpcmSize = bo.Uint32(b[20:])
 }
 
+func (s *SampleRef) Marshal(bo binary.ByteOrder, b []byte) {
+	b[0] = s.B0
+	b[1] = s.B1
+	b[2] = s.B2
+	b[3] = s.B3
+	bo.PutUint16(b[4:], s.W4)
+	b[6] = s.B6
+	b[7] = s.B7
+	b[8] = s.B8
+	b[9] = s.B9
+	b[10] = s.B10
+	b[11] = s.B11
+	bo.PutUint16(b[12:], s.W12)
+	b[14] = s.B14
+	b[15] = s.B15
+	bo.PutUint32(b[16:], s.AdpcmOffset)
+	bo.PutUint32(b[20:], s.AdpcmSize)
+}
+
 type Command struct {
 	/*
 		55f0 or 55e8
@@ -131,7 +178,7 @@ func (c *Command) Parse(bo binary.ByteOrder, bsRefs *utils.BufStack, b []byte) {
 
 	switch c.Cmd {
 	case 1:
-		c.SampleRef = &SampleRef{}
+		c.SampleRef = &SampleRef{addr: addr}
 		c.SampleRef.Parse(bo, bsRefs.Raw()[addr:])
 		bsRefs.SubBuf("cmd_1_sam", addr)
 	case 5:
@@ -154,7 +201,9 @@ func (c *Command) Parse(bo binary.ByteOrder, bsRefs *utils.BufStack, b []byte) {
 type BankSound struct {
 	name          string
 	Commands      []Command
+	Disassembly   []string
 	commandOffset uint32
+	info          [0xc]byte
 
 	B0 uint8
 	B1 uint8
@@ -163,6 +212,7 @@ type BankSound struct {
 }
 
 func (d *BankSound) Parse(bo binary.ByteOrder, b []byte) {
+	copy(d.info[:], b)
 	d.B0 = b[0]
 	d.B1 = b[1]
 
@@ -213,18 +263,22 @@ type Bank struct {
 	BankSounds    []BankSound
 
 	SmpdStart uint32
+
+	bo     binary.ByteOrder
+	raw    []byte // whole bank, used by writer
+	stream []byte // copy of stream block changed by editor
 }
 
 func (b *Bank) parseHeader(bo binary.ByteOrder, bsHeader *utils.BufStack) error {
 	b.PseudoName = utils.ReverseString(utils.BytesToString(bsHeader.Raw()[0xc:0x10]))
 	b.SoundsCount = bsHeader.EU16(bo, 0x16)
-	commandsStart := bsHeader.EU32(bo, 0x20)
+	b.CommandsStart = bsHeader.EU32(bo, 0x20)
 	b.AdpcmSize = bsHeader.EU32(bo, 0x28)
 	b.SomeInt2 = bsHeader.EU32(bo, 0x2c)
 	b.SmpdStart = bsHeader.EU32(bo, 0x34)
 
 	bsSoundsInfo := bsHeader.SubBuf("sounds_info", 0x40).SetSize(0xc * int(b.SoundsCount))
-	bsCommands := bsHeader.SubBuf("commands", int(commandsStart)).SetSize(int(b.SmpdStart) - int(commandsStart))
+	bsCommands := bsHeader.SubBuf("commands", int(b.CommandsStart)).SetSize(int(b.SmpdStart) - int(b.CommandsStart))
 	bsSMPD := bsHeader.SubBuf("smpd_streams", int(b.SmpdStart)).Expand()
 
 	b.BankSounds = make([]BankSound, b.SoundsCount)
@@ -240,6 +294,9 @@ type SBK struct {
 	Sounds     []Sound
 	IsVagFiles bool // if false - than Bank present
 	Bank       *Bank
+
+	raw      []byte   // whole tag data, used by writer
+	vagsData [][]byte // vag files changed by writer
 }
 
 func (sbk *SBK) loadBank(bsBank *utils.BufStack) error {
@@ -254,6 +311,8 @@ func (sbk *SBK) loadBank(bsBank *utils.BufStack) error {
 	}
 
 	sbk.Bank = &Bank{
+		bo:               bo,
+		raw:              bsBank.Raw(),
 		HeaderBlockStart: bsBankInfo.EU32(bo, 0x8),
 		HeaderBlockSize:  bsBankInfo.EU32(bo, 0xc),
 		StreamBlockStart: bsBankInfo.EU32(bo, 0x10),
@@ -266,6 +325,7 @@ func (sbk *SBK) loadBank(bsBank *utils.BufStack) error {
 	if sbk.Bank.StreamBlockSize != 0 {
 		sbk.Bank.StreamBlock = bsBank.SubBuf("bank_stream",
 			int(sbk.Bank.StreamBlockStart)).SetSize(int(sbk.Bank.StreamBlockSize))
+		sbk.Bank.stream = append([]byte{}, sbk.Bank.StreamBlock.Raw()...)
 	}
 
 	return sbk.Bank.parseHeader(bo, bsBankHeader)
@@ -282,6 +342,7 @@ func NewFromData(bs *utils.BufStack, isSblk bool) (*SBK, error) {
 	sbk := &SBK{
 		Sounds:     make([]Sound, soundsCount),
 		IsVagFiles: !isSblk,
+		raw:        bs.Raw(),
 	}
 
 	bsSoundInfo := bsHead.SubBufFollowing("sounds_info").SetSize(28 * int(soundsCount))
@@ -306,20 +367,44 @@ func NewFromData(bs *utils.BufStack, isSblk bool) (*SBK, error) {
 	return sbk, nil
 }
 
-func (sbk *SBK) httpSendBankSMPD(w http.ResponseWriter, wrsrc *wad.WadNodeRsrc, offset, size int) {
-	w.Header().Add("Content-Type", "audio/wav")
+// httpSendBankSMPD sends sample as wav. Rate of tone is guessed (see SampleRate),
+// so it can be set by user, zero rate means guessed one
+func (sbk *SBK) httpSendBankSMPD(w http.ResponseWriter, wrsrc *wad.WadNodeRsrc, offset, size int, loops int, rate uint32) {
+	if offset < 0 || size < 0 || offset+size > len(sbk.Bank.stream) {
+		webutils.WriteError(w, fmt.Errorf("Sample 0x%x (%d bytes) is out of stream block", offset, size))
+		return
+	}
+	if rate != 0 && (rate < SAMPLE_MIN_RATE || rate > SAMPLE_MAX_RATE) {
+		webutils.WriteError(w, fmt.Errorf("Rate %d is out of range %d-%d", rate, SAMPLE_MIN_RATE, SAMPLE_MAX_RATE))
+		return
+	}
 
-	webutils.WriteFileHeaders(w, fmt.Sprintf("%s_%d_%d.WAV", wrsrc.Tag.Name, offset, size))
+	if rate == 0 {
+		rate = SAMPLE_DEFAULT_RATE
+		for _, ref := range sbk.Bank.sampleRefs(uint32(offset)) {
+			if ref.AdpcmSize == uint32(size) {
+				rate = ref.SampleRate()
+				break
+			}
+		}
+	}
 
-	if err := utils.WaveWriteHeader(w, 1, 22050, uint32((size/16)*28*2)); err != nil {
+	pcm, loopStart, loopEnd, err := adpcm.UnpackLooped(sbk.Bank.stream[offset:offset+size], loops)
+	if err != nil {
 		webutils.WriteError(w, err)
+		return
 	}
 
-	adpcmstream := adpcm.NewAdpcmToWaveStream(w)
-
-	if _, err := adpcmstream.Write(sbk.Bank.StreamBlock.Raw()[offset : offset+size]); err != nil {
+	var buf bytes.Buffer
+	// bank samples are mono, stereo sounds use several play commands
+	if err := utils.WaveWriteHeaderLoop(&buf, 1, rate, uint32(len(pcm)), loopStart, loopEnd); err != nil {
 		webutils.WriteError(w, err)
+		return
 	}
+	buf.Write(pcm)
+
+	w.Header().Add("Content-Type", "audio/wav")
+	webutils.WriteFile(w, &buf, fmt.Sprintf("%s_%d_%d.WAV", wrsrc.Tag.Name, offset, size))
 }
 
 func (sbk *SBK) httpSendSound(w http.ResponseWriter, wrsrc *wad.WadNodeRsrc, sndName string, needWav bool) {
@@ -370,8 +455,39 @@ func (sbk *SBK) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *htt
 		var offset, size int
 		fmt.Sscan(r.URL.Query().Get("offset"), &offset)
 		fmt.Sscan(r.URL.Query().Get("size"), &size)
+		loops := 1
+		if l := r.URL.Query().Get("loops"); l != "" {
+			fmt.Sscan(l, &loops)
+		}
+		if loops > SAMPLE_MAX_LOOPS {
+			loops = SAMPLE_MAX_LOOPS
+		}
+
+		var rate uint32
+		fmt.Sscan(r.URL.Query().Get("rate"), &rate)
 
-		sbk.httpSendBankSMPD(w, wrsrc, offset, size)
+		sbk.httpSendBankSMPD(w, wrsrc, offset, size, loops, rate)
+	case "sfz":
+		var buf bytes.Buffer
+		if err := sbk.ExportSfz(&buf, wrsrc.Name()); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteFile(w, &buf, wrsrc.Name()+".zip")
+	case "sf2":
+		var buf bytes.Buffer
+		if err := sbk.ExportSf2(&buf, wrsrc.Name()); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteFile(w, &buf, wrsrc.Name()+".sf2")
+	case "disasm":
+		text := append(CommandsHelp(), sbk.DumpText()...)
+		webutils.WriteFile(w, strings.NewReader(strings.Join(text, "\n")), wrsrc.Name()+".txt")
+	case "replacesmpd", "replacevag", "addsound", "removesound", "asm":
+		if err := sbk.httpEdit(wrsrc, r, action); err != nil {
+			webutils.WriteError(w, err)
+		}
 	default:
 		log.Printf("Unknown action: %v", action)
 	}
@@ -379,18 +495,28 @@ func (sbk *SBK) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *htt
 }
 
 func (sbk *SBK) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
+	if sbk.Bank != nil {
+		for i := range sbk.Bank.BankSounds {
+			sbk.Bank.BankSounds[i].Disassembly = sbk.Bank.BankSounds[i].Disassemble()
+			for _, c := range sbk.Bank.BankSounds[i].Commands {
+				if c.SampleRef != nil {
+					c.SampleRef.GuessedRate = c.SampleRef.SampleRate()
+				}
+			}
+		}
+	}
 	return sbk, nil
 }
 
 func init() {
 	wad.SetHandler(config.GOW1, SBK_SBLK_MAGIC, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
-		return NewFromData(utils.NewBufStack("sblk", wrsrc.Tag.Data), true)
+		return NewFromData(wrsrc.NewBufStack("sblk"), true)
 	})
 	wad.SetHandler(config.GOW1, SBK_VAG_MAGIC, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
-		return NewFromData(utils.NewBufStack("sbk_vag", wrsrc.Tag.Data), false)
+		return NewFromData(wrsrc.NewBufStack("sbk_vag"), false)
 	})
 
 	wad.SetHandler(config.GOW2, GOW2_SBP_MAGIC, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
-		return NewFromData(utils.NewBufStack("sbp_vag", wrsrc.Tag.Data), true)
+		return NewFromData(wrsrc.NewBufStack("sbp_vag"), true)
 	})
 }
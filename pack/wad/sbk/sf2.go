@@ -0,0 +1,186 @@
+package sbk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+)
+
+// SoundFont 2.01 generators
+const (
+	SF2_GEN_ATTACK_VOL_ENV      = 34
+	SF2_GEN_RELEASE_VOL_ENV     = 38
+	SF2_GEN_INSTRUMENT          = 41
+	SF2_GEN_KEY_RANGE           = 43
+	SF2_GEN_INITIAL_ATTENUATION = 48
+	SF2_GEN_SAMPLE_ID           = 53
+	SF2_GEN_SAMPLE_MODES        = 54
+	SF2_GEN_OVERRIDING_ROOT_KEY = 58
+
+	SF2_SAMPLE_MONO = 1
+
+	// zero samples after every sample required by specification
+	SF2_SAMPLE_PADDING = 46
+	SF2_NAME_SIZE      = 20
+)
+
+type sf2Gen struct {
+	Oper   uint16
+	Amount int16
+}
+
+// sf2String returns zero terminated string of even size
+func sf2String(s string) []byte {
+	result := append([]byte(s), 0)
+	if len(result)%2 != 0 {
+		result = append(result, 0)
+	}
+	return result
+}
+
+func sf2Name(name string) [SF2_NAME_SIZE]byte {
+	var result [SF2_NAME_SIZE]byte
+	copy(result[:SF2_NAME_SIZE-1], name)
+	return result
+}
+
+// sf2Timecents converts seconds to timecents of envelope generators
+func sf2Timecents(seconds float64) int16 {
+	if seconds <= 0.001 {
+		return -12000
+	}
+	return int16(math.Round(1200 * math.Log2(seconds)))
+}
+
+type riffWriter struct {
+	buf bytes.Buffer
+}
+
+func (rw *riffWriter) chunk(id string, data []byte) {
+	rw.buf.WriteString(id)
+	binary.Write(&rw.buf, binary.LittleEndian, uint32(len(data)))
+	rw.buf.Write(data)
+	if len(data)%2 != 0 {
+		rw.buf.WriteByte(0)
+	}
+}
+
+func (rw *riffWriter) list(id string, listType string, content *riffWriter) {
+	rw.chunk(id, append([]byte(listType), content.buf.Bytes()...))
+}
+
+func sf2Struct(v ...interface{}) []byte {
+	var buf bytes.Buffer
+	for _, field := range v {
+		binary.Write(&buf, binary.LittleEndian, field)
+	}
+	return buf.Bytes()
+}
+
+// ExportSf2 writes sbk as SoundFont 2 file. Every instrument of sbk (128 sounds)
+// becomes preset with program number of instrument. Random choice can not be
+// described by soundfont, so only first alternative is used
+func (sbk *SBK) ExportSf2(w io.Writer, name string) error {
+	samples, regions, err := sbk.Instrument()
+	if err != nil {
+		return err
+	}
+
+	// sample data
+	var smpl bytes.Buffer
+	var shdr bytes.Buffer
+	sampleIds := make(map[*InstrumentSample]int)
+	for i, smp := range samples {
+		sampleIds[smp] = i
+		start := uint32(smpl.Len() / 2)
+		binary.Write(&smpl, binary.LittleEndian, smp.Pcm)
+		smpl.Write(make([]byte, SF2_SAMPLE_PADDING*2))
+
+		loopStart, loopEnd := start, start
+		if smp.LoopStart >= 0 {
+			loopStart, loopEnd = start+uint32(smp.LoopStart), start+uint32(smp.LoopEnd)
+		}
+		shdr.Write(sf2Struct(sf2Name(smp.Name), start, start+uint32(len(smp.Pcm)), loopStart, loopEnd,
+			smp.Rate, uint8(60), int8(0), uint16(0), uint16(SF2_SAMPLE_MONO)))
+	}
+	shdr.Write(sf2Struct(sf2Name("EOS"), make([]byte, 26)))
+
+	// instruments, one zone per region
+	instruments := 0
+	if len(regions) != 0 {
+		instruments = regions[len(regions)-1].Instrument + 1
+	}
+	var inst, ibag, igen bytes.Buffer
+	genCount, zoneCount := 0, 0
+	for i := 0; i < instruments; i++ {
+		inst.Write(sf2Struct(sf2Name(instrumentFileName(name, i)), uint16(zoneCount)))
+		for _, r := range regions {
+			if r.Instrument != i || r.RandomIndex != 0 {
+				continue
+			}
+			gens := []sf2Gen{
+				// key range must be first and sample id last
+				{SF2_GEN_KEY_RANGE, int16(r.Key) | int16(r.Key)<<8},
+				{SF2_GEN_OVERRIDING_ROOT_KEY, int16(r.Key)},
+				{SF2_GEN_ATTACK_VOL_ENV, sf2Timecents(r.Attack)},
+				{SF2_GEN_RELEASE_VOL_ENV, sf2Timecents(r.Release)},
+			}
+			if r.Volume < 0 {
+				gens = append(gens, sf2Gen{SF2_GEN_INITIAL_ATTENUATION, int16(math.Round(-r.Volume * 10))})
+			}
+			if r.Sample.LoopStart >= 0 {
+				gens = append(gens, sf2Gen{SF2_GEN_SAMPLE_MODES, 1})
+			}
+			gens = append(gens, sf2Gen{SF2_GEN_SAMPLE_ID, int16(sampleIds[r.Sample])})
+
+			ibag.Write(sf2Struct(uint16(genCount), uint16(0)))
+			for _, g := range gens {
+				igen.Write(sf2Struct(g))
+			}
+			genCount += len(gens)
+			zoneCount++
+		}
+	}
+	inst.Write(sf2Struct(sf2Name("EOI"), uint16(zoneCount)))
+	ibag.Write(sf2Struct(uint16(genCount), uint16(0)))
+	igen.Write(make([]byte, 4))
+
+	// presets, one zone with instrument per preset
+	var phdr, pbag, pgen bytes.Buffer
+	for i := 0; i < instruments; i++ {
+		phdr.Write(sf2Struct(sf2Name(instrumentFileName(name, i)), uint16(i), uint16(0), uint16(i),
+			uint32(0), uint32(0), uint32(0)))
+		pbag.Write(sf2Struct(uint16(i), uint16(0)))
+		pgen.Write(sf2Struct(sf2Gen{SF2_GEN_INSTRUMENT, int16(i)}))
+	}
+	phdr.Write(sf2Struct(sf2Name("EOP"), uint16(0), uint16(0), uint16(instruments), uint32(0), uint32(0), uint32(0)))
+	pbag.Write(sf2Struct(uint16(instruments), uint16(0)))
+	pgen.Write(make([]byte, 4))
+
+	var info, sdta, pdta, sfbk riffWriter
+	info.chunk("ifil", sf2Struct(uint16(2), uint16(1)))
+	info.chunk("isng", sf2String("EMU8000"))
+	info.chunk("INAM", sf2String(name))
+
+	sdta.chunk("smpl", smpl.Bytes())
+
+	pdta.chunk("phdr", phdr.Bytes())
+	pdta.chunk("pbag", pbag.Bytes())
+	pdta.chunk("pmod", make([]byte, 10))
+	pdta.chunk("pgen", pgen.Bytes())
+	pdta.chunk("inst", inst.Bytes())
+	pdta.chunk("ibag", ibag.Bytes())
+	pdta.chunk("imod", make([]byte, 10))
+	pdta.chunk("igen", igen.Bytes())
+	pdta.chunk("shdr", shdr.Bytes())
+
+	sfbk.list("LIST", "INFO", &info)
+	sfbk.list("LIST", "sdta", &sdta)
+	sfbk.list("LIST", "pdta", &pdta)
+
+	var riff riffWriter
+	riff.list("RIFF", "sfbk", &sfbk)
+	_, err = w.Write(riff.buf.Bytes())
+	return err
+}
@@ -0,0 +1,98 @@
+package sbk
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+func instrumentFileName(name string, instrument int) string {
+	if instrument == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s_%d", name, instrument)
+}
+
+func writeSampleWav(w io.Writer, smp *InstrumentSample) error {
+	if err := utils.WaveWriteHeaderLoop(w, 1, smp.Rate, uint32(len(smp.Pcm)*2), smp.LoopStart, smp.LoopEnd); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, smp.Pcm)
+}
+
+// writeSfz writes sfz text of instrument, samples referenced from samples directory
+func writeSfz(w io.Writer, regions []InstrumentRegion, instrument int) {
+	lastSound := ""
+	for _, r := range regions {
+		if r.Instrument != instrument {
+			continue
+		}
+		if r.Sound != lastSound {
+			fmt.Fprintf(w, "\n// sound %s\n", r.Sound)
+			lastSound = r.Sound
+		}
+		fmt.Fprintf(w, "<region> sample=samples/%s.wav key=%d pitch_keycenter=%d", r.Sample.Name, r.Key, r.Key)
+		if r.Volume != 0 {
+			fmt.Fprintf(w, " volume=%.2f", r.Volume)
+		}
+		if r.Attack != 0 {
+			fmt.Fprintf(w, " ampeg_attack=%.4f", r.Attack)
+		}
+		if r.Release != 0 {
+			fmt.Fprintf(w, " ampeg_release=%.4f", r.Release)
+		}
+		if r.Sample.LoopStart >= 0 {
+			fmt.Fprintf(w, " loop_mode=loop_continuous loop_start=%d loop_end=%d", r.Sample.LoopStart, r.Sample.LoopEnd-1)
+		}
+		if r.RandomCount != 0 {
+			fmt.Fprintf(w, " lorand=%.4f hirand=%.4f",
+				float64(r.RandomIndex)/float64(r.RandomCount), float64(r.RandomIndex+1)/float64(r.RandomCount))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// ExportSfz writes zip archive with sfz instruments and wav samples of sbk.
+// Every sound mapped to own key, see Instrument
+func (sbk *SBK) ExportSfz(w io.Writer, name string) error {
+	samples, regions, err := sbk.Instrument()
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	for _, smp := range samples {
+		f, err := zw.Create("samples/" + smp.Name + ".wav")
+		if err != nil {
+			return errors.Wrapf(err, "Can't create zip file for sample %q", smp.Name)
+		}
+		if err := writeSampleWav(f, smp); err != nil {
+			return errors.Wrapf(err, "Can't write sample %q", smp.Name)
+		}
+	}
+
+	instruments := 0
+	if len(regions) != 0 {
+		instruments = regions[len(regions)-1].Instrument + 1
+	}
+	for i := 0; i < instruments; i++ {
+		var buf bytes.Buffer
+		fmt.Fprintf(&buf, "// %s exported from sound bank %s\n", instrumentFileName(name, i), name)
+		writeSfz(&buf, regions, i)
+
+		f, err := zw.Create(instrumentFileName(name, i) + ".sfz")
+		if err != nil {
+			return errors.Wrapf(err, "Can't create zip file for sfz")
+		}
+		if _, err := f.Write(buf.Bytes()); err != nil {
+			return errors.Wrapf(err, "Can't write sfz")
+		}
+	}
+	return zw.Close()
+}
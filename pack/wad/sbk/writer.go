@@ -0,0 +1,347 @@
+package sbk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/mogaika/god_of_war_browser/ps2/vagp"
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+const (
+	SOUND_INFO_SIZE      = 28
+	BANK_INFO_SIZE       = 24
+	BANK_HEADER_SIZE     = 0x40
+	BANK_SOUND_INFO_SIZE = 0xc
+	COMMAND_SIZE         = 8
+	SAMPLE_REF_SIZE      = 24
+
+	COMMAND_PLAY_SAMPLE = 1
+	COMMAND_ADDR_MASK   = 1<<24 - 1
+)
+
+func align(v, a int) int {
+	return (v + a - 1) / a * a
+}
+
+// alignAs aligns offset to 16 bytes only if original offset was aligned
+func alignAs(offset int, original uint32) int {
+	if original%16 == 0 {
+		return align(offset, 16)
+	}
+	return offset
+}
+
+// streamAlignment guesses alignment of stream block by original offset
+func streamAlignment(start uint32) int {
+	if start == 0 {
+		return 0x40
+	}
+	a := 16
+	for a < utils.SECTOR_SIZE && start%uint32(a*2) == 0 {
+		a *= 2
+	}
+	return a
+}
+
+func (b *Bank) sampleRefs(offset uint32) []*SampleRef {
+	result := make([]*SampleRef, 0)
+	for i := range b.BankSounds {
+		for j := range b.BankSounds[i].Commands {
+			if ref := b.BankSounds[i].Commands[j].SampleRef; ref != nil && ref.AdpcmOffset == offset {
+				result = append(result, ref)
+			}
+		}
+	}
+	return result
+}
+
+// appendStream places adpcm data at the end of stream block, returns offset of data
+func (b *Bank) appendStream(data []byte) uint32 {
+	offset := align(len(b.stream), 16)
+	b.stream = append(b.stream, make([]byte, offset-len(b.stream))...)
+	b.stream = append(b.stream, data...)
+	return uint32(offset)
+}
+
+// ReplaceSample replaces adpcm data of sample at stream block offset.
+// All sample refs pointing to the sample are updated. Data is written in place
+// if it fits, otherwise it is appended to stream block
+func (b *Bank) ReplaceSample(offset uint32, data []byte) error {
+	refs := b.sampleRefs(offset)
+	if len(refs) == 0 {
+		return fmt.Errorf("Sample at offset 0x%x not found", offset)
+	}
+	if len(data)%16 != 0 {
+		return fmt.Errorf("Adpcm data size %d is not aligned to block", len(data))
+	}
+
+	newOffset := offset
+	if uint32(len(data)) <= refs[0].AdpcmSize {
+		copy(b.stream[offset:], data)
+	} else {
+		newOffset = b.appendStream(data)
+	}
+	for _, ref := range refs {
+		ref.AdpcmOffset = newOffset
+		ref.AdpcmSize = uint32(len(data))
+	}
+	return nil
+}
+
+// AddSound adds sound with commands copied from template.
+// Play sample commands of new sound reference new sample with data
+func (sbk *SBK) AddSound(name string, template string, data []byte) error {
+	if sbk.IsVagFiles {
+		return fmt.Errorf("Sound bank is not present")
+	}
+	for _, snd := range sbk.Sounds {
+		if snd.Name == name {
+			return fmt.Errorf("Sound '%s' already exists", name)
+		}
+	}
+	tmpl, err := sbk.bankSound(template)
+	if err != nil {
+		return err
+	}
+
+	bs := BankSound{
+		name:     name,
+		info:     tmpl.info,
+		B0:       tmpl.B0,
+		B1:       tmpl.B1,
+		B5:       tmpl.B5,
+		B6:       tmpl.B6,
+		Commands: make([]Command, len(tmpl.Commands)),
+	}
+	copy(bs.Commands, tmpl.Commands)
+
+	var offset uint32
+	hasSample := false
+	for i := range bs.Commands {
+		if ref := bs.Commands[i].SampleRef; ref != nil {
+			if !hasSample {
+				offset = sbk.Bank.appendStream(data)
+				hasSample = true
+			}
+			newRef := *ref
+			newRef.addr = -1
+			newRef.AdpcmOffset = offset
+			newRef.AdpcmSize = uint32(len(data))
+			bs.Commands[i].SampleRef = &newRef
+		}
+	}
+	if !hasSample {
+		return fmt.Errorf("Template sound '%s' do not play bank sample", template)
+	}
+
+	sbk.Bank.BankSounds = append(sbk.Bank.BankSounds, bs)
+	sbk.Sounds = append(sbk.Sounds, Sound{Name: name, StreamId: uint32(len(sbk.Bank.BankSounds) - 1)})
+	return nil
+}
+
+// RemoveSound removes named sound and its bank sound. Bank sound is kept if
+// other sound uses same stream id. Adpcm data stays in stream block
+func (sbk *SBK) RemoveSound(name string) error {
+	for i, snd := range sbk.Sounds {
+		if snd.Name != name {
+			continue
+		}
+		if sbk.IsVagFiles {
+			vags := sbk.vags()
+			sbk.vagsData = append(vags[:i], vags[i+1:]...)
+		}
+		sbk.Sounds = append(sbk.Sounds[:i], sbk.Sounds[i+1:]...)
+		if !sbk.IsVagFiles {
+			id := snd.StreamId
+			for _, other := range sbk.Sounds {
+				if other.StreamId == id {
+					return nil
+				}
+			}
+			sbk.Bank.BankSounds = append(sbk.Bank.BankSounds[:id], sbk.Bank.BankSounds[id+1:]...)
+			for j := range sbk.Sounds {
+				if sbk.Sounds[j].StreamId > id {
+					sbk.Sounds[j].StreamId--
+				}
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("Cannot find sound '%s'", name)
+}
+
+func (sbk *SBK) bankSound(name string) (*BankSound, error) {
+	if sbk.IsVagFiles {
+		return nil, fmt.Errorf("Sound bank is not present")
+	}
+	for _, snd := range sbk.Sounds {
+		if snd.Name == name {
+			return &sbk.Bank.BankSounds[snd.StreamId], nil
+		}
+	}
+	return nil, fmt.Errorf("Cannot find sound '%s'", name)
+}
+
+// marshalHeader rebuilds sounds info, commands and smpd blocks of header.
+// Unknown fields of header are copied from original
+func (b *Bank) marshalHeader() ([]byte, error) {
+	bo := b.bo
+	origHeader := b.raw[b.HeaderBlockStart : b.HeaderBlockStart+b.HeaderBlockSize]
+
+	smpd := append([]byte{}, origHeader[b.SmpdStart:]...)
+	var commands bytes.Buffer
+	soundsInfo := make([]byte, len(b.BankSounds)*BANK_SOUND_INFO_SIZE)
+
+	for i := range b.BankSounds {
+		bs := &b.BankSounds[i]
+		info := soundsInfo[i*BANK_SOUND_INFO_SIZE:]
+		copy(info, bs.info[:])
+		info[0], info[1], info[5], info[6] = bs.B0, bs.B1, bs.B5, bs.B6
+		if len(bs.Commands) > 0xff {
+			return nil, fmt.Errorf("Too many commands (%d) in sound %d", len(bs.Commands), i)
+		}
+		info[4] = byte(len(bs.Commands))
+		bo.PutUint32(info[8:], uint32(commands.Len()))
+
+		for j := range bs.Commands {
+			c := &bs.Commands[j]
+			addr := int(c.U0 & COMMAND_ADDR_MASK)
+			if ref := c.SampleRef; ref != nil {
+				if ref.addr < 0 {
+					ref.addr = align(len(smpd), 4)
+					smpd = append(smpd, make([]byte, ref.addr+SAMPLE_REF_SIZE-len(smpd))...)
+				}
+				ref.Marshal(bo, smpd[ref.addr:])
+				addr = ref.addr
+			}
+			if addr > COMMAND_ADDR_MASK {
+				return nil, fmt.Errorf("Command address 0x%x is out of range", addr)
+			}
+			c.U0 = uint32(c.Cmd)<<24 | uint32(addr)
+			binary.BigEndian.PutUint32(c.Bytes[:], c.U0)
+
+			var raw [COMMAND_SIZE]byte
+			bo.PutUint32(raw[0:], c.U0)
+			bo.PutUint32(raw[4:], c.U4)
+			commands.Write(raw[:])
+		}
+	}
+
+	commandsStart := alignAs(BANK_HEADER_SIZE+len(soundsInfo), b.CommandsStart)
+	smpdStart := alignAs(commandsStart+commands.Len(), b.SmpdStart)
+
+	header := make([]byte, smpdStart+len(smpd))
+	copy(header, origHeader[:BANK_HEADER_SIZE])
+	copy(header[BANK_HEADER_SIZE:], soundsInfo)
+	copy(header[commandsStart:], commands.Bytes())
+	copy(header[smpdStart:], smpd)
+
+	bo.PutUint16(header[0x16:], uint16(len(b.BankSounds)))
+	bo.PutUint32(header[0x20:], uint32(commandsStart))
+	bo.PutUint32(header[0x34:], uint32(smpdStart))
+	if b.AdpcmSize == b.StreamBlockSize {
+		bo.PutUint32(header[0x28:], uint32(len(b.stream)))
+	}
+	return header, nil
+}
+
+// Marshal rebuilds bank: header, stream block and unknown data around them
+func (b *Bank) Marshal() ([]byte, error) {
+	bo := b.bo
+	headerEnd := b.HeaderBlockStart + b.HeaderBlockSize
+	if b.StreamBlockSize != 0 && b.StreamBlockStart < headerEnd {
+		return nil, fmt.Errorf("Stream block placed before header is not supported")
+	}
+
+	header, err := b.marshalHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	end := headerEnd
+	if streamEnd := b.StreamBlockStart + b.StreamBlockSize; streamEnd > end {
+		end = streamEnd
+	}
+
+	var buf bytes.Buffer
+	buf.Write(b.raw[:b.HeaderBlockStart])
+	buf.Write(header)
+	streamStart := int(b.StreamBlockStart)
+	if len(b.stream) != 0 || b.StreamBlockSize != 0 {
+		streamStart = align(buf.Len(), streamAlignment(b.StreamBlockStart))
+		buf.Write(make([]byte, streamStart-buf.Len()))
+		buf.Write(b.stream)
+	}
+	buf.Write(b.raw[end:])
+
+	result := buf.Bytes()
+	bo.PutUint32(result[0xc:], uint32(len(header)))
+	bo.PutUint32(result[0x10:], uint32(streamStart))
+	bo.PutUint32(result[0x14:], uint32(len(b.stream)))
+	return result, nil
+}
+
+// ReplaceVag replaces vag file of sound, used when sbk contains vag files instead of bank
+func (sbk *SBK) ReplaceVag(name string, vag *vagp.VAGP) error {
+	if !sbk.IsVagFiles {
+		return fmt.Errorf("Sbk contains sound bank, not vag files")
+	}
+	for i, snd := range sbk.Sounds {
+		if snd.Name == name {
+			sbk.vags()[i] = vag.Marshal()
+			return nil
+		}
+	}
+	return fmt.Errorf("Cannot find sound '%s'", name)
+}
+
+// vags splits data of vag files, cached to allow several replaces before marshal
+func (sbk *SBK) vags() [][]byte {
+	if sbk.vagsData == nil {
+		sbk.vagsData = make([][]byte, len(sbk.Sounds))
+		for i, snd := range sbk.Sounds {
+			end := uint32(len(sbk.raw))
+			if i != len(sbk.Sounds)-1 {
+				end = sbk.Sounds[i+1].StreamId
+			}
+			sbk.vagsData[i] = sbk.raw[snd.StreamId:end]
+		}
+	}
+	return sbk.vagsData
+}
+
+// MarshalData produces data of tag
+func (sbk *SBK) MarshalData() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(sbk.raw[:4])
+	binary.Write(&buf, binary.LittleEndian, uint32(len(sbk.Sounds)))
+
+	infoStart := buf.Len()
+	for _, snd := range sbk.Sounds {
+		var name [24]byte
+		copy(name[:23], snd.Name)
+		buf.Write(name[:])
+		binary.Write(&buf, binary.LittleEndian, snd.StreamId)
+	}
+
+	if sbk.IsVagFiles {
+		vags := sbk.vags()
+		for i, vag := range vags {
+			start := alignAs(buf.Len(), sbk.Sounds[0].StreamId)
+			buf.Write(make([]byte, start-buf.Len()))
+			sbk.Sounds[i].StreamId = uint32(start)
+			binary.LittleEndian.PutUint32(buf.Bytes()[infoStart+i*SOUND_INFO_SIZE+24:], uint32(start))
+			buf.Write(vag)
+		}
+		return buf.Bytes(), nil
+	}
+
+	bank, err := sbk.Bank.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(bank)
+	return buf.Bytes(), nil
+}
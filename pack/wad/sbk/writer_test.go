@@ -0,0 +1,123 @@
+package sbk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+// makeSblk builds bank with two sounds: first plays sample 0,
+// second has delay command and plays sample 1
+func makeSblk() []byte {
+	le := binary.LittleEndian
+	tag := make([]byte, 8+2*SOUND_INFO_SIZE)
+	le.PutUint32(tag[0:], SBK_SBLK_MAGIC)
+	le.PutUint32(tag[4:], 2)
+	copy(tag[8:], "snd_a")
+	copy(tag[8+SOUND_INFO_SIZE:], "snd_b")
+	le.PutUint32(tag[8+SOUND_INFO_SIZE+24:], 1)
+
+	header := make([]byte, 0xb0)
+	copy(header[0xc:], "KNAB")
+	le.PutUint16(header[0x16:], 2)
+	le.PutUint32(header[0x20:], 0x60)
+	le.PutUint32(header[0x28:], 48)
+	le.PutUint32(header[0x34:], 0x80)
+	header[0x40], header[0x44] = 120, 1
+	header[0x4c], header[0x50] = 110, 2
+	le.PutUint32(header[0x54:], 8)
+	le.PutUint32(header[0x60:], 1<<24)
+	le.PutUint32(header[0x68:], 20<<24)
+	le.PutUint32(header[0x6c:], 50)
+	le.PutUint32(header[0x70:], 1<<24|SAMPLE_REF_SIZE)
+	header[0x80+2] = 0x40
+	le.PutUint32(header[0x80+20:], 32)
+	header[0x98+2] = 0x30
+	le.PutUint32(header[0x98+16:], 32)
+	le.PutUint32(header[0x98+20:], 16)
+
+	bank := make([]byte, 0x100+48)
+	le.PutUint32(bank[0x8:], 0x20)
+	le.PutUint32(bank[0xc:], uint32(len(header)))
+	le.PutUint32(bank[0x10:], 0x100)
+	le.PutUint32(bank[0x14:], 48)
+	copy(bank[0x20:], header)
+	for i := 0; i < 48; i++ {
+		bank[0x100+i] = byte(i)
+	}
+	return append(tag, bank...)
+}
+
+func parse(t *testing.T, data []byte) *SBK {
+	sbk, err := NewFromData(utils.NewBufStack("sblk", data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sbk
+}
+
+func marshal(t *testing.T, sbk *SBK) []byte {
+	data, err := sbk.MarshalData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestBankRoundTrip(t *testing.T) {
+	orig := makeSblk()
+	if data := marshal(t, parse(t, orig)); !bytes.Equal(data, orig) {
+		t.Fatalf("Marshaled bank differs from original:\n%x\n%x", data, orig)
+	}
+}
+
+func TestBankEdit(t *testing.T) {
+	sbk := parse(t, makeSblk())
+
+	if err := sbk.Bank.ReplaceSample(32, make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	}
+	sbk = parse(t, marshal(t, sbk))
+	ref := sbk.Bank.BankSounds[1].Commands[1].SampleRef
+	if ref.AdpcmOffset != 48 || ref.AdpcmSize != 32 || ref.B2 != 0x30 || sbk.Bank.StreamBlockSize != 80 {
+		t.Fatalf("Wrong replaced sample ref %+v, stream size %d", ref, sbk.Bank.StreamBlockSize)
+	}
+
+	if err := sbk.AddSound("snd_c", "snd_b", make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	sbk = parse(t, marshal(t, sbk))
+	if len(sbk.Sounds) != 3 || len(sbk.Bank.BankSounds) != 3 || sbk.Sounds[2].StreamId != 2 {
+		t.Fatalf("Sound was not added: %+v", sbk.Sounds)
+	}
+	added := sbk.Bank.BankSounds[2]
+	if len(added.Commands) != 2 || added.Commands[0].U4 != 50 || added.B0 != 110 {
+		t.Fatalf("Wrong added sound %+v", added)
+	}
+	if ref := added.Commands[1].SampleRef; ref.AdpcmOffset != 80 || ref.AdpcmSize != 16 || ref.B2 != 0x30 {
+		t.Fatalf("Wrong added sample ref %+v", ref)
+	}
+	if ref := sbk.Bank.BankSounds[1].Commands[1].SampleRef; ref.AdpcmOffset != 48 {
+		t.Fatalf("Sample ref of template changed %+v", ref)
+	}
+
+	if err := sbk.RemoveSound("snd_a"); err != nil {
+		t.Fatal(err)
+	}
+	sbk = parse(t, marshal(t, sbk))
+	if len(sbk.Sounds) != 2 || sbk.Sounds[0].Name != "snd_b" || sbk.Sounds[0].StreamId != 0 || sbk.Sounds[1].StreamId != 1 {
+		t.Fatalf("Sound was not removed: %+v", sbk.Sounds)
+	}
+
+	// bank sound shared by other sound is kept
+	sbk.Sounds[1].StreamId = 0
+	if err := sbk.RemoveSound("snd_b"); err != nil {
+		t.Fatal(err)
+	}
+	sbk = parse(t, marshal(t, sbk))
+	if len(sbk.Sounds) != 1 || sbk.Sounds[0].Name != "snd_c" || sbk.Sounds[0].StreamId != 0 || len(sbk.Bank.BankSounds) != 2 {
+		t.Fatalf("Shared bank sound was removed: %+v", sbk.Sounds)
+	}
+}
@@ -47,6 +47,27 @@ func (sp *ScriptParams) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 	return sp, nil
 }
 
+func (sp *ScriptParams) SearchTexts() []string {
+	if s, ok := sp.Data.(wad.Searchable); ok {
+		return s.SearchTexts()
+	}
+	return nil
+}
+
+func (sp *ScriptParams) References() []string {
+	if r, ok := sp.Data.(wad.Referencer); ok {
+		return r.References()
+	}
+	return nil
+}
+
+func (sp *ScriptParams) DumpText() []string {
+	if d, ok := sp.Data.(wad.TextDumper); ok {
+		return d.DumpText()
+	}
+	return nil
+}
+
 func (sp *ScriptParams) MarshalBufHeader() []byte {
 	result := make([]byte, HEADER_SIZE)
 	binary.LittleEndian.PutUint32(result[0x00:], SCRIPT_MAGIC)
@@ -16,6 +16,7 @@ import (
 	"github.com/mogaika/god_of_war_browser/pack/wad"
 	"github.com/mogaika/god_of_war_browser/pack/wad/scr/entitycontext"
 	"github.com/mogaika/god_of_war_browser/pack/wad/scr/store"
+	"github.com/mogaika/god_of_war_browser/scriptlang"
 	"github.com/mogaika/god_of_war_browser/utils"
 )
 
@@ -234,6 +235,45 @@ func SCR_Entities(b []byte, wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 	return entities, nil
 }
 
+func (ents *Entities) SearchTexts() []string {
+	names := make([]string, 0, len(ents.Array))
+	for _, e := range ents.Array {
+		if e.Name != "" {
+			names = append(names, e.Name)
+		}
+	}
+	return names
+}
+
+// References returns strings pushed by handlers of entities, scripts use
+// them as names of nodes (objects, textures, sounds)
+func (ents *Entities) References() []string {
+	refs := make([]string, 0)
+	for _, e := range ents.Array {
+		for _, h := range e.Handlers {
+			for _, instr := range h.Data {
+				if op, ok := instr.(*scriptlang.Opcode); ok && op.Code == 0x0e {
+					refs = append(refs, op.Parameters[0].(string))
+				}
+			}
+		}
+	}
+	return refs
+}
+
+// DumpText returns decompiled scripts of entities prefixed with entity name and handler id
+func (ents *Entities) DumpText() []string {
+	lines := make([]string, 0)
+	for _, e := range ents.Array {
+		for _, h := range e.Handlers {
+			for _, line := range h.Decompiled {
+				lines = append(lines, fmt.Sprintf("%s[%d]: %s", e.Name, h.Id, line))
+			}
+		}
+	}
+	return lines
+}
+
 func (ents *Entities) FromJSON(wrsrc *wad.WadNodeRsrc, data []byte) ([]byte, error) {
 	ec := wrsrc.Wad.GetEntityContext()
 
@@ -0,0 +1,257 @@
+package wad
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/pack/wad/scr/entitycontext"
+)
+
+// ownedGroupStart returns group start tag of group owned by node tag.
+// Same as parser does, next server instance after group start owns group,
+// other tags can be between them
+func (w *Wad) ownedGroupStart(id TagId) (TagId, bool) {
+	if w.Tags[id].Tag != GetServerInstanceTag() {
+		return 0, false
+	}
+	for i := id - 1; i >= 0; i-- {
+		switch w.Tags[i].Tag {
+		case GetGroupStartTag():
+			return i, true
+		case GetServerInstanceTag(), GetGroupEndTag():
+			return 0, false
+		}
+	}
+	return 0, false
+}
+
+// NodeTagsSpan returns range [start, end) of tags describing node.
+// For group owner it includes group start tag (which precedes node tag,
+// possibly with other tags between them), all children and group end tag
+func (w *Wad) NodeTagsSpan(id NodeId) (start TagId, end TagId) {
+	n := w.Nodes[id]
+	start, end = n.Tag.Id, n.Tag.Id+1
+
+	groupStart, ok := w.ownedGroupStart(n.Tag.Id)
+	if !ok {
+		return start, end
+	}
+
+	depth := 0
+	for i := groupStart; int(i) < len(w.Tags); i++ {
+		switch w.Tags[i].Tag {
+		case GetGroupStartTag():
+			depth++
+		case GetGroupEndTag():
+			depth--
+		}
+		if depth == 0 {
+			return groupStart, i + 1
+		}
+	}
+	log.Printf("[wad] Group of node %d-%s is not closed", n.Tag.Id, n.Tag.Name)
+	return groupStart, TagId(len(w.Tags))
+}
+
+// checkStructureSupported returns error for game versions which tags are not parsed,
+// group tags of them are unknown
+func checkStructureSupported() error {
+	switch v := config.GetGOWVersion(); v {
+	case config.GOW1, config.GOW2:
+		return nil
+	default:
+		return fmt.Errorf("Editing of wad structure is not supported for %v", v)
+	}
+}
+
+// ValidateGroups checks that tags can be parsed, by parsing them into temporary wad.
+// So group tags are accepted exactly as parser accepts them: group is owned by
+// next server instance after group start, group end right after group start
+// closes empty group, groups not closed till end of wad are allowed
+func ValidateGroups(tags []Tag) error {
+	if err := checkStructureSupported(); err != nil {
+		return err
+	}
+	tmp := &Wad{Tags: append([]Tag(nil), tags...)}
+	for i := range tmp.Tags {
+		tmp.Tags[i].Id = TagId(i)
+		tmp.Tags[i].NodeId = NODE_INVALID
+		if !isZeroSizedTag(&tmp.Tags[i]) {
+			tmp.Tags[i].Size = uint32(len(tmp.Tags[i].Data))
+		}
+	}
+	return tmp.parseTags()
+}
+
+// copyTags makes deep copy of tags range, so changes of data do not affect wad
+func copyTags(tags []Tag) []Tag {
+	result := make([]Tag, len(tags))
+	for i, t := range tags {
+		result[i] = t
+		if t.Data != nil {
+			result[i].Data = append([]byte(nil), t.Data...)
+		}
+	}
+	return result
+}
+
+// ParseCheck parses tags into temporary wad without saving and tries to
+// instantiate nodes of tags range [checkStart, checkEnd) which have handlers
+func (w *Wad) ParseCheck(tags []Tag, checkStart, checkEnd TagId) error {
+	if err := ValidateGroups(tags); err != nil {
+		return err
+	}
+
+	tmp := &Wad{
+		Source:        w.Source,
+		Tags:          copyTags(tags),
+		HeapSizes:     w.HeapSizes,
+		entityContext: entitycontext.NewContext(),
+	}
+	for i := range tmp.Tags {
+		tmp.Tags[i].Id = TagId(i)
+		tmp.Tags[i].NodeId = NODE_INVALID
+		if !isZeroSizedTag(&tmp.Tags[i]) {
+			tmp.Tags[i].Size = uint32(len(tmp.Tags[i].Data))
+		}
+	}
+	if err := tmp.parseTags(); err != nil {
+		return err
+	}
+
+	for id := checkStart; id < checkEnd; id++ {
+		t := &tmp.Tags[id]
+		if t.NodeId == NODE_INVALID || len(t.Data) == 0 {
+			continue
+		}
+		if h, _ := findHandler(tmp.Nodes[t.NodeId]); h == nil {
+			continue
+		}
+		if err := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("Panic: %v", r)
+				}
+			}()
+			_, _, err = tmp.GetInstanceFromNode(t.NodeId)
+			return err
+		}(); err != nil {
+			return fmt.Errorf("Node %d-%s is broken: %v", id, t.Name, err)
+		}
+	}
+	return nil
+}
+
+func (w *Wad) checkNodeId(id NodeId) error {
+	if err := checkStructureSupported(); err != nil {
+		return err
+	}
+	if id < 0 || int(id) >= len(w.Nodes) {
+		return fmt.Errorf("Node %d not exists", id)
+	}
+	return nil
+}
+
+// saveStructure validates groups balance before saving tags
+func (w *Wad) saveStructure(tags []Tag) error {
+	if err := ValidateGroups(tags); err != nil {
+		return fmt.Errorf("Invalid wad structure, nothing changed: %v", err)
+	}
+	return w.Save(tags)
+}
+
+func spliceTags(parts ...[]Tag) []Tag {
+	count := 0
+	for _, p := range parts {
+		count += len(p)
+	}
+	result := make([]Tag, 0, count)
+	for _, p := range parts {
+		result = append(result, p...)
+	}
+	return result
+}
+
+// DeleteNode removes node tag and whole group of node if node owns group
+func (w *Wad) DeleteNode(id NodeId) error {
+	if err := w.checkNodeId(id); err != nil {
+		return err
+	}
+	start, end := w.NodeTagsSpan(id)
+	log.Printf("[wad] Deleting node %d-%s (tags %d-%d)", id, w.Nodes[id].Tag.Name, start, end)
+	return w.saveStructure(spliceTags(w.Tags[:start], w.Tags[end:]))
+}
+
+// DuplicateNode inserts copy of node (with group) right after original.
+// Empty newName means generated from original name
+func (w *Wad) DuplicateNode(id NodeId, newName string) error {
+	if err := w.checkNodeId(id); err != nil {
+		return err
+	}
+	n := w.Nodes[id]
+	if newName == "" {
+		newName = w.GenerateName(n.Tag.Name)
+	} else if w.GetTagByName(newName, 0, true) != nil {
+		return fmt.Errorf("Name '%s' already used", newName)
+	}
+
+	start, end := w.NodeTagsSpan(id)
+	dup := copyTags(w.Tags[start:end])
+	dup[n.Tag.Id-start].Name = newName
+	return w.saveStructure(spliceTags(w.Tags[:end], dup, w.Tags[end:]))
+}
+
+// MoveNode moves node (with group) before tag pos.
+// Pos equal to tags count moves node to the end of wad
+func (w *Wad) MoveNode(id NodeId, pos TagId) error {
+	if err := w.checkNodeId(id); err != nil {
+		return err
+	}
+	if pos < 0 || int(pos) > len(w.Tags) {
+		return fmt.Errorf("Position %d is out of wad", pos)
+	}
+	start, end := w.NodeTagsSpan(id)
+	if pos > start && pos < end {
+		return fmt.Errorf("Cannot move node inside itself")
+	}
+
+	moved := w.Tags[start:end]
+	if pos <= start {
+		return w.saveStructure(spliceTags(w.Tags[:pos], moved, w.Tags[pos:start], w.Tags[end:]))
+	} else {
+		return w.saveStructure(spliceTags(w.Tags[:start], w.Tags[end:pos], moved, w.Tags[pos:]))
+	}
+}
+
+// MoveNodeToGroup moves node to the end of group owned by node groupId
+func (w *Wad) MoveNodeToGroup(id NodeId, groupId NodeId) error {
+	if err := w.checkNodeId(groupId); err != nil {
+		return err
+	}
+	start, end := w.NodeTagsSpan(groupId)
+	if start == w.Nodes[groupId].Tag.Id {
+		return fmt.Errorf("Node %d-%s do not own group", groupId, w.Nodes[groupId].Tag.Name)
+	}
+	// before group end tag
+	return w.MoveNode(id, end-1)
+}
+
+// CreateGroup makes node owner of new empty group
+func (w *Wad) CreateGroup(id NodeId) error {
+	if err := w.checkNodeId(id); err != nil {
+		return err
+	}
+	n := w.Nodes[id]
+	if n.Tag.Tag != GetServerInstanceTag() {
+		return fmt.Errorf("Only server instance can own group")
+	}
+	if start, _ := w.NodeTagsSpan(id); start != n.Tag.Id {
+		return fmt.Errorf("Node %d-%s already owns group", id, n.Tag.Name)
+	}
+
+	groupStart := Tag{Tag: GetGroupStartTag(), NodeId: NODE_INVALID}
+	groupEnd := Tag{Tag: GetGroupEndTag(), NodeId: NODE_INVALID}
+	return w.saveStructure(spliceTags(
+		w.Tags[:n.Tag.Id], []Tag{groupStart, *n.Tag, groupEnd}, w.Tags[n.Tag.Id+1:]))
+}
@@ -0,0 +1,127 @@
+package wad
+
+import (
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/config"
+)
+
+func testStructureTags() []Tag {
+	si := func(name string) Tag { return Tag{Tag: TAG_GOW1_SERVER_INSTANCE, Name: name, Data: []byte{0, 0, 0, 0}} }
+	return []Tag{
+		si("TXR_a"),
+		{Tag: TAG_GOW1_FILE_GROUP_START},
+		si("OBJ_b"),
+		{Tag: TAG_GOW1_FILE_GROUP_START},
+		si("MDL_c"),
+		si("MAT_d"),
+		{Tag: TAG_GOW1_FILE_GROUP_END},
+		si("ANM_e"),
+		{Tag: TAG_GOW1_FILE_GROUP_END},
+		si("INST_f"),
+	}
+}
+
+func TestNodeTagsSpan(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+
+	w := &Wad{Tags: testStructureTags()}
+	for i := range w.Tags {
+		w.Tags[i].Id = TagId(i)
+	}
+	if err := w.parseTags(); err != nil {
+		t.Fatalf("parseTags() failed: %v", err)
+	}
+
+	for _, c := range []struct {
+		tag        TagId
+		start, end TagId
+	}{{0, 0, 1}, {2, 1, 9}, {4, 3, 7}, {5, 5, 6}, {9, 9, 10}} {
+		start, end := w.NodeTagsSpan(w.Tags[c.tag].NodeId)
+		if start != c.start || end != c.end {
+			t.Errorf("NodeTagsSpan(%s)=[%d,%d); expected [%d,%d)", w.Tags[c.tag].Name, start, end, c.start, c.end)
+		}
+	}
+}
+
+func TestValidateGroups(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+
+	tags := testStructureTags()
+	if err := ValidateGroups(tags); err != nil {
+		t.Errorf("ValidateGroups() of valid wad returned %v", err)
+	}
+	// parser accepts groups not closed till end of wad
+	if err := ValidateGroups(tags[:len(tags)-2]); err != nil {
+		t.Errorf("ValidateGroups() of not closed group returned %v", err)
+	}
+	// second group start waits for same owner, as in parser
+	doubleStart := append([]Tag{{Tag: TAG_GOW1_FILE_GROUP_START}}, tags...)
+	if err := ValidateGroups(doubleStart[:2]); err != nil {
+		t.Errorf("ValidateGroups() of double group start returned %v", err)
+	}
+	if err := ValidateGroups(tags[3:]); err == nil {
+		t.Errorf("ValidateGroups() of group end without start returned nil")
+	}
+}
+
+func TestStructureUnsupportedVersion(t *testing.T) {
+	config.SetGOWVersion(config.GOW2018)
+	defer config.SetGOWVersion(config.GOW1)
+
+	w := &Wad{Tags: []Tag{{Tag: TAG_GOW2018_SERVER_INSTANCE, Name: "TXR_a"}}, Nodes: []*Node{{}}}
+	if err := ValidateGroups(w.Tags); err == nil {
+		t.Errorf("ValidateGroups() of gow2018 returned nil")
+	}
+	if err := w.DeleteNode(0); err == nil {
+		t.Errorf("DeleteNode() of gow2018 returned nil")
+	}
+	if err := w.DuplicateNode(0, ""); err == nil {
+		t.Errorf("DuplicateNode() of gow2018 returned nil")
+	}
+	if err := w.MoveNode(0, 1); err == nil {
+		t.Errorf("MoveNode() of gow2018 returned nil")
+	}
+}
+
+func TestGroupOwnerAfterOtherTag(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+
+	// raw data tag between group start and owner belongs to parent, as parser places it
+	w := &Wad{Tags: []Tag{
+		{Tag: TAG_GOW1_FILE_GROUP_START},
+		{Tag: TAG_GOW1_FILE_RAW_DATA, Name: "RAW_a", Data: []byte{1}},
+		{Tag: TAG_GOW1_SERVER_INSTANCE, Name: "OBJ_b", Data: []byte{0, 0, 0, 0}},
+		{Tag: TAG_GOW1_SERVER_INSTANCE, Name: "MDL_c", Data: []byte{0, 0, 0, 0}},
+		{Tag: TAG_GOW1_FILE_GROUP_END},
+		{Tag: TAG_GOW1_FILE_GROUP_START},
+		{Tag: TAG_GOW1_FILE_GROUP_END},
+	}}
+	if err := ValidateGroups(w.Tags); err != nil {
+		t.Fatalf("ValidateGroups() returned %v", err)
+	}
+	for i := range w.Tags {
+		w.Tags[i].Id = TagId(i)
+	}
+	if err := w.parseTags(); err != nil {
+		t.Fatalf("parseTags() failed: %v", err)
+	}
+	if c := w.Nodes[w.Tags[3].NodeId]; c.Parent != w.Tags[2].NodeId {
+		t.Fatalf("MDL_c is not child of OBJ_b")
+	}
+
+	for _, c := range []struct {
+		tag        TagId
+		start, end TagId
+	}{{1, 1, 2}, {2, 0, 5}, {3, 3, 4}} {
+		start, end := w.NodeTagsSpan(w.Tags[c.tag].NodeId)
+		if start != c.start || end != c.end {
+			t.Errorf("NodeTagsSpan(%s)=[%d,%d); expected [%d,%d)", w.Tags[c.tag].Name, start, end, c.start, c.end)
+		}
+	}
+
+	if err := ValidateGroups([]Tag{{Tag: TAG_GOW1_FILE_GROUP_START}, {Tag: TAG_GOW1_FILE_GROUP_START},
+		{Tag: TAG_GOW1_SERVER_INSTANCE}, {Tag: TAG_GOW1_FILE_GROUP_END}, {Tag: TAG_GOW1_FILE_GROUP_END}}); err == nil {
+		t.Errorf("ValidateGroups() of group start without owner returned nil")
+	}
+}
@@ -0,0 +1,213 @@
+package wad
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+type TransplantResult struct {
+	Source     string
+	Target     string
+	Nodes      []string          // names of copied root nodes
+	Renamed    map[string]string // old name => new name, on collision with target nodes
+	InsertedAt TagId
+	TagsCount  int
+	DataSize   uint32
+	Heap       string   `json:",omitempty"` // entity count tag which size was increased
+	Warnings   []string `json:",omitempty"`
+}
+
+type tagsSpan struct {
+	start, end TagId
+	owner      TagId
+}
+
+// dependencySpans returns tag ranges of node and all nodes it depends on
+// in order of source wad
+func (w *Wad) dependencySpans(tagId TagId, g *DependencyGraph) []tagsSpan {
+	need := append([]TagId{tagId}, g.Uses(tagId)...)
+
+	spans := make([]tagsSpan, 0, len(need))
+	for _, id := range need {
+		start, end := w.NodeTagsSpan(w.Tags[id].NodeId)
+		spans = append(spans, tagsSpan{start: start, end: end, owner: id})
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start == spans[j].start {
+			return spans[i].end > spans[j].end
+		}
+		return spans[i].start < spans[j].start
+	})
+
+	// drop nodes already included by groups
+	result := make([]tagsSpan, 0, len(spans))
+	for _, s := range spans {
+		if len(result) != 0 && s.end <= result[len(result)-1].end {
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
+
+// defaultInsertPosition returns position after last root server instance
+func (w *Wad) defaultInsertPosition() TagId {
+	pos := TagId(len(w.Tags))
+	for _, id := range w.Roots {
+		if n := w.Nodes[id]; n.Tag.Tag == GetServerInstanceTag() {
+			_, pos = w.NodeTagsSpan(id)
+		}
+	}
+	return pos
+}
+
+// Transplant copies node with tag srcTagId and every node it depends on from src to dst.
+// Tags are inserted before tag insertPos of dst (negative value means after last root node).
+// Copied root nodes colliding by name with dst nodes are renamed and references to them
+// rewritten. Size of heap (entity count tag) preceding insert position is increased
+// by size of copied data. Nothing is saved if result is not parsable, target is
+// not changed if save fails
+func Transplant(src *Wad, srcTagId TagId, dst *Wad, insertPos TagId) (*TransplantResult, error) {
+	if err := checkStructureSupported(); err != nil {
+		return nil, err
+	}
+	if int(srcTagId) >= len(src.Tags) || src.Tags[srcTagId].NodeId == NODE_INVALID {
+		return nil, fmt.Errorf("Tag %d of %s is not a node", srcTagId, src.Name())
+	}
+	if insertPos < 0 || int(insertPos) > len(dst.Tags) {
+		insertPos = dst.defaultInsertPosition()
+	}
+
+	res := &TransplantResult{
+		Source:     src.Name(),
+		Target:     dst.Name(),
+		Nodes:      make([]string, 0),
+		Renamed:    make(map[string]string),
+		InsertedAt: insertPos,
+		Warnings:   make([]string, 0),
+	}
+
+	// heap size of target is changed before save
+	dst.recordBaseline()
+
+	g := src.Dependencies()
+	spans := src.dependencySpans(srcTagId, g)
+
+	// rename root nodes which names are already used in target
+	taken := make(map[string]bool)
+	for _, s := range spans {
+		name := src.Tags[s.owner].Name
+		res.Nodes = append(res.Nodes, name)
+		if dst.GetNodeByName(name, NodeId(len(dst.Nodes)-1), false) != nil {
+			newName := dst.generateNameExcept(name, taken)
+			taken[newName] = true
+			res.Renamed[name] = newName
+		}
+	}
+
+	copied := make([]Tag, 0)
+	for _, s := range spans {
+		for id := s.start; id < s.end; id++ {
+			t := copyTags(src.Tags[id : id+1])[0]
+			if id == s.owner {
+				if newName, ok := res.Renamed[t.Name]; ok {
+					t.Name = newName
+				}
+			}
+
+			if t.NodeId != NODE_INVALID && len(t.Data) != 0 && len(res.Renamed) != 0 {
+				if inst, _, err := src.GetInstanceFromNode(t.NodeId); err == nil {
+					if r, ok := inst.(Referencer); ok {
+						for _, ref := range r.References() {
+							if _, renamed := res.Renamed[ref]; !renamed {
+								continue
+							}
+							renamer, ok := inst.(ReferenceRenamer)
+							if !ok {
+								return nil, fmt.Errorf("Cannot rewrite reference '%s' of node %d-%s: %T do not support renaming",
+									ref, id, t.Name, inst)
+							}
+							var err error
+							if t.Data, err = renameReferences(renamer, t.Data, res.Renamed); err != nil {
+								return nil, fmt.Errorf("Cannot rewrite references of node %d-%s: %v", id, t.Name, err)
+							}
+							break
+						}
+					}
+				}
+			}
+
+			res.DataSize += tagWadSize(&t)
+			copied = append(copied, t)
+		}
+	}
+	res.TagsCount = len(copied)
+
+	// references which were resolved outside of copied nodes must exist in target
+	required := map[TagId]bool{srcTagId: true}
+	for _, id := range g.Uses(srcTagId) {
+		required[id] = true
+	}
+	checkName := func(from TagId, name string) {
+		if required[from] && dst.GetTagByName(name, insertPos-1, false) == nil {
+			res.Warnings = append(res.Warnings, fmt.Sprintf("'%s' used by '%s' is not found in target", name, src.Tags[from].Name))
+		}
+	}
+	for _, ref := range g.Unresolved {
+		checkName(ref.From, ref.Name)
+	}
+	for _, e := range g.External {
+		checkName(e.From, e.Name)
+	}
+
+	newTags := make([]Tag, 0, len(dst.Tags)+len(copied))
+	newTags = append(newTags, dst.Tags[:insertPos]...)
+	newTags = append(newTags, copied...)
+	newTags = append(newTags, dst.Tags[insertPos:]...)
+
+	if err := dst.ParseCheck(newTags, insertPos, insertPos+TagId(len(copied))); err != nil {
+		return nil, fmt.Errorf("Transplant result is broken, nothing changed: %v", err)
+	}
+
+	// heap size is changed on copy, so wad keeps old sizes if save fails
+	oldTags, oldHeapSizes := dst.Tags, dst.HeapSizes
+	for id := insertPos - 1; id >= 0; id-- {
+		if t := &dst.Tags[id]; t.Tag == GetEntityCountTag() && isZeroSizedTag(t) {
+			res.Heap = t.Name
+			heapSizes := make(map[string]uint32, len(oldHeapSizes))
+			for name, size := range oldHeapSizes {
+				heapSizes[name] = size
+			}
+			heapSizes[t.Name] += res.DataSize
+			dst.HeapSizes = heapSizes
+			break
+		}
+	}
+
+	log.Printf("[wad] Transplanting %d tags from %s to %s at %d (renamed %v)",
+		len(copied), res.Source, res.Target, insertPos, res.Renamed)
+	if err := dst.Save(newTags); err != nil {
+		dst.restore(oldTags, oldHeapSizes)
+		return nil, err
+	}
+	return res, nil
+}
+
+func renameReferences(renamer ReferenceRenamer, data []byte, rename map[string]string) (result []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Panic: %v", r)
+		}
+	}()
+	return renamer.RenameReferences(data, rename), nil
+}
+
+// restore returns tags and heap sizes of wad after failed save
+func (w *Wad) restore(tags []Tag, heapSizes map[string]uint32) {
+	w.flushCache()
+	w.Tags, w.HeapSizes = tags, heapSizes
+	if err := w.parseTags(); err != nil {
+		log.Printf("[wad] Cannot restore %s after failed save: %v", w.Name(), err)
+	}
+}
@@ -0,0 +1,63 @@
+package wad
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTransplant(t *testing.T) {
+	src := newTestWad(t, "SRC.WAD", []Tag{
+		testResourceTag("TXR_a", testKindDependent),
+		testResourceTag("OBJ_root", testKindRoot, "TXR_a"),
+	})
+	dst := newTestWad(t, "DST.WAD", []Tag{
+		{Tag: TAG_GOW1_ENTITY_COUNT, Name: "heap"},
+		testResourceTag("TXR_a", testKindDependent),
+		testResourceTag("OBJ_other", testKindRoot, "TXR_a"),
+	})
+	dst.HeapSizes["heap"] = 0x1000
+
+	res, err := Transplant(src, 1, dst, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newName := res.Renamed["TXR_a"]
+	if newName == "" || res.TagsCount != 2 || res.Heap != "heap" || dst.HeapSizes["heap"] != 0x1000+res.DataSize {
+		t.Fatalf("Unexpected result %+v, heap size 0x%x", res, dst.HeapSizes["heap"])
+	}
+	if dst.Source.(*testSource).saved == nil {
+		t.Fatalf("Target was not saved")
+	}
+
+	// reload saved target, copied node must use renamed texture
+	n := dst.GetNodeByName("OBJ_root", NodeId(len(dst.Nodes)-1), false)
+	if n == nil || dst.GetNodeByName(newName, n.Id, false) == nil {
+		t.Fatalf("Copied nodes are not found in target")
+	}
+	inst, _, err := dst.GetInstanceFromNode(n.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refs := inst.(*testResource).References(); len(refs) != 1 || refs[0] != newName {
+		t.Errorf("References of copied node %v, expected %s", refs, newName)
+	}
+}
+
+func TestTransplantSaveFailure(t *testing.T) {
+	src := newTestWad(t, "SRC.WAD", []Tag{
+		testResourceTag("OBJ_root", testKindRoot),
+	})
+	dst := newTestWad(t, "DST.WAD", []Tag{
+		{Tag: TAG_GOW1_ENTITY_COUNT, Name: "heap"},
+		testResourceTag("OBJ_other", testKindRoot),
+	})
+	dst.HeapSizes["heap"] = 0x1000
+	dst.Source.(*testSource).err = fmt.Errorf("disk is full")
+
+	if _, err := Transplant(src, 0, dst, -1); err == nil {
+		t.Fatalf("Transplant() returned nil error")
+	}
+	if dst.HeapSizes["heap"] != 0x1000 || len(dst.Tags) != 2 || len(dst.Nodes) != 1 {
+		t.Errorf("Failed transplant changed target: heap 0x%x, %d tags", dst.HeapSizes["heap"], len(dst.Tags))
+	}
+}
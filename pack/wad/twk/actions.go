@@ -17,34 +17,41 @@ import (
 	"github.com/mogaika/god_of_war_browser/webutils"
 )
 
-func (t *TWK) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
-	switch action {
-	case "asyaml":
-		fake := *t
-
-		if tree, err := twktree.Root().UnmarshalTWK(t.Tree); err != nil {
-			log.Printf("Failed to produce abstract tree: %v", err)
-		} else {
-			fake.AbstractTree = tree
-			fake.Tree = nil
-			log.Printf("Produced abstract tree")
-		}
+// YAML produces yaml representation of tweak with abstract tree if possible
+func (t *TWK) YAML() ([]byte, error) {
+	fake := *t
+
+	if tree, err := twktree.Root().UnmarshalTWK(t.Tree); err != nil {
+		log.Printf("Failed to produce abstract tree: %v", err)
+	} else {
+		fake.AbstractTree = tree
+		fake.Tree = nil
+	}
 
-		var buffer bytes.Buffer
-		enc := yaml.NewEncoder(&buffer)
-		enc.SetIndent(2)
+	var buffer bytes.Buffer
+	enc := yaml.NewEncoder(&buffer)
+	enc.SetIndent(2)
 
-		if err := enc.Encode(&fake); err != nil {
-			webutils.WriteError(w, errors.Wrapf(err, "Failed to marshal yaml"))
-			return
-		}
+	if err := enc.Encode(&fake); err != nil {
+		return nil, errors.Wrapf(err, "Failed to marshal yaml")
+	}
+	if err := enc.Close(); err != nil {
+		return nil, errors.Wrapf(err, "Failed to close yaml encoder")
+	}
+	return buffer.Bytes(), nil
+}
 
-		if err := enc.Close(); err != nil {
-			webutils.WriteError(w, errors.Wrapf(err, "Failed to close yaml encoder"))
+func (t *TWK) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
+	switch action {
+	case "asyaml":
+		data, err := t.YAML()
+		if err != nil {
+			webutils.WriteError(w, err)
 			return
 		}
 
-		webutils.WriteFile(w, &buffer, fmt.Sprintf("%s-%d-%s.yaml", wrsrc.Wad.Name(), wrsrc.Tag.Id, wrsrc.Name()))
+		buffer := bytes.NewReader(data)
+		webutils.WriteFile(w, buffer, fmt.Sprintf("%s-%d-%s.yaml", wrsrc.Wad.Name(), wrsrc.Tag.Id, wrsrc.Name()))
 		return
 	case "fromyaml":
 		if strings.ToUpper(r.Method) != "POST" {
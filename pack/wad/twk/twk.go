@@ -210,11 +210,37 @@ func (twk *TWK) Marshal(rsrc *wad.WadNodeRsrc) (interface{}, error) {
 	return twk, nil
 }
 
+// SearchTexts returns full paths of all tweak tree nodes
+func (twk *TWK) SearchTexts() []string {
+	paths := make([]string, 0)
+	var walk func(node *twktree.VFSNode, path string)
+	walk = func(node *twktree.VFSNode, path string) {
+		for _, field := range node.Fields {
+			fieldPath := path + "/" + field.Name
+			paths = append(paths, fieldPath)
+			walk(field, fieldPath)
+		}
+	}
+	if twk.Tree != nil {
+		walk(twk.Tree, "")
+	}
+	return paths
+}
+
+// DumpText returns lines of yaml representation
+func (twk *TWK) DumpText() []string {
+	data, err := twk.YAML()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
 func init() {
 	wad.SetTagHandler(TWK_Tag, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
-		return NewTwkFromData(utils.NewBufStack("twk", wrsrc.Tag.Data))
+		return NewTwkFromData(wrsrc.NewBufStack("twk"))
 	})
 	wad.SetTagHandler(TWK_TagCombatFile, func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
-		return NewTwkFromCombatFile(utils.NewBufStack("twkcb", wrsrc.Tag.Data))
+		return NewTwkFromCombatFile(wrsrc.NewBufStack("twkcb"))
 	})
 }
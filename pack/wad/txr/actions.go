@@ -1,116 +1,223 @@
 package txr
 
 import (
+	"bytes"
 	"fmt"
 	"image"
+	"image/png"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 
 	_ "image/gif"
 	_ "image/jpeg"
-	_ "image/png"
 
 	"github.com/mogaika/god_of_war_browser/config"
 	"github.com/mogaika/god_of_war_browser/pack/wad"
 	file_gfx "github.com/mogaika/god_of_war_browser/pack/wad/gfx"
+	"github.com/mogaika/god_of_war_browser/webutils"
 )
 
-func (txr *Texture) changeTexturePS2(wrsrc *wad.WadNodeRsrc, img image.Image, createNewPal bool) error {
-	if txr.GfxName == "" || txr.PalName == "" {
-		return fmt.Errorf("Do not support texture with lod levels")
+// lodLevel is texture of lod chain (texture and its sub textures)
+type lodLevel struct {
+	txrNode *wad.Node
+	txr     *Texture
+	gfxNode *wad.Node
+	gfx     *file_gfx.GFX
+}
+
+const maxLodLevels = 8
+
+// lodChain returns texture and its sub textures with gfx
+func (txr *Texture) lodChain(wrsrc *wad.WadNodeRsrc) ([]lodLevel, error) {
+	chain := make([]lodLevel, 0)
+	node, t := wrsrc.Node, txr
+	for {
+		gfxn := wrsrc.Wad.GetNodeByName(t.GfxName, node.Id, false)
+		if gfxn == nil {
+			return nil, fmt.Errorf("Cannot find gfx %s", t.GfxName)
+		}
+		gfxw, _, err := wrsrc.Wad.GetInstanceFromNode(gfxn.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot get gfx %s instance: %v", t.GfxName, err)
+		}
+		chain = append(chain, lodLevel{txrNode: node, txr: t, gfxNode: gfxn, gfx: gfxw.(*file_gfx.GFX)})
+
+		if t.SubTxrName == "" || len(chain) == maxLodLevels {
+			return chain, nil
+		}
+		subName := t.SubTxrName
+		if node = wrsrc.Wad.GetNodeByName(subName, wrsrc.Node.Id, false); node == nil {
+			return nil, fmt.Errorf("Cannot find sub texture %s", subName)
+		}
+		subw, _, err := wrsrc.Wad.GetInstanceFromNode(node.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot get sub texture %s instance: %v", subName, err)
+		}
+		var ok bool
+		if t, ok = subw.(*Texture); !ok || t.GfxName == "" {
+			return nil, fmt.Errorf("Sub texture %s is not PS2 texture with gfx", subName)
+		}
 	}
+}
 
-	gfxcn := wrsrc.Wad.GetNodeByName(txr.GfxName, wrsrc.Node.Id, false)
-	palcn := wrsrc.Wad.GetNodeByName(txr.PalName, wrsrc.Node.Id, false)
+// copyGfx returns copy of gfx, setters of data replace slices, so they are not cloned
+func copyGfx(gfx *file_gfx.GFX) *file_gfx.GFX {
+	c := *gfx
+	c.Data = append([][]byte(nil), gfx.Data...)
+	return &c
+}
 
-	gfxcw, _, gfxErr := wrsrc.Wad.GetInstanceFromNode(gfxcn.Id)
-	palcw, _, palErr := wrsrc.Wad.GetInstanceFromNode(palcn.Id)
+func (txr *Texture) changeTexturePS2(wrsrc *wad.WadNodeRsrc, img image.Image, createNewPal bool, opts ImportOptions) error {
+	if txr.GfxName == "" {
+		return fmt.Errorf("Texture has no gfx")
+	}
+	if txr.PalName == "" {
+		return fmt.Errorf("Do not support true color texture (without palette)")
+	}
 
-	gfxc := gfxcw.(*file_gfx.GFX)
-	palc := palcw.(*file_gfx.GFX)
+	chain, err := txr.lodChain(wrsrc)
+	if err != nil {
+		return err
+	}
+	top := chain[0]
 
-	if gfxErr != nil || palErr != nil {
-		return fmt.Errorf("Cannot get gfx or pal instance: %v, %v", gfxErr, palErr)
+	palcn := wrsrc.Wad.GetNodeByName(txr.PalName, wrsrc.Node.Id, false)
+	if palcn == nil {
+		return fmt.Errorf("Cannot find pal %s", txr.PalName)
+	}
+	palcw, _, err := wrsrc.Wad.GetInstanceFromNode(palcn.Id)
+	if err != nil {
+		return fmt.Errorf("Cannot get pal instance: %v", err)
 	}
+	palc := copyGfx(palcw.(*file_gfx.GFX))
 
-	if len(gfxc.Data) != 1 {
+	if len(top.gfx.Data) != 1 {
 		return fmt.Errorf("Do not support gfx with DatasCount != 1")
 	}
 
-	b := img.Bounds().Max
-	log.Println("Calculating palette...")
-	newPal, newIdx := imgToPaletteAndIndex(img, gfxc.Encoding == 0)
-	//log.Println("done")
+	if opts.Bpp == 0 {
+		opts.Bpp = 8
+		if top.gfx.Bpi == 4 {
+			opts.Bpp = 4
+		}
+	}
+	lods := opts.Mipmaps
+	if lods < 0 {
+		lods = len(chain) - 1
+	}
 
-	gfxc.Data[0] = newIdx
-	gfxc.DataSize = uint32(len(gfxc.Data[0]))
-	gfxc.Bpi = 8
-	// gfxc.Encoding = do not change
-	gfxc.Width = uint32(b.X)
-	gfxc.Height = uint32(b.Y)
+	log.Printf("Converting texture: %d bpp, %s quantizer, dither %v, %d lods", opts.Bpp, opts.Quantizer, opts.Dither, lods)
+	t := encodePS2Texture(img, opts, lods)
 
-	palc.Data[0] = paletteToBytearray(newPal)
-	palc.Width = 16
-	palc.Height = (uint32(len(newPal)) / palc.Width) * uint32(len(palc.Data))
-	palc.DataSize = uint32(len(palc.Data[0]))
-	palc.Encoding = 0
-	palc.Bpi = 32
+	oldWidth, oldHeight := top.gfx.Width, top.gfx.RealHeight
+	b := img.Bounds()
+	lodDelta := lodDeltaForSize(oldWidth, oldHeight, uint32(b.Dx()), uint32(b.Dy()))
 
-	if len(palc.Data) == 2 {
-		log.Println("Detected grayscale palette. Calculating new grayscale palette...")
-		if err := gfxSecondPaletteToGrayscale(palc); err != nil {
-			return fmt.Errorf("Error when calculating grayscale palette: %v", err)
-		}
-	}
+	updates := make(map[wad.TagId][]byte)
+	newTags := make([]wad.Tag, 0)
+	insertPos := wrsrc.Tag.Id
 
-	gfxBinRaw, err := gfxc.MarshalToBinary()
-	if err != nil {
-		return fmt.Errorf("gfxc.MarshalToBinary(): %v", err)
+	if err := t.setPal(palc); err != nil {
+		return fmt.Errorf("Cannot encode palette: %v", err)
 	}
-
 	palBinRaw, err := palc.MarshalToBinary()
 	if err != nil {
 		return fmt.Errorf("palc.MarshalToBinary(): %v", err)
 	}
-
-	if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
-		gfxcn.Tag.Id: gfxBinRaw,
-	}); err != nil {
-		return fmt.Errorf("Update gfx tag error: %v", err)
-	}
-
+	palName := txr.PalName
 	if createNewPal {
-		newPalName := wrsrc.Wad.GenerateName(txr.PalName)
-
-		txr.PalName = newPalName
+		palName = wrsrc.Wad.GenerateName(txr.PalName)
+		log.Printf("Creating new palette '%s'", palName)
+		newTags = append(newTags, wad.Tag{Tag: wad.GetServerInstanceTag(), Flags: palcn.Tag.Flags, Name: palName, Data: palBinRaw})
+		if palcn.Tag.Id < insertPos {
+			insertPos = palcn.Tag.Id
+		}
+	} else {
+		updates[palcn.Tag.Id] = palBinRaw
+	}
 
-		log.Printf("Creating new palette '%s'", newPalName)
+	// names of texture of every lod level, new levels created for missing ones.
+	// Sub texture must be placed before texture, so new levels are inserted in reverse order
+	txrNames := make([]string, lods+1)
+	levelTags := make([][]wad.Tag, lods+1)
+	for i := range txrNames {
+		if i < len(chain) {
+			txrNames[i] = chain[i].txrNode.Tag.Name
+			if chain[i].txrNode.Tag.Id < insertPos {
+				insertPos = chain[i].txrNode.Tag.Id
+			}
+		} else {
+			txrNames[i] = wrsrc.Wad.GenerateName(fmt.Sprintf("%s_%d", wrsrc.Tag.Name, i))
+		}
+	}
 
-		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
-			wrsrc.Tag.Id: txr.MarshalToBinary(),
-		}); err != nil {
-			return fmt.Errorf("Update txr tag error: %v", err)
+	// instances of chain are cached by wad, so copies are changed until tags are updated.
+	// LODMultiplier kept as is: it scales distance and does not depend on size of texture
+	for i := 0; i <= lods; i++ {
+		var level lodLevel
+		if i < len(chain) {
+			level = chain[i]
+			txrCopy := *level.txr
+			level.txr = &txrCopy
+			level.gfx = copyGfx(level.gfx)
+			level.txr.LODParamK += lodDelta
+		} else {
+			level.gfx = &file_gfx.GFX{Encoding: top.gfx.Encoding}
+			level.txr = &Texture{
+				Magic:         TXR_MAGIC,
+				GfxName:       wrsrc.Wad.GenerateName(fmt.Sprintf("%s_%d", txr.GfxName, i)),
+				LODParamK:     txr.LODParamK + lodDelta,
+				LODMultiplier: txr.LODMultiplier,
+				Flags:         txr.Flags,
+			}
+		}
+		level.txr.PalName = palName
+		level.txr.SubTxrName = ""
+		if i < lods {
+			level.txr.SubTxrName = txrNames[i+1]
 		}
 
-		if err := wrsrc.Wad.InsertNewTags(palcn.Tag.Id, []wad.Tag{
-			{Tag: wad.GetServerInstanceTag(), Flags: palcn.Tag.Flags, Name: newPalName, Data: palBinRaw},
-		}); err != nil {
-			return fmt.Errorf("Insert pal tag error: %v", err)
+		if err := t.setGfx(level.gfx, i); err != nil {
+			return fmt.Errorf("Cannot encode gfx of lod %d: %v", i, err)
 		}
-	} else {
-		if err := wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{
-			palcn.Tag.Id: palBinRaw,
-		}); err != nil {
-			return fmt.Errorf("Update pal tag error: %v", err)
+		gfxBinRaw, err := level.gfx.MarshalToBinary()
+		if err != nil {
+			return fmt.Errorf("gfxc.MarshalToBinary(): %v", err)
 		}
+
+		if i < len(chain) {
+			updates[level.gfxNode.Tag.Id] = gfxBinRaw
+			updates[level.txrNode.Tag.Id] = level.txr.MarshalToBinary()
+		} else {
+			levelTags[i] = []wad.Tag{
+				{Tag: wad.GetServerInstanceTag(), Flags: top.gfxNode.Tag.Flags, Name: level.txr.GfxName, Data: gfxBinRaw},
+				{Tag: wad.GetServerInstanceTag(), Flags: wrsrc.Tag.Flags, Name: txrNames[i], Data: level.txr.MarshalToBinary()},
+			}
+		}
+	}
+	for i := lods; i >= len(chain); i-- {
+		newTags = append(newTags, levelTags[i]...)
 	}
 
+	if err := wrsrc.Wad.UpdateTagsData(updates); err != nil {
+		return fmt.Errorf("Update tags error: %v", err)
+	}
+	if len(newTags) != 0 {
+		if err := wrsrc.Wad.InsertNewTags(insertPos, newTags); err != nil {
+			return fmt.Errorf("Insert tags error: %v", err)
+		}
+	}
 	return nil
 }
 
 func (txr *Texture) ChangeTexture(wrsrc *wad.WadNodeRsrc, fNewImage io.Reader, createNewPal bool) error {
+	return txr.ChangeTextureWithOptions(wrsrc, fNewImage, createNewPal, DefaultImportOptions())
+}
+
+func (txr *Texture) ChangeTextureWithOptions(wrsrc *wad.WadNodeRsrc, fNewImage io.Reader, createNewPal bool, opts ImportOptions) error {
 	img, _, err := image.Decode(fNewImage)
 	if err != nil {
 		return err
@@ -118,42 +225,27 @@ func (txr *Texture) ChangeTexture(wrsrc *wad.WadNodeRsrc, fNewImage io.Reader, c
 
 	switch config.GetPlayStationVersion() {
 	case config.PS2:
-		return txr.changeTexturePS2(wrsrc, img, createNewPal)
+		return txr.changeTexturePS2(wrsrc, img, createNewPal, opts)
 	case config.PS3:
 		return txr.changeTexturePS3(wrsrc, img)
+	case config.PSVita:
+		return txr.changeTexturePSVita(wrsrc, img)
 	default:
 		return fmt.Errorf("Unsupported playstation version")
 	}
 
 }
 
-func gfxSecondPaletteToGrayscale(palc *file_gfx.GFX) error {
-	if len(palc.Data) != 2 {
-		return fmt.Errorf("DatasCount != 2 (%d)", len(palc.Data))
-	}
-
-	pal, err := palc.AsPalette(0, false)
-	if err != nil {
-		return fmt.Errorf("Getting palette fail: %v", err)
-	}
-	d := palc.Data[1]
-	for i := range pal {
-		c := pal[file_gfx.IndexSwizzlePalette(i)]
-
-		y := byte(0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B))
-		d[i*4] = y
-		d[i*4+1] = y
-		d[i*4+2] = y
-		d[i*4+3] = 0x80
-	}
-	return nil
-}
-
 func (txr *Texture) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r *http.Request, action string) {
 	switch action {
 	case "upload":
 		q := r.URL.Query()
 		createNewPal := strings.ToLower(q.Get("create_new_pal")) == "true"
+		opts, err := ParseImportOptions(q)
+		if err != nil {
+			fmt.Fprintln(w, err)
+			return
+		}
 
 		fImg, _, err := r.FormFile("img")
 		if err != nil {
@@ -161,9 +253,75 @@ func (txr *Texture) HttpAction(wrsrc *wad.WadNodeRsrc, w http.ResponseWriter, r
 			return
 		}
 		defer fImg.Close()
-		if err := txr.ChangeTexture(wrsrc, fImg, createNewPal); err != nil {
+		if err := txr.ChangeTextureWithOptions(wrsrc, fImg, createNewPal, opts); err != nil {
 			log.Printf("[txr] Error changing texture: %v", err)
 			fmt.Fprintln(w, "change texture error:", err)
 		}
+	case "export":
+		q := r.URL.Query()
+		var igfx, ipal int
+		fmt.Sscan(q.Get("gfx"), &igfx)
+		fmt.Sscan(q.Get("pal"), &ipal)
+		if igfx < 0 || ipal < 0 {
+			webutils.WriteError(w, fmt.Errorf("Invalid gfx %d or pal %d", igfx, ipal))
+			return
+		}
+
+		var buf bytes.Buffer
+		name, err := txr.Export(wrsrc, &buf, q.Get("format"), igfx, ipal)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteFile(w, &buf, name)
+	case "decode":
+		q := r.URL.Query()
+		var igfx, ipal int
+		fmt.Sscan(q.Get("gfx"), &igfx)
+		fmt.Sscan(q.Get("pal"), &ipal)
+		var buf bytes.Buffer
+		if err := txr.decode(wrsrc, &buf, q, igfx, ipal); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		webutils.WriteFile(w, &buf, wrsrc.Name()+".png")
+	}
+}
+
+// decode writes png of ps2 texture decoded in GS mode selected by query, because
+// gfx header do not store psm of high indexes (PSMT8H, PSMT4HL, PSMT4HH) and clut storage mode
+func (txr *Texture) decode(wrsrc *wad.WadNodeRsrc, w io.Writer, q url.Values, igfx, ipal int) error {
+	gfx, pal, err := txr.gfxAndPal(wrsrc)
+	if err != nil {
+		return err
+	}
+	if pal == nil {
+		return fmt.Errorf("Texture has no palette")
+	}
+	if igfx < 0 || ipal < 0 || igfx >= len(gfx.Data) || ipal >= len(pal.Data) {
+		return fmt.Errorf("Gfx %d or palette %d out of range", igfx, ipal)
+	}
+
+	mode := gfx.DefaultMode()
+	if name := q.Get("psm"); name != "" {
+		psm, ok := file_gfx.PsmByName(name)
+		if !ok {
+			return fmt.Errorf("Unknown psm %q", name)
+		}
+		mode.Psm = psm
+	}
+	if csm := q.Get("csm"); csm != "" {
+		if _, err := fmt.Sscan(csm, &mode.Csm); err != nil {
+			return fmt.Errorf("Invalid csm %q", csm)
+		}
+	}
+	if swizzled := q.Get("swizzled"); swizzled != "" {
+		mode.Swizzled = strings.ToLower(swizzled) == "true"
+	}
+
+	img, err := txr.imageMode(gfx, pal, igfx, ipal, &mode)
+	if err != nil {
+		return err
 	}
+	return png.Encode(w, img)
 }
@@ -0,0 +1,303 @@
+package txr
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"log"
+	"path"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+)
+
+// Batch export writes png of every texture image of wad into folder named as wad,
+// manifest describes images. Import replaces textures which images were changed
+
+const BATCH_MANIFEST_NAME = "manifest.json"
+
+// BatchTexture is manifest entry of exported texture image
+type BatchTexture struct {
+	Wad     string
+	Name    string
+	TagId   wad.TagId
+	File    string // path of png inside of folder
+	Gfx     int    // index of gfx data
+	Pal     int    // index of palette
+	GfxName string
+	PalName string
+	Flags   uint32
+	Width   int
+	Height  int
+	Hash    string // hash of pixels, used to find changed images
+}
+
+type BatchManifest struct {
+	Textures []BatchTexture
+}
+
+type BatchResult struct {
+	Wad        string
+	Name       string
+	File       string
+	SizeBefore int // size of wad data
+	SizeAfter  int
+	NewPalette bool   // palette was shared with other textures, so new one created
+	Error      string `json:",omitempty"`
+}
+
+type BatchSummary struct {
+	Changed    int
+	Unchanged  int
+	Missing    int // images removed from folder, textures are kept
+	Failed     int
+	SizeGrowth int
+	Results    []BatchResult // changed and failed textures
+}
+
+// ImageHash returns hash of size and pixels of image, so same image saved
+// by other editor has same hash
+func ImageHash(img image.Image) string {
+	b := img.Bounds()
+	h := sha1.New()
+	binary.Write(h, binary.LittleEndian, [2]uint32{uint32(b.Dx()), uint32(b.Dy())})
+	var pixel [4]byte
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			pixel[0], pixel[1], pixel[2], pixel[3] = c.R, c.G, c.B, c.A
+			h.Write(pixel[:])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// batchFileName returns path of image inside of folder, first image of texture named as texture
+func batchFileName(wadName, txrName string, iGfx, iPal int) string {
+	if iGfx == 0 && iPal == 0 {
+		return path.Join(wadName, txrName+".png")
+	}
+	return path.Join(wadName, fmt.Sprintf("%s_gfx%d_pal%d.png", txrName, iGfx, iPal))
+}
+
+func wadDataSize(w *wad.Wad) int {
+	size := 0
+	for _, t := range w.Tags {
+		size += len(t.Data)
+	}
+	return size
+}
+
+func marshalBatchTexture(txr *Texture, wrsrc *wad.WadNodeRsrc) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return txr.Marshal(wrsrc)
+}
+
+// ExportBatch writes images of all textures of wad to zip, textures which
+// failed to load are logged and skipped
+func ExportBatch(w *wad.Wad, zw *zip.Writer) ([]BatchTexture, error) {
+	entries := make([]BatchTexture, 0)
+	exported := make(map[string]bool)
+	for _, node := range w.Nodes {
+		inst, _, err := w.GetInstanceFromNode(node.Id)
+		if err != nil {
+			continue
+		}
+		txr, ok := inst.(*Texture)
+		if !ok {
+			continue
+		}
+
+		marshaled, err := marshalBatchTexture(txr, w.GetNodeResourceByNodeId(node.Id))
+		if err != nil {
+			log.Printf("[txr] Batch export of %s:%s failed: %v", w.Name(), node.Tag.Name, err)
+			continue
+		}
+
+		for _, ai := range marshaled.(*Ajax).Images {
+			file := batchFileName(w.Name(), node.Tag.Name, ai.Gfx, ai.Pal)
+			if exported[file] {
+				// next gen textures provide mipmaps as images of same gfx and pal
+				continue
+			}
+			exported[file] = true
+			img, _, err := image.Decode(bytes.NewReader(ai.Image))
+			if err != nil {
+				return nil, fmt.Errorf("Can't decode image of %s: %v", node.Tag.Name, err)
+			}
+
+			f, err := zw.Create(file)
+			if err != nil {
+				return nil, fmt.Errorf("Can't create zip file %s: %v", file, err)
+			}
+			if _, err := f.Write(ai.Image); err != nil {
+				return nil, err
+			}
+
+			entries = append(entries, BatchTexture{
+				Wad:     w.Name(),
+				Name:    node.Tag.Name,
+				TagId:   node.Tag.Id,
+				File:    file,
+				Gfx:     ai.Gfx,
+				Pal:     ai.Pal,
+				GfxName: txr.GfxName,
+				PalName: txr.PalName,
+				Flags:   txr.Flags,
+				Width:   img.Bounds().Dx(),
+				Height:  img.Bounds().Dy(),
+				Hash:    ImageHash(img),
+			})
+		}
+	}
+	return entries, nil
+}
+
+// findBatchNode finds node of texture by tag id of manifest, or by name
+// if wad was changed after export
+func findBatchNode(w *wad.Wad, e *BatchTexture) *wad.Node {
+	if int(e.TagId) < len(w.Tags) {
+		if t := w.GetTagById(e.TagId); t.Name == e.Name {
+			return w.GetNodeById(t.NodeId)
+		}
+	}
+	return w.GetNodeByName(e.Name, wad.NodeId(len(w.Nodes)-1), false)
+}
+
+// batchPaletteUsers counts textures using palette. Sub textures of lod chain
+// are not counted, they are changed together with their texture
+func batchPaletteUsers(w *wad.Wad) map[string]int {
+	textures := make(map[string]*Texture)
+	subTextures := make(map[string]bool)
+	for _, node := range w.Nodes {
+		inst, _, err := w.GetInstanceFromNode(node.Id)
+		if err != nil {
+			continue
+		}
+		if txr, ok := inst.(*Texture); ok {
+			textures[node.Tag.Name] = txr
+			if txr.SubTxrName != "" {
+				subTextures[txr.SubTxrName] = true
+			}
+		}
+	}
+
+	users := make(map[string]int)
+	for name, txr := range textures {
+		if !subTextures[name] && txr.PalName != "" {
+			users[txr.PalName]++
+		}
+	}
+	return users
+}
+
+// importBatchTexture replaces image of texture. Palette used by other textures
+// is not changed, new palette created instead. Returns true if palette was created
+func importBatchTexture(w *wad.Wad, e *BatchTexture, data []byte, palUsers map[string]int) (bool, error) {
+	if e.Gfx != 0 || e.Pal != 0 {
+		return false, fmt.Errorf("Only first gfx and palette of texture can be replaced")
+	}
+	node := findBatchNode(w, e)
+	if node == nil {
+		return false, fmt.Errorf("Cannot find texture %s", e.Name)
+	}
+	inst, _, err := w.GetInstanceFromNode(node.Id)
+	if err != nil {
+		return false, fmt.Errorf("Cannot load texture %s: %v", e.Name, err)
+	}
+	txr, ok := inst.(*Texture)
+	if !ok {
+		return false, fmt.Errorf("Node %s is not texture", e.Name)
+	}
+	palName := txr.PalName
+	createNewPal := palName != "" && palUsers[palName] > 1
+	if err := txr.ChangeTexture(w.GetNodeResourceByNodeId(node.Id), bytes.NewReader(data), createNewPal); err != nil {
+		return false, err
+	}
+	if createNewPal {
+		palUsers[palName]--
+	}
+	return createNewPal, nil
+}
+
+// ImportBatch replaces textures of wad which images in zip differ from
+// hash of manifest. Images removed from zip are ignored. Wad is written once,
+// after all textures are changed, even if import panics
+func ImportBatch(w *wad.Wad, entries []BatchTexture, files map[string]*zip.File, summary *BatchSummary) {
+	changed := make([]int, 0) // indexes of results of changed textures
+	w.DeferSave()
+	defer func() {
+		if err := w.SaveDeferred(); err != nil {
+			log.Printf("[txr] Batch import of %s failed to save: %v", w.Name(), err)
+			for _, i := range changed {
+				r := &summary.Results[i]
+				r.Error = fmt.Sprintf("Cannot save wad: %v", err)
+				summary.Changed--
+				summary.Failed++
+				summary.SizeGrowth -= r.SizeAfter - r.SizeBefore
+			}
+		}
+	}()
+	palUsers := batchPaletteUsers(w)
+
+	for i := range entries {
+		e := &entries[i]
+		if e.Wad != w.Name() {
+			continue
+		}
+
+		result := BatchResult{Wad: e.Wad, Name: e.Name, File: e.File}
+		fail := func(err error) {
+			result.Error = err.Error()
+			summary.Failed++
+			summary.Results = append(summary.Results, result)
+		}
+
+		zf, ok := files[e.File]
+		if !ok {
+			summary.Missing++
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			fail(err)
+			continue
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			fail(err)
+			continue
+		}
+		img, _, err := image.Decode(bytes.NewReader(data))
+		if err != nil {
+			fail(fmt.Errorf("Can't decode image: %v", err))
+			continue
+		}
+		if ImageHash(img) == e.Hash {
+			summary.Unchanged++
+			continue
+		}
+
+		result.SizeBefore = wadDataSize(w)
+		if result.NewPalette, err = importBatchTexture(w, e, data, palUsers); err != nil {
+			log.Printf("[txr] Batch import of %s:%s failed: %v", e.Wad, e.Name, err)
+			fail(err)
+			continue
+		}
+		result.SizeAfter = wadDataSize(w)
+		summary.Changed++
+		summary.SizeGrowth += result.SizeAfter - result.SizeBefore
+		changed = append(changed, len(summary.Results))
+		summary.Results = append(summary.Results, result)
+	}
+}
@@ -0,0 +1,39 @@
+package txr
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestImageHash(t *testing.T) {
+	nrgba := image.NewNRGBA(image.Rect(0, 0, 4, 2))
+	rgba := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	for i := 0; i < 8; i++ {
+		c := color.NRGBA{R: uint8(i * 30), G: 10, B: 200, A: 0xff}
+		nrgba.SetNRGBA(i%4, i/4, c)
+		rgba.Set(i%4, i/4, c)
+	}
+
+	if ImageHash(nrgba) != ImageHash(rgba) {
+		t.Errorf("Same pixels of different image types have different hash")
+	}
+
+	nrgba.SetNRGBA(3, 1, color.NRGBA{A: 0xff})
+	if ImageHash(nrgba) == ImageHash(rgba) {
+		t.Errorf("Changed image has same hash")
+	}
+
+	if ImageHash(image.NewNRGBA(image.Rect(0, 0, 2, 4))) == ImageHash(image.NewNRGBA(image.Rect(0, 0, 4, 2))) {
+		t.Errorf("Size is not part of hash")
+	}
+}
+
+func TestBatchFileName(t *testing.T) {
+	if name := batchFileName("R_SHELL.WAD", "TXR_sky", 0, 0); name != "R_SHELL.WAD/TXR_sky.png" {
+		t.Errorf("Unexpected name %q", name)
+	}
+	if name := batchFileName("R_SHELL.WAD", "TXR_sky", 1, 2); name != "R_SHELL.WAD/TXR_sky_gfx1_pal2.png" {
+		t.Errorf("Unexpected name %q", name)
+	}
+}
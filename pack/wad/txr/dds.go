@@ -0,0 +1,243 @@
+package txr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+
+	"github.com/mogaika/god_of_war_browser/psvita/gxt"
+)
+
+// DirectDraw Surface header flags
+const (
+	DDSD_CAPS        = 0x1
+	DDSD_HEIGHT      = 0x2
+	DDSD_WIDTH       = 0x4
+	DDSD_PITCH       = 0x8
+	DDSD_PIXELFORMAT = 0x1000
+	DDSD_MIPMAPCOUNT = 0x20000
+	DDSD_LINEARSIZE  = 0x80000
+
+	DDPF_ALPHAPIXELS = 0x1
+	DDPF_FOURCC      = 0x4
+	DDPF_RGB         = 0x40
+
+	DDSCAPS_COMPLEX = 0x8
+	DDSCAPS_TEXTURE = 0x1000
+	DDSCAPS_MIPMAP  = 0x400000
+
+	DDS_FOURCC_DXT1 = "DXT1"
+	DDS_FOURCC_DXT5 = "DXT5"
+)
+
+type ddsPixelFormat struct {
+	Size        uint32
+	Flags       uint32
+	FourCC      [4]byte
+	RGBBitCount uint32
+	RBitMask    uint32
+	GBitMask    uint32
+	BBitMask    uint32
+	ABitMask    uint32
+}
+
+type ddsHeader struct {
+	Magic             [4]byte
+	Size              uint32
+	Flags             uint32
+	Height            uint32
+	Width             uint32
+	PitchOrLinearSize uint32
+	Depth             uint32
+	MipMapCount       uint32
+	Reserved1         [11]uint32
+	PixelFormat       ddsPixelFormat
+	Caps              uint32
+	Caps2             uint32
+	Caps3             uint32
+	Caps4             uint32
+	Reserved2         uint32
+}
+
+// ddsTexture is data of dds levels, fourCC is empty for A8R8G8B8 data
+type ddsTexture struct {
+	width, height int
+	fourCC        string
+	levels        [][]byte
+}
+
+// ddsARGB returns image data in A8R8G8B8 format (bgra bytes order)
+func ddsARGB(img image.Image) []byte {
+	nrgba := MipLevels(img, 1)[0]
+	data := make([]byte, len(nrgba.Pix))
+	for i := 0; i < len(data); i += 4 {
+		data[i], data[i+1], data[i+2], data[i+3] = nrgba.Pix[i+2], nrgba.Pix[i+1], nrgba.Pix[i], nrgba.Pix[i+3]
+	}
+	return data
+}
+
+// ddsFromImages makes uncompressed dds of mipmaps, levels which are not
+// half of previous are dropped
+func ddsFromImages(images []image.Image) *ddsTexture {
+	dds := &ddsTexture{width: images[0].Bounds().Dx(), height: images[0].Bounds().Dy()}
+	w, h := dds.width, dds.height
+	for _, img := range images {
+		if img.Bounds().Dx() != w || img.Bounds().Dy() != h {
+			break
+		}
+		dds.levels = append(dds.levels, ddsARGB(img))
+		if w == 1 && h == 1 {
+			break
+		}
+		w, h = maxInt(w/2, 1), maxInt(h/2, 1)
+	}
+	return dds
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (dds *ddsTexture) Write(w io.Writer) error {
+	h := ddsHeader{
+		Size:        124,
+		Flags:       DDSD_CAPS | DDSD_HEIGHT | DDSD_WIDTH | DDSD_PIXELFORMAT,
+		Height:      uint32(dds.height),
+		Width:       uint32(dds.width),
+		MipMapCount: uint32(len(dds.levels)),
+		Caps:        DDSCAPS_TEXTURE,
+	}
+	copy(h.Magic[:], "DDS ")
+	h.PixelFormat.Size = 32
+
+	if dds.fourCC == "" {
+		h.Flags |= DDSD_PITCH
+		h.PitchOrLinearSize = uint32(dds.width * 4)
+		h.PixelFormat.Flags = DDPF_RGB | DDPF_ALPHAPIXELS
+		h.PixelFormat.RGBBitCount = 32
+		h.PixelFormat.RBitMask = 0x00ff0000
+		h.PixelFormat.GBitMask = 0x0000ff00
+		h.PixelFormat.BBitMask = 0x000000ff
+		h.PixelFormat.ABitMask = 0xff000000
+	} else {
+		h.Flags |= DDSD_LINEARSIZE
+		h.PitchOrLinearSize = uint32(len(dds.levels[0]))
+		h.PixelFormat.Flags = DDPF_FOURCC
+		copy(h.PixelFormat.FourCC[:], dds.fourCC)
+	}
+	if len(dds.levels) > 1 {
+		h.Flags |= DDSD_MIPMAPCOUNT
+		h.Caps |= DDSCAPS_COMPLEX | DDSCAPS_MIPMAP
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &h)
+	for _, level := range dds.levels {
+		buf.Write(level)
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ddsReorderBlocks returns blocks of level in rows order. blockIndex returns
+// index of source block for position of block
+func ddsReorderBlocks(data []byte, width, height, blockSize int, blockIndex func(bx, by int) int) []byte {
+	result := make([]byte, 0, width*height/16*blockSize)
+	for by := 0; by < height/4; by++ {
+		for bx := 0; bx < width/4; bx++ {
+			i := blockIndex(bx, by) * blockSize
+			result = append(result, data[i:i+blockSize]...)
+		}
+	}
+	return result
+}
+
+// transposeDXT1Block swaps rows and columns of color codes of block
+func transposeDXT1Block(block []byte) []byte {
+	result := append([]byte{}, block[:8]...)
+	code := binary.LittleEndian.Uint32(block[4:])
+	transposed := uint32(0)
+	for y := uint(0); y < 4; y++ {
+		for x := uint(0); x < 4; x++ {
+			transposed |= ((code >> (2 * (4*y + x))) & 3) << (2 * (4*x + y))
+		}
+	}
+	binary.LittleEndian.PutUint32(result[4:], transposed)
+	return result
+}
+
+// dds returns levels of ps3 texture. DXT1 blocks are copied without recompression,
+// in order and orientation they are shown by imageFromBs. Levels smaller than block are dropped
+func (t *Ps3Texture) dds() *ddsTexture {
+	if t.TextureColorFormat != CELL_GCM_TEXTURE_COMPRESSED_DXT1 {
+		return ddsFromImages(t.images)
+	}
+
+	dds := &ddsTexture{width: int(t.Width), height: int(t.Height), fourCC: DDS_FOURCC_DXT1}
+	offset := 0
+	for _, img := range t.images {
+		w, h := img.Bounds().Dx(), img.Bounds().Dy()
+		if w < 4 || h < 4 {
+			break
+		}
+		level := ddsReorderBlocks(t.payload[offset:], w, h, 8, func(bx, by int) int {
+			return ps3SwizzleIndex(uint32(bx), uint32(by), uint32(w/4), uint32(h/4))
+		})
+		for i := 0; i < len(level); i += 8 {
+			copy(level[i:], transposeDXT1Block(level[i:]))
+		}
+		dds.levels = append(dds.levels, level)
+		offset += w * h / 2
+	}
+	if len(dds.levels) == 0 {
+		return ddsFromImages(t.images)
+	}
+	return dds
+}
+
+// dds returns levels of first texture of gxt, compressed blocks copied without recompression.
+// Textures which size is not power of two exported uncompressed
+func (t *PsVitaTexture) dds() (*ddsTexture, error) {
+	ti := t.g.TextureInfos[0]
+	w, h := int(ti.Width), int(ti.Height)
+
+	var fourCC string
+	blockSize := 8
+	switch ti.Format {
+	case gxt.FORMAT_DXT1:
+		fourCC = DDS_FOURCC_DXT1
+	case gxt.FORMAT_DXT5:
+		fourCC, blockSize = DDS_FOURCC_DXT5, 0x10
+	}
+	if fourCC == "" || ti.Type != gxt.TYPE_SWIZZLED || w&(w-1) != 0 || h&(h-1) != 0 {
+		return ddsFromImages(t.images[:1]), nil
+	}
+
+	data, err := ti.Data(bytes.NewReader(t.gxtData))
+	if err != nil {
+		return nil, err
+	}
+
+	dds := &ddsTexture{width: w, height: h, fourCC: fourCC}
+	offset := 0
+	for level := 0; level < maxInt(int(ti.MipMapsCount), 1) && w >= 4 && h >= 4; level++ {
+		size := w * h / 16 * blockSize
+		if offset+size > len(data) {
+			break
+		}
+		lw, lh := w, h
+		dds.levels = append(dds.levels, ddsReorderBlocks(data[offset:], lw, lh, blockSize, func(bx, by int) int {
+			return int(gxt.IndexSwizzle(uint32(bx), uint32(by), uint32(lw/4), uint32(lh/4)))
+		}))
+		offset += size
+		w, h = w/2, h/2
+	}
+	if len(dds.levels) == 0 {
+		return ddsFromImages(t.images[:1]), nil
+	}
+	return dds, nil
+}
@@ -0,0 +1,174 @@
+package txr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/psvita/gxt"
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+func TestPs3DxtDDS(t *testing.T) {
+	// 16x8 texture with full chain of mipmaps, data of levels smaller than block is truncated
+	payload := make([]byte, 64+16+4+1+0)
+	for i := range payload {
+		payload[i] = byte(i*37 + 11)
+	}
+	tex, err := NewPs3TextureFromData(utils.NewBufStack("ps3texture",
+		testPs3TagData(CELL_GCM_TEXTURE_COMPRESSED_DXT1, 16, 8, payload, 5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tex.replace(testPs3TagData(CELL_GCM_TEXTURE_COMPRESSED_DXT1, 16, 8, payload, 5),
+		image.NewNRGBA(image.Rect(0, 0, 16, 8))); err == nil {
+		t.Errorf("Replacing of DXT1 texture returned nil error")
+	}
+
+	dds := tex.dds()
+	if dds.fourCC != DDS_FOURCC_DXT1 || len(dds.levels) != 2 || len(dds.levels[0]) != 16*8/2 {
+		t.Fatalf("Unexpected dds %q with %d levels", dds.fourCC, len(dds.levels))
+	}
+
+	// blocks of dds in rows order must decode to same image as shown by browser
+	checkDDSBlocks(t, dds.fourCC, dds.levels[0], tex.images[0].(*image.NRGBA))
+
+	var buf bytes.Buffer
+	if err := dds.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 128+64+16 || string(buf.Bytes()[:4]) != "DDS " || string(buf.Bytes()[84:88]) != "DXT1" {
+		t.Errorf("Wrong dds file of size %d", buf.Len())
+	}
+	if mips := binary.LittleEndian.Uint32(buf.Bytes()[28:]); mips != 2 {
+		t.Errorf("Wrong mipmaps count %d", mips)
+	}
+}
+
+// decodeDXTBlock decodes single DXT block, as gxt texture of block size
+func decodeDXTBlock(t *testing.T, fourCC string, block []byte) *image.NRGBA {
+	ti := &gxt.TextureInfo{Format: gxt.FORMAT_DXT1, Type: gxt.TYPE_SWIZZLED, Width: 4, Height: 4, Size: 8}
+	if fourCC == DDS_FOURCC_DXT5 {
+		ti.Format, ti.Size = gxt.FORMAT_DXT5, 0x10
+	}
+	img, err := ti.ToImage(bytes.NewReader(block[:ti.Size]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img.(*image.NRGBA)
+}
+
+// checkDDSBlocks compares blocks of dds level in rows order with image
+func checkDDSBlocks(t *testing.T, fourCC string, level []byte, expected *image.NRGBA) {
+	blockSize := 8
+	if fourCC == DDS_FOURCC_DXT5 {
+		blockSize = 0x10
+	}
+	blocksW := expected.Bounds().Dx() / 4
+	for i := 0; i < len(level)/blockSize; i++ {
+		bx, by := i%blocksW, i/blocksW
+		block := decodeDXTBlock(t, fourCC, level[i*blockSize:])
+		for y := 0; y < 4; y++ {
+			for x := 0; x < 4; x++ {
+				if c, e := block.NRGBAAt(x, y), expected.NRGBAAt(bx*4+x, by*4+y); c != e {
+					t.Fatalf("%s block %d pixel %d,%d: %v != %v", fourCC, i, x, y, c, e)
+				}
+			}
+		}
+	}
+}
+
+func testPsVitaTagData(t *testing.T, format uint32, img *image.NRGBA, levels int) []byte {
+	g := &gxt.GXT{
+		Header:       gxt.Header{Magic: 0x00545847, Version: 0x10000003},
+		TextureInfos: []gxt.TextureInfo{{PaletteIndex: ^uint32(0), Format: format, Type: gxt.TYPE_SWIZZLED}},
+	}
+	data, err := g.TextureInfos[0].FromImages(MipLevels(img, levels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gxtData, err := g.Marshal([][]byte{data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, PSVITA_GXT_OFFSET)
+	copy(header[4:], PSVITA_MAGIC)
+	return append(header, gxtData...)
+}
+
+func TestPsVitaDxtDDS(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 16, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 16), G: uint8(y * 32), B: uint8(x * y), A: 0xff})
+		}
+	}
+
+	for _, c := range []struct {
+		format    uint32
+		fourCC    string
+		blockSize int
+	}{{gxt.FORMAT_DXT1, DDS_FOURCC_DXT1, 8}, {gxt.FORMAT_DXT5, DDS_FOURCC_DXT5, 0x10}} {
+		tex, err := NewPsVitaTextureFromData(utils.NewBufStack("psvita", testPsVitaTagData(t, c.format, img, 2)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dds, err := tex.dds()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dds.fourCC != c.fourCC || len(dds.levels) != 2 ||
+			len(dds.levels[0]) != 16*8/16*c.blockSize || len(dds.levels[1]) != 8*4/16*c.blockSize {
+			t.Fatalf("Unexpected dds %q with %d levels", dds.fourCC, len(dds.levels))
+		}
+
+		// swizzled blocks must be reordered to rows, so they decode to same image as gxt
+		checkDDSBlocks(t, dds.fourCC, dds.levels[0], tex.images[0].(*image.NRGBA))
+		data, err := tex.g.TextureInfos[0].Data(bytes.NewReader(tex.gxtData))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mip, err := (&gxt.TextureInfo{Format: c.format, Type: gxt.TYPE_SWIZZLED, Width: 8, Height: 4,
+			Size: uint32(len(dds.levels[1]))}).ToImage(bytes.NewReader(data[len(dds.levels[0]):]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkDDSBlocks(t, dds.fourCC, dds.levels[1], mip.(*image.NRGBA))
+
+		var buf bytes.Buffer
+		if err := dds.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != 128+len(dds.levels[0])+len(dds.levels[1]) || string(buf.Bytes()[84:88]) != c.fourCC {
+			t.Errorf("Wrong dds file of size %d", buf.Len())
+		}
+		if mips := binary.LittleEndian.Uint32(buf.Bytes()[28:]); mips != 2 {
+			t.Errorf("Wrong mipmaps count %d", mips)
+		}
+	}
+}
+
+func TestPaletteFiles(t *testing.T) {
+	palette := []color.NRGBA{{R: 1, G: 2, B: 3, A: 0xff}, {A: 0}, {R: 0xff, A: 0x80}}
+
+	var act bytes.Buffer
+	if err := writeACT(&act, palette); err != nil {
+		t.Fatal(err)
+	}
+	if b := act.Bytes(); len(b) != 772 || b[0] != 1 || b[2] != 3 || b[6] != 0xff ||
+		binary.BigEndian.Uint16(b[768:]) != 3 || binary.BigEndian.Uint16(b[770:]) != 1 {
+		t.Errorf("Wrong act file")
+	}
+
+	var gpl bytes.Buffer
+	if err := writeGPL(&gpl, "test", palette); err != nil {
+		t.Fatal(err)
+	}
+	want := "GIMP Palette\nName: test\nColumns: 16\n#\n" +
+		"  1   2   3\tIndex 0 alpha 255\n  0   0   0\tIndex 1 alpha 0\n255   0   0\tIndex 2 alpha 128\n"
+	if gpl.String() != want {
+		t.Errorf("Wrong gpl file:\n%s", gpl.String())
+	}
+}
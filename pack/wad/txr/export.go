@@ -0,0 +1,291 @@
+package txr
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	file_gfx "github.com/mogaika/god_of_war_browser/pack/wad/gfx"
+)
+
+// Export formats of texture
+const (
+	EXPORT_DDS     = "dds"     // uncompressed with lod levels, or DXT of remaster textures as is
+	EXPORT_TGA     = "tga"     // 32 bit image
+	EXPORT_INDEXED = "indexed" // zip of paletted png, raw indexes and all palettes as act and gpl
+	EXPORT_ACT     = "act"     // Adobe color table of palette
+	EXPORT_GPL     = "gpl"     // GIMP palette
+)
+
+// gfxAndPal returns gfx and palette of texture, palette is nil for true color textures
+func (txr *Texture) gfxAndPal(wrsrc *wad.WadNodeRsrc) (*file_gfx.GFX, *file_gfx.GFX, error) {
+	if txr.GfxName == "" {
+		return nil, nil, fmt.Errorf("Texture has no gfx")
+	}
+	get := func(name string) (*file_gfx.GFX, error) {
+		n := wrsrc.Wad.GetNodeByName(name, wrsrc.Node.Id, false)
+		if n == nil {
+			return nil, fmt.Errorf("Cannot find %s", name)
+		}
+		inst, _, err := wrsrc.Wad.GetInstanceFromNode(n.Id)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting %s: %v", name, err)
+		}
+		gfx, ok := inst.(*file_gfx.GFX)
+		if !ok {
+			return nil, fmt.Errorf("%s is not gfx", name)
+		}
+		return gfx, nil
+	}
+
+	gfx, err := get(txr.GfxName)
+	if err != nil {
+		return nil, nil, err
+	}
+	var pal *file_gfx.GFX
+	if txr.PalName != "" {
+		if pal, err = get(txr.PalName); err != nil {
+			return nil, nil, err
+		}
+	}
+	return gfx, pal, nil
+}
+
+func isNextGenTexture() bool {
+	v := config.GetPlayStationVersion()
+	return v == config.PS3 || v == config.PSVita
+}
+
+// exportImage returns image of gfx and palette, first image for remaster textures
+func (txr *Texture) exportImage(wrsrc *wad.WadNodeRsrc, igfx, ipal int) (image.Image, error) {
+	if isNextGenTexture() {
+		_, ngtf, err := txr.findPSNextGenTexture(wrsrc)
+		if err != nil {
+			return nil, err
+		}
+		return ngtf.(nextGenImager).Images()[0], nil
+	}
+
+	gfx, pal, err := txr.gfxAndPal(wrsrc)
+	if err != nil {
+		return nil, err
+	}
+	if igfx >= len(gfx.Data) || (pal != nil && ipal >= len(pal.Data)) {
+		return nil, fmt.Errorf("Gfx %d or palette %d out of range", igfx, ipal)
+	}
+	return txr.image(gfx, pal, igfx, ipal)
+}
+
+// exportDDS returns lod chain of ps2 texture or data of remaster texture
+func (txr *Texture) exportDDS(wrsrc *wad.WadNodeRsrc, igfx, ipal int) (*ddsTexture, error) {
+	if isNextGenTexture() {
+		_, ngtf, err := txr.findPSNextGenTexture(wrsrc)
+		if err != nil {
+			return nil, err
+		}
+		switch t := ngtf.(type) {
+		case *Ps3Texture:
+			return t.dds(), nil
+		case *PsVitaTexture:
+			return t.dds()
+		}
+		return nil, fmt.Errorf("Unknown next gen texture %s", txr.SubTxrName)
+	}
+
+	chain, err := txr.lodChain(wrsrc)
+	if err != nil {
+		return nil, err
+	}
+	images := make([]image.Image, 0, len(chain))
+	for _, level := range chain {
+		if igfx >= len(level.gfx.Data) {
+			break
+		}
+		_, pal, err := level.txr.gfxAndPal(wrsrc.Wad.GetNodeResourceByNodeId(level.txrNode.Id))
+		if err != nil {
+			return nil, err
+		}
+		levelPal := ipal
+		if pal != nil && levelPal >= len(pal.Data) {
+			levelPal = 0
+		}
+		img, err := level.txr.image(level.gfx, pal, igfx, levelPal)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	if len(images) == 0 {
+		return nil, fmt.Errorf("Gfx %d out of range", igfx)
+	}
+	return ddsFromImages(images), nil
+}
+
+// writeTGA writes uncompressed 32 bit tga with top left origin
+func writeTGA(w io.Writer, img image.Image) error {
+	nrgba := MipLevels(img, 1)[0]
+	b := nrgba.Bounds()
+
+	header := make([]byte, 18)
+	header[2] = 2 // uncompressed true color
+	binary.LittleEndian.PutUint16(header[12:], uint16(b.Dx()))
+	binary.LittleEndian.PutUint16(header[14:], uint16(b.Dy()))
+	header[16] = 32
+	header[17] = 0x20 | 8 // top left origin, 8 bits of alpha
+
+	data := ddsARGB(nrgba)
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// writeACT writes palette as Adobe color table. Alpha is not supported by format,
+// first fully transparent color marked as transparent index
+func writeACT(w io.Writer, palette []color.NRGBA) error {
+	data := make([]byte, 256*3+4)
+	transparent := 0xffff
+	for i, c := range palette {
+		if i >= 256 {
+			break
+		}
+		data[i*3], data[i*3+1], data[i*3+2] = c.R, c.G, c.B
+		if c.A == 0 && transparent == 0xffff {
+			transparent = i
+		}
+	}
+	binary.BigEndian.PutUint16(data[256*3:], uint16(len(palette)))
+	binary.BigEndian.PutUint16(data[256*3+2:], uint16(transparent))
+	_, err := w.Write(data)
+	return err
+}
+
+// writeGPL writes palette as GIMP palette, alpha is kept in color names
+func writeGPL(w io.Writer, name string, palette []color.NRGBA) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "GIMP Palette\nName: %s\nColumns: 16\n#\n", name)
+	for i, c := range palette {
+		fmt.Fprintf(bw, "%3d %3d %3d\tIndex %d alpha %d\n", c.R, c.G, c.B, i, c.A)
+	}
+	return bw.Flush()
+}
+
+// exportPalette returns palette of paletted ps2 texture
+func (txr *Texture) exportPalette(wrsrc *wad.WadNodeRsrc, ipal int) ([]color.NRGBA, error) {
+	_, pal, err := txr.gfxAndPal(wrsrc)
+	if err != nil {
+		return nil, err
+	}
+	if pal == nil {
+		return nil, fmt.Errorf("Texture has no palette")
+	}
+	if ipal >= len(pal.Data) {
+		return nil, fmt.Errorf("Palette %d out of range", ipal)
+	}
+	return pal.AsPalette(ipal, true)
+}
+
+// exportIndexed writes zip with paletted png of gfx and palette, raw indexes
+// (byte per pixel) and every palette of texture as act and gpl
+func (txr *Texture) exportIndexed(wrsrc *wad.WadNodeRsrc, w io.Writer, igfx, ipal int) error {
+	gfx, pal, err := txr.gfxAndPal(wrsrc)
+	if err != nil {
+		return err
+	}
+	if pal == nil {
+		return fmt.Errorf("Texture has no palette")
+	}
+	if igfx >= len(gfx.Data) || ipal >= len(pal.Data) {
+		return fmt.Errorf("Gfx %d or palette %d out of range", igfx, ipal)
+	}
+	indexes, err := gfx.AsPaletteIndexes(igfx)
+	if err != nil {
+		return err
+	}
+
+	name := wrsrc.Name()
+	zw := zip.NewWriter(w)
+	for i := range pal.Data {
+		palette, err := pal.AsPalette(i, true)
+		if err != nil {
+			return err
+		}
+		if i == ipal {
+			img := image.NewPaletted(image.Rect(0, 0, int(gfx.Width), int(gfx.RealHeight)), make(color.Palette, len(palette)))
+			for ci, c := range palette {
+				img.Palette[ci] = c
+			}
+			copy(img.Pix, indexes)
+
+			f, err := zw.Create(name + ".png")
+			if err != nil {
+				return err
+			}
+			if err := png.Encode(f, img); err != nil {
+				return err
+			}
+			if f, err = zw.Create(name + ".raw"); err != nil {
+				return err
+			}
+			if _, err := f.Write(indexes); err != nil {
+				return err
+			}
+		}
+
+		palName := fmt.Sprintf("%s_pal%d", name, i)
+		f, err := zw.Create(palName + ".act")
+		if err != nil {
+			return err
+		}
+		if err := writeACT(f, palette); err != nil {
+			return err
+		}
+		if f, err = zw.Create(palName + ".gpl"); err != nil {
+			return err
+		}
+		if err := writeGPL(f, palName, palette); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Export writes texture in one of EXPORT_ formats, returns name of file
+func (txr *Texture) Export(wrsrc *wad.WadNodeRsrc, w io.Writer, format string, igfx, ipal int) (string, error) {
+	name := wrsrc.Name()
+	switch format {
+	case EXPORT_DDS:
+		dds, err := txr.exportDDS(wrsrc, igfx, ipal)
+		if err != nil {
+			return "", err
+		}
+		return name + ".dds", dds.Write(w)
+	case EXPORT_TGA:
+		img, err := txr.exportImage(wrsrc, igfx, ipal)
+		if err != nil {
+			return "", err
+		}
+		return name + ".tga", writeTGA(w, img)
+	case EXPORT_INDEXED:
+		return name + ".zip", txr.exportIndexed(wrsrc, w, igfx, ipal)
+	case EXPORT_ACT, EXPORT_GPL:
+		palette, err := txr.exportPalette(wrsrc, ipal)
+		if err != nil {
+			return "", err
+		}
+		palName := fmt.Sprintf("%s_pal%d", name, ipal)
+		if format == EXPORT_ACT {
+			return palName + ".act", writeACT(w, palette)
+		}
+		return palName + ".gpl", writeGPL(w, palName, palette)
+	}
+	return "", fmt.Errorf("Unknown export format '%s'", format)
+}
@@ -0,0 +1,71 @@
+package txr
+
+import (
+	"fmt"
+	"image"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/psvita/gxt"
+)
+
+// Thumbnail downsamples image until both sides fit size. Small images are returned as is
+func Thumbnail(img image.Image, size int) *image.NRGBA {
+	thumb := MipLevels(img, 1)[0]
+	for thumb.Bounds().Dx() > size || thumb.Bounds().Dy() > size {
+		thumb = Downsample(thumb)
+	}
+	return thumb
+}
+
+func ps3FormatName(format uint8) string {
+	switch format {
+	case CELL_GCM_TEXTURE_A8R8G8B8:
+		return "A8R8G8B8"
+	case CELL_GCM_TEXTURE_COMPRESSED_DXT1:
+		return "DXT1"
+	case CELL_GCM_TEXTURE_D8R8G8B8:
+		return "D8R8G8B8"
+	}
+	return fmt.Sprintf("0x%.2x", format)
+}
+
+func gxtFormatName(format uint32) string {
+	switch format {
+	case gxt.FORMAT_DXT1:
+		return "DXT1"
+	case gxt.FORMAT_DXT5:
+		return "DXT5"
+	}
+	return fmt.Sprintf("0x%.8x", format)
+}
+
+// FormatName returns pixel format of texture: psm of gfx and palette for ps2,
+// or format of remaster texture
+func (txr *Texture) FormatName(wrsrc *wad.WadNodeRsrc) (string, error) {
+	if isNextGenTexture() {
+		_, ngtf, err := txr.findPSNextGenTexture(wrsrc)
+		if err != nil {
+			return "", err
+		}
+		switch t := ngtf.(type) {
+		case *Ps3Texture:
+			return ps3FormatName(t.TextureColorFormat), nil
+		case *PsVitaTexture:
+			return gxtFormatName(t.g.TextureInfos[0].Format), nil
+		}
+		return "", fmt.Errorf("Unknown next gen texture %s", txr.SubTxrName)
+	}
+
+	gfx, pal, err := txr.gfxAndPal(wrsrc)
+	if err != nil {
+		return "", err
+	}
+	name := strings.TrimPrefix(gfx.Psm, "GS_PSM_")
+	if pal != nil {
+		name += fmt.Sprintf(" x%d, palette %s x%d", len(gfx.Data), strings.TrimPrefix(pal.Psm, "GS_PSM_"), len(pal.Data))
+	} else if len(gfx.Data) > 1 {
+		name += fmt.Sprintf(" x%d", len(gfx.Data))
+	}
+	return name, nil
+}
@@ -0,0 +1,22 @@
+package txr
+
+import (
+	"image"
+	"testing"
+)
+
+func TestThumbnail(t *testing.T) {
+	for _, tc := range []struct {
+		w, h, size   int
+		wantW, wantH int
+	}{
+		{256, 64, 96, 64, 16},
+		{64, 32, 96, 64, 32},
+		{300, 10, 96, 75, 2},
+	} {
+		thumb := Thumbnail(image.NewNRGBA(image.Rect(0, 0, tc.w, tc.h)), tc.size)
+		if b := thumb.Bounds(); b.Dx() != tc.wantW || b.Dy() != tc.wantH {
+			t.Errorf("Thumbnail of %dx%d: %dx%d, want %dx%d", tc.w, tc.h, b.Dx(), b.Dy(), tc.wantW, tc.wantH)
+		}
+	}
+}
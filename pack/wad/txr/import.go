@@ -0,0 +1,148 @@
+package txr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+
+	file_gfx "github.com/mogaika/god_of_war_browser/pack/wad/gfx"
+)
+
+// ImportOptions controls conversion of image to PS2 texture
+type ImportOptions struct {
+	Bpp       int    // 4 or 8 bits per pixel, 0 - keep bpp of replaced texture
+	Quantizer string // QUANTIZER_MEDIAN_CUT or QUANTIZER_KMEANS
+	Dither    bool   // Floyd-Steinberg dithering
+	Mipmaps   int    // count of lod levels after first (sub textures), -1 - keep count of existing levels
+}
+
+func DefaultImportOptions() ImportOptions {
+	return ImportOptions{Quantizer: QUANTIZER_MEDIAN_CUT, Mipmaps: -1}
+}
+
+// ParseImportOptions reads options from query of upload action:
+// bpp=4|8, quantizer=mediancut|kmeans, dither=true, mipmaps=N
+func ParseImportOptions(q url.Values) (ImportOptions, error) {
+	opts := DefaultImportOptions()
+	if v := q.Get("bpp"); v != "" && v != "0" {
+		bpp, err := strconv.Atoi(v)
+		if err != nil || (bpp != 4 && bpp != 8) {
+			return opts, fmt.Errorf("Invalid bpp '%s', must be 4 or 8", v)
+		}
+		opts.Bpp = bpp
+	}
+	switch v := strings.ToLower(q.Get("quantizer")); v {
+	case "":
+	case QUANTIZER_MEDIAN_CUT, QUANTIZER_KMEANS:
+		opts.Quantizer = v
+	default:
+		return opts, fmt.Errorf("Unknown quantizer '%s'", v)
+	}
+	opts.Dither = strings.ToLower(q.Get("dither")) == "true"
+	if v := q.Get("mipmaps"); v != "" {
+		mipmaps, err := strconv.Atoi(v)
+		if err != nil || mipmaps < -1 || mipmaps > 7 {
+			return opts, fmt.Errorf("Invalid mipmaps count '%s'", v)
+		}
+		opts.Mipmaps = mipmaps
+	}
+	return opts, nil
+}
+
+// ps2Texture is image converted to indexes of lod levels and shared palette
+type ps2Texture struct {
+	bpp     int
+	palette []uint32 // PS2 colors, alpha 0-0x80
+	levels  []image.Image
+	indexes [][]byte
+}
+
+// encodePS2Texture quantizes image and generates lods levels of image
+func encodePS2Texture(img image.Image, opts ImportOptions, lods int) *ps2Texture {
+	t := &ps2Texture{bpp: opts.Bpp}
+	if t.bpp == 0 {
+		t.bpp = 8
+	}
+
+	t.levels = []image.Image{img}
+	for i := 0; i < lods; i++ {
+		t.levels = append(t.levels, Downsample(t.levels[len(t.levels)-1]))
+	}
+
+	colors := 1 << uint(t.bpp)
+	palette := Quantize(img, colors, opts.Quantizer)
+	for len(palette) < colors {
+		palette = append(palette, color.NRGBA{})
+	}
+	t.palette = make([]uint32, colors)
+	for i, c := range palette {
+		t.palette[i] = file_gfx.NRGBAToPS2Color(c)
+	}
+
+	for _, level := range t.levels {
+		t.indexes = append(t.indexes, MapToPalette(level, palette, opts.Dither))
+	}
+	return t
+}
+
+// setGfx writes lod level to gfx with single data, encoding of gfx is kept
+func (t *ps2Texture) setGfx(gfx *file_gfx.GFX, level int) error {
+	b := t.levels[level].Bounds()
+	gfx.Magic = file_gfx.GFX_MAGIC
+	gfx.Width = uint32(b.Dx())
+	gfx.Height = uint32(b.Dy())
+	gfx.RealHeight = gfx.Height
+	gfx.Bpi = uint32(t.bpp)
+	if len(gfx.Data) != 1 {
+		gfx.Data = make([][]byte, 1)
+	}
+	return gfx.SetPaletteIndexes(0, t.indexes[level])
+}
+
+// setPal writes palette to first data of pal: 16x16 (CSM1) for 8 bit textures,
+// 8x2 for 4 bit textures. Second palette of grayscale textures regenerated
+func (t *ps2Texture) setPal(pal *file_gfx.GFX) error {
+	pal.Magic = file_gfx.GFX_MAGIC
+	if t.bpp == 8 {
+		pal.Width, pal.RealHeight = 16, 16
+	} else {
+		pal.Width, pal.RealHeight = 8, 2
+	}
+	if len(pal.Data) == 0 {
+		pal.Data = make([][]byte, 1)
+	}
+	pal.Height = pal.RealHeight * uint32(len(pal.Data))
+	pal.Encoding = 0
+	pal.Bpi = 32
+
+	if err := pal.SetRawPalette(0, t.palette); err != nil {
+		return err
+	}
+	if len(pal.Data) == 2 {
+		gray := make([]uint32, len(t.palette))
+		for i, clr := range t.palette {
+			c := file_gfx.PS2ColorToNRGBA(clr, false)
+			y := uint32(0.299*float32(c.R) + 0.587*float32(c.G) + 0.114*float32(c.B))
+			gray[i] = y | y<<8 | y<<16 | file_gfx.GS_ALPHA_ONE<<24
+		}
+		if err := pal.SetRawPalette(1, gray); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lodDeltaForSize returns shift of LODParamK when size of texture changed, so the same
+// mip level is used at same distance. LODParamK treated as K of TEX1 register (1/16 units)
+func lodDeltaForSize(oldWidth, oldHeight, newWidth, newHeight uint32) int32 {
+	if oldWidth == 0 || oldHeight == 0 {
+		return 0
+	}
+	oldSize := math.Max(float64(oldWidth), float64(oldHeight))
+	newSize := math.Max(float64(newWidth), float64(newHeight))
+	return int32(math.Round(16 * math.Log2(newSize/oldSize)))
+}
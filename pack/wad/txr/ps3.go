@@ -2,6 +2,7 @@ package txr
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
@@ -19,6 +20,9 @@ const (
 	CELL_GCM_TEXTURE_A8R8G8B8        = 0x85
 	CELL_GCM_TEXTURE_COMPRESSED_DXT1 = 0x86
 	CELL_GCM_TEXTURE_D8R8G8B8        = 0x9e
+
+	// data of texture padded to size of header
+	PS3_DATA_ALIGN = 0x80
 )
 
 type Ps3Texture struct {
@@ -38,7 +42,8 @@ type Ps3Texture struct {
 	Zero24             uint8 // 0x24
 	Unk25              uint8 // 0x25
 
-	images []image.Image
+	images  []image.Image
+	payload []byte
 }
 
 func (t *Ps3Texture) Images() []image.Image {
@@ -257,6 +262,7 @@ func NewPs3TextureFromData(bs *utils.BufStack) (*Ps3Texture, error) {
 	payloadDataBs := dataBs.SubBuf("payload", 0).SetSize(int(t.DataPayloadSize))
 	dataBs.SubBuf("padding", int(t.DataPayloadSize)).SetSize(int(t.DataTotalSize - t.DataPayloadSize))
 
+	t.payload = payloadDataBs.Raw()
 	if err := t.loadImages(payloadDataBs); err != nil {
 		return nil, fmt.Errorf("Error loading images: %v", err)
 	}
@@ -280,11 +286,85 @@ func (txr *Texture) findPSNextGenTexture(wrsrc *wad.WadNodeRsrc) (*wad.Node, wad
 	return node, texture, nil
 }
 
+// imageToBytes is inverse of imageFromBs for uncompressed formats
+func (t *Ps3Texture) imageToBytes(img *image.NRGBA, swizzle bool) []byte {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	swizzlePos := func(x, y int) int {
+		if swizzle {
+			return ps3SwizzleIndex(uint32(x), uint32(y), uint32(width), uint32(height))
+		}
+		return y*width + x
+	}
+
+	data := make([]byte, width*height*4)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pos := swizzlePos(x, y) * 4
+			c := img.NRGBAAt(x, y)
+			data[pos], data[pos+1], data[pos+2], data[pos+3] = c.A, c.R, c.G, c.B
+		}
+	}
+	return data
+}
+
+// replace encodes image with full chain of mipmaps in format of texture.
+// Returns new data of tag
+func (t *Ps3Texture) replace(tagData []byte, img image.Image) ([]byte, error) {
+	if t.TextureColorFormat == CELL_GCM_TEXTURE_COMPRESSED_DXT1 {
+		// imageFromBs do not decode dxt1 layout correctly, so we cannot write it
+		return nil, fmt.Errorf("Replacing of DXT1 ps3 texture is not supported: layout of data is unknown")
+	}
+
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width&(width-1) != 0 || height&(height-1) != 0 || width > 0xffff || height > 0xffff {
+		return nil, fmt.Errorf("Size of image %dx%d must be power of two", width, height)
+	}
+
+	levels := MipLevels(img, bits.Len(uint(width|height)))
+	payload := make([]byte, 0)
+	for _, level := range levels {
+		payload = append(payload, t.imageToBytes(level, true)...)
+	}
+	totalSize := (len(payload) + PS3_DATA_ALIGN - 1) / PS3_DATA_ALIGN * PS3_DATA_ALIGN
+
+	dataStart := 4 + int(t.DataOffset)
+	dataEnd := dataStart + int(t.DataTotalSize)
+	if len(tagData) < dataEnd {
+		return nil, fmt.Errorf("Tag data is too small: %d < %d", len(tagData), dataEnd)
+	}
+
+	result := make([]byte, 0, dataStart+totalSize+len(tagData)-dataEnd)
+	result = append(result, tagData[:dataStart]...)
+	result = append(result, payload...)
+	result = append(result, make([]byte, totalSize-len(payload))...)
+	result = append(result, tagData[dataEnd:]...)
+
+	header := result[4:]
+	binary.BigEndian.PutUint32(header[0x04:], uint32(totalSize))
+	binary.BigEndian.PutUint32(header[0x14:], uint32(len(payload)))
+	header[0x19] = uint8(len(levels))
+	binary.BigEndian.PutUint16(header[0x20:], uint16(width))
+	binary.BigEndian.PutUint16(header[0x22:], uint16(height))
+
+	return result, nil
+}
+
 func (txr *Texture) changeTexturePS3(wrsrc *wad.WadNodeRsrc, img image.Image) error {
-	_, _, err := txr.findPSNextGenTexture(wrsrc)
+	node, texture, err := txr.findPSNextGenTexture(wrsrc)
+	if err != nil {
+		return err
+	}
+	t, ok := texture.(*Ps3Texture)
+	if !ok {
+		return fmt.Errorf("Next gen texture %s is not ps3 texture", txr.SubTxrName)
+	}
+
+	data, err := t.replace(node.Tag.Data, img)
 	if err != nil {
 		return err
 	}
 
-	return fmt.Errorf("Not implemented")
+	return wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{node.Tag.Id: data})
 }
@@ -0,0 +1,66 @@
+package txr
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+func testPs3TagData(format uint8, width, height uint16, payload []byte, mipmaps uint8) []byte {
+	data := make([]byte, 4+0x80+len(payload))
+	h := data[4:]
+	binary.BigEndian.PutUint32(h[0x00:], 0x2000000)
+	binary.BigEndian.PutUint32(h[0x04:], uint32(len(payload)))
+	binary.BigEndian.PutUint32(h[0x08:], 1)
+	binary.BigEndian.PutUint32(h[0x10:], 0x80)
+	binary.BigEndian.PutUint32(h[0x14:], uint32(len(payload)))
+	h[0x18], h[0x19], h[0x1a] = format, mipmaps, 2
+	binary.BigEndian.PutUint32(h[0x1c:], 0xAAE4)
+	binary.BigEndian.PutUint16(h[0x20:], width)
+	binary.BigEndian.PutUint16(h[0x22:], height)
+	h[0x25] = 1
+	copy(h[0x80:], payload)
+	return data
+}
+
+func TestPs3Replace(t *testing.T) {
+	// 2x2 texture with mipmap 1x1
+	tex, err := NewPs3TextureFromData(utils.NewBufStack("ps3texture",
+		testPs3TagData(CELL_GCM_TEXTURE_A8R8G8B8, 2, 2, make([]byte, 5*4), 2)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 30), G: uint8(y * 60), B: 7, A: 0xff})
+		}
+	}
+
+	data, err := tex.replace(testPs3TagData(CELL_GCM_TEXTURE_A8R8G8B8, 2, 2, make([]byte, 5*4), 2), img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewPs3TextureFromData(utils.NewBufStack("ps3texture", data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Width != 8 || result.Height != 4 || result.MipMapCounts != 4 || len(result.images) != 4 {
+		t.Fatalf("Wrong header %+v", result)
+	}
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 8; x++ {
+			if c := result.images[0].(*image.NRGBA).NRGBAAt(x, y); c != img.NRGBAAt(x, y) {
+				t.Errorf("Pixel %d,%d: %v != %v", x, y, c, img.NRGBAAt(x, y))
+			}
+		}
+	}
+
+	if _, err := tex.replace(data, image.NewNRGBA(image.Rect(0, 0, 6, 4))); err == nil {
+		t.Errorf("Expected error for size which is not power of two")
+	}
+}
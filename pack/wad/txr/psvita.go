@@ -5,6 +5,7 @@ import (
 	"image"
 	"image/png"
 	"io"
+	"math/bits"
 
 	"github.com/pkg/errors"
 
@@ -13,11 +14,17 @@ import (
 	"github.com/mogaika/god_of_war_browser/utils"
 )
 
-const PSVITA_MAGIC = "TXTR"
+const (
+	PSVITA_MAGIC = "TXTR"
+
+	// serverId, magic and params before gxt data
+	PSVITA_GXT_OFFSET = 14
+)
 
 type PsVitaTexture struct {
-	g      *gxt.GXT
-	images []image.Image
+	g       *gxt.GXT
+	gxtData []byte
+	images  []image.Image
 }
 
 type PsVitaTextureAjax struct {
@@ -63,7 +70,7 @@ func NewPsVitaTextureFromData(bs *utils.BufStack) (*PsVitaTexture, error) {
 
 	t := &PsVitaTexture{}
 
-	headerBs := bs.SubBuf("params", 4).SetSize(10)
+	headerBs := bs.SubBuf("params", 4).SetSize(PSVITA_GXT_OFFSET - 4)
 	magic := headerBs.ReadStringBuffer(4)
 	if magic != PSVITA_MAGIC {
 		return nil, errors.Errorf("Incorrect magic 0x%x", magic)
@@ -80,9 +87,76 @@ func NewPsVitaTextureFromData(bs *utils.BufStack) (*PsVitaTexture, error) {
 		t.g = g
 	}
 
+	t.gxtData = gxtBs.Raw()
 	if err := t.readImages(bytes.NewReader(gxtBs.Raw())); err != nil {
 		return nil, errors.Wrapf(err, "Failed to read images")
 	}
 
 	return t, nil
 }
+
+// replace encodes image with mipmaps in place of first texture of gxt,
+// other textures of gxt kept as is. Returns new data of tag
+func (t *PsVitaTexture) replace(tagData []byte, img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	if b.Dx()&(b.Dx()-1) != 0 || b.Dy()&(b.Dy()-1) != 0 {
+		return nil, errors.Errorf("Size of image %dx%d must be power of two", b.Dx(), b.Dy())
+	}
+	if len(t.g.TextureInfos) == 0 {
+		return nil, errors.Errorf("Gxt has no textures")
+	}
+
+	r := bytes.NewReader(tagData[PSVITA_GXT_OFFSET:])
+	g := *t.g
+	g.TextureInfos = append([]gxt.TextureInfo{}, t.g.TextureInfos...)
+
+	textures := make([][]byte, len(g.TextureInfos))
+	for i := range g.TextureInfos {
+		if data, err := g.TextureInfos[i].Data(r); err != nil {
+			return nil, errors.Wrapf(err, "Failed to read texture %d", i)
+		} else {
+			textures[i] = data
+		}
+	}
+
+	ti := &g.TextureInfos[0]
+	// keep count of mipmaps, but not smaller than 1x1
+	levels := int(ti.MipMapsCount)
+	if maxLevels := bits.Len(uint(b.Dx() | b.Dy())); levels > maxLevels {
+		levels = maxLevels
+	}
+	if levels < 1 {
+		levels = 1
+	}
+
+	data, err := ti.FromImages(MipLevels(img, levels))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to encode image")
+	}
+	textures[0] = data
+
+	gxtData, err := g.Marshal(textures)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to write gxt")
+	}
+
+	return append(append([]byte{}, tagData[:PSVITA_GXT_OFFSET]...), gxtData...), nil
+}
+
+func (txr *Texture) changeTexturePSVita(wrsrc *wad.WadNodeRsrc, img image.Image) error {
+	node, texture, err := txr.findPSNextGenTexture(wrsrc)
+	if err != nil {
+		return err
+	}
+	t, ok := texture.(*PsVitaTexture)
+	if !ok {
+		return errors.Errorf("Next gen texture %s is not vita texture", txr.SubTxrName)
+	}
+
+	data, err := t.replace(node.Tag.Data, img)
+	if err != nil {
+		return err
+	}
+
+	return wrsrc.Wad.UpdateTagsData(map[wad.TagId][]byte{node.Tag.Id: data})
+}
@@ -0,0 +1,321 @@
+package txr
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+const (
+	QUANTIZER_MEDIAN_CUT = "mediancut"
+	QUANTIZER_KMEANS     = "kmeans"
+
+	kmeansIterations = 10
+)
+
+// histogram entry of unique color
+type quantColor struct {
+	c     [4]float64 // r, g, b, a in 0-255 range
+	count int
+}
+
+// ps2AlphaPrecision rounds alpha to precision of PS2 (0-128) and back to 0-255 range
+func ps2AlphaPrecision(a uint8) uint8 {
+	ps2 := math.Round(float64(a) * 128.0 / 255.0)
+	return uint8(math.Min(255, math.Round(ps2*255.0/128.0)))
+}
+
+func toNRGBA(c color.Color) color.NRGBA {
+	clr := color.NRGBAModel.Convert(c).(color.NRGBA)
+	clr.A = ps2AlphaPrecision(clr.A)
+	if clr.A == 0 {
+		// fully transparent pixels are same color
+		clr.R, clr.G, clr.B = 0, 0, 0
+	}
+	return clr
+}
+
+func imageHistogram(img image.Image) []quantColor {
+	counts := make(map[color.NRGBA]int)
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			counts[toNRGBA(img.At(x, y))]++
+		}
+	}
+	result := make([]quantColor, 0, len(counts))
+	for c, count := range counts {
+		result = append(result, quantColor{
+			c:     [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)},
+			count: count,
+		})
+	}
+	// map iteration order is random, keep result stable
+	sort.Slice(result, func(i, j int) bool {
+		for k := 0; k < 4; k++ {
+			if result[i].c[k] != result[j].c[k] {
+				return result[i].c[k] < result[j].c[k]
+			}
+		}
+		return false
+	})
+	return result
+}
+
+func colorDistance(a, b [4]float64) float64 {
+	var d float64
+	for k := 0; k < 4; k++ {
+		d += (a[k] - b[k]) * (a[k] - b[k])
+	}
+	return d
+}
+
+func meanColor(colors []quantColor) [4]float64 {
+	var sum [4]float64
+	total := 0
+	for _, qc := range colors {
+		for k := 0; k < 4; k++ {
+			sum[k] += qc.c[k] * float64(qc.count)
+		}
+		total += qc.count
+	}
+	for k := range sum {
+		sum[k] /= float64(total)
+	}
+	return sum
+}
+
+// quantizeMedianCut splits color space box with widest channel range at weighted median
+// until count of boxes reached
+func quantizeMedianCut(hist []quantColor, count int) [][4]float64 {
+	boxes := [][]quantColor{hist}
+	for len(boxes) < count {
+		best, bestChannel := -1, 0
+		bestRange := 0.0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			for k := 0; k < 4; k++ {
+				min, max := box[0].c[k], box[0].c[k]
+				for _, qc := range box {
+					min = math.Min(min, qc.c[k])
+					max = math.Max(max, qc.c[k])
+				}
+				if max-min > bestRange {
+					best, bestChannel, bestRange = i, k, max-min
+				}
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.SliceStable(box, func(i, j int) bool { return box[i].c[bestChannel] < box[j].c[bestChannel] })
+		total := 0
+		for _, qc := range box {
+			total += qc.count
+		}
+		split, acc := 1, 0
+		for i, qc := range box[:len(box)-1] {
+			acc += qc.count
+			split = i + 1
+			if acc*2 >= total {
+				break
+			}
+		}
+		boxes[best] = box[:split]
+		boxes = append(boxes, box[split:])
+	}
+
+	result := make([][4]float64, len(boxes))
+	for i, box := range boxes {
+		result[i] = meanColor(box)
+	}
+	return result
+}
+
+func nearestColor(palette [][4]float64, c [4]float64) int {
+	best, bestDist := 0, math.Inf(1)
+	for i, p := range palette {
+		if d := colorDistance(p, c); d < bestDist {
+			best, bestDist = i, d
+		}
+	}
+	return best
+}
+
+// quantizeKMeans refines median cut palette with k-means iterations
+func quantizeKMeans(hist []quantColor, count int) [][4]float64 {
+	palette := quantizeMedianCut(hist, count)
+	clusters := make([][]quantColor, len(palette))
+	for iter := 0; iter < kmeansIterations; iter++ {
+		for i := range clusters {
+			clusters[i] = clusters[i][:0]
+		}
+		for _, qc := range hist {
+			i := nearestColor(palette, qc.c)
+			clusters[i] = append(clusters[i], qc)
+		}
+		changed := false
+		for i, cluster := range clusters {
+			if len(cluster) == 0 {
+				continue
+			}
+			if mean := meanColor(cluster); mean != palette[i] {
+				palette[i] = mean
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return palette
+}
+
+// Quantize builds palette of up to count colors for image. Alpha of result
+// has PS2 precision, fully transparent colors are black
+func Quantize(img image.Image, count int, quantizer string) []color.NRGBA {
+	hist := imageHistogram(img)
+	var palette [][4]float64
+	switch {
+	case len(hist) <= count:
+		palette = make([][4]float64, len(hist))
+		for i, qc := range hist {
+			palette[i] = qc.c
+		}
+	case quantizer == QUANTIZER_KMEANS:
+		palette = quantizeKMeans(hist, count)
+	default:
+		palette = quantizeMedianCut(hist, count)
+	}
+
+	result := make([]color.NRGBA, len(palette))
+	for i, p := range palette {
+		result[i] = toNRGBA(color.NRGBA{
+			R: uint8(math.Round(p[0])),
+			G: uint8(math.Round(p[1])),
+			B: uint8(math.Round(p[2])),
+			A: uint8(math.Round(p[3])),
+		})
+	}
+	return result
+}
+
+// MapToPalette returns index of palette color for every pixel of image.
+// With dither rgb error is distributed by Floyd-Steinberg algorithm, alpha is not dithered
+// to keep edges of cutout textures clean
+func MapToPalette(img image.Image, palette []color.NRGBA, dither bool) []byte {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	pal := make([][4]float64, len(palette))
+	for i, c := range palette {
+		pal[i] = [4]float64{float64(c.R), float64(c.G), float64(c.B), float64(c.A)}
+	}
+
+	indexes := make([]byte, width*height)
+	cache := make(map[[4]float64]byte)
+	errCur := make([][3]float64, width+2)
+	errNext := make([][3]float64, width+2)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			clr := toNRGBA(img.At(b.Min.X+x, b.Min.Y+y))
+			want := [4]float64{float64(clr.R), float64(clr.G), float64(clr.B), float64(clr.A)}
+			if dither && clr.A != 0 {
+				for k := 0; k < 3; k++ {
+					want[k] = math.Max(0, math.Min(255, want[k]+errCur[x+1][k]))
+				}
+			}
+
+			index, ok := cache[want]
+			if !ok {
+				index = byte(nearestColor(pal, want))
+				if !dither {
+					cache[want] = index
+				}
+			}
+			indexes[y*width+x] = index
+
+			if dither && clr.A != 0 {
+				for k := 0; k < 3; k++ {
+					e := want[k] - pal[index][k]
+					errCur[x+2][k] += e * 7 / 16
+					errNext[x][k] += e * 3 / 16
+					errNext[x+1][k] += e * 5 / 16
+					errNext[x+2][k] += e * 1 / 16
+				}
+			}
+		}
+		errCur, errNext = errNext, errCur
+		for i := range errNext {
+			errNext[i] = [3]float64{}
+		}
+	}
+	return indexes
+}
+
+// Downsample halves image size with box filter, color weighted by alpha
+func Downsample(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	width, height := b.Dx()/2, b.Dy()/2
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	result := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			samples := 0
+			for dy := 0; dy < 2; dy++ {
+				for dx := 0; dx < 2; dx++ {
+					sx, sy := x*2+dx, y*2+dy
+					if sx >= b.Dx() || sy >= b.Dy() {
+						continue
+					}
+					c := color.NRGBAModel.Convert(img.At(b.Min.X+sx, b.Min.Y+sy)).(color.NRGBA)
+					a := float64(c.A)
+					sum[0] += float64(c.R) * a
+					sum[1] += float64(c.G) * a
+					sum[2] += float64(c.B) * a
+					sum[3] += a
+					samples++
+				}
+			}
+			var c color.NRGBA
+			if sum[3] != 0 {
+				c.R = uint8(math.Round(sum[0] / sum[3]))
+				c.G = uint8(math.Round(sum[1] / sum[3]))
+				c.B = uint8(math.Round(sum[2] / sum[3]))
+				c.A = uint8(math.Round(sum[3] / float64(samples)))
+			}
+			result.SetNRGBA(x, y, c)
+		}
+	}
+	return result
+}
+
+// MipLevels returns image and count-1 downsampled levels of it
+func MipLevels(img image.Image, count int) []*image.NRGBA {
+	b := img.Bounds()
+	first := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			first.SetNRGBA(x, y, color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA))
+		}
+	}
+
+	levels := []*image.NRGBA{first}
+	for len(levels) < count {
+		levels = append(levels, Downsample(levels[len(levels)-1]))
+	}
+	return levels
+}
@@ -0,0 +1,116 @@
+package txr
+
+import (
+	"image"
+	"image/color"
+	"net/url"
+	"testing"
+)
+
+func gradient(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x * 255 / width), uint8(y * 255 / height), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestQuantizeExact(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	colors := []color.NRGBA{{255, 0, 0, 255}, {0, 255, 0, 255}, {0, 0, 255, 0}, {255, 0, 0, 255}}
+	for i, c := range colors {
+		img.SetNRGBA(i, 0, c)
+	}
+	palette := Quantize(img, 16, QUANTIZER_MEDIAN_CUT)
+	if len(palette) != 3 {
+		t.Fatalf("Wrong palette size %d", len(palette))
+	}
+	indexes := MapToPalette(img, palette, false)
+	for i, c := range colors {
+		if c.A == 0 {
+			c = color.NRGBA{}
+		}
+		if palette[indexes[i]] != c {
+			t.Errorf("Pixel %d mapped to %v instead of %v", i, palette[indexes[i]], c)
+		}
+	}
+}
+
+// blockError returns squared error of mean red of 8x8 blocks
+func blockError(img *image.NRGBA, palette []color.NRGBA, indexes []byte) float64 {
+	var errSum float64
+	for by := 0; by < 64; by += 8 {
+		for bx := 0; bx < 64; bx += 8 {
+			var want, got float64
+			for y := by; y < by+8; y++ {
+				for x := bx; x < bx+8; x++ {
+					want += float64(img.NRGBAAt(x, y).R)
+					got += float64(palette[indexes[y*64+x]].R)
+				}
+			}
+			errSum += (want - got) * (want - got) / 64 / 64
+		}
+	}
+	return errSum
+}
+
+func TestQuantizeReduce(t *testing.T) {
+	img := gradient(64, 64)
+	for _, quantizer := range []string{QUANTIZER_MEDIAN_CUT, QUANTIZER_KMEANS} {
+		palette := Quantize(img, 16, quantizer)
+		if len(palette) != 16 {
+			t.Fatalf("%s: wrong palette size %d", quantizer, len(palette))
+		}
+
+		indexes := MapToPalette(img, palette, false)
+		var errSum float64
+		for i, index := range indexes {
+			d := float64(img.NRGBAAt(i%64, i/64).R) - float64(palette[index].R)
+			errSum += d * d
+		}
+		if mse := errSum / float64(len(indexes)); mse > 400 {
+			t.Errorf("%s: error is too big %f", quantizer, mse)
+		}
+
+		dithered := MapToPalette(img, palette, true)
+		if plain, dith := blockError(img, palette, indexes), blockError(img, palette, dithered); dith > plain {
+			t.Errorf("%s: dithering increased error of average color %f > %f", quantizer, dith, plain)
+		}
+	}
+}
+
+func TestDownsample(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{200, 0, 0, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{0, 200, 0, 0})
+	small := Downsample(img)
+	if b := small.Bounds(); b.Dx() != 1 || b.Dy() != 1 {
+		t.Fatalf("Wrong size %v", b)
+	}
+	// transparent pixel do not affect color
+	if c := small.NRGBAAt(0, 0); c != (color.NRGBA{200, 0, 0, 128}) {
+		t.Errorf("Wrong color %v", c)
+	}
+}
+
+func TestEncodePS2Texture(t *testing.T) {
+	opts, err := ParseImportOptions(url.Values{"bpp": {"4"}, "dither": {"true"}, "mipmaps": {"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tex := encodePS2Texture(gradient(32, 16), opts, opts.Mipmaps)
+	if len(tex.palette) != 16 || len(tex.levels) != 3 {
+		t.Fatalf("Wrong palette %d or levels %d", len(tex.palette), len(tex.levels))
+	}
+	if b := tex.levels[2].Bounds(); b.Dx() != 8 || b.Dy() != 4 {
+		t.Errorf("Wrong size of last lod %v", b)
+	}
+	if d := lodDeltaForSize(64, 64, 128, 32); d != 16 {
+		t.Errorf("Wrong lod delta %d", d)
+	}
+	if _, err := ParseImportOptions(url.Values{"bpp": {"16"}}); err == nil {
+		t.Errorf("Invalid bpp accepted")
+	}
+}
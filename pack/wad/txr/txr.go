@@ -2,20 +2,18 @@ package txr
 
 import (
 	"bytes"
-	"encoding/binary"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/png"
-	"math"
 
 	"github.com/pkg/errors"
 
 	"github.com/mogaika/god_of_war_browser/config"
 	"github.com/mogaika/god_of_war_browser/pack/wad"
 	file_gfx "github.com/mogaika/god_of_war_browser/pack/wad/gfx"
-	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
 )
 
 type Texture struct {
@@ -36,15 +34,25 @@ const FILE_SIZE = 0x58
 const TXR_MAGIC = 0x00000007
 const PS3_VITA_TEXTURE_MAGIC = 0x00070007
 
+var Layout = structlayout.Register(structlayout.New("gow_txr", "God of War PS2 texture (TXR_)", FILE_SIZE,
+	structlayout.Field{Name: "magic", Offset: 0x00, Kind: structlayout.U32, Doc: "always 7"},
+	structlayout.Field{Name: "gfx_name", Offset: 0x04, Kind: structlayout.String, Size: 24},
+	structlayout.Field{Name: "pal_name", Offset: 0x1c, Kind: structlayout.String, Size: 24},
+	structlayout.Field{Name: "sub_txr_name", Offset: 0x34, Kind: structlayout.String, Size: 24, Doc: "next lod level texture"},
+	structlayout.Field{Name: "lod_param_k", Offset: 0x4c, Kind: structlayout.S32},
+	structlayout.Field{Name: "lod_multiplier", Offset: 0x50, Kind: structlayout.F32},
+	structlayout.Field{Name: "flags", Offset: 0x54, Kind: structlayout.U32},
+))
+
 func NewFromData(buf []byte) (*Texture, error) {
 	tex := &Texture{
-		Magic:         binary.LittleEndian.Uint32(buf[0:4]),
-		GfxName:       utils.BytesToString(buf[4:28]),
-		PalName:       utils.BytesToString(buf[28:52]),
-		SubTxrName:    utils.BytesToString(buf[52:76]),
-		LODParamK:     int32(binary.LittleEndian.Uint32(buf[76:80])),
-		LODMultiplier: math.Float32frombits(binary.LittleEndian.Uint32(buf[80:84])),
-		Flags:         binary.LittleEndian.Uint32(buf[84:88]),
+		Magic:         Layout.Field("magic").U32(buf),
+		GfxName:       Layout.Field("gfx_name").String(buf),
+		PalName:       Layout.Field("pal_name").String(buf),
+		SubTxrName:    Layout.Field("sub_txr_name").String(buf),
+		LODParamK:     Layout.Field("lod_param_k").S32(buf),
+		LODMultiplier: Layout.Field("lod_multiplier").F32(buf),
+		Flags:         Layout.Field("flags").U32(buf),
 	}
 
 	if tex.Magic != TXR_MAGIC {
@@ -73,32 +81,75 @@ func NewFromData(buf []byte) (*Texture, error) {
 
 func (txr *Texture) MarshalToBinary() []byte {
 	var buf [FILE_SIZE]byte
-	binary.LittleEndian.PutUint32(buf[0:4], txr.Magic)
-	copy(buf[4:28], utils.StringToBytesBuffer(txr.GfxName, 24, true))
-	copy(buf[28:52], utils.StringToBytesBuffer(txr.PalName, 24, true))
-	copy(buf[52:76], utils.StringToBytesBuffer(txr.SubTxrName, 24, true))
-	binary.LittleEndian.PutUint32(buf[76:80], uint32(txr.LODParamK))
-	binary.LittleEndian.PutUint32(buf[80:84], math.Float32bits(txr.LODMultiplier))
-	binary.LittleEndian.PutUint32(buf[84:88], txr.Flags)
+	Layout.Field("magic").PutU32(buf[:], txr.Magic)
+	Layout.Field("gfx_name").PutString(buf[:], txr.GfxName, true)
+	Layout.Field("pal_name").PutString(buf[:], txr.PalName, true)
+	Layout.Field("sub_txr_name").PutString(buf[:], txr.SubTxrName, true)
+	Layout.Field("lod_param_k").PutU32(buf[:], uint32(txr.LODParamK))
+	Layout.Field("lod_multiplier").PutF32(buf[:], txr.LODMultiplier)
+	Layout.Field("flags").PutU32(buf[:], txr.Flags)
 	return buf[:]
 }
 
+func (txr *Texture) References() []string {
+	return []string{txr.GfxName, txr.PalName, txr.SubTxrName}
+}
+
+func (txr *Texture) RenameReferences(data []byte, rename map[string]string) []byte {
+	result := append([]byte(nil), data...)
+	for _, field := range []string{"gfx_name", "pal_name", "sub_txr_name"} {
+		if newName, ok := rename[Layout.Field(field).String(result)]; ok {
+			Layout.Field(field).PutString(result, newName, true)
+		}
+	}
+	return result
+}
+
 func (txr *Texture) image(gfx *file_gfx.GFX, pal *file_gfx.GFX, igfx int, ipal int) (*image.NRGBA, error) {
+	if file_gfx.IsTrueColorPsm(gfx.GetPSM()) {
+		return txr.imageMode(gfx, pal, igfx, ipal, nil)
+	}
+	mode := gfx.DefaultMode()
+	return txr.imageMode(gfx, pal, igfx, ipal, &mode)
+}
+
+// imageMode decodes gfx stored in GS mode, true color image is decoded when mode is nil
+func (txr *Texture) imageMode(gfx *file_gfx.GFX, pal *file_gfx.GFX, igfx int, ipal int, mode *file_gfx.GsMode) (*image.NRGBA, error) {
 	width := int(gfx.Width)
 	height := int(gfx.RealHeight)
 
 	img := image.NewNRGBA(image.Rect(0, 0, width, height))
-	palette, err := pal.AsPalette(ipal, true)
 
+	if mode == nil {
+		colors, err := gfx.AsColors(igfx, true)
+		if err != nil {
+			return nil, err
+		}
+		for i, clr := range colors {
+			img.SetNRGBA(i%width, i/width, clr)
+		}
+		return img, nil
+	}
+
+	if pal == nil {
+		return nil, fmt.Errorf("Paletted gfx requires palette")
+	}
+
+	palette, err := pal.AsPaletteCsm(ipal, mode.Csm, true)
 	if err != nil {
 		return nil, err
 	}
 
-	palidx := gfx.AsPaletteIndexes(igfx)
+	palidx, err := gfx.AsPaletteIndexesMode(igfx, *mode)
+	if err != nil {
+		return nil, err
+	}
 
 	for y := 0; y < height; y++ {
 		for x := 0; x < width; x++ {
-			img.Set(x, y, palette[palidx[x+y*width]])
+			if i := palidx[x+y*width]; int(i) < len(palette) {
+				img.Set(x, y, palette[i])
+			}
 		}
 	}
 
@@ -165,19 +216,25 @@ func (txr *Texture) MarshalBlend(clrBlend []float32, wrsrc *wad.WadNodeRsrc) (in
 		}
 	}()
 
-	if txr.GfxName != "" && txr.PalName != "" {
+	if txr.GfxName != "" {
 		gfxn := wrsrc.Wad.GetNodeByName(txr.GfxName, wrsrc.Node.Id, false)
-		paln := wrsrc.Wad.GetNodeByName(txr.PalName, wrsrc.Node.Id, false)
 		if gfxn == nil {
 			return nil, fmt.Errorf("Cannot find gfx: %s", txr.GfxName)
 		}
 
-		if paln == nil {
-			return nil, fmt.Errorf("Cannot find pal: %s", txr.PalName)
+		// true color textures do not use palette
+		var paln *wad.Node
+		if txr.PalName != "" {
+			if paln = wrsrc.Wad.GetNodeByName(txr.PalName, wrsrc.Node.Id, false); paln == nil {
+				return nil, fmt.Errorf("Cannot find pal: %s", txr.PalName)
+			}
 		}
 
 		switch config.GetPlayStationVersion() {
 		case config.PS3, config.PSVita:
+			if paln == nil {
+				break
+			}
 			_, ngtf, err := txr.findPSNextGenTexture(wrsrc)
 			if err != nil {
 				return nil, err
@@ -203,19 +260,23 @@ func (txr *Texture) MarshalBlend(clrBlend []float32, wrsrc *wad.WadNodeRsrc) (in
 				return nil, fmt.Errorf("Error getting gfx %s: %v", txr.GfxName, err)
 			}
 
-			palc, _, err := wrsrc.Wad.GetInstanceFromNode(paln.Id)
-			if err != nil {
-				return nil, fmt.Errorf("Error getting pal %s: %v", txr.PalName, err)
-			}
-
 			gfx := gfxc.(*file_gfx.GFX)
-			pal := palc.(*file_gfx.GFX)
+			var pal *file_gfx.GFX
+			pals := 1
+			if paln != nil {
+				palc, _, err := wrsrc.Wad.GetInstanceFromNode(paln.Id)
+				if err != nil {
+					return nil, fmt.Errorf("Error getting pal %s: %v", txr.PalName, err)
+				}
+				pal = palc.(*file_gfx.GFX)
+				pals = len(pal.Data)
+			}
 
-			res.Images = make([]AjaxImage, len(gfx.Data)*len(pal.Data))
+			res.Images = make([]AjaxImage, len(gfx.Data)*pals)
 
 			i := 0
 			for iGfx := range gfx.Data {
-				for iPal := range pal.Data {
+				for iPal := 0; iPal < pals; iPal++ {
 					img, err := txr.Image(gfx, pal, iGfx, iPal)
 					if err != nil {
 						return nil, err
@@ -243,6 +304,8 @@ func (t *Texture) Marshal(wrsrc *wad.WadNodeRsrc) (interface{}, error) {
 }
 
 func init() {
+	wad.SetDependentResource((*Texture)(nil))
+
 	h := func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
 		return NewFromData(wrsrc.Tag.Data)
 	}
@@ -252,9 +315,9 @@ func init() {
 	hRemaster := func(wrsrc *wad.WadNodeRsrc) (wad.File, error) {
 		switch config.GetPlayStationVersion() {
 		case config.PS3:
-			return NewPs3TextureFromData(utils.NewBufStack("ps3texture", wrsrc.Tag.Data))
+			return NewPs3TextureFromData(wrsrc.NewBufStack("ps3texture"))
 		case config.PSVita:
-			return NewPsVitaTextureFromData(utils.NewBufStack("psvita", wrsrc.Tag.Data))
+			return NewPsVitaTextureFromData(wrsrc.NewBufStack("psvita"))
 		default:
 			return nil, errors.Errorf("playstation version is not supported")
 		}
@@ -0,0 +1,170 @@
+package wad
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+)
+
+var gDependentTypes = make(map[string]bool)
+
+// SetDependentResource marks resource type as used by game only when other
+// nodes refer it (textures, materials, models). Nodes of such types which
+// cannot be reached from other nodes are reported as unused
+func SetDependentResource(f File) {
+	gDependentTypes[reflect.TypeOf(f).String()] = true
+}
+
+type UnusedNode struct {
+	TagId TagId
+	Name  string
+	Type  string
+	Size  uint32 // bytes occupied in wad, including group of node
+}
+
+type UnusedReport struct {
+	Wad       string
+	Nodes     []UnusedNode
+	TotalSize uint32
+	Users     []string       // other wads checked for references to nodes of wad
+	Failed    []ParseFailure // nodes with unknown references, nothing reported unused if not empty
+	Removed   bool           // nodes were removed from wad
+}
+
+func (w *Wad) tagsSpanSize(start, end TagId) uint32 {
+	size := uint32(0)
+	for i := start; i < end; i++ {
+		size += tagWadSize(&w.Tags[i])
+	}
+	return size
+}
+
+// spanHasReachable reports if group of unused node contains used node
+func (w *Wad) spanHasReachable(start, end TagId, reachable map[TagId]bool) bool {
+	for i := start; i < end; i++ {
+		if id := w.Tags[i].NodeId; id != NODE_INVALID && reachable[w.Nodes[id].Tag.Id] {
+			return true
+		}
+	}
+	return false
+}
+
+// FindUnused reports nodes of dependent resource types which are not referenced
+// by any other node of wad or by users, graphs of wads which load this wad (list it
+// in RSRCS). Nothing is reported when some node failed to parse, because
+// its references are unknown
+func (w *Wad) FindUnused(users []*DependencyGraph) *UnusedReport {
+	g := w.Dependencies()
+	report := &UnusedReport{Wad: w.Name(), Nodes: make([]UnusedNode, 0), Users: make([]string, 0), Failed: g.Failed}
+	if len(g.Failed) != 0 {
+		return report
+	}
+
+	reachable := make(map[TagId]bool)
+	queue := make([]TagId, 0)
+	use := func(id TagId) {
+		if !reachable[id] {
+			reachable[id] = true
+			queue = append(queue, id)
+		}
+	}
+	for _, n := range g.Nodes {
+		if !gDependentTypes[n.Type] {
+			use(n.TagId)
+		}
+	}
+
+	names := g.rootNames()
+	for _, u := range users {
+		report.Users = append(report.Users, u.Wad)
+		for _, ref := range u.Unresolved {
+			if id, ok := names[ref.Name]; ok {
+				use(id)
+			}
+		}
+		for _, e := range u.External {
+			if e.Wad == w.Name() {
+				use(e.To)
+			}
+		}
+	}
+
+	for len(queue) != 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, e := range g.Edges {
+			if e.From == id {
+				use(e.To)
+			}
+		}
+	}
+
+	spans := make([]tagsSpan, 0)
+	for _, n := range g.Nodes {
+		if !reachable[n.TagId] {
+			start, end := w.NodeTagsSpan(w.Tags[n.TagId].NodeId)
+			if !w.spanHasReachable(start, end, reachable) {
+				spans = append(spans, tagsSpan{start: start, end: end, owner: n.TagId})
+			}
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	lastEnd := TagId(0)
+	for _, s := range spans {
+		if s.end <= lastEnd {
+			// removed together with group owner
+			continue
+		}
+		lastEnd = s.end
+
+		un := UnusedNode{
+			TagId: s.owner,
+			Name:  w.Tags[s.owner].Name,
+			Type:  g.Nodes[w.Tags[s.owner].NodeId].Type,
+			Size:  w.tagsSpanSize(s.start, s.end),
+		}
+		report.Nodes = append(report.Nodes, un)
+		report.TotalSize += un.Size
+	}
+	return report
+}
+
+// Compact removes unused nodes reported by FindUnused and saves wad. Without
+// confirm wad is not changed, so report shows what would be removed
+func (w *Wad) Compact(users []*DependencyGraph, confirm bool) (*UnusedReport, error) {
+	if err := checkStructureSupported(); err != nil {
+		return nil, err
+	}
+	report := w.FindUnused(users)
+	if len(report.Failed) != 0 {
+		return report, fmt.Errorf("Cannot compact wad, references of %d nodes are unknown (first is %s: %s)",
+			len(report.Failed), report.Failed[0].Name, report.Failed[0].Error)
+	}
+	if len(report.Nodes) == 0 || !confirm {
+		return report, nil
+	}
+
+	remove := make(map[TagId]bool)
+	for _, un := range report.Nodes {
+		start, end := w.NodeTagsSpan(w.Tags[un.TagId].NodeId)
+		for id := start; id < end; id++ {
+			remove[id] = true
+		}
+	}
+
+	tags := make([]Tag, 0, len(w.Tags)-len(remove))
+	for _, t := range w.Tags {
+		if !remove[t.Id] {
+			tags = append(tags, t)
+		}
+	}
+
+	log.Printf("[wad] Compacting %s: removing %d nodes (%d bytes)", w.Name(), len(report.Nodes), report.TotalSize)
+	if err := w.saveStructure(tags); err != nil {
+		return nil, fmt.Errorf("Cannot compact wad: %v", err)
+	}
+	report.Removed = true
+	return report, nil
+}
@@ -0,0 +1,191 @@
+package wad
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/config"
+)
+
+// test resources: data is server id, kind byte and comma separated references
+const testResourceServerId = 0x7e570001
+
+const (
+	testKindRoot      = 'r'
+	testKindDependent = 'd'
+	testKindBroken    = 'x'
+)
+
+type testResource struct {
+	refs []string
+}
+
+func (r *testResource) Marshal(wrsrc *WadNodeRsrc) (interface{}, error) { return r, nil }
+
+func (r *testResource) References() []string { return r.refs }
+
+func (r *testResource) RenameReferences(data []byte, rename map[string]string) []byte {
+	refs := make([]string, len(r.refs))
+	for i, ref := range r.refs {
+		refs[i] = ref
+		if newName, ok := rename[ref]; ok {
+			refs[i] = newName
+		}
+	}
+	return testResourceTag("", data[4], refs...).Data
+}
+
+// testDependent is resource used only by other nodes
+type testDependent struct {
+	testResource
+}
+
+func init() {
+	SetDependentResource((*testDependent)(nil))
+	SetHandler(config.GOW1, testResourceServerId, func(wrsrc *WadNodeRsrc) (File, error) {
+		data := wrsrc.Tag.Data[4:]
+		r := testResource{}
+		if len(data) > 1 {
+			r.refs = strings.Split(string(data[1:]), ",")
+		}
+		switch data[0] {
+		case testKindDependent:
+			return &testDependent{r}, nil
+		case testKindBroken:
+			return nil, fmt.Errorf("broken resource")
+		}
+		return &r, nil
+	})
+}
+
+func testResourceTag(name string, kind byte, refs ...string) Tag {
+	data := make([]byte, 4, 0x20)
+	binary.LittleEndian.PutUint32(data, testResourceServerId)
+	data = append(data, kind)
+	data = append(data, strings.Join(refs, ",")...)
+	return Tag{Tag: TAG_GOW1_SERVER_INSTANCE, Name: name, Data: data}
+}
+
+type testSource struct {
+	name  string
+	saved []byte
+	err   error
+}
+
+func (s *testSource) Name() string { return s.name }
+func (s *testSource) Size() int64  { return int64(len(s.saved)) }
+func (s *testSource) Save(in *io.SectionReader) error {
+	if s.err != nil {
+		return s.err
+	}
+	data, err := ioutil.ReadAll(in)
+	s.saved = data
+	return err
+}
+
+func newTestWad(t *testing.T, name string, tags []Tag) *Wad {
+	config.SetGOWVersion(config.GOW1)
+	w := &Wad{Source: &testSource{name: name}, Tags: tags, HeapSizes: make(map[string]uint32)}
+	for i := range w.Tags {
+		w.Tags[i].Id = TagId(i)
+	}
+	if err := w.parseTags(); err != nil {
+		t.Fatalf("parseTags() failed: %v", err)
+	}
+	return w
+}
+
+func unusedNames(r *UnusedReport) []string {
+	names := make([]string, 0)
+	for _, n := range r.Nodes {
+		names = append(names, n.Name)
+	}
+	return names
+}
+
+func TestFindUnused(t *testing.T) {
+	w := newTestWad(t, "TEST.WAD", []Tag{
+		testResourceTag("TXR_used", testKindDependent),
+		testResourceTag("TXR_script", testKindDependent),
+		testResourceTag("TXR_shared", testKindDependent),
+		testResourceTag("TXR_unused", testKindDependent),
+		testResourceTag("OBJ_root", testKindRoot, "TXR_used"),
+		testResourceTag("SCR_root", testKindRoot, "TXR_script", "not a node"),
+	})
+
+	if names := unusedNames(w.FindUnused(nil)); len(names) != 2 || names[0] != "TXR_shared" || names[1] != "TXR_unused" {
+		t.Errorf("FindUnused() = %v", names)
+	}
+
+	user := &DependencyGraph{Wad: "USER.WAD", Unresolved: []UnresolvedReference{{From: 0, Name: "TXR_shared"}}}
+	report := w.FindUnused([]*DependencyGraph{user})
+	if names := unusedNames(report); len(names) != 1 || names[0] != "TXR_unused" {
+		t.Errorf("FindUnused() with user = %v", names)
+	}
+	if len(report.Users) != 1 || report.Users[0] != "USER.WAD" {
+		t.Errorf("Users = %v", report.Users)
+	}
+}
+
+func TestFindUnusedParseFailure(t *testing.T) {
+	w := newTestWad(t, "TEST.WAD", []Tag{
+		testResourceTag("TXR_a", testKindDependent),
+		testResourceTag("OBJ_broken", testKindBroken, "TXR_a"),
+	})
+
+	report := w.FindUnused(nil)
+	if len(report.Nodes) != 0 || len(report.Failed) != 1 || report.Failed[0].Name != "OBJ_broken" {
+		t.Errorf("FindUnused() = %v, failed %v", unusedNames(report), report.Failed)
+	}
+	if _, err := w.Compact(nil, true); err == nil {
+		t.Errorf("Compact() of wad with broken node returned nil error")
+	}
+	if len(w.Tags) != 2 {
+		t.Errorf("Compact() changed wad")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	w := newTestWad(t, "TEST.WAD", []Tag{
+		testResourceTag("TXR_used", testKindDependent),
+		testResourceTag("TXR_unused", testKindDependent),
+		testResourceTag("OBJ_root", testKindRoot, "TXR_used"),
+	})
+	src := w.Source.(*testSource)
+
+	report, err := w.Compact(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Removed || len(report.Nodes) != 1 || len(w.Tags) != 3 || src.saved != nil {
+		t.Fatalf("Dry run Compact() changed wad")
+	}
+
+	if report, err = w.Compact(nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if !report.Removed || len(w.Tags) != 2 || w.Tags[1].Name != "OBJ_root" || src.saved == nil {
+		t.Errorf("Compact() left %d tags, removed %v", len(w.Tags), report.Removed)
+	}
+}
+
+func TestDependencyOfSameName(t *testing.T) {
+	tags := []Tag{
+		testResourceTag("TXR_a", testKindDependent),
+		testResourceTag("TXR_a", testKindRoot, "TXR_a"),
+	}
+	for i := range tags {
+		// not zero sized, so second node is not link to first one
+		tags[i].Size = uint32(len(tags[i].Data))
+	}
+	w := newTestWad(t, "TEST.WAD", tags)
+
+	g := w.Dependencies()
+	if len(g.Edges) != 1 || g.Edges[0].From != 1 || g.Edges[0].To != 0 || len(g.Unresolved) != 0 {
+		t.Errorf("Reference to node of same name is resolved as edges %v, unresolved %v", g.Edges, g.Unresolved)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/mogaika/god_of_war_browser/config"
 	"github.com/mogaika/god_of_war_browser/pack"
 	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
 )
 
 const WAD_ITEM_SIZE = 0x20
@@ -21,6 +22,35 @@ type File interface {
 	Marshal(rsrc *WadNodeRsrc) (interface{}, error)
 }
 
+// Searchable is implemented by resources which contain texts
+// worth to be found by global search (labels, tweak paths, entity names)
+type Searchable interface {
+	SearchTexts() []string
+}
+
+// TextDumper is implemented by resources which can be represented
+// as text lines, used for semantic comparison of resources
+type TextDumper interface {
+	DumpText() []string
+}
+
+// Referencer is implemented by resources which use other nodes by name.
+// Names are resolved by backward search from resource node (see GetNodeByName)
+type Referencer interface {
+	References() []string
+}
+
+// ReferenceRenamer is implemented by resources which can rewrite names
+// of used nodes. Returns new tag data
+type ReferenceRenamer interface {
+	RenameReferences(data []byte, rename map[string]string) []byte
+}
+
+// WadReferencer is implemented by resources which make other wad files required
+type WadReferencer interface {
+	WadReferences() []string
+}
+
 type FileLoader func(rsrc *WadNodeRsrc) (File, error)
 
 var gHandlers map[uint64]FileLoader = make(map[uint64]FileLoader, 0)
@@ -57,6 +87,11 @@ type Wad struct {
 	entityContext entitycontext.EntityLevelContext
 
 	HeapSizes map[string]uint32
+
+	deferSave         bool
+	pendingSave       []byte // wad data not written to source yet, see DeferSave
+	deferredTags      []Tag  // state of wad when DeferSave called, restored if write fails
+	deferredHeapSizes map[string]uint32
 }
 
 type Tag struct {
@@ -78,13 +113,12 @@ type Node struct {
 	SubGroupNodes  []NodeId
 	Cache          File `json:"-"`
 	CachedServerId uint32
-}
 
-func (w *Wad) CallHandler(id NodeId) (File, uint32, error) {
-	var h FileLoader
-	var serverId uint32
+	recordLayout bool            // set only for parse made by GetNodeLayout
+	layout       *utils.BufStack // root buffer of that parse, if parser uses BufStack
+}
 
-	n := w.GetNodeById(id)
+func findHandler(n *Node) (h FileLoader, serverId uint32) {
 	if han, ex := gTagHandlers[n.Tag.Tag]; ex {
 		h = han
 	} else if n.Tag.Tag == GetServerInstanceTag() {
@@ -95,6 +129,12 @@ func (w *Wad) CallHandler(id NodeId) (File, uint32, error) {
 			}
 		}
 	}
+	return h, serverId
+}
+
+func (w *Wad) CallHandler(id NodeId) (File, uint32, error) {
+	n := w.GetNodeById(id)
+	h, serverId := findHandler(n)
 	if h == nil {
 		return nil, serverId, fmt.Errorf("Cannot find handler for tag %.4x (%s)", n.Tag.Tag, n.Tag.Name)
 	}
@@ -122,22 +162,37 @@ func (w *Wad) GetInstanceFromNode(nodeId NodeId) (File, uint32, error) {
 	}
 }
 
+var TagLayout = structlayout.Register(structlayout.New("gow_wad_tag", "God of War wad tag header", WAD_ITEM_SIZE,
+	structlayout.Field{Name: "tag", Offset: 0x00, Kind: structlayout.U16},
+	structlayout.Field{Name: "flags", Offset: 0x02, Kind: structlayout.U16},
+	structlayout.Field{Name: "size", Offset: 0x04, Kind: structlayout.U32, Doc: "size of data following header, aligned to 16 bytes"},
+	structlayout.Field{Name: "name", Offset: 0x08, Kind: structlayout.String, Size: 24},
+))
+
+// fields resolved once, headers are parsed for every tag
+var (
+	tagFieldTag   = TagLayout.Field("tag")
+	tagFieldFlags = TagLayout.Field("flags")
+	tagFieldSize  = TagLayout.Field("size")
+	tagFieldName  = TagLayout.Field("name")
+)
+
 func UnmarshalTag(buf []byte) Tag {
 	return Tag{
-		Tag:    binary.LittleEndian.Uint16(buf[0:2]),
-		Flags:  binary.LittleEndian.Uint16(buf[2:4]),
-		Size:   binary.LittleEndian.Uint32(buf[4:8]),
-		Name:   utils.BytesToString(buf[8:32]),
+		Tag:    tagFieldTag.U16(buf),
+		Flags:  tagFieldFlags.U16(buf),
+		Size:   tagFieldSize.U32(buf),
+		Name:   tagFieldName.String(buf),
 		NodeId: NODE_INVALID,
 	}
 }
 
 func MarshalTag(t *Tag) []byte {
 	buf := make([]byte, WAD_ITEM_SIZE)
-	binary.LittleEndian.PutUint16(buf[0:2], t.Tag)
-	binary.LittleEndian.PutUint16(buf[2:4], t.Flags)
-	binary.LittleEndian.PutUint32(buf[4:8], t.Size)
-	copy(buf[8:32], utils.StringToBytesBuffer(t.Name, 24, false))
+	tagFieldTag.PutU16(buf, t.Tag)
+	tagFieldFlags.PutU16(buf, t.Flags)
+	tagFieldSize.PutU32(buf, t.Size)
+	tagFieldName.PutString(buf, t.Name, false)
 	return buf
 }
 
@@ -279,6 +334,10 @@ func (w *Wad) GetTagByName(name string, searchStart TagId, searchForward bool) *
 }
 
 func (w *Wad) GenerateName(prefix string) string {
+	return w.generateNameExcept(prefix, nil)
+}
+
+func (w *Wad) generateNameExcept(prefix string, taken map[string]bool) string {
 	// generates name by first free hex suffix
 	// l - hex suffix byes count
 	for l := 1; ; l += 1 {
@@ -289,7 +348,7 @@ func (w *Wad) GenerateName(prefix string) string {
 
 		for i := 0; i < 0x100*l; i++ {
 			name := fmt.Sprintf("%s%x", prefix, i)
-			if w.GetTagByName(name, 0, true) == nil {
+			if w.GetTagByName(name, 0, true) == nil && !taken[name] {
 				return name
 			}
 		}
@@ -341,6 +400,9 @@ func alignToWadTag(pos int) int {
 func (w *Wad) Save(tags []Tag) error {
 	var buf bytes.Buffer
 
+	w.recordBaseline()
+	w.warnBudget(tags)
+
 	for _, t := range tags {
 		if isZeroSizedTag(&t) {
 			t.Size = w.HeapSizes[t.Name]
@@ -364,15 +426,47 @@ func (w *Wad) Save(tags []Tag) error {
 		return fmt.Errorf("Error when parsing tags: %v", err)
 	}
 
+	if w.deferSave {
+		w.pendingSave = buf.Bytes()
+		return nil
+	}
 	return w.Source.Save(io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(buf.Len())))
 }
 
+// DeferSave makes Save only rebuild and check wad in memory until SaveDeferred
+// is called, so many changes are written to source at once
+func (w *Wad) DeferSave() {
+	w.deferSave = true
+	w.deferredTags = append([]Tag(nil), w.Tags...)
+	w.deferredHeapSizes = make(map[string]uint32, len(w.HeapSizes))
+	for name, size := range w.HeapSizes {
+		w.deferredHeapSizes[name] = size
+	}
+}
+
+// SaveDeferred writes changes made after DeferSave, if there are any.
+// If write fails, wad is restored to state of DeferSave call, so it matches source
+func (w *Wad) SaveDeferred() error {
+	data, tags, heapSizes := w.pendingSave, w.deferredTags, w.deferredHeapSizes
+	w.deferSave = false
+	w.pendingSave, w.deferredTags, w.deferredHeapSizes = nil, nil, nil
+	if data == nil {
+		return nil
+	}
+	if err := w.Source.Save(io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))); err != nil {
+		w.restore(tags, heapSizes)
+		return err
+	}
+	return nil
+}
+
 func (w *Wad) InsertNewTags(insertAfterId TagId, newTags []Tag) error {
 	updatedTagsArray := append(w.Tags[:insertAfterId], append(newTags, w.Tags[insertAfterId:]...)...)
 	return w.Save(updatedTagsArray)
 }
 
 func (w *Wad) UpdateTagInfo(updateTags map[TagId]Tag) error {
+	w.recordBaseline()
 	for i, newTag := range updateTags {
 		t := &w.Tags[i]
 		log.Printf("Updating tag %x-%s to %x-%s", t.Id, t.Name, newTag.Id, newTag.Name)
@@ -382,6 +476,7 @@ func (w *Wad) UpdateTagInfo(updateTags map[TagId]Tag) error {
 }
 
 func (w *Wad) UpdateTagsData(updateData map[TagId][]byte) error {
+	w.recordBaseline()
 	for i, newData := range updateData {
 		t := &w.Tags[i]
 		log.Println("Changing size at ", t.Name, " from ", t.Size, " to ", len(newData))
@@ -414,6 +509,7 @@ func NewWad(r io.ReadSeeker, rsrc utils.ResourceSource) (*Wad, error) {
 	if err := w.parseTags(); err != nil {
 		return nil, fmt.Errorf("Error when parsing tags: %v", err)
 	}
+	w.recordBaseline()
 
 	if config.GetGOWVersion() == config.GOW1 {
 		// load scripts so we have filled variables
@@ -444,6 +540,16 @@ func (r *WadNodeRsrc) Size() int64 {
 	return int64(r.Node.Tag.Size)
 }
 
+// NewBufStack creates root buffer over tag data. Buffer is remembered as node
+// layout only during parse made by GetNodeLayout, other parses do not keep it
+func (r *WadNodeRsrc) NewBufStack(kind string) *utils.BufStack {
+	bs := utils.NewBufStack(kind, r.Tag.Data).SetName(r.Tag.Name)
+	if r.Node.recordLayout {
+		r.Node.layout = bs
+	}
+	return bs
+}
+
 func init() {
 	pack.SetHandler(".WAD", func(p utils.ResourceSource, r *io.SectionReader) (interface{}, error) {
 		return NewWad(r, p)
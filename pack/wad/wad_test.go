@@ -0,0 +1,98 @@
+package wad
+
+import (
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/config"
+)
+
+const testLayoutServerId = 0x7e570002
+
+func init() {
+	SetHandler(config.GOW1, testLayoutServerId, func(wrsrc *WadNodeRsrc) (File, error) {
+		bs := wrsrc.NewBufStack("test")
+		bs.SubBuf("header", 0).SetSize(4)
+		return &testResource{}, nil
+	})
+}
+
+func TestDeferSave(t *testing.T) {
+	w := newTestWad(t, "TEST.WAD", []Tag{
+		testResourceTag("TXR_a", testKindDependent),
+		testResourceTag("OBJ_root", testKindRoot, "TXR_a"),
+	})
+	src := w.Source.(*testSource)
+
+	w.DeferSave()
+	if err := w.UpdateTagsData(map[TagId][]byte{0: testResourceTag("TXR_a", testKindDependent, "TXR_b").Data}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.InsertNewTags(0, []Tag{testResourceTag("TXR_b", testKindDependent)}); err != nil {
+		t.Fatal(err)
+	}
+	if src.saved != nil {
+		t.Fatalf("Wad saved before SaveDeferred()")
+	}
+	if len(w.Tags) != 3 || w.GetNodeByName("TXR_b", NodeId(len(w.Nodes)-1), false) == nil {
+		t.Fatalf("Deferred changes are not applied in memory")
+	}
+
+	if err := w.SaveDeferred(); err != nil {
+		t.Fatal(err)
+	}
+	saved := src.saved
+	if saved == nil {
+		t.Fatalf("SaveDeferred() did not write wad")
+	}
+	if err := w.SaveDeferred(); err != nil || &src.saved[0] != &saved[0] {
+		t.Errorf("Second SaveDeferred() wrote wad again")
+	}
+}
+
+func TestSaveDeferredFailure(t *testing.T) {
+	w := newTestWad(t, "TEST.WAD", []Tag{
+		testResourceTag("TXR_a", testKindDependent),
+		testResourceTag("OBJ_root", testKindRoot, "TXR_a"),
+	})
+	w.Source.(*testSource).err = fmt.Errorf("disk is full")
+
+	w.DeferSave()
+	if err := w.InsertNewTags(0, []Tag{testResourceTag("TXR_b", testKindDependent)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SaveDeferred(); err == nil {
+		t.Fatalf("SaveDeferred() returned nil error")
+	}
+	if len(w.Tags) != 2 || w.Tags[0].Name != "TXR_a" || w.GetNodeByName("TXR_b", 0, true) != nil {
+		t.Errorf("Wad is not restored after failed write: %d tags", len(w.Tags))
+	}
+	if w.deferSave {
+		t.Errorf("Wad left in deferred mode")
+	}
+}
+
+func TestGetNodeLayout(t *testing.T) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint32(data, testLayoutServerId)
+	w := newTestWad(t, "TEST.WAD", []Tag{{Tag: TAG_GOW1_SERVER_INSTANCE, Name: "LAY_a", Data: data}})
+
+	if _, _, err := w.GetInstanceFromNode(0); err != nil {
+		t.Fatal(err)
+	}
+	if w.Nodes[0].layout != nil {
+		t.Errorf("Usual parse recorded layout")
+	}
+
+	layout, parseErr, err := w.GetNodeLayout(0)
+	if err != nil || parseErr != nil {
+		t.Fatal(err, parseErr)
+	}
+	if len(layout) != 2 || layout[1].Kind != "header" || layout[1].Size != 4 {
+		t.Errorf("Unexpected layout %+v", layout)
+	}
+	if n := w.Nodes[0]; n.layout != nil || n.recordLayout {
+		t.Errorf("Layout is kept after GetNodeLayout()")
+	}
+}
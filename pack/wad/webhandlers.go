@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strconv"
 
+	"github.com/mogaika/god_of_war_browser/utils"
 	"github.com/mogaika/god_of_war_browser/webutils"
 )
 
@@ -32,6 +33,57 @@ func (wad *Wad) WebHandlerForNodeByTagId(w http.ResponseWriter, tagId TagId) err
 	return nil
 }
 
+// GetNodeLayout reparses node and returns regions recorded by its BufStack parser.
+// Regions are returned even if parser failed, so partially known data can be inspected.
+// Buffer is kept only for this parse, other parses do not record layout
+func (wad *Wad) GetNodeLayout(tagId TagId) (layout []utils.BufStackRegion, parseErr error, err error) {
+	tag := wad.GetTagById(tagId)
+	node := wad.GetNodeById(tag.NodeId)
+	if node == nil {
+		return nil, nil, fmt.Errorf("Tag %d-%s is not a node", tagId, tag.Name)
+	}
+
+	node.Cache = nil
+	node.recordLayout = true
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				parseErr = fmt.Errorf("Parser panic: %v", r)
+			}
+		}()
+		_, _, parseErr = wad.CallHandler(node.Id)
+	}()
+	root := node.layout
+	node.recordLayout, node.layout = false, nil
+
+	if root == nil {
+		if parseErr != nil {
+			return nil, nil, parseErr
+		}
+		return nil, nil, fmt.Errorf("Parser of %d-%s do not record layout", tagId, node.Tag.Name)
+	}
+	return root.Layout(), parseErr, nil
+}
+
+func (wad *Wad) WebHandlerLayoutForNodeByTagId(w http.ResponseWriter, tagId TagId) error {
+	layout, parseErr, err := wad.GetNodeLayout(tagId)
+	if err != nil {
+		return err
+	}
+
+	type Result struct {
+		Tag        *Tag
+		Regions    []utils.BufStackRegion
+		ParseError string `json:",omitempty"`
+	}
+	res := &Result{Tag: wad.GetTagById(tagId), Regions: layout}
+	if parseErr != nil {
+		res.ParseError = parseErr.Error()
+	}
+	webutils.WriteJson(w, res)
+	return nil
+}
+
 func (wad *Wad) WebHandlerDumpTagData(w http.ResponseWriter, id TagId) {
 	tag := wad.GetTagById(id)
 	webutils.WriteFile(w, bytes.NewBuffer(tag.Data), tag.Name)
@@ -62,6 +114,8 @@ func (wad *Wad) WebHandlerCallResourceHttpAction(w http.ResponseWriter, r *http.
 		if err := wad.UpdateTagInfo(map[TagId]Tag{id: newTag}); err != nil {
 			return fmt.Errorf("Error when updating wad tag %d: %v", id, err)
 		}
+	case "delete", "duplicate", "move", "movetogroup", "creategroup":
+		return wad.webHandlerStructureAction(w, r, id, action)
 	default:
 		if inst, _, err := wad.GetInstanceFromTag(id); err == nil {
 			rt := reflect.TypeOf(inst)
@@ -84,3 +138,60 @@ func (wad *Wad) WebHandlerCallResourceHttpAction(w http.ResponseWriter, r *http.
 	}
 	return nil
 }
+
+// webHandlerStructureAction changes wad structure around node of tag id
+// and responds with updated wad
+func (wad *Wad) webHandlerStructureAction(w http.ResponseWriter, r *http.Request, id TagId, action string) error {
+	if r.Method != http.MethodPost {
+		return fmt.Errorf("Action %s requires POST request", action)
+	}
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("Cannot parse form: %v", err)
+	}
+
+	nodeId := wad.GetTagById(id).NodeId
+	if nodeId == NODE_INVALID {
+		return fmt.Errorf("Tag %d is not a node", id)
+	}
+
+	formTagId := func(key string) (TagId, error) {
+		v, err := strconv.Atoi(r.Form.Get(key))
+		if err != nil {
+			return 0, fmt.Errorf("Form value '%s'='%s' is not integer", key, r.Form.Get(key))
+		}
+		if v < 0 || v > len(wad.Tags) {
+			return 0, fmt.Errorf("Form value '%s'=%d is out of wad", key, v)
+		}
+		return TagId(v), nil
+	}
+
+	var err error
+	switch action {
+	case "delete":
+		err = wad.DeleteNode(nodeId)
+	case "duplicate":
+		err = wad.DuplicateNode(nodeId, r.Form.Get("name"))
+	case "move":
+		var pos TagId
+		if pos, err = formTagId("pos"); err == nil {
+			err = wad.MoveNode(nodeId, pos)
+		}
+	case "movetogroup":
+		var group TagId
+		if group, err = formTagId("group"); err == nil {
+			if int(group) == len(wad.Tags) || wad.GetTagById(group).NodeId == NODE_INVALID {
+				err = fmt.Errorf("Tag %d is not a node", group)
+			} else {
+				err = wad.MoveNodeToGroup(nodeId, wad.GetTagById(group).NodeId)
+			}
+		}
+	case "creategroup":
+		err = wad.CreateGroup(nodeId)
+	}
+	if err != nil {
+		return err
+	}
+
+	webutils.WriteJson(w, wad)
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"fmt"
+
 	"github.com/mogaika/god_of_war_browser/pack/wad/twk"
 	"github.com/mogaika/god_of_war_browser/pack/wad/twk/twktree"
 
@@ -9,6 +11,7 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/mogaika/god_of_war_browser/jobs"
 	"github.com/mogaika/god_of_war_browser/pack"
 	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
 
@@ -16,21 +19,29 @@ import (
 	"github.com/mogaika/god_of_war_browser/vfs"
 )
 
-func parseCheck(rootfs vfs.Directory) {
+func parseCheck(j *jobs.Job, rootfs vfs.Directory) error {
 	packList, err := rootfs.List()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	sort.Sort(sort.Reverse(sort.StringSlice(packList)))
 
-	for _, fname := range packList {
+	failed := make([]string, 0)
+
+	for iFile, fname := range packList {
+		if j.Cancelled() {
+			break
+		}
 		if !strings.HasSuffix(fname, ".WAD") && !strings.HasSuffix(fname, ".wad_psp2") {
 			continue
 		}
 		log.Printf("Parsecheck %q", fname)
-		data, _ := pack.GetInstanceHandler(rootfs, fname)
+		j.Progress(float32(iFile)/float32(len(packList)), "Parsecheck '%s'", fname)
+		data, err := pack.GetInstanceHandler(rootfs, fname)
 		if data == nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", fname, err))
+			j.SetResult(failed)
 			continue
 		}
 		switch data.(type) {
@@ -51,6 +62,7 @@ func parseCheck(rootfs vfs.Directory) {
 					} else {
 						if _, err := twktree.Root().UnmarshalTWK(tw.Tree); err != nil {
 							log.Printf("Failed to parse abstarct tree for %s:%s: %v", wad.Name(), node.Tag.Name, err)
+							failed = append(failed, fmt.Sprintf("%s:%s: %v", wad.Name(), node.Tag.Name, err))
 						}
 					}
 
@@ -90,4 +102,7 @@ func parseCheck(rootfs vfs.Directory) {
 			}
 		}
 	}
+
+	j.SetResult(failed)
+	return nil
 }
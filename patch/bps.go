@@ -0,0 +1,302 @@
+package patch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/mogaika/god_of_war_browser/jobs"
+)
+
+const BPS_MAGIC = "BPS1"
+
+const (
+	BPS_SOURCE_READ = iota
+	BPS_TARGET_READ
+	BPS_SOURCE_COPY
+	BPS_TARGET_COPY
+)
+
+// equal runs shorter than this are stored as target data,
+// because action header costs more than data itself
+const bpsEqualThreshold = 8
+
+// pending target data is flushed as separate action after this size
+const bpsMaxTargetRead = 0x10000
+
+func bpsEncodeNumber(w io.ByteWriter, v uint64) {
+	for {
+		x := byte(v & 0x7f)
+		v >>= 7
+		if v == 0 {
+			w.WriteByte(0x80 | x)
+			return
+		}
+		w.WriteByte(x)
+		v--
+	}
+}
+
+func bpsDecodeNumber(r io.ByteReader) (uint64, error) {
+	var v uint64
+	shift := uint64(1)
+	for {
+		x, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		v += uint64(x&0x7f) * shift
+		if x&0x80 != 0 {
+			return v, nil
+		}
+		shift <<= 7
+		v += shift
+	}
+}
+
+type bpsEncoder struct {
+	w        *bufio.Writer
+	target   []byte // pending target read data
+	equal    []byte // pending equal data while run is shorter than threshold
+	equalRun int64
+}
+
+func (e *bpsEncoder) action(command int, length int64) {
+	bpsEncodeNumber(e.w, uint64(length-1)<<2|uint64(command))
+}
+
+func (e *bpsEncoder) flushTarget() {
+	if len(e.target) != 0 {
+		e.action(BPS_TARGET_READ, int64(len(e.target)))
+		e.w.Write(e.target)
+		e.target = e.target[:0]
+	}
+}
+
+func (e *bpsEncoder) addEqual(data []byte) {
+	if e.equalRun+int64(len(data)) < bpsEqualThreshold {
+		e.equal = append(e.equal, data...)
+	} else if e.equalRun < bpsEqualThreshold {
+		// run became long enough to be source read
+		e.flushTarget()
+		e.equal = e.equal[:0]
+	}
+	e.equalRun += int64(len(data))
+}
+
+func (e *bpsEncoder) endEqual() {
+	if e.equalRun >= bpsEqualThreshold {
+		e.action(BPS_SOURCE_READ, e.equalRun)
+	} else {
+		e.target = append(e.target, e.equal...)
+	}
+	e.equal = e.equal[:0]
+	e.equalRun = 0
+}
+
+func (e *bpsEncoder) addDifferent(data []byte) {
+	e.endEqual()
+	e.target = append(e.target, data...)
+	if len(e.target) >= bpsMaxTargetRead {
+		e.flushTarget()
+	}
+}
+
+// CreateBPS writes linear BPS patch: unchanged data is read from same offset of source,
+// changed data is stored in patch. Enough for images where files are replaced in place
+func CreateBPS(j *jobs.Job, source io.ReaderAt, sourceSize int64, target io.ReaderAt, targetSize int64, metadata string, w io.Writer) error {
+	patchCrc := crc32.NewIEEE()
+	targetCrc := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, patchCrc))
+	e := &bpsEncoder{w: bw}
+
+	bw.WriteString(BPS_MAGIC)
+	bpsEncodeNumber(bw, uint64(sourceSize))
+	bpsEncodeNumber(bw, uint64(targetSize))
+	bpsEncodeNumber(bw, uint64(len(metadata)))
+	bw.WriteString(metadata)
+
+	if err := compareChunks(j, source, sourceSize, target, targetSize, func(off int64, src, tgt []byte) {
+		targetCrc.Write(tgt)
+		if bytes.Equal(src, tgt) {
+			e.addEqual(tgt)
+			return
+		}
+		for i := 0; i < len(tgt); {
+			if n := equalPrefix(src, tgt, i); n != 0 {
+				e.addEqual(tgt[i : i+n])
+				i += n
+			} else {
+				e.addDifferent(tgt[i : i+1])
+				i++
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	e.endEqual()
+	e.flushTarget()
+
+	sourceCrc, err := Checksum(j, source, sourceSize)
+	if err != nil {
+		return err
+	}
+
+	var footer [8]byte
+	binary.LittleEndian.PutUint32(footer[0:], sourceCrc)
+	binary.LittleEndian.PutUint32(footer[4:], targetCrc.Sum32())
+	bw.Write(footer[:])
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+
+	binary.LittleEndian.PutUint32(footer[:], patchCrc.Sum32())
+	_, err = w.Write(footer[:4])
+	return err
+}
+
+type bpsOutput struct {
+	w      ReadWriterAt
+	offset int64
+	crc    hash.Hash32
+}
+
+func (o *bpsOutput) write(b []byte) error {
+	if _, err := o.w.WriteAt(b, o.offset); err != nil {
+		return err
+	}
+	o.crc.Write(b)
+	o.offset += int64(len(b))
+	return nil
+}
+
+// copyFrom copies data by small blocks, so overlapping target copy repeats pattern
+func (o *bpsOutput) copyFrom(r io.ReaderAt, offset int64, length int64, block int64) error {
+	buf := make([]byte, CHUNK_SIZE)
+	for length > 0 {
+		n := length
+		if n > block {
+			n = block
+		}
+		if n > int64(len(buf)) {
+			n = int64(len(buf))
+		}
+		if _, err := r.ReadAt(buf[:n], offset); err != nil && err != io.EOF {
+			return err
+		}
+		if err := o.write(buf[:n]); err != nil {
+			return err
+		}
+		offset += n
+		length -= n
+	}
+	return nil
+}
+
+// ApplyBPS verifies checksums of patch and source and writes target to output
+func ApplyBPS(j *jobs.Job, patch []byte, source io.ReaderAt, sourceSize int64, output ReadWriterAt) (int64, error) {
+	if len(patch) < len(BPS_MAGIC)+12 || string(patch[:len(BPS_MAGIC)]) != BPS_MAGIC {
+		return 0, fmt.Errorf("[patch] Not a bps patch")
+	}
+	footer := patch[len(patch)-12:]
+	if crc32.ChecksumIEEE(patch[:len(patch)-4]) != binary.LittleEndian.Uint32(footer[8:]) {
+		return 0, fmt.Errorf("[patch] Patch checksum mismatch, patch file is corrupted")
+	}
+
+	r := bytes.NewReader(patch[len(BPS_MAGIC) : len(patch)-12])
+	expectedSourceSize, err := bpsDecodeNumber(r)
+	if err != nil {
+		return 0, err
+	}
+	targetSize, err := bpsDecodeNumber(r)
+	if err != nil {
+		return 0, err
+	}
+	metadataSize, err := bpsDecodeNumber(r)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(int64(metadataSize), io.SeekCurrent); err != nil {
+		return 0, err
+	}
+
+	if uint64(sourceSize) != expectedSourceSize {
+		return 0, fmt.Errorf("[patch] Source size %d do not match patch source size %d", sourceSize, expectedSourceSize)
+	}
+	sourceCrc, err := Checksum(j, source, sourceSize)
+	if err != nil {
+		return 0, err
+	}
+	if sourceCrc != binary.LittleEndian.Uint32(footer[0:]) {
+		return 0, fmt.Errorf("[patch] Source checksum %.8x do not match patch source checksum %.8x",
+			sourceCrc, binary.LittleEndian.Uint32(footer[0:]))
+	}
+
+	out := &bpsOutput{w: output, crc: crc32.NewIEEE()}
+	var sourceRelative, targetRelative int64
+	relative := func(v uint64) int64 {
+		if v&1 != 0 {
+			return -int64(v >> 1)
+		}
+		return int64(v >> 1)
+	}
+
+	for r.Len() != 0 {
+		if j.Cancelled() {
+			return 0, fmt.Errorf("[patch] Cancelled")
+		}
+		j.Progress(float32(out.offset)/float32(targetSize), "Applying patch")
+
+		data, err := bpsDecodeNumber(r)
+		if err != nil {
+			return 0, err
+		}
+		command, length := int(data&3), int64(data>>2)+1
+		if out.offset+length > int64(targetSize) {
+			return 0, fmt.Errorf("[patch] Patch writes out of target")
+		}
+
+		switch command {
+		case BPS_SOURCE_READ:
+			err = out.copyFrom(source, out.offset, length, CHUNK_SIZE)
+		case BPS_TARGET_READ:
+			buf := make([]byte, length)
+			if _, err = io.ReadFull(r, buf); err == nil {
+				err = out.write(buf)
+			}
+		case BPS_SOURCE_COPY:
+			var v uint64
+			if v, err = bpsDecodeNumber(r); err == nil {
+				sourceRelative += relative(v)
+				err = out.copyFrom(source, sourceRelative, length, CHUNK_SIZE)
+				sourceRelative += length
+			}
+		case BPS_TARGET_COPY:
+			var v uint64
+			if v, err = bpsDecodeNumber(r); err == nil {
+				targetRelative += relative(v)
+				if targetRelative < 0 || targetRelative >= out.offset {
+					return 0, fmt.Errorf("[patch] Target copy from 0x%x is out of written data", targetRelative)
+				}
+				// source region can overlap written one
+				err = out.copyFrom(output, targetRelative, length, out.offset-targetRelative)
+				targetRelative += length
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("[patch] Error applying action %d at 0x%x: %v", command, out.offset, err)
+		}
+	}
+
+	if out.offset != int64(targetSize) {
+		return 0, fmt.Errorf("[patch] Patch produced %d bytes instead of %d", out.offset, targetSize)
+	}
+	if out.crc.Sum32() != binary.LittleEndian.Uint32(footer[4:]) {
+		return 0, fmt.Errorf("[patch] Result checksum mismatch")
+	}
+	return out.offset, nil
+}
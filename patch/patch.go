@@ -0,0 +1,132 @@
+// Package patch creates and applies binary patches (BPS, PPF3) between
+// original and modified game images, so mods can be distributed without image
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/mogaika/god_of_war_browser/jobs"
+)
+
+const (
+	FORMAT_BPS = "bps"
+	FORMAT_PPF = "ppf"
+)
+
+// size of blocks images are compared and checksummed by
+const CHUNK_SIZE = 1024 * 1024
+
+type ReadWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// Create writes patch converting source to target in selected format.
+// Description is stored in patch (BPS metadata or PPF description)
+func Create(j *jobs.Job, format string, source io.ReaderAt, sourceSize int64, target io.ReaderAt, targetSize int64, description string, w io.Writer) error {
+	switch format {
+	case FORMAT_BPS:
+		return CreateBPS(j, source, sourceSize, target, targetSize, description, w)
+	case FORMAT_PPF:
+		return CreatePPF(j, source, sourceSize, target, targetSize, description, w)
+	default:
+		return fmt.Errorf("[patch] Unknown patch format '%s'", format)
+	}
+}
+
+// DetectFormat returns format of patch by magic
+func DetectFormat(patch []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(patch, []byte(BPS_MAGIC)):
+		return FORMAT_BPS, nil
+	case bytes.HasPrefix(patch, []byte(PPF_MAGIC)):
+		return FORMAT_PPF, nil
+	default:
+		return "", fmt.Errorf("[patch] Unknown patch format")
+	}
+}
+
+// Apply verifies that source matches patch and writes patched image to output.
+// Returns size of result
+func Apply(j *jobs.Job, patch []byte, source io.ReaderAt, sourceSize int64, output ReadWriterAt) (int64, error) {
+	format, err := DetectFormat(patch)
+	if err != nil {
+		return 0, err
+	}
+	switch format {
+	case FORMAT_BPS:
+		return ApplyBPS(j, patch, source, sourceSize, output)
+	default:
+		return ApplyPPF(j, patch, source, sourceSize, output)
+	}
+}
+
+// Checksum calculates crc32 of whole image
+func Checksum(j *jobs.Job, r io.ReaderAt, size int64) (uint32, error) {
+	h := crc32.NewIEEE()
+	buf := make([]byte, CHUNK_SIZE)
+	for off := int64(0); off < size; off += CHUNK_SIZE {
+		if j.Cancelled() {
+			return 0, fmt.Errorf("[patch] Cancelled")
+		}
+		j.Progress(float32(off)/float32(size), "Checksum of image")
+		n := int64(len(buf))
+		if size-off < n {
+			n = size - off
+		}
+		if _, err := r.ReadAt(buf[:n], off); err != nil && err != io.EOF {
+			return 0, err
+		}
+		h.Write(buf[:n])
+	}
+	return h.Sum32(), nil
+}
+
+// compareChunks reads source and target by chunks and calls f for every chunk
+// of target. Source chunk is shorter than target one (or empty) past the end of source
+func compareChunks(j *jobs.Job, source io.ReaderAt, sourceSize int64, target io.ReaderAt, targetSize int64,
+	f func(off int64, src, tgt []byte)) error {
+	srcBuf := make([]byte, CHUNK_SIZE)
+	tgtBuf := make([]byte, CHUNK_SIZE)
+
+	for off := int64(0); off < targetSize; off += CHUNK_SIZE {
+		if j.Cancelled() {
+			return fmt.Errorf("[patch] Cancelled")
+		}
+		j.Progress(float32(off)/float32(targetSize), "Comparing images")
+
+		tgt := tgtBuf
+		if targetSize-off < int64(len(tgt)) {
+			tgt = tgt[:targetSize-off]
+		}
+		if _, err := target.ReadAt(tgt, off); err != nil && err != io.EOF {
+			return fmt.Errorf("[patch] Cannot read target: %v", err)
+		}
+
+		src := srcBuf[:0]
+		if off < sourceSize {
+			src = srcBuf[:len(tgt)]
+			if sourceSize-off < int64(len(src)) {
+				src = src[:sourceSize-off]
+			}
+			if _, err := source.ReadAt(src, off); err != nil && err != io.EOF {
+				return fmt.Errorf("[patch] Cannot read source: %v", err)
+			}
+		}
+
+		f(off, src, tgt)
+	}
+	return nil
+}
+
+// equalPrefix returns length of equal part of src and tgt starting at i
+func equalPrefix(src, tgt []byte, i int) int {
+	j := i
+	for j < len(src) && j < len(tgt) && src[j] == tgt[j] {
+		j++
+	}
+	return j - i
+}
@@ -0,0 +1,75 @@
+package patch
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+type memoryImage struct {
+	data []byte
+}
+
+func (m *memoryImage) ReadAt(b []byte, off int64) (int, error) {
+	return copy(b, m.data[off:]), nil
+}
+
+func (m *memoryImage) WriteAt(b []byte, off int64) (int, error) {
+	if end := int(off) + len(b); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	return copy(m.data[off:], b), nil
+}
+
+func testImages(grow int) ([]byte, []byte) {
+	rnd := rand.New(rand.NewSource(1))
+	source := make([]byte, 0x10000)
+	rnd.Read(source)
+
+	target := append([]byte{}, source...)
+	for _, off := range []int{0, 5, 0x9400, 0x9401, 0x9410, 0xfff0} {
+		target[off] ^= 0xff
+	}
+	copy(target[0x2000:], bytes.Repeat([]byte{0x55}, 600))
+	extra := make([]byte, grow)
+	rnd.Read(extra)
+	return source, append(target, extra...)
+}
+
+func testRoundTrip(t *testing.T, format string, grow int) {
+	source, target := testImages(grow)
+
+	var patch bytes.Buffer
+	if err := Create(nil, format, bytes.NewReader(source), int64(len(source)),
+		bytes.NewReader(target), int64(len(target)), "test", &patch); err != nil {
+		t.Fatalf("Create(%s) failed: %v", format, err)
+	}
+	if patch.Len() > 4096+2*grow {
+		t.Errorf("%s patch is too big: %d bytes", format, patch.Len())
+	}
+
+	out := &memoryImage{}
+	size, err := Apply(nil, patch.Bytes(), bytes.NewReader(source), int64(len(source)), out)
+	if err != nil {
+		t.Fatalf("Apply(%s) failed: %v", format, err)
+	}
+	if !bytes.Equal(out.data[:size], target) {
+		t.Errorf("%s patch result differs from target", format)
+	}
+
+	wrongSource := append([]byte{}, source...)
+	wrongSource[0x9400] ^= 1
+	if _, err := Apply(nil, patch.Bytes(), bytes.NewReader(wrongSource), int64(len(wrongSource)), &memoryImage{}); err == nil {
+		t.Errorf("%s patch applied to wrong source", format)
+	}
+}
+
+func TestBPS(t *testing.T) {
+	testRoundTrip(t, FORMAT_BPS, 0)
+	testRoundTrip(t, FORMAT_BPS, 100)
+}
+
+func TestPPF(t *testing.T) {
+	testRoundTrip(t, FORMAT_PPF, 0)
+	testRoundTrip(t, FORMAT_PPF, 100)
+}
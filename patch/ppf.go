@@ -0,0 +1,245 @@
+package patch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/mogaika/god_of_war_browser/jobs"
+)
+
+const PPF_MAGIC = "PPF30"
+
+const (
+	PPF_HEADER_SIZE      = 60
+	PPF_DESCRIPTION_SIZE = 50
+	PPF_BLOCKCHECK_SIZE  = 1024
+	PPF_MAX_RECORD       = 0xff
+
+	PPF_IMAGE_BIN = 0
+	PPF_IMAGE_GI  = 1
+)
+
+const ppfFileIdMagic = "@BEGIN_FILE_ID.DIZ"
+
+// equal runs shorter than record header are included into record
+const ppfGapThreshold = 9
+
+func ppfBlockCheckOffset(imageType byte) int64 {
+	if imageType == PPF_IMAGE_GI {
+		return 0x80A0
+	}
+	return 0x9320
+}
+
+type ppfRecord struct {
+	offset int64
+	data   []byte
+	undo   []byte
+}
+
+type ppfEncoder struct {
+	w      *bufio.Writer
+	rec    ppfRecord
+	open   bool
+	gap    []byte // equal data following record data
+	gapSrc []byte
+}
+
+func (e *ppfEncoder) flush() {
+	if e.open {
+		var off [8]byte
+		binary.LittleEndian.PutUint64(off[:], uint64(e.rec.offset))
+		e.w.Write(off[:])
+		e.w.WriteByte(byte(len(e.rec.data)))
+		e.w.Write(e.rec.data)
+		e.w.Write(e.rec.undo)
+	}
+	e.open = false
+	e.rec.data = e.rec.data[:0]
+	e.rec.undo = e.rec.undo[:0]
+	e.gap = e.gap[:0]
+	e.gapSrc = e.gapSrc[:0]
+}
+
+func (e *ppfEncoder) addEqual(data []byte) {
+	if !e.open {
+		return
+	}
+	if len(e.gap)+len(data) >= ppfGapThreshold || len(e.rec.data)+len(e.gap)+len(data) >= PPF_MAX_RECORD {
+		e.flush()
+		return
+	}
+	e.gap = append(e.gap, data...)
+	// equal data, so undo is same
+	e.gapSrc = append(e.gapSrc, data...)
+}
+
+func (e *ppfEncoder) addDifferent(off int64, b byte, src byte) {
+	if e.open {
+		e.rec.data = append(e.rec.data, e.gap...)
+		e.rec.undo = append(e.rec.undo, e.gapSrc...)
+		e.gap = e.gap[:0]
+		e.gapSrc = e.gapSrc[:0]
+	} else {
+		e.open = true
+		e.rec.offset = off
+	}
+	e.rec.data = append(e.rec.data, b)
+	e.rec.undo = append(e.rec.undo, src)
+	if len(e.rec.data) == PPF_MAX_RECORD {
+		e.flush()
+	}
+}
+
+// CreatePPF writes PPF3 patch with block check and undo data.
+// PPF can not make image smaller
+func CreatePPF(j *jobs.Job, source io.ReaderAt, sourceSize int64, target io.ReaderAt, targetSize int64, description string, w io.Writer) error {
+	if targetSize < sourceSize {
+		return fmt.Errorf("[patch] PPF cannot shrink image from %d to %d bytes", sourceSize, targetSize)
+	}
+
+	bw := bufio.NewWriter(w)
+	header := make([]byte, PPF_HEADER_SIZE)
+	copy(header, PPF_MAGIC)
+	header[5] = 2 // encoding method of PPF3
+	desc := []byte(description)
+	if len(desc) > PPF_DESCRIPTION_SIZE {
+		desc = desc[:PPF_DESCRIPTION_SIZE]
+	}
+	copy(header[6:], bytes.Repeat([]byte(" "), PPF_DESCRIPTION_SIZE))
+	copy(header[6:], desc)
+	header[56] = PPF_IMAGE_BIN
+	blockCheck := sourceSize >= ppfBlockCheckOffset(PPF_IMAGE_BIN)+PPF_BLOCKCHECK_SIZE
+	if blockCheck {
+		header[57] = 1
+	}
+	header[58] = 1 // undo data present
+	bw.Write(header)
+
+	if blockCheck {
+		block := make([]byte, PPF_BLOCKCHECK_SIZE)
+		if _, err := source.ReadAt(block, ppfBlockCheckOffset(PPF_IMAGE_BIN)); err != nil {
+			return fmt.Errorf("[patch] Cannot read source block check: %v", err)
+		}
+		bw.Write(block)
+	}
+
+	e := &ppfEncoder{w: bw}
+	if err := compareChunks(j, source, sourceSize, target, targetSize, func(off int64, src, tgt []byte) {
+		if bytes.Equal(src, tgt) {
+			e.addEqual(tgt)
+			return
+		}
+		for i := 0; i < len(tgt); {
+			if n := equalPrefix(src, tgt, i); n != 0 {
+				e.addEqual(tgt[i : i+n])
+				i += n
+			} else {
+				var s byte
+				if i < len(src) {
+					s = src[i]
+				}
+				e.addDifferent(off+int64(i), tgt[i], s)
+				i++
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	e.flush()
+	return bw.Flush()
+}
+
+// ApplyPPF checks block check and undo data of PPF3 patch against source,
+// copies source to output and applies records
+func ApplyPPF(j *jobs.Job, patch []byte, source io.ReaderAt, sourceSize int64, output ReadWriterAt) (int64, error) {
+	if len(patch) < PPF_HEADER_SIZE || string(patch[:len(PPF_MAGIC)]) != PPF_MAGIC || patch[5] != 2 {
+		return 0, fmt.Errorf("[patch] Only PPF3 patches are supported")
+	}
+	imageType, blockCheck, undo := patch[56], patch[57] != 0, patch[58] != 0
+	pos := PPF_HEADER_SIZE
+
+	if blockCheck {
+		if len(patch) < pos+PPF_BLOCKCHECK_SIZE {
+			return 0, fmt.Errorf("[patch] Patch is truncated")
+		}
+		block := make([]byte, PPF_BLOCKCHECK_SIZE)
+		if _, err := source.ReadAt(block, ppfBlockCheckOffset(imageType)); err != nil {
+			return 0, fmt.Errorf("[patch] Cannot read source block check: %v", err)
+		}
+		if !bytes.Equal(block, patch[pos:pos+PPF_BLOCKCHECK_SIZE]) {
+			return 0, fmt.Errorf("[patch] Source do not match patch block check, wrong image")
+		}
+		pos += PPF_BLOCKCHECK_SIZE
+	}
+
+	records := make([]ppfRecord, 0)
+	resultSize := sourceSize
+	for pos < len(patch) && !bytes.HasPrefix(patch[pos:], []byte(ppfFileIdMagic)) {
+		if len(patch) < pos+9 {
+			return 0, fmt.Errorf("[patch] Patch is truncated")
+		}
+		rec := ppfRecord{offset: int64(binary.LittleEndian.Uint64(patch[pos:]))}
+		length := int(patch[pos+8])
+		pos += 9
+
+		recSize := length
+		if undo {
+			recSize *= 2
+		}
+		if len(patch) < pos+recSize {
+			return 0, fmt.Errorf("[patch] Patch is truncated")
+		}
+		rec.data = patch[pos : pos+length]
+		if undo {
+			rec.undo = patch[pos+length : pos+recSize]
+		}
+		pos += recSize
+
+		if rec.undo != nil && rec.offset < sourceSize {
+			n := int64(len(rec.undo))
+			if sourceSize-rec.offset < n {
+				n = sourceSize - rec.offset
+			}
+			current := make([]byte, n)
+			if _, err := source.ReadAt(current, rec.offset); err != nil && err != io.EOF {
+				return 0, err
+			}
+			if !bytes.Equal(current, rec.undo[:n]) {
+				return 0, fmt.Errorf("[patch] Source data at 0x%x do not match patch undo data, wrong image", rec.offset)
+			}
+		}
+		if end := rec.offset + int64(len(rec.data)); end > resultSize {
+			resultSize = end
+		}
+		records = append(records, rec)
+	}
+
+	buf := make([]byte, CHUNK_SIZE)
+	for off := int64(0); off < sourceSize; off += CHUNK_SIZE {
+		if j.Cancelled() {
+			return 0, fmt.Errorf("[patch] Cancelled")
+		}
+		j.Progress(float32(off)/float32(sourceSize), "Copying source")
+		n := int64(len(buf))
+		if sourceSize-off < n {
+			n = sourceSize - off
+		}
+		if _, err := source.ReadAt(buf[:n], off); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if _, err := output.WriteAt(buf[:n], off); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, rec := range records {
+		if _, err := output.WriteAt(rec.data, rec.offset); err != nil {
+			return 0, err
+		}
+	}
+	return resultSize, nil
+}
@@ -105,3 +105,58 @@ func (stream *AdpcmToWaveStream) Write(p []byte) (n int, err error) {
 
 	return stream.outstream.Write(packed)
 }
+
+// UnpackLooped decodes sound honoring block flags: decoding stops at block with end flag,
+// blocks between loop start and loop end are decoded loops times.
+// Returns loop of first iteration in samples, loopStart is -1 if sound is not looped
+func UnpackLooped(packs []byte, loops int) (result []byte, loopStart int, loopEnd int, err error) {
+	if len(packs)%16 != 0 {
+		return nil, -1, -1, errors.New("Support only 8 bytes blocks of stream")
+	}
+	if loops < 1 {
+		loops = 1
+	}
+
+	stream := NewAdpcmStream()
+	result = make([]byte, 0, AdpcmSizeToWaveSize(len(packs)))
+	loopStart, loopEnd = -1, -1
+	loopStartBlock := -1
+	for iBlock := 0; iBlock < len(packs)/16; iBlock++ {
+		block := packs[iBlock*16 : iBlock*16+16]
+		flags := block[1]
+		if flags == FLAG_LOOP_START|FLAG_LOOP_REPEAT|FLAG_LOOP_END {
+			// end marker of not looped sound, data of block is not a sound
+			break
+		}
+		if flags&FLAG_LOOP_START != 0 {
+			loopStartBlock = iBlock
+			loopStart = len(result) / 2
+		}
+
+		pcm, err := stream.Unpack(block)
+		if err != nil {
+			return nil, -1, -1, err
+		}
+		result = append(result, pcm...)
+
+		if flags&FLAG_LOOP_END != 0 {
+			if flags&FLAG_LOOP_REPEAT == 0 || loopStartBlock < 0 {
+				loopStart = -1
+				break
+			}
+			loopEnd = len(result) / 2
+			for i := 1; i < loops; i++ {
+				pcm, err := stream.Unpack(packs[loopStartBlock*16 : iBlock*16+16])
+				if err != nil {
+					return nil, -1, -1, err
+				}
+				result = append(result, pcm...)
+			}
+			break
+		}
+	}
+	if loopEnd < 0 {
+		loopStart = -1
+	}
+	return result, loopStart, loopEnd, nil
+}
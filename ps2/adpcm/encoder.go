@@ -0,0 +1,160 @@
+package adpcm
+
+import "math"
+
+const (
+	BLOCK_SIZE    = 16 // bytes of adpcm block
+	BLOCK_SAMPLES = 28 // samples of one block
+)
+
+// flags of second byte of block
+const (
+	FLAG_LOOP_END    = 0x1 // jump to loop start address, sound stops if repeat flag not set
+	FLAG_LOOP_REPEAT = 0x2 // block is part of loop
+	FLAG_LOOP_START  = 0x4 // address of block stored as loop start address
+)
+
+// max shift factor, decoder shifts nibble placed at top of 16 bit value
+const maxShift = 12
+
+func WaveSamplesToAdpcmSize(samples int) int {
+	return (samples + BLOCK_SAMPLES - 1) / BLOCK_SAMPLES * BLOCK_SIZE
+}
+
+// in - 16 bit pcm samples of one channel
+// out - adpcm blocks
+// keeps prediction history between blocks the same way as AdpcmStream does
+type AdpcmEncoder struct {
+	hist1 float64
+	hist2 float64
+}
+
+func NewAdpcmEncoder() *AdpcmEncoder {
+	return &AdpcmEncoder{}
+}
+
+// simulate encodes block with selected filter and shift, returns nibbles,
+// squared error and history of decoder after block
+func (e *AdpcmEncoder) simulate(samples []int16, predict, shift int, nibbles *[BLOCK_SAMPLES]int8) (float64, float64, float64) {
+	hist1, hist2 := e.hist1, e.hist2
+	step := float64(int(1) << uint(maxShift-shift))
+	var errSum float64
+
+	for i := 0; i < BLOCK_SAMPLES; i++ {
+		var target float64
+		if i < len(samples) {
+			target = float64(samples[i])
+		}
+		predicted := hist1*vag_f[predict][0] + hist2*vag_f[predict][1]
+
+		n := math.Floor((target-predicted)/step + 0.5)
+		if n > 7 {
+			n = 7
+		} else if n < -8 {
+			n = -8
+		}
+		nibbles[i] = int8(n)
+
+		decoded := n*step + predicted
+		errSum += (target - decoded) * (target - decoded)
+		if decoded > math.MaxInt16 || decoded < math.MinInt16 {
+			// decoder do not clamp samples, so overflow produces click
+			errSum += math.MaxInt32
+		}
+		hist2, hist1 = hist1, decoded
+	}
+	return errSum, hist1, hist2
+}
+
+// EncodeBlock searches filter and shift with smallest error for up to 28 samples
+// (missing samples are silence) and writes block with flags
+func (e *AdpcmEncoder) EncodeBlock(samples []int16, flags byte) [BLOCK_SIZE]byte {
+	var nibbles, bestNibbles [BLOCK_SAMPLES]int8
+	bestErr := math.Inf(1)
+	var bestPredict, bestShift int
+	var bestHist1, bestHist2 float64
+
+	for predict := range vag_f {
+		for shift := 0; shift <= maxShift; shift++ {
+			errSum, hist1, hist2 := e.simulate(samples, predict, shift, &nibbles)
+			if errSum < bestErr {
+				bestErr, bestPredict, bestShift = errSum, predict, shift
+				bestHist1, bestHist2 = hist1, hist2
+				bestNibbles = nibbles
+			}
+		}
+	}
+	e.hist1, e.hist2 = bestHist1, bestHist2
+
+	var block [BLOCK_SIZE]byte
+	block[0] = byte(bestPredict<<4 | bestShift)
+	block[1] = flags
+	for i := 0; i < BLOCK_SAMPLES; i += 2 {
+		block[2+i/2] = byte(bestNibbles[i])&0xf | byte(bestNibbles[i+1])<<4
+	}
+	return block
+}
+
+// Pack encodes samples without flags, last block padded with silence.
+// Used for streams (vpk), where blocks of next call continue sound
+func (e *AdpcmEncoder) Pack(samples []int16) []byte {
+	result := make([]byte, 0, WaveSamplesToAdpcmSize(len(samples)))
+	for i := 0; i < len(samples); i += BLOCK_SAMPLES {
+		end := i + BLOCK_SAMPLES
+		if end > len(samples) {
+			end = len(samples)
+		}
+		block := e.EncodeBlock(samples[i:end], 0)
+		result = append(result, block[:]...)
+	}
+	return result
+}
+
+// Encode packs sound of one channel and sets flags of loop or end of sound.
+// loopStart < 0 means sound without loop, otherwise loop start is aligned down
+// and loop end (exclusive) aligned up to 28 samples block, samples after loop are dropped
+func Encode(samples []int16, loopStart, loopEnd int) []byte {
+	blocks := (len(samples) + BLOCK_SAMPLES - 1) / BLOCK_SAMPLES
+	if blocks == 0 {
+		blocks = 1
+	}
+	loopStartBlock, loopEndBlock := -1, -1
+	if loopStart >= 0 && loopEnd > loopStart {
+		loopStartBlock = loopStart / BLOCK_SAMPLES
+		loopEndBlock = (loopEnd - 1) / BLOCK_SAMPLES
+		if loopEndBlock < blocks {
+			blocks = loopEndBlock + 1
+		}
+	}
+
+	e := NewAdpcmEncoder()
+	result := make([]byte, 0, blocks*BLOCK_SIZE)
+	for iBlock := 0; iBlock < blocks; iBlock++ {
+		var flags byte
+		if loopStartBlock >= 0 {
+			if iBlock >= loopStartBlock {
+				flags |= FLAG_LOOP_REPEAT
+			}
+			if iBlock == loopStartBlock {
+				flags |= FLAG_LOOP_START
+			}
+			if iBlock == blocks-1 {
+				flags |= FLAG_LOOP_END
+			}
+		} else if iBlock == blocks-1 {
+			flags = FLAG_LOOP_END
+		}
+
+		var blockSamples []int16
+		if start := iBlock * BLOCK_SAMPLES; start < len(samples) {
+			end := start + BLOCK_SAMPLES
+			if end > len(samples) {
+				end = len(samples)
+			}
+			blockSamples = samples[start:end]
+		}
+		block := e.EncodeBlock(blockSamples, flags)
+		result = append(result, block[:]...)
+	}
+	return result
+}
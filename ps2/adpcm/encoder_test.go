@@ -0,0 +1,91 @@
+package adpcm
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func sine(count int, period float64, amplitude float64) []int16 {
+	samples := make([]int16, count)
+	for i := range samples {
+		samples[i] = int16(math.Sin(float64(i)*2*math.Pi/period) * amplitude)
+	}
+	return samples
+}
+
+func TestEncodeDecode(t *testing.T) {
+	samples := sine(28*50+5, 37.3, 20000)
+	packed := Encode(samples, -1, 0)
+	if len(packed) != WaveSamplesToAdpcmSize(len(samples)) {
+		t.Fatalf("Wrong encoded size %d", len(packed))
+	}
+
+	wave, err := NewAdpcmStream().Unpack(packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var signal, noise float64
+	for i, s := range samples {
+		d := float64(int16(binary.LittleEndian.Uint16(wave[i*2:])))
+		signal += float64(s) * float64(s)
+		noise += (float64(s) - d) * (float64(s) - d)
+	}
+	if snr := 10 * math.Log10(signal/noise); snr < 30 {
+		t.Errorf("Signal to noise ratio is too low: %.1f dB", snr)
+	}
+}
+
+func TestEncodeFlags(t *testing.T) {
+	samples := sine(28*10, 50, 1000)
+
+	packed := Encode(samples, -1, 0)
+	for i := 0; i < len(packed); i += BLOCK_SIZE {
+		expected := byte(0)
+		if i == len(packed)-BLOCK_SIZE {
+			expected = FLAG_LOOP_END
+		}
+		if packed[i+1] != expected {
+			t.Errorf("Block %d of sound without loop has flags %x", i/BLOCK_SIZE, packed[i+1])
+		}
+	}
+
+	// loop from block 2 to block 6, blocks after loop are dropped
+	packed = Encode(samples, 28*2+3, 28*6+10)
+	expected := []byte{0, 0, 6, 2, 2, 2, 3}
+	if len(packed) != len(expected)*BLOCK_SIZE {
+		t.Fatalf("Wrong looped sound size %d", len(packed))
+	}
+	for i, flags := range expected {
+		if packed[i*BLOCK_SIZE+1] != flags {
+			t.Errorf("Block %d of looped sound has flags %x instead of %x", i, packed[i*BLOCK_SIZE+1], flags)
+		}
+	}
+}
+
+func TestUnpackLooped(t *testing.T) {
+	samples := sine(28*10, 50, 1000)
+	packed := Encode(samples, 28*4, 28*8)
+	// garbage after end of sound must be ignored
+	packed = append(packed, 0x0c, 0, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77, 0x77)
+
+	wave, loopStart, loopEnd, err := UnpackLooped(packed, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loopStart != 28*4 || loopEnd != 28*8 {
+		t.Errorf("Wrong loop %d-%d", loopStart, loopEnd)
+	}
+	if len(wave) != (28*8+28*4*2)*2 {
+		t.Errorf("Wrong size of sound with 3 loops %d", len(wave))
+	}
+
+	wave, loopStart, _, err = UnpackLooped(Encode(samples, -1, 0), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loopStart != -1 || len(wave) != len(samples)*2 {
+		t.Errorf("Sound without loop decoded wrong: loop %d, size %d", loopStart, len(wave))
+	}
+}
@@ -4,58 +4,174 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/mogaika/god_of_war_browser/ps2/adpcm"
 	"github.com/mogaika/god_of_war_browser/utils"
 )
 
+const (
+	VAGP_MAGIC       = "VAGp"
+	VAGP_VERSION     = 0x20
+	VAGP_HEADER_SIZE = 0x30
+
+	// used for multichannel files without interleave in header
+	VAGP_DEFAULT_INTERLEAVE = 0x10
+	// interleave of multichannel files written by us
+	VAGP_WRITE_INTERLEAVE = 0x800
+)
+
 type VAGP struct {
-	WaveData   []byte `json:"-"`
+	WaveData   []byte `json:"-"` // interleaved adpcm of all channels
+	Name       string
 	Channels   byte
 	SampleRate uint32
+	Interleave uint32 // bytes of one channel before next channel data, used if Channels > 1
 }
 
 func NewVAGPFromReader(r io.Reader) (*VAGP, error) {
-	var buf [0x30]byte
-	if _, err := r.Read(buf[:]); err != nil {
+	var buf [VAGP_HEADER_SIZE]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
 		return nil, err
 	}
 
-	if bytes.Compare([]byte{0x56, 0x41, 0x47, 0x70}, buf[:4]) != 0 {
+	if !bytes.Equal([]byte(VAGP_MAGIC), buf[:4]) {
 		return nil, errors.New("Magic not matched")
 	}
 
 	vagp := &VAGP{
 		Channels:   buf[0x1E],
+		Name:       utils.BytesToString(buf[0x20:0x30]),
 		SampleRate: binary.BigEndian.Uint32(buf[0x10:0x14]),
+		Interleave: binary.BigEndian.Uint32(buf[0x8:0xC]),
 		WaveData:   make([]byte, binary.BigEndian.Uint32(buf[0xC:0x10])),
 	}
+	// zero in most of mono files
+	if vagp.Channels == 0 {
+		vagp.Channels = 1
+	}
+	if vagp.Interleave == 0 {
+		vagp.Interleave = VAGP_DEFAULT_INTERLEAVE
+	}
+	if vagp.SampleRate == 0 {
+		return nil, fmt.Errorf("Invalid sample rate 0")
+	}
+	if vagp.Channels > 1 && (vagp.Interleave%adpcm.BLOCK_SIZE != 0 ||
+		len(vagp.WaveData)%(int(vagp.Interleave)*int(vagp.Channels)) != 0) {
+		return nil, fmt.Errorf("Invalid interleave 0x%x of %d channels with data size 0x%x",
+			vagp.Interleave, vagp.Channels, len(vagp.WaveData))
+	}
 
-	if _, err := r.Read(vagp.WaveData); err != nil {
+	if _, err := io.ReadFull(r, vagp.WaveData); err != nil {
 		return nil, err
 	}
 
 	return vagp, nil
 }
 
+// ChannelData returns adpcm of one channel
+func (vagp *VAGP) ChannelData(channel int) []byte {
+	if vagp.Channels <= 1 {
+		return vagp.WaveData
+	}
+	interleave := int(vagp.Interleave)
+	step := interleave * int(vagp.Channels)
+	result := make([]byte, 0, len(vagp.WaveData)/int(vagp.Channels))
+	for pos := channel * interleave; pos < len(vagp.WaveData); pos += step {
+		result = append(result, vagp.WaveData[pos:pos+interleave]...)
+	}
+	return result
+}
+
 func (vagp *VAGP) AsWave() (*bytes.Buffer, error) {
-	if vagp.Channels > 1 {
-		panic("Not mono not supported")
+	channels := int(vagp.Channels)
+	if channels < 1 {
+		channels = 1
 	}
 
-	var buf bytes.Buffer
+	// decoding stops at end flag, loop of first channel written to smpl chunk
+	pcm := make([][]byte, channels)
+	var loopStart, loopEnd int
+	size := 0
+	for i := range pcm {
+		var err error
+		var start, end int
+		if pcm[i], start, end, err = adpcm.UnpackLooped(vagp.ChannelData(i), 1); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			loopStart, loopEnd = start, end
+		}
+		if len(pcm[i]) > size {
+			size = len(pcm[i])
+		}
+	}
 
-	//WaveWriteHeader(w io.Writer, channels int16, sampleRate uint32, dataSize uint32) error {
-	if err := utils.WaveWriteHeader(&buf, 1, vagp.SampleRate, uint32((len(vagp.WaveData)/16)*28*2)); err != nil {
+	var buf bytes.Buffer
+	if err := utils.WaveWriteHeaderLoop(&buf, uint16(channels), vagp.SampleRate, uint32(size*channels), loopStart, loopEnd); err != nil {
 		return nil, err
 	}
 
-	adpcmstream := adpcm.NewAdpcmToWaveStream(&buf)
-	_, err := adpcmstream.Write(vagp.WaveData)
-	if err != nil {
-		return nil, err
+	// interleave 16 bit samples of channels, shorter channels padded with silence
+	for i := range pcm {
+		pcm[i] = append(pcm[i], make([]byte, size-len(pcm[i]))...)
+	}
+	for pos := 0; pos < size; pos += 2 {
+		for i := range pcm {
+			buf.Write(pcm[i][pos : pos+2])
+		}
 	}
 
 	return &buf, nil
 }
+
+// NewVAGPFromWave encodes wave to adpcm, loop of wave is kept
+func NewVAGPFromWave(wav *utils.Wave, name string) (*VAGP, error) {
+	if wav.Channels == 0 || wav.Channels > 0xff {
+		return nil, fmt.Errorf("Invalid channels count %d", wav.Channels)
+	}
+
+	vagp := &VAGP{
+		Name:       name,
+		Channels:   byte(wav.Channels),
+		SampleRate: wav.SampleRate,
+	}
+
+	streams := make([][]byte, wav.Channels)
+	for i := range streams {
+		// sound starts with silent block, as in original files
+		streams[i] = append(make([]byte, adpcm.BLOCK_SIZE), adpcm.Encode(wav.Samples[i], wav.LoopStart, wav.LoopEnd)...)
+	}
+
+	if vagp.Channels == 1 {
+		vagp.WaveData = streams[0]
+		return vagp, nil
+	}
+
+	vagp.Interleave = VAGP_WRITE_INTERLEAVE
+	interleave := int(vagp.Interleave)
+	for pos := 0; pos < len(streams[0]); pos += interleave {
+		for _, stream := range streams {
+			chunk := make([]byte, interleave)
+			copy(chunk, stream[pos:])
+			vagp.WaveData = append(vagp.WaveData, chunk...)
+		}
+	}
+	return vagp, nil
+}
+
+func (vagp *VAGP) Marshal() []byte {
+	var header [VAGP_HEADER_SIZE]byte
+	copy(header[:], VAGP_MAGIC)
+	binary.BigEndian.PutUint32(header[0x4:], VAGP_VERSION)
+	if vagp.Channels > 1 {
+		binary.BigEndian.PutUint32(header[0x8:], vagp.Interleave)
+		header[0x1E] = vagp.Channels
+	}
+	binary.BigEndian.PutUint32(header[0xC:], uint32(len(vagp.WaveData)))
+	binary.BigEndian.PutUint32(header[0x10:], vagp.SampleRate)
+	copy(header[0x20:0x2F], vagp.Name)
+
+	return append(header[:], vagp.WaveData...)
+}
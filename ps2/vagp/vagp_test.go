@@ -0,0 +1,49 @@
+package vagp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+func TestStereoRoundTrip(t *testing.T) {
+	wav := &utils.Wave{Channels: 2, SampleRate: 22050, LoopStart: -1, Samples: make([][]int16, 2)}
+	for ch := range wav.Samples {
+		wav.Samples[ch] = make([]int16, 3000)
+		for i := range wav.Samples[ch] {
+			// channels differ, so swapped channels are detected
+			wav.Samples[ch][i] = int16((i%100 - 50) * 100 * (ch*2 - 1))
+		}
+	}
+
+	vag, err := NewVAGPFromWave(wav, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := NewVAGPFromReader(bytes.NewReader(vag.Marshal()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Channels != 2 || parsed.SampleRate != 22050 || parsed.Name != "test" || parsed.Interleave != VAGP_WRITE_INTERLEAVE {
+		t.Fatalf("Wrong header %+v", parsed)
+	}
+
+	buf, err := parsed.AsWave()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := utils.WaveRead(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// first 28 samples are silent block
+	for ch := range wav.Samples {
+		for _, i := range []int{10, 777, 2999} {
+			expected, got := int(wav.Samples[ch][i]), int(decoded.Samples[ch][i+28])
+			if got-expected > 500 || expected-got > 500 {
+				t.Errorf("Channel %d sample %d is %d instead of %d", ch, i, got, expected)
+			}
+		}
+	}
+}
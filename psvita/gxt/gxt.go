@@ -1,6 +1,7 @@
 package gxt
 
 import (
+	"bytes"
 	"encoding/binary"
 	"image"
 	"io"
@@ -58,33 +59,53 @@ func (g *GXT) parseTextureInfo(r io.Reader, ti *TextureInfo) error {
 	return nil
 }
 
-func (ti *TextureInfo) ToImage(r io.ReadSeeker) (image.Image, error) {
+const (
+	FORMAT_DXT1 = 0x85000000
+	FORMAT_DXT5 = 0x87000000
+
+	TYPE_SWIZZLED = 0
+
+	// alignment of texture data inside gxt
+	DATA_ALIGN = 0x10
+)
+
+// Data returns raw data of texture including mipmaps
+func (ti *TextureInfo) Data(r io.ReadSeeker) ([]byte, error) {
 	if _, err := r.Seek(int64(ti.Offset), os.SEEK_SET); err != nil {
 		return nil, errors.Wrapf(err, "Failed to seek")
 	}
 
 	data := make([]byte, ti.Size)
 
-	if _, err := r.Read(data); err != nil {
+	if _, err := io.ReadFull(r, data); err != nil {
 		return nil, errors.Wrapf(err, "Failed to read")
 	}
 
+	return data, nil
+}
+
+func (ti *TextureInfo) ToImage(r io.ReadSeeker) (image.Image, error) {
+	data, err := ti.Data(r)
+	if err != nil {
+		return nil, err
+	}
+
 	var img *image.NRGBA
 
 	width := int(ti.Width)
 	height := int(ti.Height)
 
 	switch ti.Format {
-	case 0x87000000: // dxt5
+	case FORMAT_DXT5:
 		img = textureformats.DecompressImageDX5(data, width, height)
-	case 0x85000000: // dxt1
+	case FORMAT_DXT1:
 		img = textureformats.DecompressImageDX1(data, width, height)
 	default:
 		return nil, errors.Errorf("Unsupported image format 0x%x", ti.Format)
 	}
 
 	switch ti.Type {
-	case 0: // swizzled
+	case TYPE_SWIZZLED:
 		img = ImageUnSwizzle(img)
 	default:
 		return nil, errors.Errorf("Unsupported image type 0x%x", ti.Type)
@@ -95,6 +116,90 @@ func (ti *TextureInfo) ToImage(r io.ReadSeeker) (image.Image, error) {
 	return img, nil
 }
 
+func isOpaque(img *image.NRGBA) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if img.NRGBAAt(x, y).A != 0xff {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FromImages encodes image and its mipmaps in format of texture, inverse of ToImage.
+// Size of levels must be power of two. Returns data of texture, Size and
+// dimensions of texture info are updated
+func (ti *TextureInfo) FromImages(levels []*image.NRGBA) ([]byte, error) {
+	if ti.Type != TYPE_SWIZZLED {
+		return nil, errors.Errorf("Unsupported image type 0x%x", ti.Type)
+	}
+
+	var data []byte
+	for i, level := range levels {
+		b := level.Bounds()
+		if b.Dx()&(b.Dx()-1) != 0 || b.Dy()&(b.Dy()-1) != 0 {
+			return nil, errors.Errorf("Size of level %d %dx%d is not power of two", i, b.Dx(), b.Dy())
+		}
+
+		swizzled := ImageSwizzle(level)
+		switch ti.Format {
+		case FORMAT_DXT5:
+			data = append(data, textureformats.CompressImageDX5(swizzled)...)
+		case FORMAT_DXT1:
+			// compressor writes only 4 color blocks, punch-through alpha is not kept
+			if !isOpaque(level) {
+				return nil, errors.Errorf("Level %d has transparent pixels, DXT1 texture cannot keep alpha", i)
+			}
+			data = append(data, textureformats.CompressImageDX1(swizzled)...)
+		default:
+			return nil, errors.Errorf("Unsupported image format 0x%x", ti.Format)
+		}
+	}
+
+	if len(levels) != 0 {
+		ti.Width = uint16(levels[0].Bounds().Dx())
+		ti.Height = uint16(levels[0].Bounds().Dy())
+	}
+	ti.MipMapsCount = uint16(len(levels))
+	ti.Size = uint32(len(data))
+	return data, nil
+}
+
+// Marshal writes gxt with provided data of textures, offsets and sizes updated
+func (g *GXT) Marshal(textures [][]byte) ([]byte, error) {
+	if len(textures) != len(g.TextureInfos) {
+		return nil, errors.Errorf("Textures count %d do not match infos count %d", len(textures), len(g.TextureInfos))
+	}
+
+	headersSize := uint32(binary.Size(g.Header)) + uint32(binary.Size(TextureInfo{})*len(g.TextureInfos))
+	if g.Header.DataOffset < headersSize {
+		g.Header.DataOffset = headersSize
+	}
+
+	var data bytes.Buffer
+	for i, texture := range textures {
+		for data.Len()%DATA_ALIGN != 0 {
+			data.WriteByte(0)
+		}
+		g.TextureInfos[i].Offset = g.Header.DataOffset + uint32(data.Len())
+		g.TextureInfos[i].Size = uint32(len(texture))
+		data.Write(texture)
+	}
+
+	g.Header.TexturesCount = uint32(len(g.TextureInfos))
+	g.Header.DataSize = uint32(data.Len())
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &g.Header)
+	binary.Write(&buf, binary.LittleEndian, g.TextureInfos)
+	buf.Write(make([]byte, g.Header.DataOffset-uint32(buf.Len())))
+	buf.Write(data.Bytes())
+
+	return buf.Bytes(), nil
+}
+
 func Open(r io.Reader) (*GXT, error) {
 	g := &GXT{}
 
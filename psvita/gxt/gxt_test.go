@@ -0,0 +1,64 @@
+package gxt
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestImageRoundTrip(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 8), G: uint8(y * 16), B: 0x40, A: uint8(255 - y*16)})
+		}
+	}
+
+	if _, err := (&TextureInfo{Format: FORMAT_DXT1, Type: TYPE_SWIZZLED}).FromImages([]*image.NRGBA{img}); err == nil {
+		t.Errorf("DXT1 texture with alpha encoded without error")
+	}
+	opaque := image.NewNRGBA(img.Bounds())
+	for i := range img.Pix {
+		opaque.Pix[i] = img.Pix[i]
+		if i%4 == 3 {
+			opaque.Pix[i] = 0xff
+		}
+	}
+
+	for _, format := range []uint32{FORMAT_DXT1, FORMAT_DXT5} {
+		ti := &TextureInfo{Format: format, Type: TYPE_SWIZZLED}
+		src := img
+		if format == FORMAT_DXT1 {
+			src = opaque
+		}
+		data, err := ti.FromImages([]*image.NRGBA{src})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ti.Width != 32 || ti.Height != 16 || ti.Size != uint32(len(data)) {
+			t.Fatalf("Wrong info %+v", ti)
+		}
+
+		result, err := ti.ToImage(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := result.(*image.NRGBA)
+		total := 0
+		for y := 0; y < 16; y++ {
+			for x := 0; x < 32; x++ {
+				a, b := src.NRGBAAt(x, y), res.NRGBAAt(x, y)
+				for _, d := range []int{int(a.R) - int(b.R), int(a.G) - int(b.G), int(a.B) - int(b.B)} {
+					if d < 0 {
+						d = -d
+					}
+					total += d
+				}
+			}
+		}
+		if mean := float64(total) / (32 * 16 * 3); mean > 5 {
+			t.Errorf("Format 0x%x: mean error %v is too big", format, mean)
+		}
+	}
+}
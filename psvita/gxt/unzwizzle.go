@@ -52,3 +52,46 @@ func ImageUnSwizzle(img *image.NRGBA) *image.NRGBA {
 	}
 	return newImage
 }
+
+func part1By1(pos uint32) uint32 {
+	pos &= 0x0000_ffff
+	pos = (pos | (pos << 8)) & 0x00ff_00ff
+	pos = (pos | (pos << 4)) & 0x0f0f_0f0f
+	pos = (pos | (pos << 2)) & 0x3333_3333
+	pos = (pos | (pos << 1)) & 0x5555_5555
+	return pos
+}
+
+// IndexSwizzle is inverse of IndexUnSwizzle
+func IndexSwizzle(x, y, width, height uint32) uint32 {
+	min := width
+	if height < width {
+		min = height
+	}
+
+	k := uint32(bits.TrailingZeros32(min))
+
+	var mx, my, high uint32
+	if height < width {
+		mx, my, high = y, x&(min-1), x>>k
+	} else {
+		mx, my, high = y&(min-1), x, y>>k
+	}
+
+	return (high << (2 * k)) | part1By1(mx) | (part1By1(my) << 1)
+}
+
+// ImageSwizzle is inverse of ImageUnSwizzle
+func ImageSwizzle(img *image.NRGBA) *image.NRGBA {
+	newImage := image.NewNRGBA(img.Rect)
+	width := img.Bounds().Max.X
+	height := img.Bounds().Max.Y
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := IndexSwizzle(uint32(x), uint32(y), uint32(width), uint32(height))
+			newImage.Set(int(i)%width, int(i)/width, img.At(x, y))
+		}
+	}
+	return newImage
+}
@@ -0,0 +1,22 @@
+package gxt
+
+import "testing"
+
+func TestIndexSwizzle(t *testing.T) {
+	for _, size := range [][2]uint32{{16, 16}, {32, 8}, {8, 64}} {
+		w, h := size[0], size[1]
+		seen := make(map[uint32]bool)
+		for y := uint32(0); y < h; y++ {
+			for x := uint32(0); x < w; x++ {
+				i := IndexSwizzle(x, y, w, h)
+				if seen[i] || i >= w*h {
+					t.Fatalf("%dx%d: bad index %d for %d,%d", w, h, i, x, y)
+				}
+				seen[i] = true
+				if rx, ry := IndexUnSwizzle(i, w, h); rx != x || ry != y {
+					t.Errorf("%dx%d: %d,%d -> %d -> %d,%d", w, h, x, y, i, rx, ry)
+				}
+			}
+		}
+	}
+}
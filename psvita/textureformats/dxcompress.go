@@ -0,0 +1,294 @@
+package textureformats
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+)
+
+// Block compressor, inverse of decompressors. Color endpoints are taken along
+// principal axis of block colors and refined once by least squares
+
+const dxRefineIterations = 1
+
+func colorTo565(c [3]float64) uint16 {
+	clamp := func(v float64, max float64) uint16 {
+		return uint16(math.Max(0, math.Min(max, math.Round(v*max/255))))
+	}
+	return clamp(c[0], 31)<<11 | clamp(c[1], 63)<<5 | clamp(c[2], 31)
+}
+
+// dxColorPalette returns 4 colors of block decoded same way as decompressor does
+func dxColorPalette(color0, color1 uint16) [4][3]float64 {
+	r0, g0, b0 := rgb565fromUint16(color0)
+	r1, g1, b1 := rgb565fromUint16(color1)
+	var palette [4][3]float64
+	for code := range palette {
+		r, g, b := dxColorFromPosition(uint32(code), color0, color1, r0, g0, b0, r1, g1, b1)
+		palette[code] = [3]float64{float64(r), float64(g), float64(b)}
+	}
+	return palette
+}
+
+func colorDist(a, b [3]float64) float64 {
+	return (a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2])
+}
+
+// dxColorCodes selects nearest palette color for every pixel, returns codes and error
+func dxColorCodes(colors [][3]float64, color0, color1 uint16) (uint32, float64) {
+	palette := dxColorPalette(color0, color1)
+	code := uint32(0)
+	total := 0.0
+	for i, c := range colors {
+		best, bestDist := 0, math.Inf(1)
+		for j, p := range palette {
+			if d := colorDist(c, p); d < bestDist {
+				best, bestDist = j, d
+			}
+		}
+		code |= uint32(best) << uint(2*i)
+		total += bestDist
+	}
+	return code, total
+}
+
+// dxPrincipalEndpoints returns colors at ends of projection of block to principal axis
+func dxPrincipalEndpoints(colors [][3]float64) ([3]float64, [3]float64) {
+	var mean [3]float64
+	for _, c := range colors {
+		for k := range mean {
+			mean[k] += c[k] / float64(len(colors))
+		}
+	}
+
+	var cov [3][3]float64
+	for _, c := range colors {
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				cov[i][j] += (c[i] - mean[i]) * (c[j] - mean[j])
+			}
+		}
+	}
+
+	// power iteration
+	axis := [3]float64{1, 1, 1}
+	for iter := 0; iter < 8; iter++ {
+		var next [3]float64
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				next[i] += cov[i][j] * axis[j]
+			}
+		}
+		length := math.Sqrt(next[0]*next[0] + next[1]*next[1] + next[2]*next[2])
+		if length < 1e-9 {
+			break
+		}
+		for k := range axis {
+			axis[k] = next[k] / length
+		}
+	}
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, c := range colors {
+		t := (c[0]-mean[0])*axis[0] + (c[1]-mean[1])*axis[1] + (c[2]-mean[2])*axis[2]
+		min = math.Min(min, t)
+		max = math.Max(max, t)
+	}
+	var hi, lo [3]float64
+	for k := range hi {
+		hi[k] = mean[k] + axis[k]*max
+		lo[k] = mean[k] + axis[k]*min
+	}
+	return hi, lo
+}
+
+// dxLeastSquaresEndpoints finds endpoints which best fit selected codes of 4 color mode
+func dxLeastSquaresEndpoints(colors [][3]float64, code uint32) ([3]float64, [3]float64, bool) {
+	weights := [4]float64{1, 0, 2.0 / 3.0, 1.0 / 3.0}
+	var aa, bb, ab float64
+	var ax, bx [3]float64
+	for i, c := range colors {
+		a := weights[(code>>uint(2*i))&3]
+		b := 1 - a
+		aa += a * a
+		bb += b * b
+		ab += a * b
+		for k := range ax {
+			ax[k] += a * c[k]
+			bx[k] += b * c[k]
+		}
+	}
+	det := aa*bb - ab*ab
+	if math.Abs(det) < 1e-9 {
+		return ax, bx, false
+	}
+	var c0, c1 [3]float64
+	for k := range c0 {
+		c0[k] = (ax[k]*bb - bx[k]*ab) / det
+		c1[k] = (bx[k]*aa - ax[k]*ab) / det
+	}
+	return c0, c1, true
+}
+
+// compressBlockDXT1Color writes 8 bytes of color block, always in 4 color mode
+func compressBlockDXT1Color(colors []color.NRGBA, out []byte) {
+	rgb := make([][3]float64, len(colors))
+	for i, c := range colors {
+		rgb[i] = [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+	}
+
+	encode := func(hi, lo [3]float64) (uint16, uint16, uint32, float64) {
+		color0, color1 := colorTo565(hi), colorTo565(lo)
+		if color0 < color1 {
+			color0, color1 = color1, color0
+		}
+		if color0 == color1 {
+			// block of one color, code 3 would be black in 3 color mode
+			palette := dxColorPalette(color0, color1)
+			e := 0.0
+			for _, c := range rgb {
+				e += colorDist(c, palette[0])
+			}
+			return color0, color1, 0, e
+		}
+		code, e := dxColorCodes(rgb, color0, color1)
+		return color0, color1, code, e
+	}
+
+	color0, color1, code, bestErr := encode(dxPrincipalEndpoints(rgb))
+	for iter := 0; iter < dxRefineIterations && color0 != color1; iter++ {
+		hi, lo, ok := dxLeastSquaresEndpoints(rgb, code)
+		if !ok {
+			break
+		}
+		c0, c1, cd, e := encode(hi, lo)
+		if e >= bestErr {
+			break
+		}
+		color0, color1, code, bestErr = c0, c1, cd, e
+	}
+
+	binary.LittleEndian.PutUint16(out[0:], color0)
+	binary.LittleEndian.PutUint16(out[2:], color1)
+	binary.LittleEndian.PutUint32(out[4:], code)
+}
+
+// dxAlphaPalette returns 8 alphas of block decoded same way as decompressor does
+func dxAlphaPalette(alpha0, alpha1 uint32) [8]uint32 {
+	palette := [8]uint32{alpha0, alpha1}
+	for code := uint32(2); code < 8; code++ {
+		if alpha0 > alpha1 {
+			palette[code] = ((8-code)*alpha0 + (code-1)*alpha1) / 7
+		} else if code == 6 {
+			palette[code] = 0
+		} else if code == 7 {
+			palette[code] = 0xff
+		} else {
+			palette[code] = ((6-code)*alpha0 + (code-1)*alpha1) / 5
+		}
+	}
+	return palette
+}
+
+func dxAlphaCodes(colors []color.NRGBA, alpha0, alpha1 uint32) (uint64, int) {
+	palette := dxAlphaPalette(alpha0, alpha1)
+	code := uint64(0)
+	total := 0
+	for i, c := range colors {
+		best, bestDist := 0, math.MaxInt32
+		for j, p := range palette {
+			d := int(c.A) - int(p)
+			if d*d < bestDist {
+				best, bestDist = j, d*d
+			}
+		}
+		code |= uint64(best) << uint(3*i)
+		total += bestDist
+	}
+	return code, total
+}
+
+// compressBlockDXT5Alpha writes 8 bytes of alpha block. Both 8 alphas mode and
+// 6 alphas mode with explicit 0 and 0xff tried, result with smaller error used
+func compressBlockDXT5Alpha(colors []color.NRGBA, out []byte) {
+	min, max := uint32(0xff), uint32(0)
+	// range of alphas except 0 and 0xff
+	innerMin, innerMax := uint32(0xff), uint32(0)
+	for _, c := range colors {
+		a := uint32(c.A)
+		if a < min {
+			min = a
+		}
+		if a > max {
+			max = a
+		}
+		if a != 0 && a != 0xff {
+			if a < innerMin {
+				innerMin = a
+			}
+			if a > innerMax {
+				innerMax = a
+			}
+		}
+	}
+
+	alpha0, alpha1 := max, min
+	code, bestErr := dxAlphaCodes(colors, alpha0, alpha1)
+	if innerMin <= innerMax {
+		if c, e := dxAlphaCodes(colors, innerMin, innerMax); e < bestErr {
+			alpha0, alpha1, code, bestErr = innerMin, innerMax, c, e
+		}
+	}
+
+	out[0], out[1] = byte(alpha0), byte(alpha1)
+	for i := 0; i < 6; i++ {
+		out[2+i] = byte(code >> uint(8*i))
+	}
+}
+
+func compressBlockDXT1(colors []color.NRGBA, out []byte) {
+	compressBlockDXT1Color(colors, out)
+}
+
+func compressBlockDXT5(colors []color.NRGBA, out []byte) {
+	compressBlockDXT5Alpha(colors, out)
+	compressBlockDXT1Color(colors, out[8:])
+}
+
+// compressImageDX gathers blocks of image in same order as decomporessImageDX places them.
+// Size of image rounded to power of two, pixels outside of image are transparent black
+func compressImageDX(img *image.NRGBA, blockSize int, blockmethod func(colors []color.NRGBA, out []byte)) []byte {
+	b := img.Bounds()
+	roundedW := roundToPow2(b.Dx())
+	roundedH := roundToPow2(b.Dy())
+
+	blocks := (roundedW*roundedH + 15) / 16
+	result := make([]byte, blocks*blockSize)
+	colors := make([]color.NRGBA, 4*4)
+
+	for iBlock := 0; iBlock < blocks; iBlock++ {
+		for iColor := range colors {
+			pos := iBlock*4*4 + dxtReplacement[iColor]
+			x, y := pos%roundedW, pos/roundedW
+			if x < b.Dx() && y < b.Dy() {
+				colors[iColor] = img.NRGBAAt(b.Min.X+x, b.Min.Y+y)
+			} else {
+				colors[iColor] = color.NRGBA{}
+			}
+		}
+		blockmethod(colors, result[iBlock*blockSize:])
+	}
+
+	return result
+}
+
+// CompressImageDX1 is inverse of DecompressImageDX1, alpha is ignored
+func CompressImageDX1(img *image.NRGBA) []byte {
+	return compressImageDX(img, 8, compressBlockDXT1)
+}
+
+// CompressImageDX5 is inverse of DecompressImageDX5
+func CompressImageDX5(img *image.NRGBA) []byte {
+	return compressImageDX(img, 0x10, compressBlockDXT5)
+}
@@ -0,0 +1,31 @@
+package textureformats
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestCompressSolidBlock(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	for i := 0; i < 16; i++ {
+		img.SetNRGBA(i%4, i/4, color.NRGBA{R: 0xff, G: 0, B: 0xff, A: 0x80})
+	}
+	result := DecompressImageDX5(CompressImageDX5(img), 4, 4)
+	for i := 0; i < 16; i++ {
+		if c := result.NRGBAAt(i%4, i/4); c != img.NRGBAAt(i%4, i/4) {
+			t.Errorf("Solid block changed at %d: %v", i, c)
+		}
+	}
+}
+
+func TestRgb565Expand(t *testing.T) {
+	for _, c := range []struct {
+		v       uint16
+		r, g, b uint16
+	}{{0x0000, 0, 0, 0}, {0xffff, 255, 255, 255}, {0x8410, 132, 130, 132}, {0x0841, 8, 8, 8}} {
+		if r, g, b := rgb565fromUint16(c.v); r != c.r || g != c.g || b != c.b {
+			t.Errorf("rgb565fromUint16(0x%.4x)=%d,%d,%d; expected %d,%d,%d", c.v, r, g, b, c.r, c.g, c.b)
+		}
+	}
+}
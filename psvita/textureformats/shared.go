@@ -14,18 +14,19 @@ var dxtReplacement = []int{
 	5, 7, 13, 15,
 }
 
+// rgb565fromUint16 expands channels of 565 color to 0-255 with rounding.
+// Earlier bit replication was applied after this scaling too, so already
+// expanded values were shifted again and truncated to byte by caller
+// (for example 5 bit 16 decoded to 65 instead of 132). Only this scaling
+// is kept, encoder selects endpoints by same palette as decoder
 func rgb565fromUint16(v uint16) (r, g, b uint16) {
 	r = (v >> 11) & 0x1f
 	g = (v >> 5) & 0x3f
 	b = (v >> 0) & 0x1f
 
-	 r = uint16(((uint32(r) * 255) + 15) / 31)
-	 g = uint16(((uint32(g) * 255) + 31) / 63)
-	 b = uint16(((uint32(b) * 255) + 15) / 31)
-
-	r = (r << 3) | (r >> 2)
-	g = (g << 2) | (g >> 4)
-	b = (b << 3) | (b >> 2)
+	r = uint16(((uint32(r) * 255) + 15) / 31)
+	g = uint16(((uint32(g) * 255) + 31) / 63)
+	b = uint16(((uint32(b) * 255) + 15) / 31)
 
 	return
 }
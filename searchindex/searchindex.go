@@ -0,0 +1,302 @@
+// Package searchindex collects names and texts of all wad resources
+// of the game to provide global search across files
+package searchindex
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mogaika/god_of_war_browser/jobs"
+	"github.com/mogaika/god_of_war_browser/pack"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+const DEFAULT_RESULTS_LIMIT = 500
+
+type Entry struct {
+	TagId    wad.TagId
+	Tag      uint16
+	Name     string
+	ServerId uint32   `json:",omitempty"`
+	Type     string   `json:",omitempty"` // type of parsed resource
+	Texts    []string `json:",omitempty"` // texts provided by wad.Searchable resources
+}
+
+type FileIndex struct {
+	Size    int64
+	Crc32   uint32
+	Error   string `json:",omitempty"`
+	Entries []Entry
+}
+
+type Index struct {
+	Files map[string]*FileIndex
+}
+
+type Result struct {
+	File     string
+	TagId    wad.TagId
+	Tag      uint16
+	Name     string
+	ServerId uint32 `json:",omitempty"`
+	Type     string `json:",omitempty"`
+	Match    string // matched name or text
+	Link     string // location hash of web browser
+}
+
+var gLock sync.RWMutex
+var gIndex = Index{Files: make(map[string]*FileIndex)}
+var gPath string // empty if indexing is disabled
+
+func isIndexable(name string) bool {
+	return strings.HasSuffix(name, ".WAD") || strings.HasSuffix(name, ".wad_psp2")
+}
+
+// Load reads previously saved index and enables indexing. Later changes are
+// saved to same path. Missing file is not an error, index will be built from scratch
+func Load(path string) error {
+	gLock.Lock()
+	defer gLock.Unlock()
+
+	gPath = path
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("[searchindex] Cannot read '%s': %v", path, err)
+	}
+
+	var index Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return fmt.Errorf("[searchindex] Cannot parse '%s': %v", path, err)
+	}
+	if index.Files != nil {
+		gIndex = index
+	}
+	return nil
+}
+
+func isEnabled() bool {
+	gLock.RLock()
+	defer gLock.RUnlock()
+	return gPath != ""
+}
+
+func save() error {
+	gLock.RLock()
+	path := gPath
+	var data []byte
+	var err error
+	if path != "" {
+		data, err = json.Marshal(&gIndex)
+	}
+	gLock.RUnlock()
+	if path == "" || err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path, data, 0666); err != nil {
+		return fmt.Errorf("[searchindex] Cannot write '%s': %v", path, err)
+	}
+	return nil
+}
+
+func indexNode(w *wad.Wad, node *wad.Node) (e Entry) {
+	e = Entry{TagId: node.Tag.Id, Tag: node.Tag.Tag, Name: node.Tag.Name}
+	if len(node.Tag.Data) == 0 {
+		return e
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[searchindex] Panic when parsing %s:%s: %v", w.Name(), node.Tag.Name, r)
+		}
+	}()
+
+	inst, serverId, err := w.GetInstanceFromNode(node.Id)
+	e.ServerId = serverId
+	if err != nil {
+		return e
+	}
+
+	e.Type = reflect.TypeOf(inst).String()
+	if s, ok := inst.(wad.Searchable); ok {
+		e.Texts = s.SearchTexts()
+	}
+	return e
+}
+
+func indexFile(d vfs.Directory, name string) *FileIndex {
+	fi := &FileIndex{Entries: make([]Entry, 0)}
+
+	var err error
+	if fi.Size, fi.Crc32, err = vfs.DirectoryFileChecksum(d, name); err != nil {
+		fi.Error = err.Error()
+		return fi
+	}
+
+	inst, err := pack.GetInstanceHandler(d, name)
+	if err != nil {
+		fi.Error = err.Error()
+		return fi
+	}
+
+	if w, ok := inst.(*wad.Wad); ok {
+		for _, node := range w.Nodes {
+			fi.Entries = append(fi.Entries, indexNode(w, node))
+		}
+	}
+	return fi
+}
+
+func isUpToDate(d vfs.Directory, name string) bool {
+	gLock.RLock()
+	fi, ok := gIndex.Files[name]
+	gLock.RUnlock()
+	if !ok {
+		return false
+	}
+
+	size, crc, err := vfs.DirectoryFileChecksum(d, name)
+	return err == nil && fi.Size == size && fi.Crc32 == crc
+}
+
+// Build indexes every wad of directory. Files which were not changed
+// since last build (same size and checksum) are not parsed again
+func Build(j *jobs.Job, d vfs.Directory) error {
+	if !isEnabled() {
+		return fmt.Errorf("[searchindex] Indexing is disabled, start browser with -searchindex flag")
+	}
+	files, err := d.List()
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	present := make(map[string]bool)
+	updated := 0
+	for i, name := range files {
+		if j.Cancelled() {
+			break
+		}
+		if !isIndexable(name) {
+			continue
+		}
+		present[name] = true
+
+		j.Progress(float32(i)/float32(len(files)), "Indexing '%s'", name)
+		if isUpToDate(d, name) {
+			continue
+		}
+
+		fi := indexFile(d, name)
+		gLock.Lock()
+		gIndex.Files[name] = fi
+		gLock.Unlock()
+		updated++
+	}
+
+	if !j.Cancelled() {
+		gLock.Lock()
+		for name := range gIndex.Files {
+			if !present[name] {
+				delete(gIndex.Files, name)
+			}
+		}
+		gLock.Unlock()
+	}
+
+	j.SetResult(fmt.Sprintf("%d files reindexed", updated))
+	return save()
+}
+
+// Refresh reindexes single file in background, used after file was changed.
+// Returns started job, or nil if indexing is disabled
+func Refresh(d vfs.Directory, name string) *jobs.Job {
+	if !isEnabled() || !isIndexable(name) {
+		return nil
+	}
+	return jobs.Start("searchindex "+name, func(j *jobs.Job) error {
+		j.Progress(0, "Indexing '%s'", name)
+		fi := indexFile(d, name)
+		gLock.Lock()
+		gIndex.Files[name] = fi
+		gLock.Unlock()
+		return save()
+	})
+}
+
+// Search finds entries which name or texts start with query (case insensitive)
+// or match regular expression if isRegex is set
+func Search(query string, isRegex bool, limit int) ([]Result, error) {
+	var match func(s string) bool
+	if isRegex {
+		re, err := regexp.Compile(query)
+		if err != nil {
+			return nil, fmt.Errorf("[searchindex] Invalid regexp: %v", err)
+		}
+		match = re.MatchString
+	} else {
+		lowerQuery := strings.ToLower(query)
+		match = func(s string) bool {
+			return strings.HasPrefix(strings.ToLower(s), lowerQuery)
+		}
+	}
+	if limit <= 0 {
+		limit = DEFAULT_RESULTS_LIMIT
+	}
+
+	gLock.RLock()
+	defer gLock.RUnlock()
+
+	names := make([]string, 0, len(gIndex.Files))
+	for name := range gIndex.Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]Result, 0)
+	for _, name := range names {
+		for _, e := range gIndex.Files[name].Entries {
+			matched, found := e.Name, match(e.Name)
+			for i := 0; !found && i < len(e.Texts); i++ {
+				matched, found = e.Texts[i], match(e.Texts[i])
+			}
+			if !found {
+				continue
+			}
+
+			results = append(results, Result{
+				File:     name,
+				TagId:    e.TagId,
+				Tag:      e.Tag,
+				Name:     e.Name,
+				ServerId: e.ServerId,
+				Type:     e.Type,
+				Match:    matched,
+				Link:     fmt.Sprintf("#/%s/%d", name, e.TagId),
+			})
+			if len(results) >= limit {
+				return results, nil
+			}
+		}
+	}
+	return results, nil
+}
+
+// FilesCount returns amount of indexed files
+func FilesCount() int {
+	gLock.RLock()
+	defer gLock.RUnlock()
+	return len(gIndex.Files)
+}
@@ -0,0 +1,86 @@
+package searchindex
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mogaika/god_of_war_browser/config"
+	"github.com/mogaika/god_of_war_browser/jobs"
+	"github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+func testWad(names ...string) []byte {
+	var buf bytes.Buffer
+	for _, name := range names {
+		t := wad.Tag{Tag: wad.TAG_GOW1_FILE_RAW_DATA, Name: name, Data: []byte{1, 2, 3}, Size: 3}
+		buf.Write(wad.MarshalTag(&t))
+		buf.Write(t.Data)
+		buf.Write(make([]byte, (buf.Len()+15)/16*16-buf.Len()))
+	}
+	return buf.Bytes()
+}
+
+func waitJob(t *testing.T, j *jobs.Job) {
+	for start := time.Now(); j.Info().State == jobs.STATE_RUNNING; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 10*time.Second {
+			t.Fatalf("Job %s is not finished", j.Info().Name)
+		}
+	}
+	if info := j.Info(); info.State != jobs.STATE_DONE {
+		t.Fatalf("Job %s failed: %s", info.Name, info.Error)
+	}
+}
+
+func TestRefreshAndSearch(t *testing.T) {
+	config.SetGOWVersion(config.GOW1)
+	dir, err := ioutil.TempDir("", "searchindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "TEST.WAD"), testWad("MSH_first", "MSH_second", "RAW_third"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	d := vfs.NewDirectoryDriver(dir)
+
+	gPath = ""
+	if j := Refresh(d, "TEST.WAD"); j != nil {
+		t.Fatalf("Refresh() started job while indexing is disabled")
+	}
+
+	indexPath := filepath.Join(dir, "index.json")
+	if err := Load(indexPath); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { gPath = "" }()
+	if j := Refresh(d, "README.txt"); j != nil {
+		t.Errorf("Refresh() started job for not wad file")
+	}
+	waitJob(t, Refresh(d, "TEST.WAD"))
+
+	results, err := Search("msh_", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].Name != "MSH_first" || results[1].File != "TEST.WAD" || results[1].Link != "#/TEST.WAD/1" {
+		t.Errorf("Search() = %+v", results)
+	}
+	if results, _ := Search("^RAW|second$", true, 1); len(results) != 1 || results[0].Name != "MSH_second" {
+		t.Errorf("Search() with regex and limit = %+v", results)
+	}
+	if _, err := Search("[", true, 0); err == nil {
+		t.Errorf("Search() with invalid regex returned nil error")
+	}
+
+	if _, err := os.Stat(indexPath); err != nil {
+		t.Errorf("Index was not saved: %v", err)
+	}
+	if FilesCount() != 1 {
+		t.Errorf("FilesCount() = %d", FilesCount())
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/mogaika/god_of_war_browser/utils/structlayout"
+
+	_ "github.com/mogaika/god_of_war_browser/drivers/toc"
+	_ "github.com/mogaika/god_of_war_browser/pack/wad"
+	_ "github.com/mogaika/god_of_war_browser/pack/wad/cam"
+	_ "github.com/mogaika/god_of_war_browser/pack/wad/inst"
+	_ "github.com/mogaika/god_of_war_browser/pack/wad/light"
+	_ "github.com/mogaika/god_of_war_browser/pack/wad/mat"
+	_ "github.com/mogaika/god_of_war_browser/pack/wad/txr"
+)
+
+func main() {
+	var outDir, format string
+	var list bool
+	flag.StringVar(&outDir, "out", "templates", "Output directory")
+	flag.StringVar(&format, "format", "all", "Template format (ksy, bt, all)")
+	flag.BoolVar(&list, "list", false, "List known structures")
+	flag.Parse()
+
+	if list {
+		for _, l := range structlayout.List() {
+			log.Printf("%-20s %s", l.Name, l.Title)
+		}
+		return
+	}
+
+	if format != "all" && format != "ksy" && format != "bt" {
+		log.Fatalf("Unknown format %q", format)
+	}
+
+	if err := os.MkdirAll(outDir, 0777); err != nil {
+		log.Fatalf("Cannot create output directory: %v", err)
+	}
+
+	for _, l := range structlayout.List() {
+		if format == "all" || format == "ksy" {
+			write(filepath.Join(outDir, l.Name+".ksy"), l.Kaitai())
+		}
+		if format == "all" || format == "bt" {
+			write(filepath.Join(outDir, l.Name+".bt"), l.Template010())
+		}
+	}
+}
+
+func write(path string, data []byte) {
+	if err := ioutil.WriteFile(path, data, 0666); err != nil {
+		log.Fatalf("Cannot write %q: %v", path, err)
+	}
+	log.Printf("Written %q", path)
+}
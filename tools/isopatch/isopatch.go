@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/patch"
+)
+
+func openImage(path string) (*os.File, int64) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return f, info.Size()
+}
+
+func main() {
+	var originalPath, modifiedPath, patchPath, outPath, format, description string
+
+	flag.StringVar(&originalPath, "original", "", "Original (clean) image")
+	flag.StringVar(&modifiedPath, "modified", "", "Modified image, patch is created if provided")
+	flag.StringVar(&patchPath, "patch", "", "Patch file")
+	flag.StringVar(&outPath, "out", "", "Result image, patch is applied if provided")
+	flag.StringVar(&format, "format", "", "Patch format (bps, ppf), detected by patch extension by default")
+	flag.StringVar(&description, "description", "", "Description stored in patch")
+	flag.Parse()
+
+	if originalPath == "" || patchPath == "" || (modifiedPath == "") == (outPath == "") {
+		flag.PrintDefaults()
+		log.Fatalf("Provide -original, -patch and one of -modified or -out arguments")
+	}
+
+	original, originalSize := openImage(originalPath)
+	defer original.Close()
+
+	if modifiedPath != "" {
+		if format == "" {
+			format = strings.TrimPrefix(strings.ToLower(filepath.Ext(patchPath)), ".")
+		}
+		modified, modifiedSize := openImage(modifiedPath)
+		defer modified.Close()
+
+		f, err := os.Create(patchPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+
+		if err := patch.Create(nil, format, original, originalSize, modified, modifiedSize, description, f); err != nil {
+			log.Fatalf("Failed to create patch: %v", err)
+		}
+		log.Printf("Patch '%s' created", patchPath)
+	} else {
+		data, err := ioutil.ReadFile(patchPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		out, err := os.Create(outPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer out.Close()
+
+		size, err := patch.Apply(nil, data, original, originalSize, out)
+		if err != nil {
+			log.Fatalf("Failed to apply patch: %v", err)
+		}
+		if err := out.Truncate(size); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Patched image '%s' (%d bytes) created", outPath, size)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/pack"
+	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/vfs"
+)
+
+func openWad(rootfs vfs.Directory, name string) (*file_wad.Wad, error) {
+	data, err := pack.GetInstanceHandler(rootfs, name)
+	if err != nil {
+		return nil, err
+	}
+	if wad, ok := data.(*file_wad.Wad); ok {
+		return wad, nil
+	}
+	return nil, fmt.Errorf("'%s' is not wad", name)
+}
+
+// transplant copies node with all dependencies between wads.
+// Argument format is SOURCE.WAD:NODE_NAME:TARGET.WAD
+func transplant(rootfs vfs.Directory, arg string) error {
+	parts := strings.Split(arg, ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("Transplant argument '%s' must be in format SOURCE.WAD:NODE_NAME:TARGET.WAD", arg)
+	}
+
+	src, err := openWad(rootfs, parts[0])
+	if err != nil {
+		return err
+	}
+	tag := src.GetTagByName(parts[1], 0, true)
+	if tag == nil {
+		return fmt.Errorf("Cannot find '%s' in '%s'", parts[1], parts[0])
+	}
+	dst, err := openWad(rootfs, parts[2])
+	if err != nil {
+		return err
+	}
+
+	res, err := file_wad.Transplant(src, tag.Id, dst, -1)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Transplanted %d tags (%d bytes) of %v to '%s' at tag %d",
+		res.TagsCount, res.DataSize, res.Nodes, res.Target, res.InsertedAt)
+	for oldName, newName := range res.Renamed {
+		log.Printf("  renamed '%s' => '%s'", oldName, newName)
+	}
+	if res.Heap != "" {
+		log.Printf("  heap '%s' increased by %d bytes", res.Heap, res.DataSize)
+	}
+	for _, warn := range res.Warnings {
+		log.Printf("  warning: %s", warn)
+	}
+	return nil
+}
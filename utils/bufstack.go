@@ -159,6 +159,40 @@ func (bs *BufStack) StringTree() string {
 	return bs.stringTree(0)
 }
 
+type BufStackRegion struct {
+	Id             int
+	Parent         int // -1 for root
+	Depth          int
+	Kind           string
+	Name           string
+	Offset         int // absolute
+	RelativeOffset int
+	Size           int // 0 if size unknown
+}
+
+func (bs *BufStack) layout(parent int, depth int, regions []BufStackRegion) []BufStackRegion {
+	id := len(regions)
+	regions = append(regions, BufStackRegion{
+		Id:             id,
+		Parent:         parent,
+		Depth:          depth,
+		Kind:           bs.kind,
+		Name:           bs.name,
+		Offset:         bs.absoluteOffset,
+		RelativeOffset: bs.relativeOffset,
+		Size:           bs.size,
+	})
+	for _, child := range bs.childs {
+		regions = child.layout(id, depth+1, regions)
+	}
+	return regions
+}
+
+// Layout returns flattened tree of buffer and all sub buffers in depth-first order
+func (bs *BufStack) Layout() []BufStackRegion {
+	return bs.layout(-1, 0, make([]BufStackRegion, 0, 16))
+}
+
 func (bs *BufStack) Raw() []byte {
 	raw := bs.buf[:]
 	if bs.size != 0 {
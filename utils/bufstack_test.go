@@ -0,0 +1,27 @@
+package utils
+
+import "testing"
+
+func TestBufStackLayout(t *testing.T) {
+	bs := NewBufStack("root", make([]byte, 0x40)).SetName("file")
+	hdr := bs.SubBuf("header", 0).SetSize(0x10)
+	hdr.SubBuf("magic", 0).SetSize(4)
+	bs.SubBuf("body", 0x20).Expand()
+
+	layout := bs.Layout()
+	expected := []BufStackRegion{
+		{Id: 0, Parent: -1, Depth: 0, Kind: "root", Name: "file", Offset: 0, Size: 0x40},
+		{Id: 1, Parent: 0, Depth: 1, Kind: "header", Offset: 0, Size: 0x10},
+		{Id: 2, Parent: 1, Depth: 2, Kind: "magic", Offset: 0, Size: 4},
+		{Id: 3, Parent: 0, Depth: 1, Kind: "body", Offset: 0x20, RelativeOffset: 0x20, Size: 0x20},
+	}
+
+	if len(layout) != len(expected) {
+		t.Fatalf("Layout() returned %d regions; expected %d", len(layout), len(expected))
+	}
+	for i := range expected {
+		if layout[i] != expected[i] {
+			t.Errorf("Layout()[%d]=%+v; expected %+v", i, layout[i], expected[i])
+		}
+	}
+}
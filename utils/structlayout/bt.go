@@ -0,0 +1,114 @@
+package structlayout
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+func btTypeName(l *Layout) string {
+	return strings.ToUpper(l.Name)
+}
+
+func (f *Field) btType() string {
+	switch f.Kind {
+	case U8, Bytes:
+		return "ubyte"
+	case U16:
+		return "uint16"
+	case U32:
+		return "uint32"
+	case S32:
+		return "int32"
+	case F32:
+		return "float"
+	case String:
+		return "char"
+	case Struct:
+		return btTypeName(f.Sub)
+	}
+	return ""
+}
+
+func (f *Field) btArraySize() string {
+	count := ""
+	if f.CountField != "" {
+		count = f.CountField
+		if f.Count > 1 {
+			count = fmt.Sprintf("%s * %d", f.CountField, f.Count)
+		}
+	} else if f.Count > 1 {
+		count = fmt.Sprint(f.Count)
+	}
+
+	if f.Kind == String || f.Kind == Bytes {
+		if count != "" {
+			return fmt.Sprintf("[(%s) * %d]", count, f.Size)
+		}
+		return fmt.Sprintf("[%d]", f.Size)
+	}
+	if count != "" {
+		return "[" + count + "]"
+	}
+	return ""
+}
+
+func writeBtStruct(b *bytes.Buffer, l *Layout) {
+	if l.Doc != "" {
+		fmt.Fprintf(b, "// %s\n", strings.ReplaceAll(l.Doc, "\n", "\n// "))
+	}
+	fmt.Fprintf(b, "typedef struct {\n")
+	pos := 0
+	gap := func(to int) {
+		if to > pos {
+			fmt.Fprintf(b, "    ubyte unk_%x[%d];\n", pos, to-pos)
+		}
+	}
+	dynamic := false
+	for i := range l.Fields {
+		f := &l.Fields[i]
+		if !dynamic {
+			gap(f.Offset)
+		}
+		fmt.Fprintf(b, "    %s %s%s;", f.btType(), f.Name, f.btArraySize())
+		if f.Doc != "" {
+			fmt.Fprintf(b, " // %s", f.Doc)
+		}
+		b.WriteByte('\n')
+
+		if f.CountField != "" {
+			dynamic = true
+		}
+		if !dynamic {
+			pos = f.Offset + f.TotalSize()
+		}
+	}
+	if !dynamic && l.Size != 0 {
+		gap(l.Size)
+	}
+	fmt.Fprintf(b, "} %s <optimize=false>;\n\n", btTypeName(l))
+}
+
+// Template010 generates 010 Editor binary template (.bt) of layout
+func (l *Layout) Template010() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "//------------------------------------------------\n")
+	fmt.Fprintf(&b, "//--- 010 Editor Binary Template\n")
+	fmt.Fprintf(&b, "//   File: %s.bt\n", l.Name)
+	if l.Title != "" {
+		fmt.Fprintf(&b, "//  Title: %s\n", l.Title)
+	}
+	fmt.Fprintf(&b, "// Generated by god_of_war_browser tools/formatgen. Do not edit.\n")
+	fmt.Fprintf(&b, "//------------------------------------------------\n")
+	fmt.Fprintf(&b, "LittleEndian();\n\n")
+
+	// sub structures must be declared before usage
+	subs := collectSubLayouts(l, nil)
+	for i := len(subs) - 1; i >= 0; i-- {
+		writeBtStruct(&b, subs[i])
+	}
+	writeBtStruct(&b, l)
+
+	fmt.Fprintf(&b, "%s %s;\n", btTypeName(l), l.Name)
+	return b.Bytes()
+}
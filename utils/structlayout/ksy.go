@@ -0,0 +1,131 @@
+package structlayout
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func (f *Field) ksyType() (string, int) {
+	switch f.Kind {
+	case U8:
+		return "u1", 0
+	case U16:
+		return "u2", 0
+	case U32:
+		return "u4", 0
+	case S32:
+		return "s4", 0
+	case F32:
+		return "f4", 0
+	case String:
+		return "strz", f.Size
+	case Bytes:
+		return "", f.Size
+	case Struct:
+		return f.Sub.Name, 0
+	}
+	return "", 0
+}
+
+func ksyRepeatExpr(f *Field) string {
+	if f.CountField != "" {
+		if f.Count > 1 {
+			return fmt.Sprintf("%s * %d", f.CountField, f.Count)
+		}
+		return f.CountField
+	}
+	if f.Count > 1 {
+		return strconv.Itoa(f.Count)
+	}
+	return ""
+}
+
+func writeKsySeq(b *bytes.Buffer, l *Layout, indent string) {
+	fmt.Fprintf(b, "%sseq:\n", indent)
+	pos := 0
+	gap := func(to int) {
+		if to > pos {
+			fmt.Fprintf(b, "%s  - id: unk_%x\n%s    size: %d\n", indent, pos, indent, to-pos)
+		}
+	}
+	dynamic := false
+	for i := range l.Fields {
+		f := &l.Fields[i]
+		if !dynamic {
+			gap(f.Offset)
+		}
+
+		fmt.Fprintf(b, "%s  - id: %s\n", indent, f.Name)
+		if t, size := f.ksyType(); t != "" {
+			fmt.Fprintf(b, "%s    type: %s\n", indent, t)
+			if size != 0 {
+				fmt.Fprintf(b, "%s    size: %d\n", indent, size)
+			}
+		} else {
+			fmt.Fprintf(b, "%s    size: %d\n", indent, size)
+		}
+		if expr := ksyRepeatExpr(f); expr != "" {
+			fmt.Fprintf(b, "%s    repeat: expr\n%s    repeat-expr: %s\n", indent, indent, expr)
+		}
+		if f.Doc != "" {
+			fmt.Fprintf(b, "%s    doc: %s\n", indent, strconv.Quote(f.Doc))
+		}
+
+		if f.CountField != "" {
+			dynamic = true
+		}
+		if !dynamic {
+			pos = f.Offset + f.TotalSize()
+		}
+	}
+	if !dynamic && l.Size != 0 {
+		gap(l.Size)
+	}
+}
+
+func collectSubLayouts(l *Layout, result []*Layout) []*Layout {
+	for _, f := range l.Fields {
+		if f.Kind != Struct {
+			continue
+		}
+		already := false
+		for _, r := range result {
+			if r.Name == f.Sub.Name {
+				already = true
+			}
+		}
+		if !already {
+			result = collectSubLayouts(f.Sub, append(result, f.Sub))
+		}
+	}
+	return result
+}
+
+// Kaitai generates Kaitai Struct (.ksy) description of layout
+func (l *Layout) Kaitai() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# Generated by god_of_war_browser tools/formatgen. Do not edit.\n")
+	fmt.Fprintf(&b, "meta:\n  id: %s\n", l.Name)
+	if l.Title != "" {
+		fmt.Fprintf(&b, "  title: %s\n", strconv.Quote(l.Title))
+	}
+	fmt.Fprintf(&b, "  endian: le\n  encoding: ASCII\n")
+	if l.Doc != "" {
+		fmt.Fprintf(&b, "doc: |\n  %s\n", strings.ReplaceAll(l.Doc, "\n", "\n  "))
+	}
+	writeKsySeq(&b, l, "")
+
+	if subs := collectSubLayouts(l, nil); len(subs) != 0 {
+		fmt.Fprintf(&b, "types:\n")
+		for _, sub := range subs {
+			fmt.Fprintf(&b, "  %s:\n", sub.Name)
+			if sub.Doc != "" {
+				fmt.Fprintf(&b, "    doc: %s\n", strconv.Quote(sub.Doc))
+			}
+			writeKsySeq(&b, sub, "    ")
+		}
+	}
+	return b.Bytes()
+}
@@ -0,0 +1,231 @@
+// Package structlayout describes fixed-layout little endian structures of game formats.
+// Tables are used by parsers to read fields and by tools/formatgen
+// to generate Kaitai Struct (.ksy) and 010 Editor (.bt) templates.
+package structlayout
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/mogaika/god_of_war_browser/utils"
+)
+
+type Kind int
+
+const (
+	U8 Kind = iota
+	U16
+	U32
+	S32
+	F32
+	String // zero terminated string inside buffer of Size bytes
+	Bytes  // raw buffer of Size bytes
+	Struct // nested structure Sub
+)
+
+// Field offset is unknown, field follows previous one (after dynamic array)
+const OFFSET_FOLLOWING = -1
+
+type Field struct {
+	Name       string // snake_case
+	Offset     int
+	Kind       Kind
+	Size       int    // buffer size for String and Bytes
+	Count      int    // elements count of array, 0 - not array
+	CountField string // name of previous field which contains elements count
+	Sub        *Layout
+	Doc        string
+}
+
+type Layout struct {
+	Name   string // snake_case
+	Title  string
+	Doc    string
+	Size   int // 0 if size is dynamic
+	Fields []Field
+
+	index map[string]int // field name => index in Fields
+}
+
+func New(name, title string, size int, fields ...Field) *Layout {
+	l := &Layout{Name: name, Title: title, Size: size, Fields: fields, index: make(map[string]int, len(fields))}
+	for i := range fields {
+		if _, ok := l.index[fields[i].Name]; ok {
+			log.Panicf("[structlayout] Invalid layout %q: field %q is duplicated", name, fields[i].Name)
+		}
+		l.index[fields[i].Name] = i
+	}
+	if err := l.verify(); err != nil {
+		log.Panicf("[structlayout] Invalid layout %q: %v", name, err)
+	}
+	return l
+}
+
+func (l *Layout) SetDoc(doc string) *Layout {
+	l.Doc = doc
+	return l
+}
+
+func (l *Layout) verify() error {
+	pos := 0
+	dynamic := false
+	for i := range l.Fields {
+		f := &l.Fields[i]
+		if f.Offset == OFFSET_FOLLOWING {
+			if !dynamic {
+				f.Offset = pos
+			}
+		} else {
+			if dynamic {
+				return fmt.Errorf("field %q has fixed offset after dynamic field", f.Name)
+			}
+			if f.Offset < pos {
+				return fmt.Errorf("field %q overlaps previous field (0x%x < 0x%x)", f.Name, f.Offset, pos)
+			}
+		}
+		if f.Kind == Struct && f.Sub == nil {
+			return fmt.Errorf("field %q has no sub layout", f.Name)
+		}
+		if (f.Kind == String || f.Kind == Bytes) && f.Size == 0 {
+			return fmt.Errorf("field %q has no size", f.Name)
+		}
+		if f.CountField != "" {
+			if l.field(f.CountField) == nil {
+				return fmt.Errorf("field %q uses unknown count field %q", f.Name, f.CountField)
+			}
+			dynamic = true
+		}
+		if !dynamic {
+			pos = f.Offset + f.TotalSize()
+		}
+	}
+	if !dynamic && l.Size != 0 && pos > l.Size {
+		return fmt.Errorf("fields size 0x%x > struct size 0x%x", pos, l.Size)
+	}
+	return nil
+}
+
+func (l *Layout) field(name string) *Field {
+	if i, ok := l.index[name]; ok {
+		return &l.Fields[i]
+	}
+	return nil
+}
+
+// Field returns field description by name. Panics if not found,
+// because tables are static and error means programming mistake.
+// Parsers of many small structures should resolve fields once
+func (l *Layout) Field(name string) *Field {
+	if f := l.field(name); f != nil {
+		return f
+	}
+	log.Panicf("[structlayout] Layout %q has no field %q", l.Name, name)
+	return nil
+}
+
+func (f *Field) ElementSize() int {
+	switch f.Kind {
+	case U8:
+		return 1
+	case U16:
+		return 2
+	case U32, S32, F32:
+		return 4
+	case String, Bytes:
+		return f.Size
+	case Struct:
+		return f.Sub.Size
+	default:
+		log.Panicf("[structlayout] Unknown kind %v", f.Kind)
+		return 0
+	}
+}
+
+// TotalSize returns size of field. For arrays with CountField it is size of one element
+func (f *Field) TotalSize() int {
+	if f.Count > 1 && f.CountField == "" {
+		return f.ElementSize() * f.Count
+	}
+	return f.ElementSize()
+}
+
+func (f *Field) Raw(buf []byte) []byte {
+	return buf[f.Offset : f.Offset+f.TotalSize()]
+}
+
+func (f *Field) U8(buf []byte) uint8 {
+	return buf[f.Offset]
+}
+
+func (f *Field) U16(buf []byte) uint16 {
+	return binary.LittleEndian.Uint16(buf[f.Offset:])
+}
+
+func (f *Field) U32(buf []byte) uint32 {
+	return binary.LittleEndian.Uint32(buf[f.Offset:])
+}
+
+func (f *Field) S32(buf []byte) int32 {
+	return int32(f.U32(buf))
+}
+
+func (f *Field) F32(buf []byte) float32 {
+	return math.Float32frombits(f.U32(buf))
+}
+
+// U32s reads array of uint32, out length defines amount
+func (f *Field) U32s(buf []byte, out []uint32) {
+	for i := range out {
+		out[i] = binary.LittleEndian.Uint32(buf[f.Offset+i*4:])
+	}
+}
+
+// F32s reads array of floats, out length defines amount
+func (f *Field) F32s(buf []byte, out []float32) {
+	for i := range out {
+		out[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[f.Offset+i*4:]))
+	}
+}
+
+func (f *Field) String(buf []byte) string {
+	return utils.BytesToString(buf[f.Offset : f.Offset+f.Size])
+}
+
+func (f *Field) PutU16(buf []byte, v uint16) {
+	binary.LittleEndian.PutUint16(buf[f.Offset:], v)
+}
+
+func (f *Field) PutU32(buf []byte, v uint32) {
+	binary.LittleEndian.PutUint32(buf[f.Offset:], v)
+}
+
+func (f *Field) PutF32(buf []byte, v float32) {
+	f.PutU32(buf, math.Float32bits(v))
+}
+
+func (f *Field) PutString(buf []byte, s string, nilTerminate bool) {
+	copy(buf[f.Offset:f.Offset+f.Size], utils.StringToBytesBuffer(s, f.Size, nilTerminate))
+}
+
+var gLayouts = make(map[string]*Layout)
+
+// Register adds layout to list of layouts exported by template generator
+func Register(l *Layout) *Layout {
+	if _, ok := gLayouts[l.Name]; ok {
+		log.Panicf("[structlayout] Trying to override layout %q", l.Name)
+	}
+	gLayouts[l.Name] = l
+	return l
+}
+
+func List() []*Layout {
+	result := make([]*Layout, 0, len(gLayouts))
+	for _, l := range gLayouts {
+		result = append(result, l)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
@@ -0,0 +1,120 @@
+package structlayout
+
+import (
+	"strings"
+	"testing"
+)
+
+func testLayout() *Layout {
+	sub := New("test_sub", "", 8,
+		Field{Name: "value", Offset: 0, Kind: F32},
+		Field{Name: "id", Offset: 6, Kind: U16},
+	)
+	return New("test_struct", "Test structure", 0x40,
+		Field{Name: "magic", Offset: 0, Kind: U32, Doc: "always 7"},
+		Field{Name: "name", Offset: 4, Kind: String, Size: 8},
+		Field{Name: "color", Offset: 0x10, Kind: F32, Count: 4},
+		Field{Name: "count", Offset: 0x20, Kind: U32},
+		Field{Name: "items", Offset: 0x24, Kind: Struct, Sub: sub, CountField: "count"},
+		Field{Name: "tail", Offset: OFFSET_FOLLOWING, Kind: U8},
+	)
+}
+
+func TestFieldAccess(t *testing.T) {
+	l := testLayout()
+	buf := make([]byte, 0x40)
+	l.Field("magic").PutU32(buf, 7)
+	l.Field("name").PutString(buf, "TXR_a", true)
+	l.Field("color").PutF32(buf, 0.5)
+
+	if v := l.Field("magic").U32(buf); v != 7 || buf[0] != 7 {
+		t.Errorf("magic = %d", v)
+	}
+	if v := l.Field("name").String(buf); v != "TXR_a" {
+		t.Errorf("name = %q", v)
+	}
+	var color [4]float32
+	l.Field("color").F32s(buf, color[:])
+	if color[0] != 0.5 || color[1] != 0 {
+		t.Errorf("color = %v", color)
+	}
+	if f := l.Field("color"); f.TotalSize() != 16 || len(f.Raw(buf)) != 16 {
+		t.Errorf("Wrong size of array field %d", f.TotalSize())
+	}
+	if f := l.Field("items"); f.TotalSize() != 8 {
+		t.Errorf("Size of dynamic array must be size of element, got %d", f.TotalSize())
+	}
+	if f := l.Field("tail"); f.Offset != OFFSET_FOLLOWING {
+		t.Errorf("Field after dynamic array has offset %d", f.Offset)
+	}
+}
+
+func TestUnknownFieldPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Field() of unknown name did not panic")
+		}
+	}()
+	testLayout().Field("unknown")
+}
+
+func TestVerify(t *testing.T) {
+	for name, fields := range map[string][]Field{
+		"overlap":       {{Name: "a", Offset: 0, Kind: U32}, {Name: "b", Offset: 2, Kind: U16}},
+		"no size":       {{Name: "a", Offset: 0, Kind: String}},
+		"no sub":        {{Name: "a", Offset: 0, Kind: Struct}},
+		"unknown count": {{Name: "a", Offset: 0, Kind: U32, CountField: "n"}},
+		"too big":       {{Name: "a", Offset: 0, Kind: Bytes, Size: 0x20}},
+		"duplicate":     {{Name: "a", Offset: 0, Kind: U8}, {Name: "a", Offset: 1, Kind: U8}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Layout %q is accepted", name)
+				}
+			}()
+			New("invalid", "", 0x10, fields...)
+		}()
+	}
+}
+
+func TestKaitai(t *testing.T) {
+	ksy := string(testLayout().Kaitai())
+	for _, want := range []string{
+		"meta:\n  id: test_struct\n  title: \"Test structure\"\n  endian: le\n",
+		"  - id: magic\n    type: u4\n    doc: \"always 7\"\n",
+		"  - id: name\n    type: strz\n    size: 8\n",
+		"  - id: unk_c\n    size: 4\n",
+		"  - id: color\n    type: f4\n    repeat: expr\n    repeat-expr: 4\n",
+		"  - id: items\n    type: test_sub\n    repeat: expr\n    repeat-expr: count\n",
+		"types:\n  test_sub:\n    seq:\n      - id: value\n        type: f4\n      - id: unk_4\n        size: 2\n",
+	} {
+		if !strings.Contains(ksy, want) {
+			t.Errorf("Kaitai() has no %q:\n%s", want, ksy)
+		}
+	}
+	// size of struct is unknown after dynamic array, so no tail gap
+	if strings.Contains(ksy, "unk_25") || strings.Contains(ksy, "unk_2c") {
+		t.Errorf("Kaitai() has gap after dynamic field:\n%s", ksy)
+	}
+}
+
+func TestTemplate010(t *testing.T) {
+	bt := string(testLayout().Template010())
+	for _, want := range []string{
+		"LittleEndian();\n",
+		"    uint32 magic; // always 7\n",
+		"    char name[8];\n",
+		"    ubyte unk_c[4];\n",
+		"    float color[4];\n",
+		"    TEST_SUB items[count];\n",
+		"} TEST_STRUCT <optimize=false>;\n\nTEST_STRUCT test_struct;\n",
+	} {
+		if !strings.Contains(bt, want) {
+			t.Errorf("Template010() has no %q:\n%s", want, bt)
+		}
+	}
+	if strings.Index(bt, "} TEST_SUB") > strings.Index(bt, "} TEST_STRUCT") {
+		t.Errorf("Sub structure is declared after usage:\n%s", bt)
+	}
+}
@@ -2,11 +2,21 @@ package utils
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 )
 
 func WaveWriteHeader(w io.Writer, channels uint16, sampleRate uint32, dataSize uint32) error {
-	var buf [0x2c]byte
+	return WaveWriteHeaderLoop(w, channels, sampleRate, dataSize, -1, -1)
+}
+
+// WaveWriteHeaderLoop writes header with "smpl" chunk if loopStart >= 0.
+// Loop is in samples, end is exclusive
+func WaveWriteHeaderLoop(w io.Writer, channels uint16, sampleRate uint32, dataSize uint32, loopStart, loopEnd int) error {
+	const smplSize = 36 + 24
+	var buf [0x2c + 8 + smplSize]byte
 	var pos = 0
 
 	write16 := func(v uint16) {
@@ -19,8 +29,13 @@ func WaveWriteHeader(w io.Writer, channels uint16, sampleRate uint32, dataSize u
 		pos += 4
 	}
 
+	headerSize := uint32(36)
+	if loopStart >= 0 {
+		headerSize += 8 + smplSize
+	}
+
 	write32(0x46464952) // "RIFF"
-	write32(36 + dataSize)
+	write32(headerSize + dataSize)
 	write32(0x45564157)                        // "WAVE"
 	write32(0x20746d66)                        // "fmt " chunk
 	write32(16)                                // chunk size
@@ -30,9 +45,161 @@ func WaveWriteHeader(w io.Writer, channels uint16, sampleRate uint32, dataSize u
 	write32(sampleRate * uint32(channels) * 2) // byteRate (sampleRate * channels * bytesPerSample)
 	write16(uint16(channels) * 2)              // blockAlign (channels * bytesPerSample)
 	write16(16)                                // bits per sample
-	write32(0x61746164)                        // "data"
-	write32(dataSize)                          // data chunk size
+	if loopStart >= 0 {
+		write32(0x6c706d73)              // "smpl" chunk
+		write32(smplSize)                // chunk size
+		write32(0)                       // manufacturer
+		write32(0)                       // product
+		write32(1000000000 / sampleRate) // sample period in nanoseconds
+		write32(60)                      // midi unity note
+		write32(0)                       // midi pitch fraction
+		write32(0)                       // smpte format
+		write32(0)                       // smpte offset
+		write32(1)                       // sample loops count
+		write32(0)                       // sampler data
+		write32(0)                       // cue point id
+		write32(0)                       // loop type (forward)
+		write32(uint32(loopStart))       // loop start
+		write32(uint32(loopEnd - 1))     // loop end (inclusive)
+		write32(0)                       // fraction
+		write32(0)                       // play count (infinite)
+	}
+	write32(0x61746164) // "data"
+	write32(dataSize)   // data chunk size
 
-	_, err := w.Write(buf[:])
+	_, err := w.Write(buf[:pos])
 	return err
 }
+
+const (
+	WAVE_FORMAT_PCM        = 1
+	WAVE_FORMAT_FLOAT      = 3
+	WAVE_FORMAT_EXTENSIBLE = 0xfffe
+)
+
+// Wave is decoded wav file, samples converted to 16 bit
+type Wave struct {
+	Channels   uint16
+	SampleRate uint32
+	Samples    [][]int16 // per channel
+	// loop from "smpl" chunk in samples, end is exclusive.
+	// LoopStart is -1 if file has no loop
+	LoopStart int
+	LoopEnd   int
+}
+
+// SamplesCount returns samples count of one channel
+func (wav *Wave) SamplesCount() int {
+	if len(wav.Samples) == 0 {
+		return 0
+	}
+	return len(wav.Samples[0])
+}
+
+// WaveRead parses riff wave file with pcm (8, 16, 24 or 32 bit) or float samples
+func WaveRead(r io.Reader) (*Wave, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("Not a riff wave file")
+	}
+
+	wav := &Wave{LoopStart: -1}
+	var format, bits uint16
+	var samples []byte
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		pos += 8
+		if pos+size > len(data) {
+			// some writers put wrong size of last data chunk
+			size = len(data) - pos
+		}
+		chunk := data[pos : pos+size]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("Invalid fmt chunk size %d", size)
+			}
+			format = binary.LittleEndian.Uint16(chunk[0:])
+			wav.Channels = binary.LittleEndian.Uint16(chunk[2:])
+			wav.SampleRate = binary.LittleEndian.Uint32(chunk[4:])
+			bits = binary.LittleEndian.Uint16(chunk[14:])
+			if format == WAVE_FORMAT_EXTENSIBLE && size >= 26 {
+				// first two bytes of subformat guid
+				format = binary.LittleEndian.Uint16(chunk[24:])
+			}
+		case "data":
+			samples = chunk
+		case "smpl":
+			if size >= 36+24 && binary.LittleEndian.Uint32(chunk[28:]) != 0 {
+				wav.LoopStart = int(binary.LittleEndian.Uint32(chunk[36+8:]))
+				wav.LoopEnd = int(binary.LittleEndian.Uint32(chunk[36+12:])) + 1
+			}
+		}
+		// chunks are aligned to word
+		pos += size + size&1
+	}
+
+	if wav.Channels == 0 || bits == 0 || bits%8 != 0 {
+		return nil, fmt.Errorf("Invalid or missing fmt chunk")
+	}
+	if samples == nil {
+		return nil, fmt.Errorf("Missing data chunk")
+	}
+	if format != WAVE_FORMAT_PCM && !(format == WAVE_FORMAT_FLOAT && bits == 32) {
+		return nil, fmt.Errorf("Unsupported wave format %d with %d bits per sample", format, bits)
+	}
+
+	sampleSize := int(bits / 8)
+	count := len(samples) / (sampleSize * int(wav.Channels))
+	wav.Samples = make([][]int16, wav.Channels)
+	for ch := range wav.Samples {
+		wav.Samples[ch] = make([]int16, count)
+	}
+	for i := 0; i < count; i++ {
+		for ch := range wav.Samples {
+			b := samples[(i*int(wav.Channels)+ch)*sampleSize:]
+			var v int16
+			switch {
+			case format == WAVE_FORMAT_FLOAT:
+				f := math.Float32frombits(binary.LittleEndian.Uint32(b)) * 32767
+				if f > 32767 {
+					f = 32767
+				} else if f < -32768 {
+					f = -32768
+				}
+				v = int16(f)
+			case sampleSize == 1:
+				v = int16(int(b[0])-128) << 8
+			default:
+				// use two most significant bytes
+				v = int16(binary.LittleEndian.Uint16(b[sampleSize-2:]))
+			}
+			wav.Samples[ch][i] = v
+		}
+	}
+	if wav.LoopStart >= count || wav.LoopEnd > count || wav.LoopEnd <= wav.LoopStart {
+		wav.LoopStart, wav.LoopEnd = -1, 0
+	}
+	return wav, nil
+}
+
+// Mono returns average of all channels
+func (wav *Wave) Mono() []int16 {
+	if len(wav.Samples) == 1 {
+		return wav.Samples[0]
+	}
+	result := make([]int16, wav.SamplesCount())
+	for i := range result {
+		var sum int
+		for ch := range wav.Samples {
+			sum += int(wav.Samples[ch][i])
+		}
+		result[i] = int16(sum / len(wav.Samples))
+	}
+	return result
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestWaveRead(t *testing.T) {
+	var buf bytes.Buffer
+	samples := []int16{0, 100, -100, 32767, -32768, 5}
+	WaveWriteHeader(&buf, 2, 44100, uint32(len(samples)*2))
+	binary.Write(&buf, binary.LittleEndian, samples)
+
+	wav, err := WaveRead(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.Channels != 2 || wav.SampleRate != 44100 || wav.SamplesCount() != 3 || wav.LoopStart != -1 {
+		t.Fatalf("Wrong wave header %+v", wav)
+	}
+	for i, s := range samples {
+		if v := wav.Samples[i%2][i/2]; v != s {
+			t.Errorf("Sample %d is %d instead of %d", i, v, s)
+		}
+	}
+}
+
+func TestWaveLoop(t *testing.T) {
+	var buf bytes.Buffer
+	samples := make([]int16, 100)
+	WaveWriteHeaderLoop(&buf, 1, 22050, uint32(len(samples)*2), 28, 84)
+	binary.Write(&buf, binary.LittleEndian, samples)
+
+	wav, err := WaveRead(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wav.SamplesCount() != 100 || wav.LoopStart != 28 || wav.LoopEnd != 84 {
+		t.Fatalf("Wrong wave loop %d-%d (%d samples)", wav.LoopStart, wav.LoopEnd, wav.SamplesCount())
+	}
+}
@@ -2,6 +2,7 @@ package vfs
 
 import (
 	"fmt"
+	"hash/crc32"
 	"io"
 )
 
@@ -40,3 +41,22 @@ func DirectoryGetFile(d Directory, name string) (File, error) {
 		return f.(File), nil
 	}
 }
+
+// DirectoryFileChecksum returns size and crc32 of file data, used to detect changed files
+func DirectoryFileChecksum(d Directory, name string) (int64, uint32, error) {
+	f, err := DirectoryGetFile(d, name)
+	if err != nil {
+		return 0, 0, err
+	}
+	r, err := OpenFileAndGetReader(f, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, r); err != nil {
+		return 0, 0, err
+	}
+	return r.Size(), h.Sum32(), nil
+}
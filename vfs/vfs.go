@@ -35,5 +35,11 @@ type Syncer interface {
 	Sync() error
 }
 
+// RecursiveLister is directory that can list files of all
+// subdirectories, paths are separated by '/'
+type RecursiveLister interface {
+	ListRecursive() ([]string, error)
+}
+
 type ReadSeekerAt interface {
 }
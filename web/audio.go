@@ -0,0 +1,73 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mogaika/god_of_war_browser/pack"
+	file_vpk "github.com/mogaika/god_of_war_browser/pack/vpk"
+	file_vagp "github.com/mogaika/god_of_war_browser/ps2/vagp"
+	"github.com/mogaika/god_of_war_browser/searchindex"
+	"github.com/mogaika/god_of_war_browser/status"
+	"github.com/mogaika/god_of_war_browser/utils"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// HandlerUploadWav encodes uploaded wav file and replaces vag or vpk pack file with it
+func HandlerUploadWav(w http.ResponseWriter, r *http.Request) {
+	targetFile := mux.Vars(r)["file"]
+	fileStream, _, err := r.FormFile("data")
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("File stream getting error: %v", err))
+		return
+	}
+	defer fileStream.Close()
+
+	wav, err := utils.WaveRead(fileStream)
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("Cannot read wav: %v", err))
+		return
+	}
+
+	original, err := pack.GetInstanceHandler(ServerDirectory, targetFile)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	switch v := original.(type) {
+	case *file_vagp.VAGP:
+		vag, err := file_vagp.NewVAGPFromWave(wav, v.Name)
+		if err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+		buf.Write(vag.Marshal())
+	case *file_vpk.VPK:
+		if _, err := file_vpk.EncodeWave(wav, &buf); err != nil {
+			webutils.WriteError(w, err)
+			return
+		}
+	default:
+		webutils.WriteError(w, fmt.Errorf("File %s is not vag or vpk", targetFile))
+		return
+	}
+
+	f, err := vfs.DirectoryGetFile(ServerDirectory, targetFile)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	defer f.Close()
+	if err := vfs.OpenFileAndCopy(f, &buf); err != nil {
+		webutils.WriteError(w, fmt.Errorf("Error when updating pack file: %v", err))
+		return
+	}
+	status.Info("Replaced '%s' with %d channels %d Hz wav", targetFile, wav.Channels, wav.SampleRate)
+	searchindex.Refresh(ServerDirectory, targetFile)
+}
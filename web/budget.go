@@ -0,0 +1,18 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+func HandlerAjaxBudget(w http.ResponseWriter, r *http.Request) {
+	wad, err := getWadFromServerDirectory(mux.Vars(r)["file"])
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	webutils.WriteJson(w, wad.Budget())
+}
@@ -114,6 +114,46 @@ function packLoad() {
     })
 }
 
+function packSearch(query) {
+    let params = new URLSearchParams();
+    if (query.length > 1 && query.startsWith('/') && query.endsWith('/')) {
+        params.append('q', query.slice(1, -1));
+        params.append('regex', '1');
+    } else {
+        params.append('q', query);
+    }
+
+    $.getJSON('/json/search?' + params.toString(), function(data) {
+        if (data.error) {
+            alert('Search error: ' + data.error);
+            return;
+        }
+        dataTree.empty();
+        dataSelectors.empty();
+        setTitle(viewTree, 'Search "' + query + '" (' + data.FilesIndexed + ' files indexed)');
+
+        let table = $('<table>');
+        table.append($('<tr>')
+            .append($('<th>').text('File'))
+            .append($('<th>').text('Tag'))
+            .append($('<th>').text('Name'))
+            .append($('<th>').text('Match')));
+        for (let res of data.Results) {
+            let link = $('<a>').attr('href', res.Link).text(res.Name).click(function(ev) {
+                ev.preventDefault();
+                defferedLoadingWadNode = res.TagId;
+                packLoadFile(res.File);
+            });
+            table.append($('<tr>')
+                .append($('<td>').text(res.File))
+                .append($('<td>').text(res.TagId))
+                .append($('<td>').append(link))
+                .append($('<td>').text(res.Match !== res.Name ? res.Match : '')));
+        }
+        dataTree.append(table);
+    });
+}
+
 function uploadAjaxHandler() {
     var link = $(this).attr("href");
     var form = $('<form action="' + link + '" method="post" enctype="multipart/form-data">');
@@ -199,6 +239,11 @@ function treeLoadVagVpk(filename, data) {
     list.append($("<li>").append("SampleRate: " + data.SampleRate));
     list.append($("<li>").append("Canais: " + data.Channels));
     list.append($("<li>").append($("<a>").attr("href", wavPath).append("Download WAV")));
+    list.append($("<li>").append("Replace with WAV ").append($("<div>")
+        .addClass('button-upload')
+        .attr('title', 'Upload wav, it will be encoded to ' + filename)
+        .attr("href", '/upload/wav/' + filename)
+        .click(uploadAjaxHandler)));
     dataTree.append(list)
 
     dataTree.append($("<audio controls autoplay>").append($("<source>").attr("src", wavPath)));
@@ -249,6 +294,22 @@ function treeLoadWad(wadName, data) {
     dataSelectors.append($('<div class="item-selector">').click(function() {
         treeLoadWadAsTags(wadName, data);
     }).text("Tags"));
+    dataSelectors.append($('<a class="item-selector" download>')
+        .attr('href', '/json/deps/' + wadName + '?external=1&format=dot')
+        .attr('title', 'Download dependency graph in Graphviz format')
+        .text("Deps"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        wadShowUnused(wadName);
+    }).text("Unused"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        wadShowBudget(wadName);
+    }).text("Budget"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        wadShowTextures(wadName);
+    }).text("Textures"));
+    dataSelectors.append($('<div class="item-selector">').click(function() {
+        wadShowGallery(wadName);
+    }).text("Gallery"));
 
     if (wad_last_load_view_type === 'nodes') {
         treeLoadWadAsNodes(wadName, data);
@@ -530,6 +591,11 @@ $(document).ready(function() {
     var itemFilter = localStorage.getItem('item-filter');
     $('#view-pack-filter').on('input', treePackInputFilterHandler).val(packFilter ? packFilter : '.wad');
     $('#view-item-filter').on('input', treeItemInputFilterHandler).val(itemFilter ? itemFilter : '');
+    $('#view-pack-search').on('keydown', function(ev) {
+        if (ev.key === 'Enter' && $(this).val() !== '') {
+            packSearch($(this).val());
+        }
+    });
 
     // URL Parsing
     var urlParts = decodeURI(window.location.hash).split("/");
@@ -584,6 +650,78 @@ function hexdump(buffer, blockSize) {
     return table;
 }
 
+// returns per byte index of deepest layout region covering it (or -1)
+function layoutByteRegions(length, regions) {
+    var owners = new Int32Array(length).fill(-1);
+    for (var i = 0; i < regions.length; i++) {
+        var r = regions[i];
+        var size = r.Size;
+        if (size == 0) {
+            // unknown size, region lasts till next sibling or parent end
+            size = length - r.Offset;
+            for (var j = i + 1; j < regions.length; j++) {
+                if (regions[j].Parent == r.Parent) {
+                    size = regions[j].Offset - r.Offset;
+                    break;
+                }
+            }
+        }
+        for (var b = Math.max(0, r.Offset); b < Math.min(length, r.Offset + size); b++) {
+            if (owners[b] == -1 || regions[owners[b]].Depth <= r.Depth) {
+                owners[b] = i;
+            }
+        }
+    }
+    return owners;
+}
+
+function hexdumpLayout(buffer, regions, blockSize) {
+    var table = $('<table>');
+    blockSize = blockSize || 16;
+    var hex = "0123456789ABCDEF";
+    var owners = layoutByteRegions(buffer.length, regions);
+    var regionColor = function(iRegion) {
+        if (iRegion < 0) {
+            return 'transparent';
+        }
+        return 'hsla(' + ((iRegion * 47) % 360) + ', 70%, 50%, 0.35)';
+    };
+    var regionTitle = function(iRegion) {
+        if (iRegion < 0) {
+            return 'unknown';
+        }
+        var r = regions[iRegion];
+        var title = r.Kind + (r.Name ? '(' + r.Name + ')' : '') + ' @0x' + r.Offset.toString(16) + ' size 0x' + r.Size.toString(16);
+        for (var p = r.Parent; p >= 0; p = regions[p].Parent) {
+            title += ' < ' + regions[p].Kind;
+        }
+        return title;
+    };
+
+    var blocks = Math.ceil(buffer.length / blockSize);
+    for (var iBlock = 0; iBlock < blocks; iBlock += 1) {
+        var blockPos = iBlock * blockSize;
+        var tdHex = $('<td>');
+        var chars = '';
+        for (var j = 0; j < Math.min(blockSize, buffer.length - blockPos); j += 1) {
+            var code = buffer[blockPos + j];
+            var owner = owners[blockPos + j];
+            tdHex.append(' ').append($('<span>')
+                .text(hex[(0xF0 & code) >> 4] + hex[0x0F & code])
+                .attr('title', regionTitle(owner))
+                .css('background-color', regionColor(owner)));
+            chars += (code > 0x20 && code < 0x80) ? String.fromCharCode(code) : '.';
+        }
+
+        var tr = $('<tr>');
+        tr.append($('<td>').append(("000000" + blockPos.toString(16)).slice(-6)));
+        tr.append(tdHex);
+        tr.append($('<td>').text(chars));
+        table.append(tr);
+    }
+    return table;
+}
+
 /* ========================================================================== */
 /* GoW Browser Pro global UI controls                                           */
 /* ========================================================================== */
@@ -272,6 +272,328 @@ function treeLoadWadTag(wad, tagid) {
     tbl.append($('<tr>').append($('<td>')).append($('<td>').append($('<input type="submit" value="Update tag info">'))));
 
     dataSummary.append(form.append(tbl));
+    displayResourceDependencies(wad, tagid);
+
+    let targetInput = $('<input type="text" placeholder="TARGET.WAD">');
+    let transplantButton = $('<input type="button" value="Copy with dependencies to">').click(function() {
+        let target = targetInput.val();
+        if (target === '') {
+            return;
+        }
+        $.getJSON('/transplant/' + wad + '/' + tagid + '?to=' + encodeURIComponent(target), function(res) {
+            if (res.error) {
+                alert('Transplant failed: ' + res.error);
+                return;
+            }
+            let msg = 'Copied ' + res.TagsCount + ' tags (' + res.DataSize + ' bytes) to ' + res.Target;
+            for (let oldName in res.Renamed) {
+                msg += '\nrenamed ' + oldName + ' => ' + res.Renamed[oldName];
+            }
+            for (let warn of res.Warnings) {
+                msg += '\nwarning: ' + warn;
+            }
+            alert(msg);
+        });
+    });
+    dataSummary.append($('<div>').append(transplantButton).append(targetInput));
+
+    let structureAction = function(action, params = {}) {
+        $.post(getActionLinkForWadNode(wad, tagid, action), params, function(res) {
+            if (res.error) {
+                alert('Action ' + action + ' failed: ' + res.error);
+            } else {
+                packLoadFile(wad);
+            }
+        }, 'json');
+    };
+    let posInput = $('<input type="text" class="no-width" placeholder="tag id">');
+    dataSummary.append($('<div>')
+        .append($('<input type="button" value="Delete">').click(function() {
+            if (confirm('Delete node and its group?')) {
+                structureAction('delete');
+            }
+        }))
+        .append($('<input type="button" value="Duplicate">').click(function() {
+            structureAction('duplicate');
+        }))
+        .append($('<input type="button" value="Create group">').click(function() {
+            structureAction('creategroup');
+        }))
+        .append($('<input type="button" value="Move before">').click(function() {
+            structureAction('move', {pos: posInput.val()});
+        }))
+        .append($('<input type="button" value="Move to group">').click(function() {
+            structureAction('movetogroup', {group: posInput.val()});
+        }))
+        .append(posInput));
+}
+
+function wadShowBudget(wad) {
+    dataSummary.empty();
+    setTitle(viewSummary, 'Memory budget of ' + wad);
+    $.getJSON('/json/budget/' + wad, function(b) {
+        if (b.error) {
+            dataSummary.append($('<h5>').text('Error: ' + b.error));
+            return;
+        }
+        let limit = b.Limit ? ', limit ' + b.Limit : '';
+        dataSummary.append($('<h5>').text('Size ' + b.Size + ' bytes, original ' + b.OriginalSize +
+            ' bytes (' + b.Original + ')' + limit));
+        for (let warn of b.Warnings) {
+            dataSummary.append($('<div>').css('color', 'red').text(warn));
+        }
+        let table = $('<table>').append($('<tr>')
+            .append($('<th>').text('Namespace'))
+            .append($('<th>').text('Heap'))
+            .append($('<th>').text('Used'))
+            .append($('<th>').text('Declared'))
+            .append($('<th>').text('Original used'))
+            .append($('<th>').text('Original declared'))
+            .append($('<th>').text('Limit')));
+        for (let h of b.Heaps) {
+            table.append($('<tr>')
+                .append($('<td>').text(h.Namespace))
+                .append($('<td>').append($('<a>').text(h.Name).click(function() {
+                    treeLoadWadNode(wad, h.TagId);
+                })))
+                .append($('<td>').text(h.Used))
+                .append($('<td>').text(h.Declared))
+                .append($('<td>').text(h.Original ? h.Original.Used : ''))
+                .append($('<td>').text(h.Original ? h.Original.Declared : ''))
+                .append($('<td>').text(h.Limit || '')));
+        }
+        dataSummary.append(table);
+    });
+}
+
+function wadShowUnused(wad) {
+    dataSummary.empty();
+    setTitle(viewSummary, 'Unused resources of ' + wad);
+    $.getJSON('/json/unused/' + wad, function(report) {
+        if (report.error) {
+            dataSummary.append($('<h5>').text('Error: ' + report.error));
+            return;
+        }
+        if (report.Users.length !== 0) {
+            dataSummary.append($('<div>').text('References of ' + report.Users.join(', ') + ' checked'));
+        }
+        if (report.Failed.length !== 0) {
+            dataSummary.append($('<h5>').css('color', 'red').text(report.Failed.length +
+                ' nodes failed to parse, their references are unknown so nothing can be removed'));
+            let failed = $('<table>');
+            for (let f of report.Failed) {
+                failed.append($('<tr>')
+                    .append($('<td>').append($('<a>').text(f.Name).click(function() {
+                        treeLoadWadNode(wad, f.TagId);
+                    })))
+                    .append($('<td>').css('color', 'red').text(f.Error)));
+            }
+            dataSummary.append(failed);
+            return;
+        }
+        dataSummary.append($('<h5>').text(report.Nodes.length + ' unused nodes, ' + report.TotalSize + ' bytes'));
+        let table = $('<table>');
+        for (let n of report.Nodes) {
+            table.append($('<tr>')
+                .append($('<td>').append($('<a>').text(n.Name).click(function() {
+                    treeLoadWadNode(wad, n.TagId);
+                })))
+                .append($('<td>').text(n.Type))
+                .append($('<td>').text(n.Size)));
+        }
+        dataSummary.append(table);
+        if (report.Nodes.length !== 0) {
+            dataSummary.append($('<input type="button" value="Remove unused nodes">').click(function() {
+                if (!confirm('Remove ' + report.Nodes.length + ' nodes from ' + wad + '? Wads which do not list ' +
+                        wad + ' in RSRCS are not checked.')) {
+                    return;
+                }
+                $.post('/compact/' + wad, {confirm: 1}, function(res) {
+                    if (res.error) {
+                        alert('Compact failed: ' + res.error);
+                    } else {
+                        packLoadFile(wad);
+                    }
+                }, 'json');
+            }));
+        }
+    });
+}
+
+function waitForJob(job, onDone) {
+    $.getJSON('/json/jobs/' + job.Id, function(j) {
+        if (j.error) {
+            alert('Job failed: ' + j.error);
+        } else if (j.State === 0) {
+            setTimeout(function() {
+                waitForJob(j, onDone);
+            }, 1000);
+        } else {
+            onDone(j);
+        }
+    });
+}
+
+function wadShowTexturesImportSummary(summary) {
+    dataSummary.append($('<h5>').text(summary.Changed + ' changed, ' + summary.Unchanged + ' unchanged, ' +
+        summary.Missing + ' missing, ' + summary.Failed + ' failed, size growth ' + summary.SizeGrowth + ' bytes'));
+    let table = $('<table>').append($('<tr>')
+        .append($('<th>').text('Wad'))
+        .append($('<th>').text('Texture'))
+        .append($('<th>').text('Size before'))
+        .append($('<th>').text('Size after'))
+        .append($('<th>').text('Error')));
+    for (let r of summary.Results) {
+        table.append($('<tr>')
+            .append($('<td>').text(r.Wad))
+            .append($('<td>').text(r.Name + (r.NewPalette ? ' (new palette, original is shared)' : '')))
+            .append($('<td>').text(r.SizeBefore))
+            .append($('<td>').text(r.SizeAfter))
+            .append($('<td>').css('color', 'red').text(r.Error || '')));
+    }
+    dataSummary.append(table);
+}
+
+function wadShowTextures(wad) {
+    dataSummary.empty();
+    setTitle(viewSummary, 'Textures of ' + wad);
+
+    let jobStatus = $('<div>');
+    let startExport = function(params) {
+        $.getJSON('/textures/export?' + params, function(job) {
+            jobStatus.text('Exporting...');
+            waitForJob(job, function(j) {
+                if (j.Error) {
+                    jobStatus.text('Export failed: ' + j.Error);
+                } else {
+                    jobStatus.empty().append($('<a download>').attr('href', '/dump/jobs/' + j.Id)
+                        .text('Download ' + j.ArtifactName + ' (' + j.Result + ')'));
+                }
+            });
+        });
+    };
+
+    let form = $('<form method="post" enctype="multipart/form-data">');
+    form.append($('<input type="file" name="data" accept=".zip">'));
+    form.append($('<input type="button" value="Import changed textures">').click(function() {
+        $.ajax({
+            url: '/textures/import',
+            type: 'post',
+            data: new FormData(form[0]),
+            processData: false,
+            contentType: false,
+            dataType: 'json',
+            success: function(job) {
+                if (job.error) {
+                    alert('Import failed: ' + job.error);
+                    return;
+                }
+                jobStatus.text('Importing...');
+                waitForJob(job, function(j) {
+                    if (j.Error) {
+                        jobStatus.text('Import failed: ' + j.Error);
+                    } else {
+                        jobStatus.text('Import finished');
+                        wadShowTexturesImportSummary(j.Result);
+                    }
+                });
+            }
+        });
+    }));
+
+    dataSummary.append($('<div>')
+        .append($('<input type="button" value="Export textures of wad">').click(function() {
+            startExport('wad=' + encodeURIComponent(wad));
+        }))
+        .append($('<input type="button" value="Export textures of all wads">').click(function() {
+            startExport('');
+        })));
+    dataSummary.append($('<div>').text('Edit png files of exported zip and import it back, only changed images are replaced'));
+    dataSummary.append(form);
+    dataSummary.append(jobStatus);
+}
+
+function wadShowGallery(wad) {
+    dataSummary.empty();
+    setTitle(viewSummary, 'Gallery of ' + wad);
+    $.getJSON('/json/gallery/' + wad, function(g) {
+        if (g.error) {
+            dataSummary.append($('<h5>').text('Error: ' + g.error));
+            return;
+        }
+        let filter = $('<input type="text" placeholder="Filter by name">');
+        let showMaterials = $('<input type="checkbox">');
+        let grid = $('<div>').css({'display': 'flex', 'flex-wrap': 'wrap'});
+        let update = function() {
+            let text = filter.val().toLowerCase();
+            grid.children().each(function() {
+                let $item = $(this);
+                let visible = $item.attr('name').toLowerCase().indexOf(text) !== -1 &&
+                    ($item.attr('kind') === 'txr' || showMaterials.is(':checked'));
+                $item.toggle(visible);
+            });
+        };
+
+        for (let item of g.Items) {
+            let title = item.Kind === 'mat' ? item.Name + ' [' + item.Layer + '] ' + item.Texture : item.Name;
+            let $item = $('<div>').attr('name', title).attr('kind', item.Kind).css({
+                'width': (g.Size + 8) + 'px',
+                'margin': '4px',
+                'text-align': 'center',
+                'cursor': 'pointer',
+                'word-wrap': 'break-word',
+                'font-size': 'smaller'
+            }).click(function() {
+                treeLoadWadNode(wad, item.TagId);
+            });
+            let $thumb = $('<div>').css({'height': g.Size + 'px', 'line-height': g.Size + 'px'});
+            if (item.Thumbnail) {
+                $thumb.append($('<img>').addClass('no-interpolate').css('vertical-align', 'middle')
+                    .attr('src', 'data:image/png;base64,' + item.Thumbnail));
+            }
+            $item.append($thumb).append($('<div>').text(title));
+            if (item.Error) {
+                $item.append($('<div>').css('color', 'red').text(item.Error));
+            } else {
+                $item.append($('<div>').text(item.Width + 'x' + item.Height + ' ' + item.Format));
+            }
+            $item.attr('title', title + (item.Error ? '\n' + item.Error : '\n' + item.Width + 'x' + item.Height + ' ' + item.Format));
+            grid.append($item);
+        }
+
+        filter.on('input', update);
+        showMaterials.change(update);
+        dataSummary.append($('<div>').append(filter)
+            .append($('<label>').append(showMaterials).append(' Materials with blend colors')));
+        dataSummary.append(grid);
+        update();
+    });
+}
+
+function displayResourceDependencies(wad, tagid) {
+    $.getJSON('/json/deps/' + wad + '/' + tagid + '?external=1', function(deps) {
+        if (deps.error) {
+            dataSummary.append($("<h5>").text('Dependencies error: ' + deps.error));
+            return;
+        }
+        let nodesList = function(title, nodes) {
+            let list = $('<ul>');
+            for (let n of nodes) {
+                list.append($('<li>').append($('<a>').text(n.Name + (n.Type ? ' (' + n.Type + ')' : '')).click(function() {
+                    treeLoadWadNode(wad, n.TagId);
+                })));
+            }
+            return $('<div>').append($('<h5>').text(title + ': ' + nodes.length)).append(list);
+        };
+        dataSummary.append(nodesList('Uses', deps.Uses));
+        dataSummary.append(nodesList('Used by', deps.UsedBy));
+        for (let e of deps.External) {
+            dataSummary.append($('<div>').text('External: ' + e.Name + ' from ' + e.Wad));
+        }
+        for (let ref of deps.Unresolved) {
+            dataSummary.append($('<div>').text('Unresolved: ' + ref.Name));
+        }
+    });
 }
 
 function displayResourceHexDump(wad, tagid) {
@@ -285,7 +607,18 @@ function displayResourceHexDump(wad, tagid) {
             fileReader.onload = function() {
                 let arr = new Uint8Array(this.result);
                 dataSummary.append($("<h5>").append('Size in bytes:' + arr.length));
-                dataSummary.append(hexdump(arr));
+                $.getJSON('/json/layout/' + wad + '/' + tagid, function(layout) {
+                    if (layout.error || !layout.Regions) {
+                        dataSummary.append(hexdump(arr));
+                        return;
+                    }
+                    if (layout.ParseError) {
+                        dataSummary.append($("<h5>").text('Layout parse error: ' + layout.ParseError));
+                    }
+                    dataSummary.append(hexdumpLayout(arr, layout.Regions));
+                }).fail(function() {
+                    dataSummary.append(hexdump(arr));
+                });
             };
             fileReader.readAsArrayBuffer(blob);
         }
@@ -770,13 +1103,70 @@ function summaryLoadWadTxr(data, wad, nodeid) {
             .attr('alt', 'gfx:' + img.Gfx + '  pal:' + img.Pal));
     }
 
+    let exportLinks = $('<div>');
+    let exported = {};
+    for (let img of data.Images || []) {
+        let key = img.Gfx + '_' + img.Pal;
+        if (exported[key]) {
+            continue;
+        }
+        exported[key] = true;
+        exportLinks.append($('<span>').text('gfx ' + img.Gfx + ' pal ' + img.Pal + ': '));
+        for (let format of ['dds', 'tga', 'indexed', 'act', 'gpl']) {
+            exportLinks.append($('<a>').text(format + ' ').attr('href',
+                getActionLinkForWadNode(wad, nodeid, 'export', 'format=' + format + '&gfx=' + img.Gfx + '&pal=' + img.Pal)));
+        }
+        exportLinks.append($('<br>'));
+    }
+    dataSummary.append(exportLinks);
+
+    if (data.Data.PalName) {
+        // gfx header do not store psm of high indexes and clut storage mode, so select it manually
+        let decodePsm = $('<select>');
+        for (let psm of ['', 'PSMT8', 'PSMT8H', 'PSMT4', 'PSMT4HL', 'PSMT4HH']) {
+            decodePsm.append($('<option>').val(psm && 'GS_PSM_' + psm).text(psm || 'auto'));
+        }
+        let decodeCsm = $('<select>')
+            .append($('<option>').val('0').text('CSM1'))
+            .append($('<option>').val('1').text('CSM2'));
+        let decodeSwizzled = $('<select>')
+            .append($('<option>').val('').text('auto'))
+            .append($('<option>').val('true').text('swizzled'))
+            .append($('<option>').val('false').text('linear'));
+        let decodeImg = $('<img>').addClass('no-interpolate');
+        let decodeStatus = $('<span>');
+        let img = (data.Images || [{Gfx: 0, Pal: 0}])[0];
+        dataSummary.append($('<div>')
+            .append('Decode as: ').append(decodePsm).append(decodeCsm).append(decodeSwizzled)
+            .append($('<input type="button" value="Decode">').click(function() {
+                let params = 'gfx=' + img.Gfx + '&pal=' + img.Pal + '&csm=' + decodeCsm.val();
+                if (decodePsm.val()) {
+                    params += '&psm=' + decodePsm.val();
+                }
+                if (decodeSwizzled.val()) {
+                    params += '&swizzled=' + decodeSwizzled.val();
+                }
+                decodeStatus.text('');
+                decodeImg.off('error').on('error', function() {
+                    decodeStatus.text('Cannot decode in selected mode');
+                }).attr('src', getActionLinkForWadNode(wad, nodeid, 'decode', params));
+            }))
+            .append(decodeStatus)
+            .append($('<br>'))
+            .append(decodeImg));
+    }
+
     let form = $('<form action="' + getActionLinkForWadNode(wad, nodeid, 'upload') + '" method="post" enctype="multipart/form-data">');
     form.append($('<input type="file" name="img">'));
     let replaceBtn = $('<input type="button" value="Replace texture">')
     replaceBtn.click(function() {
         let form = $(this).parent();
         $.ajax({
-            url: form.attr('action') + "create_new_pal=" + form.find("#create_new_pal")[0].checked,
+            url: form.attr('action') + "create_new_pal=" + form.find("#create_new_pal")[0].checked +
+                "&bpp=" + form.find("#import_bpp").val() +
+                "&quantizer=" + form.find("#import_quantizer").val() +
+                "&dither=" + form.find("#import_dither")[0].checked +
+                "&mipmaps=" + form.find("#import_mipmaps").val(),
             type: 'post',
             data: new FormData(form[0]),
             processData: false,
@@ -792,6 +1182,16 @@ function summaryLoadWadTxr(data, wad, nodeid) {
         });
     });
     form.append(replaceBtn);
+    form.append($('</br><label>Bits per pixel </label>')).append($('<select id="import_bpp">')
+        .append($('<option value="0">').text('keep'))
+        .append($('<option value="8">').text('8 (256 colors)'))
+        .append($('<option value="4">').text('4 (16 colors)')));
+    form.append($('<label> Palette </label>')).append($('<select id="import_quantizer">')
+        .append($('<option value="mediancut">').text('median cut'))
+        .append($('<option value="kmeans">').text('k-means')));
+    form.append($('<label> Dithering </label>')).append($('<input type="checkbox" id="import_dither">'));
+    form.append($('<label> Mip levels (-1 keep existing) </label>'))
+        .append($('<input type="number" id="import_mipmaps" min="-1" max="7" value="-1">'));
     form.append($('</br></br><b>WARNING: Use checkbox below only if you know what you are doing</b></br><input type="checkbox" id="create_new_pal" name="create_new_pal" value="true">'));
     form.append($('<label>Create new palette for replaced texture. Handy if palette used by multiply textures.</label>'));
 
@@ -1100,10 +1500,110 @@ function summaryLoadWadSbk(data, wad, nodeid) {
 
         if (data.IsVagFiles) {
             li.append("<br>").append(wavlink);
+            li.append(' ').append($('<div>')
+                .addClass('button-upload')
+                .attr('title', 'Replace with wav')
+                .attr('href', getActionLinkForWadNode(wad, nodeid, 'replacevag', 'snd=' + snd.Name))
+                .click(uploadAjaxHandler));
+        } else {
+            let bankSound = data.Bank.BankSounds[snd.StreamId];
+            let samples = $('<ul>');
+            for (let cmd of bankSound.Commands) {
+                if (!cmd.SampleRef) {
+                    continue;
+                }
+                let ref = cmd.SampleRef;
+                let params = 'offset=' + ref.AdpcmOffset + '&size=' + ref.AdpcmSize;
+                let audio = $("<audio controls>").attr("preload", "none")
+                    .append($("<source>").attr("src", getActionLinkForWadNode(wad, nodeid, 'smpd', params)));
+                let loopsLink = $('<a>').text('wav x4 loops').attr('href', getActionLinkForWadNode(wad, nodeid, 'smpd', params + '&loops=4'));
+                let rateInput = $('<input type="number" min="1000" max="96000" style="width: 6em">')
+                    .val(ref.GuessedRate)
+                    .attr('title', 'Playback rate is guessed from tone note (B2, B3), it can be wrong')
+                    .change(function() {
+                        let rateParams = params + '&rate=' + parseInt($(this).val());
+                        audio.empty().append($("<source>").attr("src", getActionLinkForWadNode(wad, nodeid, 'smpd', rateParams)));
+                        audio[0].load();
+                        loopsLink.attr('href', getActionLinkForWadNode(wad, nodeid, 'smpd', rateParams + '&loops=4'));
+                    });
+                samples.append($('<li>')
+                    .append('sample 0x' + ref.AdpcmOffset.toString(16) + ' (' + ref.AdpcmSize + ' bytes), guessed rate ')
+                    .append(rateInput).append(' Hz ')
+                    .append(audio)
+                    .append(loopsLink)
+                    .append($('<div>')
+                        .addClass('button-upload')
+                        .attr('title', 'Replace sample with wav')
+                        .attr('href', getActionLinkForWadNode(wad, nodeid, 'replacesmpd', 'offset=' + ref.AdpcmOffset))
+                        .click(uploadAjaxHandler)));
+            }
+            li.append(samples);
+
+            let script = $('<textarea>').attr('rows', bankSound.Disassembly.length + 1).attr('cols', 80)
+                .val(bankSound.Disassembly.join('\n'));
+            li.append(script).append($('<button>').text('Assemble').click(function() {
+                $.post(getActionLinkForWadNode(wad, nodeid, 'asm', 'snd=' + snd.Name), {
+                    'text': script.val()
+                }, function(res) {
+                    if (res !== "") {
+                        alert('Error assembling: ' + res);
+                    } else {
+                        window.location.reload();
+                    }
+                });
+            }));
         }
+        li.append($('<button>').text('Remove').click(function() {
+            if (!confirm('Remove sound ' + snd.Name + '?')) {
+                return;
+            }
+            $.post(getActionLinkForWadNode(wad, nodeid, 'removesound', 'snd=' + snd.Name), function(res) {
+                if (res !== "") {
+                    alert('Error removing: ' + res);
+                } else {
+                    window.location.reload();
+                }
+            });
+        }));
         list.append(li);
     }
     dataSummary.append(list);
+
+    dataSummary.append($('<a>').text('Export as sfz instrument')
+        .attr('href', getActionLinkForWadNode(wad, nodeid, 'sfz')));
+    dataSummary.append(' ').append($('<a>').text('Export as sf2 soundfont')
+        .attr('href', getActionLinkForWadNode(wad, nodeid, 'sf2')));
+    dataSummary.append('<br>');
+
+    if (!data.IsVagFiles) {
+        dataSummary.append($('<a>').text('Download commands disassembly')
+            .attr('href', getActionLinkForWadNode(wad, nodeid, 'disasm')));
+        let form = $('<form action="' + getActionLinkForWadNode(wad, nodeid, 'addsound') + '" method="post" enctype="multipart/form-data">');
+        form.append($('<label>').text('New sound name ').append($('<input type="text" name="name">')));
+        let like = $('<select name="like">');
+        for (let snd of data.Sounds) {
+            like.append($('<option>').attr('value', snd.Name).text(snd.Name));
+        }
+        form.append($('<label>').text(' commands like ').append(like));
+        form.append($('<input type="file" name="data" accept=".wav">'));
+        form.append($('<input type="button" value="Add sound">').click(function() {
+            $.ajax({
+                url: form.attr('action'),
+                type: 'post',
+                data: new FormData(form[0]),
+                processData: false,
+                contentType: false,
+                success: function(a1) {
+                    if (a1 !== "") {
+                        alert('Error adding sound: ' + a1);
+                    } else {
+                        window.location.reload();
+                    }
+                }
+            });
+        }));
+        dataSummary.append(form);
+    }
 }
 
 function summaryLoadWadGeomShape(data) {
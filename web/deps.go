@@ -0,0 +1,138 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mogaika/god_of_war_browser/pack"
+	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+func getWadFromServerDirectory(name string) (*file_wad.Wad, error) {
+	data, err := pack.GetInstanceHandler(ServerDirectory, name)
+	if err != nil {
+		return nil, err
+	}
+	if wad, ok := data.(*file_wad.Wad); ok {
+		return wad, nil
+	}
+	return nil, fmt.Errorf("File %s is not wad", name)
+}
+
+// getReferencedWad opens wad listed in RSRCS. Names are stored without extension
+func getReferencedWad(name string) (*file_wad.Wad, error) {
+	if wad, err := getWadFromServerDirectory(name); err == nil {
+		return wad, nil
+	}
+	return getWadFromServerDirectory(strings.ToUpper(name) + ".WAD")
+}
+
+func getDependencyGraph(file string, resolveExternal bool) (*file_wad.DependencyGraph, error) {
+	wad, err := getWadFromServerDirectory(file)
+	if err != nil {
+		return nil, err
+	}
+
+	g := wad.Dependencies()
+	if resolveExternal {
+		for _, name := range g.Wads {
+			if len(g.Unresolved) == 0 {
+				break
+			}
+			if ref, err := getReferencedWad(name); err != nil {
+				log.Printf("[web] Cannot open referenced wad '%s' of '%s': %v", name, file, err)
+			} else {
+				g.ResolveExternal(ref.Dependencies())
+			}
+		}
+	}
+	return g, nil
+}
+
+func HandlerAjaxDeps(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	g, err := getDependencyGraph(file, r.URL.Query().Get("external") != "")
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "dot" {
+		webutils.WriteFile(w, bytes.NewReader(g.Dot()), file+".dot")
+	} else {
+		webutils.WriteJson(w, g)
+	}
+}
+
+func HandlerAjaxDepsParam(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	param := mux.Vars(r)["param"]
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("param '%s' is not integer", param))
+		return
+	}
+
+	g, err := getDependencyGraph(file, r.URL.Query().Get("external") != "")
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	nodes := make(map[file_wad.TagId]file_wad.DependencyNode)
+	for _, n := range g.Nodes {
+		nodes[n.TagId] = n
+	}
+	toNodes := func(ids []file_wad.TagId) []file_wad.DependencyNode {
+		result := make([]file_wad.DependencyNode, len(ids))
+		for i, id := range ids {
+			result[i] = nodes[id]
+		}
+		return result
+	}
+
+	node, ok := nodes[file_wad.TagId(id)]
+	if !ok {
+		webutils.WriteError(w, fmt.Errorf("Tag %d is not a node", id))
+		return
+	}
+
+	uses := g.Uses(node.TagId)
+	required := map[file_wad.TagId]bool{node.TagId: true}
+	for _, id := range uses {
+		required[id] = true
+	}
+	external := make([]file_wad.ExternalDependency, 0)
+	for _, e := range g.External {
+		if required[e.From] {
+			external = append(external, e)
+		}
+	}
+	unresolved := make([]file_wad.UnresolvedReference, 0)
+	for _, ref := range g.Unresolved {
+		if required[ref.From] {
+			unresolved = append(unresolved, ref)
+		}
+	}
+
+	webutils.WriteJson(w, struct {
+		Node       file_wad.DependencyNode
+		Uses       []file_wad.DependencyNode
+		UsedBy     []file_wad.DependencyNode
+		External   []file_wad.ExternalDependency
+		Unresolved []file_wad.UnresolvedReference
+	}{
+		Node:       node,
+		Uses:       toNodes(uses),
+		UsedBy:     toNodes(g.UsedBy(node.TagId)),
+		External:   external,
+		Unresolved: unresolved,
+	})
+}
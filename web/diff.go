@@ -0,0 +1,78 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/gamediff"
+	"github.com/mogaika/god_of_war_browser/jobs"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// DiffDirectory is folder with game sources for diff requests. Paths of sources
+// are relative to it, diff handler is disabled when it is empty
+var DiffDirectory string
+
+// diffSourceSpec returns source spec (kind:path) with path inside of DiffDirectory
+func diffSourceSpec(spec string) (string, error) {
+	if DiffDirectory == "" {
+		return "", fmt.Errorf("Diff folder is not configured, start server with -diffdir")
+	}
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("Source '%s' must be in format kind:path (iso, toc, dir, psarc)", spec)
+	}
+	return parts[0] + ":" + filepath.Join(DiffDirectory, filepath.Clean(string(filepath.Separator)+parts[1])), nil
+}
+
+// HandlerStartDiff starts comparing of current game with other source.
+// Source path is relative to DiffDirectory.
+// Report is stored as job artifact in html or json format
+func HandlerStartDiff(w http.ResponseWriter, r *http.Request) {
+	spec := r.URL.Query().Get("with")
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "html"
+	}
+	if format != "html" && format != "json" {
+		webutils.WriteError(w, fmt.Errorf("Unknown report format '%s'", format))
+		return
+	}
+
+	path, err := diffSourceSpec(spec)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	other, closer, err := gamediff.OpenSource(path)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	j := jobs.Start("diff "+spec, func(j *jobs.Job) error {
+		defer closer.Close()
+		report, err := gamediff.Compare(j, ServerDirectory, other, "current", spec)
+		if err != nil {
+			return err
+		}
+
+		var data []byte
+		if format == "json" {
+			data, err = json.MarshalIndent(report, "", "  ")
+		} else {
+			data, err = report.HTML()
+		}
+		if err != nil {
+			return err
+		}
+
+		j.SetArtifact("diff."+format, data)
+		j.SetResult(fmt.Sprintf("%d different files, %d equal files", len(report.Files), report.Same))
+		return nil
+	})
+	webutils.WriteJson(w, j.Info())
+}
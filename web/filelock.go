@@ -0,0 +1,23 @@
+package web
+
+import "sync"
+
+var gPackFileLocks = struct {
+	sync.Mutex
+	files map[string]*sync.Mutex
+}{files: make(map[string]*sync.Mutex)}
+
+// lockPackFile serializes changes of pack file. Every change reads file, edits it
+// and writes it back whole, so concurrent changes would lose each other
+func lockPackFile(name string) (unlock func()) {
+	gPackFileLocks.Lock()
+	l, ok := gPackFileLocks.files[name]
+	if !ok {
+		l = new(sync.Mutex)
+		gPackFileLocks.files[name] = l
+	}
+	gPackFileLocks.Unlock()
+
+	l.Lock()
+	return l.Unlock
+}
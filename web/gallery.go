@@ -0,0 +1,212 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
+	file_mat "github.com/mogaika/god_of_war_browser/pack/wad/mat"
+	file_txr "github.com/mogaika/god_of_war_browser/pack/wad/txr"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+const GALLERY_DEFAULT_SIZE = 96
+
+// thumbnails are made only of these sizes, so cache has limited amount of variants
+var gallerySizes = []int{32, 64, 96, 128, 256}
+
+// how many galleries we keep in memory
+const GALLERY_CACHE_LIMIT = 16
+
+// GalleryItem is thumbnail of texture, or of texture of material layer blended with layer color
+type GalleryItem struct {
+	Name      string
+	TagId     file_wad.TagId
+	Kind      string // "txr" or "mat"
+	Texture   string `json:",omitempty"` // texture of material layer
+	Layer     int
+	Width     int // size of original image
+	Height    int
+	Format    string
+	Thumbnail []byte
+	Error     string `json:",omitempty"`
+}
+
+type Gallery struct {
+	Wad   string
+	Size  int
+	Items []GalleryItem
+}
+
+type galleryCacheEntry struct {
+	key     string
+	size    int64
+	crc     uint32
+	gallery *Gallery
+}
+
+// cache entries are checked by checksum of wad file, so wad is parsed
+// only if it was changed. Entries are ordered from least recently used
+var galleryCache = struct {
+	sync.Mutex
+	entries []*galleryCacheEntry
+}{entries: make([]*galleryCacheEntry, 0, GALLERY_CACHE_LIMIT)}
+
+// galleryCacheGet returns cached gallery and moves it to the end of list
+func galleryCacheGet(key string, size int64, crc uint32) *Gallery {
+	galleryCache.Lock()
+	defer galleryCache.Unlock()
+	for i, e := range galleryCache.entries {
+		if e.key == key {
+			if e.size != size || e.crc != crc {
+				return nil
+			}
+			galleryCache.entries = append(append(galleryCache.entries[:i], galleryCache.entries[i+1:]...), e)
+			return e.gallery
+		}
+	}
+	return nil
+}
+
+// galleryCachePut replaces entry of key, least recently used entry is dropped if cache is full
+func galleryCachePut(e *galleryCacheEntry) {
+	galleryCache.Lock()
+	defer galleryCache.Unlock()
+	entries := galleryCache.entries[:0]
+	for _, old := range galleryCache.entries {
+		if old.key != e.key {
+			entries = append(entries, old)
+		}
+	}
+	if len(entries) >= GALLERY_CACHE_LIMIT {
+		entries = append(entries[:0], entries[1:]...)
+	}
+	galleryCache.entries = append(entries, e)
+}
+
+// galleryTextureImage returns first image of texture, blended if color provided
+func galleryTextureImage(txr *file_txr.Texture, wrsrc *file_wad.WadNodeRsrc, blend []float32) (img image.Image, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	marshaled, err := txr.MarshalBlend(blend, wrsrc)
+	if err != nil {
+		return nil, err
+	}
+	images := marshaled.(*file_txr.Ajax).Images
+	if len(images) == 0 {
+		return nil, fmt.Errorf("Texture has no images")
+	}
+	img, _, err = image.Decode(bytes.NewReader(images[0].Image))
+	return img, err
+}
+
+func fillGalleryItem(item *GalleryItem, txr *file_txr.Texture, wrsrc *file_wad.WadNodeRsrc, blend []float32, size int) {
+	img, err := galleryTextureImage(txr, wrsrc, blend)
+	if err != nil {
+		item.Error = err.Error()
+		return
+	}
+	item.Width, item.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	if item.Format, err = txr.FormatName(wrsrc); err != nil {
+		item.Error = err.Error()
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, file_txr.Thumbnail(img, size)); err != nil {
+		item.Error = err.Error()
+		return
+	}
+	item.Thumbnail = buf.Bytes()
+}
+
+func buildGallery(wad *file_wad.Wad, size int) *Gallery {
+	g := &Gallery{Wad: wad.Name(), Size: size, Items: make([]GalleryItem, 0)}
+	for _, node := range wad.Nodes {
+		inst, _, err := wad.GetInstanceFromNode(node.Id)
+		if err != nil {
+			continue
+		}
+
+		switch v := inst.(type) {
+		case *file_txr.Texture:
+			item := GalleryItem{Name: node.Tag.Name, TagId: node.Tag.Id, Kind: "txr"}
+			fillGalleryItem(&item, v, wad.GetNodeResourceByNodeId(node.Id), nil, size)
+			g.Items = append(g.Items, item)
+		case *file_mat.Material:
+			for iLayer, layer := range v.Layers {
+				if layer.Texture == "" {
+					continue
+				}
+				item := GalleryItem{Name: node.Tag.Name, TagId: node.Tag.Id, Kind: "mat", Texture: layer.Texture, Layer: iLayer}
+				// same lookup as material marshaling does
+				if n := wad.GetNodeByName(layer.Texture, node.Id-1, false); n == nil {
+					item.Error = fmt.Sprintf("Cannot find texture %s", layer.Texture)
+				} else if txrInst, _, err := wad.GetInstanceFromNode(n.Id); err != nil {
+					item.Error = err.Error()
+				} else if txr, ok := txrInst.(*file_txr.Texture); !ok {
+					item.Error = fmt.Sprintf("%s is not texture", layer.Texture)
+				} else {
+					fillGalleryItem(&item, txr, wad.GetNodeResourceByNodeId(n.Id), layer.BlendColor[:], size)
+				}
+				g.Items = append(g.Items, item)
+			}
+		}
+	}
+	return g
+}
+
+// getGallery returns cached gallery if wad file was not changed, otherwise
+// parses wad and builds gallery. Building is done outside of cache lock
+func getGallery(file string, size int) (*Gallery, error) {
+	key := fmt.Sprintf("%s:%d", file, size)
+	fileSize, crc, err := vfs.DirectoryFileChecksum(ServerDirectory, file)
+	if err != nil {
+		return nil, err
+	}
+	if g := galleryCacheGet(key, fileSize, crc); g != nil {
+		return g, nil
+	}
+
+	wad, err := getWadFromServerDirectory(file)
+	if err != nil {
+		return nil, err
+	}
+	g := buildGallery(wad, size)
+	galleryCachePut(&galleryCacheEntry{key: key, size: fileSize, crc: crc, gallery: g})
+	return g, nil
+}
+
+func HandlerAjaxGallery(w http.ResponseWriter, r *http.Request) {
+	size := GALLERY_DEFAULT_SIZE
+	if s := r.URL.Query().Get("size"); s != "" {
+		size, _ = strconv.Atoi(s)
+		valid := false
+		for _, gs := range gallerySizes {
+			valid = valid || gs == size
+		}
+		if !valid {
+			webutils.WriteError(w, fmt.Errorf("Invalid thumbnail size '%s', should be one of %v", s, gallerySizes))
+			return
+		}
+	}
+
+	g, err := getGallery(mux.Vars(r)["file"], size)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	webutils.WriteJson(w, g)
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"sort"
 	"strconv"
 
@@ -17,6 +18,7 @@ import (
 	file_vpk "github.com/mogaika/god_of_war_browser/pack/vpk"
 	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
 	file_vagp "github.com/mogaika/god_of_war_browser/ps2/vagp"
+	"github.com/mogaika/god_of_war_browser/searchindex"
 	"github.com/mogaika/god_of_war_browser/status"
 	"github.com/mogaika/god_of_war_browser/vfs"
 	"github.com/mogaika/god_of_war_browser/webutils"
@@ -38,6 +40,13 @@ func HandlerAjaxPack(w http.ResponseWriter, r *http.Request) {
 func HandlerAjaxFs(w http.ResponseWriter, r *http.Request) {
 	if DriverDirectory == nil {
 		w.WriteHeader(405)
+	} else if rl, ok := DriverDirectory.(vfs.RecursiveLister); ok {
+		if files, err := rl.ListRecursive(); err != nil {
+			webutils.WriteError(w, err)
+		} else {
+			sort.Strings(files)
+			webutils.WriteJson(w, files)
+		}
 	} else {
 		handleVfsDirList(w, r, DriverDirectory)
 	}
@@ -81,15 +90,41 @@ func HandlerAjaxPackFileParam(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func HandlerAjaxLayoutFileParam(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	param := mux.Vars(r)["param"]
+	data, err := pack.GetInstanceHandler(ServerDirectory, file)
+	if err != nil {
+		log.Printf("Error getting file from pack: %v", err)
+		webutils.WriteError(w, err)
+	} else {
+		switch data.(type) {
+		case *file_wad.Wad:
+			wad := data.(*file_wad.Wad)
+			id, err := strconv.Atoi(param)
+			if err != nil {
+				webutils.WriteError(w, fmt.Errorf("param '%s' is not integer", param))
+			} else {
+				if err := wad.WebHandlerLayoutForNodeByTagId(w, file_wad.TagId(id)); err != nil {
+					webutils.WriteError(w, fmt.Errorf("wad layout handler return error: %v", err))
+				}
+			}
+		default:
+			webutils.WriteError(w, fmt.Errorf("File %s not contain subdata", file))
+		}
+	}
+}
+
 func handlerDumpFileVfs(w http.ResponseWriter, r *http.Request, d vfs.Directory) {
 	file := mux.Vars(r)["file"]
 	f, err := vfs.DirectoryGetFile(d, file)
 	if err != nil {
 		webutils.WriteError(w, err)
+		return
 	}
 
 	if reader, err := vfs.OpenFileAndGetReader(f, true); err == nil {
-		webutils.WriteFile(w, reader, file)
+		webutils.WriteFile(w, reader, path.Base(file))
 		defer f.Close()
 	} else {
 		fmt.Fprintf(w, "Error getting file reader: %v", err)
@@ -170,6 +205,9 @@ func HandlerActionPackFileParam(w http.ResponseWriter, r *http.Request) {
 	file := mux.Vars(r)["file"]
 	param := mux.Vars(r)["param"]
 	action := mux.Vars(r)["action"]
+	if r.Method == http.MethodPost {
+		defer lockPackFile(file)()
+	}
 	data, err := pack.GetInstanceHandler(ServerDirectory, file)
 	if err != nil {
 		log.Printf("Error getting file from pack: %v", err)
@@ -184,6 +222,9 @@ func HandlerActionPackFileParam(w http.ResponseWriter, r *http.Request) {
 			} else {
 				if err := wad.WebHandlerCallResourceHttpAction(w, r, file_wad.TagId(id), action); err != nil {
 					webutils.WriteError(w, fmt.Errorf("Wad handler error on %s-%d instance: %v", file, id, err))
+				} else if r.Method == http.MethodPost {
+					// actions which change resources use POST requests
+					searchindex.Refresh(ServerDirectory, file)
 				}
 			}
 		default:
@@ -209,12 +250,15 @@ func HandlerUploadPackFile(w http.ResponseWriter, r *http.Request) {
 	}
 	fileStream.Seek(0, os.SEEK_SET)
 
+	defer lockPackFile(targetFile)()
 	if f, err := vfs.DirectoryGetFile(ServerDirectory, targetFile); err != nil {
 		webutils.WriteError(w, err)
 	} else {
 		defer f.Close()
 		if err := vfs.OpenFileAndCopy(f, io.NewSectionReader(fileStream, 0, fileSize)); err != nil {
 			webutils.WriteError(w, fmt.Errorf("Error when updating pack file: %v", err))
+		} else {
+			searchindex.Refresh(ServerDirectory, targetFile)
 		}
 	}
 }
@@ -229,6 +273,7 @@ func HandlerUploadPackFileParam(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	defer lockPackFile(targetFile)()
 	data, err := pack.GetInstanceHandler(ServerDirectory, targetFile)
 	if err != nil {
 		log.Printf("Error getting instance from pack: %v", err)
@@ -244,6 +289,8 @@ func HandlerUploadPackFileParam(w http.ResponseWriter, r *http.Request) {
 				if fileData, err := ioutil.ReadAll(fileStream); err == nil {
 					if err := wad.UpdateTagsData(map[file_wad.TagId][]byte{file_wad.TagId(id): fileData}); err != nil {
 						webutils.WriteError(w, fmt.Errorf("Error updating tags: %v", err))
+					} else {
+						searchindex.Refresh(ServerDirectory, targetFile)
 					}
 				} else {
 					webutils.WriteError(w, fmt.Errorf("reading file error: %v", err))
@@ -0,0 +1,105 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mogaika/god_of_war_browser/drivers/toc"
+	"github.com/mogaika/god_of_war_browser/jobs"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+type JobOperation func(j *jobs.Job, d vfs.Directory) error
+
+var gJobOperations = make(map[string]JobOperation)
+
+// SetJobOperation registers operation that can be started over /jobs/start/{operation}
+func SetJobOperation(name string, op JobOperation) {
+	gJobOperations[name] = op
+}
+
+func init() {
+	SetJobOperation("shrink", func(j *jobs.Job, d vfs.Directory) error {
+		if t, ok := d.(*toc.TableOfContent); ok {
+			return t.ShrinkJob(j)
+		}
+		return fmt.Errorf("Shrink supported only for toc")
+	})
+	SetJobOperation("removereplicas", func(j *jobs.Job, d vfs.Directory) error {
+		if t, ok := d.(*toc.TableOfContent); ok {
+			return t.RemoveReplicasJob(j)
+		}
+		return fmt.Errorf("Replicas removing supported only for toc")
+	})
+}
+
+func getJobFromRequest(r *http.Request) (*jobs.Job, error) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, fmt.Errorf("job id '%s' is not integer", mux.Vars(r)["id"])
+	}
+	if j := jobs.Get(id); j != nil {
+		return j, nil
+	}
+	return nil, fmt.Errorf("Cannot find job %d", id)
+}
+
+func HandlerAjaxJobs(w http.ResponseWriter, r *http.Request) {
+	webutils.WriteJson(w, jobs.List())
+}
+
+func HandlerAjaxJobOperations(w http.ResponseWriter, r *http.Request) {
+	ops := make([]string, 0, len(gJobOperations))
+	for name := range gJobOperations {
+		ops = append(ops, name)
+	}
+	sort.Strings(ops)
+	webutils.WriteJson(w, ops)
+}
+
+func HandlerAjaxJob(w http.ResponseWriter, r *http.Request) {
+	if j, err := getJobFromRequest(r); err != nil {
+		webutils.WriteError(w, err)
+	} else {
+		webutils.WriteJson(w, j.Info())
+	}
+}
+
+func HandlerStartJob(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["operation"]
+	op, ok := gJobOperations[name]
+	if !ok {
+		webutils.WriteError(w, fmt.Errorf("Unknown job operation '%s'", name))
+		return
+	}
+	j := jobs.Start(name, func(j *jobs.Job) error {
+		return op(j, ServerDirectory)
+	})
+	webutils.WriteJson(w, j.Info())
+}
+
+func HandlerCancelJob(w http.ResponseWriter, r *http.Request) {
+	if j, err := getJobFromRequest(r); err != nil {
+		webutils.WriteError(w, err)
+	} else if err := jobs.Cancel(j.Id()); err != nil {
+		webutils.WriteError(w, err)
+	} else {
+		webutils.WriteJson(w, j.Info())
+	}
+}
+
+func HandlerDumpJobArtifact(w http.ResponseWriter, r *http.Request) {
+	if j, err := getJobFromRequest(r); err != nil {
+		webutils.WriteError(w, err)
+	} else if name, data := j.Artifact(); data == nil {
+		webutils.WriteError(w, fmt.Errorf("Job %d has no artifact", j.Id()))
+	} else {
+		webutils.WriteFile(w, bytes.NewReader(data), name)
+	}
+}
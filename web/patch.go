@@ -0,0 +1,169 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/mogaika/god_of_war_browser/drivers/iso"
+	"github.com/mogaika/god_of_war_browser/jobs"
+	"github.com/mogaika/god_of_war_browser/patch"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// PatchDirectory is folder with original images and patched results. Paths of
+// patch requests are relative to it, patch handlers are disabled when it is empty
+var PatchDirectory string
+
+// patchPath returns path of file inside of PatchDirectory, name can't escape folder
+func patchPath(name string) (string, error) {
+	if PatchDirectory == "" {
+		return "", fmt.Errorf("Patch folder is not configured, start server with -patchdir")
+	}
+	if name == "" {
+		return "", fmt.Errorf("Empty file name")
+	}
+	return filepath.Join(PatchDirectory, filepath.Clean(string(filepath.Separator)+name)), nil
+}
+
+// sameFile reports if both paths point to same existing file, including links
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
+
+func openPatchImage(name string) (*os.File, int64, error) {
+	path, err := patchPath(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// HandlerCreatePatch starts creating patch from original image (name in PatchDirectory)
+// to currently opened iso. Patch is stored as job artifact
+func HandlerCreatePatch(w http.ResponseWriter, r *http.Request) {
+	isoDriver, ok := DriverDirectory.(*iso.IsoDriver)
+	if !ok {
+		webutils.WriteError(w, fmt.Errorf("Patch creation supported only for iso images"))
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = patch.FORMAT_BPS
+	}
+	description := r.URL.Query().Get("description")
+
+	original, originalSize, err := openPatchImage(r.URL.Query().Get("original"))
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("Cannot open original image: %v", err))
+		return
+	}
+
+	modified := isoDriver.Image()
+	j := jobs.Start("patch "+format, func(j *jobs.Job) error {
+		defer original.Close()
+
+		var buf bytes.Buffer
+		if err := patch.Create(j, format, original, originalSize, modified, modified.Size(), description, &buf); err != nil {
+			return err
+		}
+		j.SetArtifact(filepath.Base(modified.Name())+"."+format, buf.Bytes())
+		j.SetResult(fmt.Sprintf("%d bytes patch", buf.Len()))
+		return nil
+	})
+	webutils.WriteJson(w, j.Info())
+}
+
+// HandlerApplyPatch applies uploaded patch to original image and writes result
+// to out file, both are names in PatchDirectory
+func HandlerApplyPatch(w http.ResponseWriter, r *http.Request) {
+	outPath, err := patchPath(r.URL.Query().Get("out"))
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("Wrong out file: %v", err))
+		return
+	}
+	originalPath, err := patchPath(r.URL.Query().Get("original"))
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("Wrong original file: %v", err))
+		return
+	}
+	if outPath == originalPath || sameFile(outPath, originalPath) {
+		webutils.WriteError(w, fmt.Errorf("Out file can't be original image"))
+		return
+	}
+
+	fileStream, _, err := r.FormFile("data")
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("File stream getting error: %v", err))
+		return
+	}
+	data, err := ioutil.ReadAll(fileStream)
+	fileStream.Close()
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	if _, err := patch.DetectFormat(data); err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	original, originalSize, err := openPatchImage(r.URL.Query().Get("original"))
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("Cannot open original image: %v", err))
+		return
+	}
+
+	j := jobs.Start("apply patch", func(j *jobs.Job) error {
+		defer original.Close()
+
+		// not truncated until checked, out can be link created after request
+		out, err := os.OpenFile(outPath, os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		outInfo, err := out.Stat()
+		if err != nil {
+			return err
+		}
+		originalInfo, err := original.Stat()
+		if err != nil {
+			return err
+		}
+		if os.SameFile(outInfo, originalInfo) {
+			return fmt.Errorf("Out file can't be original image")
+		}
+
+		size, err := patch.Apply(j, data, original, originalSize, out)
+		if err != nil {
+			return err
+		}
+		if err := out.Truncate(size); err != nil {
+			return err
+		}
+		j.SetResult(fmt.Sprintf("Patched image '%s' (%d bytes) created", r.URL.Query().Get("out"), size))
+		return nil
+	})
+	webutils.WriteJson(w, j.Info())
+}
@@ -0,0 +1,32 @@
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mogaika/god_of_war_browser/searchindex"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+func init() {
+	SetJobOperation("searchindex", searchindex.Build)
+}
+
+func HandlerAjaxSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+
+	results, err := searchindex.Search(q.Get("q"), q.Get("regex") != "", limit)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	webutils.WriteJson(w, struct {
+		FilesIndexed int
+		Results      []searchindex.Result
+	}{
+		FilesIndexed: searchindex.FilesCount(),
+		Results:      results,
+	})
+}
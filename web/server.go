@@ -27,13 +27,34 @@ func StartServer(addr string, packsDir vfs.Directory, driver vfs.Directory, webP
 	r.HandleFunc("/json/pack/{file}", HandlerAjaxPackFile)
 	r.HandleFunc("/json/pack", HandlerAjaxPack)
 	r.HandleFunc("/json/fs", HandlerAjaxFs)
+	r.HandleFunc("/json/layout/{file}/{param}", HandlerAjaxLayoutFileParam)
+	r.HandleFunc("/json/search", HandlerAjaxSearch)
+	r.HandleFunc("/json/deps/{file}/{param}", HandlerAjaxDepsParam)
+	r.HandleFunc("/json/deps/{file}", HandlerAjaxDeps)
+	r.HandleFunc("/transplant/{file}/{param}", HandlerTransplant)
+	r.HandleFunc("/json/unused/{file}", HandlerAjaxUnused)
+	r.HandleFunc("/compact/{file}", HandlerCompactWad)
+	r.HandleFunc("/json/budget/{file}", HandlerAjaxBudget)
+	r.HandleFunc("/json/gallery/{file}", HandlerAjaxGallery)
+	r.HandleFunc("/textures/export", HandlerExportTextures)
+	r.HandleFunc("/textures/import", HandlerImportTextures)
+	r.HandleFunc("/diff/start", HandlerStartDiff)
+	r.HandleFunc("/patch/create", HandlerCreatePatch)
+	r.HandleFunc("/patch/apply", HandlerApplyPatch)
 	r.HandleFunc("/dump/pack/{file}/{param}", HandlerDumpPackParamFile)
 	r.HandleFunc("/dump/pack/{file}", HandlerDumpPackFile)
-	r.HandleFunc("/dump/fs/{file}", HandlerDumpFsFile)
+	r.HandleFunc("/dump/fs/{file:.+}", HandlerDumpFsFile)
 	r.HandleFunc("/delete/pack/{file}", HandlerDeletePackFile)
 	r.HandleFunc("/upload/pack/{file}", HandlerUploadPackFile)
 	r.HandleFunc("/upload/pack/{file}/{param}", HandlerUploadPackFileParam)
+	r.HandleFunc("/upload/wav/{file}", HandlerUploadWav)
 	r.HandleFunc("/ws/status", HandlerWebsocketStatus)
+	r.HandleFunc("/json/jobs", HandlerAjaxJobs)
+	r.HandleFunc("/json/jobs/operations", HandlerAjaxJobOperations)
+	r.HandleFunc("/json/jobs/{id}", HandlerAjaxJob)
+	r.HandleFunc("/jobs/start/{operation}", HandlerStartJob)
+	r.HandleFunc("/jobs/cancel/{id}", HandlerCancelJob)
+	r.HandleFunc("/dump/jobs/{id}", HandlerDumpJobArtifact)
 
 	r.PathPrefix("/").Handler(http.FileServer(http.Dir(path.Join(webPath, "data"))))
 
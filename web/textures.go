@@ -0,0 +1,201 @@
+package web
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/mogaika/god_of_war_browser/jobs"
+	file_txr "github.com/mogaika/god_of_war_browser/pack/wad/txr"
+	"github.com/mogaika/god_of_war_browser/searchindex"
+	"github.com/mogaika/god_of_war_browser/status"
+	"github.com/mogaika/god_of_war_browser/vfs"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+func init() {
+	SetJobOperation("txrexport", func(j *jobs.Job, d vfs.Directory) error {
+		return exportTexturesJob(j, d, "")
+	})
+}
+
+func isWadFileName(name string) bool {
+	return strings.HasSuffix(name, ".WAD") || strings.HasSuffix(name, ".wad_psp2")
+}
+
+// exportTexturesJob writes zip artifact with images of textures of wad, or of all wads if wadName is empty
+func exportTexturesJob(j *jobs.Job, d vfs.Directory, wadName string) error {
+	files := []string{wadName}
+	if wadName == "" {
+		var err error
+		if files, err = d.List(); err != nil {
+			return err
+		}
+		sort.Strings(files)
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	manifest := file_txr.BatchManifest{Textures: make([]file_txr.BatchTexture, 0)}
+	for i, name := range files {
+		if j.Cancelled() {
+			return nil
+		}
+		if wadName == "" && !isWadFileName(name) {
+			continue
+		}
+		j.Progress(float32(i)/float32(len(files)), "Exporting textures of '%s'", name)
+
+		wad, err := getWadFromServerDirectory(name)
+		if err != nil {
+			if wadName != "" {
+				return err
+			}
+			status.Error("Skipping '%s': %v", name, err)
+			continue
+		}
+		entries, err := file_txr.ExportBatch(wad, zw)
+		if err != nil {
+			return fmt.Errorf("Export of '%s' failed: %v", name, err)
+		}
+		manifest.Textures = append(manifest.Textures, entries...)
+	}
+
+	f, err := zw.Create(file_txr.BATCH_MANIFEST_NAME)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "\t")
+	if err := enc.Encode(&manifest); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	artifact := "textures.zip"
+	if wadName != "" {
+		artifact = wadName + "_textures.zip"
+	}
+	j.SetArtifact(artifact, buf.Bytes())
+	j.SetResult(fmt.Sprintf("%d images exported", len(manifest.Textures)))
+	return nil
+}
+
+// importTexturesJob replaces textures which images of zip were changed since export
+func importTexturesJob(j *jobs.Job, zr *zip.Reader) error {
+	// folder can be archived together with its parent folder
+	root := ""
+	var mf *zip.File
+	for _, f := range zr.File {
+		if path.Base(f.Name) == file_txr.BATCH_MANIFEST_NAME && (mf == nil || len(f.Name) < len(mf.Name)) {
+			mf = f
+			root = strings.TrimSuffix(f.Name, file_txr.BATCH_MANIFEST_NAME)
+		}
+	}
+	if mf == nil {
+		return fmt.Errorf("Archive has no %s", file_txr.BATCH_MANIFEST_NAME)
+	}
+
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		if strings.HasPrefix(f.Name, root) {
+			files[strings.TrimPrefix(f.Name, root)] = f
+		}
+	}
+
+	rc, err := mf.Open()
+	if err != nil {
+		return err
+	}
+	var manifest file_txr.BatchManifest
+	err = json.NewDecoder(rc).Decode(&manifest)
+	rc.Close()
+	if err != nil {
+		return fmt.Errorf("Can't parse manifest: %v", err)
+	}
+
+	wads := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, e := range manifest.Textures {
+		if !seen[e.Wad] {
+			seen[e.Wad] = true
+			wads = append(wads, e.Wad)
+		}
+	}
+
+	summary := &file_txr.BatchSummary{Results: make([]file_txr.BatchResult, 0)}
+	for i, name := range wads {
+		if j.Cancelled() {
+			break
+		}
+		j.Progress(float32(i)/float32(len(wads)), "Importing textures of '%s'", name)
+
+		unlock := lockPackFile(name)
+		wad, err := getWadFromServerDirectory(name)
+		if err != nil {
+			unlock()
+			summary.Failed++
+			summary.Results = append(summary.Results, file_txr.BatchResult{Wad: name, Error: err.Error()})
+			continue
+		}
+		changed := summary.Changed
+		func() {
+			defer unlock()
+			file_txr.ImportBatch(wad, manifest.Textures, files, summary)
+		}()
+		if summary.Changed != changed {
+			searchindex.Refresh(ServerDirectory, name)
+		}
+	}
+
+	status.Info("Textures import: %d changed, %d failed, size growth %d bytes",
+		summary.Changed, summary.Failed, summary.SizeGrowth)
+	j.SetResult(summary)
+	return nil
+}
+
+func HandlerExportTextures(w http.ResponseWriter, r *http.Request) {
+	wadName := r.URL.Query().Get("wad")
+	j := jobs.Start("txrexport "+wadName, func(j *jobs.Job) error {
+		return exportTexturesJob(j, ServerDirectory, wadName)
+	})
+	webutils.WriteJson(w, j.Info())
+}
+
+func HandlerImportTextures(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		webutils.WriteError(w, fmt.Errorf("Import requires POST request"))
+		return
+	}
+
+	fileStream, _, err := r.FormFile("data")
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("File stream getting error: %v", err))
+		return
+	}
+	defer fileStream.Close()
+
+	data, err := ioutil.ReadAll(fileStream)
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("reading file error: %v", err))
+		return
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("File is not zip archive: %v", err))
+		return
+	}
+
+	j := jobs.Start("txrimport", func(j *jobs.Job) error {
+		return importTexturesJob(j, zr)
+	})
+	webutils.WriteJson(w, j.Info())
+}
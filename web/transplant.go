@@ -0,0 +1,55 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/searchindex"
+	"github.com/mogaika/god_of_war_browser/status"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+func HandlerTransplant(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	param := mux.Vars(r)["param"]
+	target := r.URL.Query().Get("to")
+
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		webutils.WriteError(w, fmt.Errorf("param '%s' is not integer", param))
+		return
+	}
+	insertPos := -1
+	if at := r.URL.Query().Get("at"); at != "" {
+		if insertPos, err = strconv.Atoi(at); err != nil {
+			webutils.WriteError(w, fmt.Errorf("at '%s' is not integer", at))
+			return
+		}
+	}
+
+	defer lockPackFile(target)()
+	src, err := getWadFromServerDirectory(file)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	dst, err := getWadFromServerDirectory(target)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	res, err := file_wad.Transplant(src, file_wad.TagId(id), dst, file_wad.TagId(insertPos))
+	if err != nil {
+		status.Error("Transplant failed: %v", err)
+		webutils.WriteError(w, err)
+		return
+	}
+	status.Info("Transplanted %d tags from '%s' to '%s'", res.TagsCount, file, target)
+	searchindex.Refresh(ServerDirectory, target)
+	webutils.WriteJson(w, res)
+}
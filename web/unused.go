@@ -0,0 +1,93 @@
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	file_wad "github.com/mogaika/god_of_war_browser/pack/wad"
+	"github.com/mogaika/god_of_war_browser/searchindex"
+	"github.com/mogaika/god_of_war_browser/status"
+	"github.com/mogaika/god_of_war_browser/webutils"
+)
+
+// getWadUsers returns dependency graphs of wads which list wad in RSRCS.
+// Wad which can't be opened makes users unknown, so error is returned
+func getWadUsers(file string) ([]*file_wad.DependencyGraph, error) {
+	files, err := ServerDirectory.List()
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(file, path.Ext(file))
+
+	users := make([]*file_wad.DependencyGraph, 0)
+	for _, f := range files {
+		if f == file || !isWadFileName(f) {
+			continue
+		}
+		wad, err := getWadFromServerDirectory(f)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot check references of '%s': %v", f, err)
+		}
+		g := wad.Dependencies()
+		for _, ref := range g.Wads {
+			if strings.EqualFold(ref, name) || strings.EqualFold(ref, file) {
+				users = append(users, g)
+				break
+			}
+		}
+	}
+	return users, nil
+}
+
+func HandlerAjaxUnused(w http.ResponseWriter, r *http.Request) {
+	file := mux.Vars(r)["file"]
+	defer lockPackFile(file)()
+	wad, err := getWadFromServerDirectory(file)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	users, err := getWadUsers(file)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	webutils.WriteJson(w, wad.FindUnused(users))
+}
+
+// HandlerCompactWad removes unused nodes when confirm=1 is provided,
+// otherwise only reports nodes to remove
+func HandlerCompactWad(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		webutils.WriteError(w, fmt.Errorf("Compact requires POST request"))
+		return
+	}
+
+	file := mux.Vars(r)["file"]
+	wad, err := getWadFromServerDirectory(file)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+	users, err := getWadUsers(file)
+	if err != nil {
+		webutils.WriteError(w, err)
+		return
+	}
+
+	report, err := wad.Compact(users, r.FormValue("confirm") == "1")
+	if err != nil {
+		status.Error("Compact of '%s' failed: %v", file, err)
+		webutils.WriteError(w, err)
+		return
+	}
+	if report.Removed {
+		status.Info("Removed %d unused nodes (%d bytes) from '%s'", len(report.Nodes), report.TotalSize, file)
+		searchindex.Refresh(ServerDirectory, file)
+	}
+	webutils.WriteJson(w, report)
+}